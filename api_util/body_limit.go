@@ -0,0 +1,77 @@
+package api_util
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrBodyTooLarge is returned when reading a request body past the limit set by
+// BodyLimitMiddleware.
+var ErrBodyTooLarge = errors.New("the request body is too large")
+
+// limitedBody is the body of the requests let through by BodyLimitMiddleware. It remembers
+// whether the limit has been reached, as decoders do not always wrap the errors of the
+// reader they are given.
+type limitedBody struct {
+	io.ReadCloser
+	maxBytes   int64
+	readCount  int64
+	isTooLarge bool
+}
+
+//----------------------------------------------------------------------------------------
+func tooLargeMessage(maxBytes int64) string {
+	return fmt.Sprintf("The request body is larger than %d bytes.", maxBytes)
+}
+
+//----------------------------------------------------------------------------------------
+// Read reads from the http.MaxBytesReader wrapped, and turns the error it returns once more
+// than maxBytes have been sent into ErrBodyTooLarge.
+func (bodyInst *limitedBody) Read(buffer []byte) (int, error) {
+	readCount, err := bodyInst.ReadCloser.Read(buffer)
+	bodyInst.readCount += int64(readCount)
+
+	if err != nil && err != io.EOF && bodyInst.readCount >= bodyInst.maxBytes {
+		bodyInst.isTooLarge = true
+		return readCount, fmt.Errorf("%w. Error: %v", ErrBodyTooLarge, err)
+	}
+
+	return readCount, err
+}
+
+//----------------------------------------------------------------------------------------
+// BodyLimitMiddleware rejects the requests whose body is declared larger than maxBytes and
+// stops reading the others once maxBytes have been read, so that a client cannot tie up the
+// server with an endless upload.
+func BodyLimitMiddleware(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.ContentLength > maxBytes {
+				SetupCORSResponse(&writer)
+				WriteMsg(&writer, http.StatusRequestEntityTooLarge, tooLargeMessage(maxBytes))
+				return
+			}
+
+			request.Body = &limitedBody{ReadCloser: http.MaxBytesReader(writer, request.Body, maxBytes), maxBytes: maxBytes}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// WriteBodyError reports err, returned while reading the body of request, as a bad request
+// with message as its detail. Bodies sent without their length, which BodyLimitMiddleware
+// can only stop once the limit is reached, are reported as too large instead.
+func WriteBodyError(write *http.ResponseWriter, request *http.Request, message string, err error) {
+	if bodyInst, isLimited := request.Body.(*limitedBody); isLimited && bodyInst.isTooLarge {
+		WriteMsg(write, http.StatusRequestEntityTooLarge, tooLargeMessage(bodyInst.maxBytes))
+		return
+	} else if errors.Is(err, ErrBodyTooLarge) {
+		WriteMsg(write, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	WriteMsg(write, http.StatusBadRequest, fmt.Sprintf("%s Error: %v", message, err))
+}
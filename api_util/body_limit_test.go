@@ -0,0 +1,71 @@
+package api_util
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	bodyLimitConst = 32
+)
+
+func newBodyLimitRouter() http.Handler {
+	var apiInst GenAPI[*listTestObject]
+
+	apiInst.ObjectID = "id"
+	apiInst.Constructor = func() *listTestObject { return &listTestObject{} }
+	apiInst.GetObjectByCode = func(code string) (*listTestObject, error) { return &listTestObject{Code: code}, nil }
+
+	router := mux.NewRouter()
+	router.HandleFunc(listURLConst, apiInst.Put).Methods(http.MethodPut)
+	router.HandleFunc(listURLConst+"/{id}", apiInst.Patch).Methods(http.MethodPatch)
+
+	return BodyLimitMiddleware(bodyLimitConst)(router)
+}
+
+func TestBodyLimit(t *testing.T) {
+	var problem Problem
+
+	handler := newBodyLimitRouter()
+	largeBody := `{"code": "` + strings.Repeat("x", bodyLimitConst) + `"}`
+
+	requestList := []struct {
+		method   string
+		url      string
+		body     string
+		expected int
+	}{
+		{http.MethodPut, listURLConst, `{"code": "a"}`, http.StatusOK},
+		{http.MethodPut, listURLConst, `{"code": `, http.StatusBadRequest},
+		{http.MethodPut, listURLConst, largeBody, http.StatusRequestEntityTooLarge},
+		{http.MethodPatch, listURLConst + "/a", largeBody, http.StatusRequestEntityTooLarge},
+	}
+
+	t.Log("Bodies sent without their length are reported as too large once over the limit")
+	for _, requestInst := range requestList {
+		// A reader of unknown length leaves ContentLength unset, as with a chunked upload.
+		req := httptest.NewRequest(requestInst.method, requestInst.url, io.MultiReader(strings.NewReader(requestInst.body)))
+		if req.ContentLength != -1 {
+			t.Fatalf("Expected no content length, got %d", req.ContentLength)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != requestInst.expected {
+			t.Errorf("Expected status %d for %s of %d bytes, got %d: %s", requestInst.expected, requestInst.method, len(requestInst.body), resp.Code, resp.Body.String())
+			continue
+		}
+
+		if resp.Code == http.StatusRequestEntityTooLarge {
+			if err := json.Unmarshal(resp.Body.Bytes(), &problem); err != nil || problem.ErrorCode != ErrorCodeTooLarge {
+				t.Errorf("Expected the %s problem, got %s. Error: %v", ErrorCodeTooLarge, resp.Body.String(), err)
+			}
+		}
+	}
+}
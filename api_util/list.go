@@ -0,0 +1,385 @@
+package api_util
+
+import (
+	"colmanback/db"
+	"colmanback/objects"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Query parameters understood by every list endpoint. Any other parameter but ExpandParam is
+// taken as an equality filter on the field with that JSON name, e.g. country=gb or isCargo=true.
+const (
+	LimitParam  = "limit"
+	CursorParam = "cursor"
+	SortParam   = "sort"
+
+	MAX_LIST_LIMIT = 1000
+
+	NextCursorHeader = "X-Next-Cursor"
+	LinkHeader       = "Link"
+)
+
+type listField struct {
+	name  string
+	index []int
+}
+
+type sortField struct {
+	listField
+	isDescending bool
+}
+
+type listFilter struct {
+	listField
+	valueList []reflect.Value
+}
+
+// listCursor points at the last object of a page. The next page starts with the first object
+// that sorts after it, so objects added or deleted in between do not shift the pages.
+type listCursor struct {
+	Sort string          `json:"sort"`
+	Code string          `json:"code"`
+	Key  json.RawMessage `json:"key"`
+
+	keyInst reflect.Value
+}
+
+type listQuery struct {
+	sortSpec   string
+	sortList   []sortField
+	filterList []listFilter
+	limit      int
+	cursor     *listCursor
+}
+
+//----------------------------------------------------------------------------------------
+// listFieldMap returns the scalar fields of the struct pointed to by K, keyed by their JSON
+// names in lower case.
+func listFieldMap[K objects.Object]() (reflect.Type, map[string]listField) {
+	fieldMap := make(map[string]listField)
+
+	structType := reflect.TypeOf((*K)(nil)).Elem()
+	if structType.Kind() == reflect.Pointer {
+		structType = structType.Elem()
+	}
+
+	if structType.Kind() != reflect.Struct {
+		return structType, fieldMap
+	}
+
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		if !field.IsExported() || name == "" || name == "-" || !isScalar(field.Type.Kind()) {
+			continue
+		}
+
+		fieldMap[strings.ToLower(name)] = listField{name: name, index: field.Index}
+	}
+
+	return structType, fieldMap
+}
+
+//----------------------------------------------------------------------------------------
+func isScalar(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+//----------------------------------------------------------------------------------------
+// compareValues compares two values of the same field. Strings are compared ignoring case.
+func compareValues(a reflect.Value, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.String:
+		return strings.Compare(strings.ToLower(a.String()), strings.ToLower(b.String()))
+	case reflect.Bool:
+		if a.Bool() == b.Bool() {
+			return 0
+		} else if !a.Bool() {
+			return -1
+		}
+		return 1
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(a.Uint(), b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float(), b.Float())
+	}
+
+	return 0
+}
+
+//----------------------------------------------------------------------------------------
+func compareOrdered[T int64 | uint64 | float64](a T, b T) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+
+	return 0
+}
+
+//----------------------------------------------------------------------------------------
+// parseFieldValue converts a filter value to the type of the field it applies to.
+func parseFieldValue(fieldType reflect.Type, text string) (reflect.Value, error) {
+	value := reflect.New(fieldType).Elem()
+
+	switch fieldType.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		boolValue, err := strconv.ParseBool(text)
+		if err != nil {
+			return value, err
+		}
+		value.SetBool(boolValue)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		intValue, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return value, err
+		}
+		value.SetInt(intValue)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		uintValue, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return value, err
+		}
+		value.SetUint(uintValue)
+	case reflect.Float32, reflect.Float64:
+		floatValue, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return value, err
+		}
+		value.SetFloat(floatValue)
+	}
+
+	return value, nil
+}
+
+//----------------------------------------------------------------------------------------
+func structValue(objectInst interface{}) reflect.Value {
+	value := reflect.ValueOf(objectInst)
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+
+	return value
+}
+
+//----------------------------------------------------------------------------------------
+func parseListQuery[K objects.Object](queryValues url.Values) (*listQuery, error) {
+	var err error
+	query := &listQuery{}
+
+	structType, fieldMap := listFieldMap[K]()
+
+	if limitParam := queryValues.Get(LimitParam); limitParam != "" {
+		query.limit, err = strconv.Atoi(limitParam)
+		if err != nil || query.limit < 1 || query.limit > MAX_LIST_LIMIT {
+			return nil, &db.ValidationError{Message: fmt.Sprintf("%s must be a number between 1 and %d", LimitParam, MAX_LIST_LIMIT)}
+		}
+	}
+
+	query.sortSpec = queryValues.Get(SortParam)
+	for _, sortName := range strings.Split(query.sortSpec, ",") {
+		sortName = strings.TrimSpace(sortName)
+		if sortName == "" {
+			continue
+		}
+
+		isDescending := strings.HasPrefix(sortName, "-")
+		field, isKnown := fieldMap[strings.ToLower(strings.TrimPrefix(sortName, "-"))]
+		if !isKnown {
+			return nil, &db.ValidationError{Message: fmt.Sprintf("the list cannot be sorted by %s", sortName)}
+		}
+
+		query.sortList = append(query.sortList, sortField{listField: field, isDescending: isDescending})
+	}
+
+	for paramName, paramValueList := range queryValues {
+		if paramName == LimitParam || paramName == CursorParam || paramName == SortParam || paramName == ExpandParam {
+			continue
+		}
+
+		field, isKnown := fieldMap[strings.ToLower(paramName)]
+		if !isKnown {
+			return nil, &db.ValidationError{Message: fmt.Sprintf("the list cannot be filtered by %s", paramName)}
+		}
+
+		filter := listFilter{listField: field}
+		for _, paramValue := range paramValueList {
+			value, parseErr := parseFieldValue(structType.FieldByIndex(field.index).Type, paramValue)
+			if parseErr != nil {
+				return nil, &db.ValidationError{Message: fmt.Sprintf("invalid value %s for %s", paramValue, paramName), Err: parseErr}
+			}
+
+			filter.valueList = append(filter.valueList, value)
+		}
+
+		query.filterList = append(query.filterList, filter)
+	}
+
+	if cursorParam := queryValues.Get(CursorParam); cursorParam != "" {
+		query.cursor, err = decodeCursor(cursorParam, structType, query.sortSpec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return query, nil
+}
+
+//----------------------------------------------------------------------------------------
+func decodeCursor(cursorParam string, structType reflect.Type, sortSpec string) (*listCursor, error) {
+	cursor := &listCursor{}
+
+	cursorJson, err := base64.RawURLEncoding.DecodeString(cursorParam)
+	if err == nil {
+		err = json.Unmarshal(cursorJson, cursor)
+	}
+
+	if err == nil {
+		cursor.keyInst = reflect.New(structType)
+		err = json.Unmarshal(cursor.Key, cursor.keyInst.Interface())
+	}
+
+	if err != nil {
+		return nil, &db.ValidationError{Message: "invalid cursor", Err: err}
+	}
+
+	if cursor.Sort != sortSpec {
+		return nil, &db.ValidationError{Message: fmt.Sprintf("the cursor was issued for sort %q and cannot be used with sort %q", cursor.Sort, sortSpec)}
+	}
+
+	return cursor, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (query *listQuery) encodeCursor(objectInst objects.Object) (string, error) {
+	keyMap := make(map[string]interface{})
+
+	value := structValue(objectInst)
+	for _, field := range query.sortList {
+		keyMap[field.name] = value.FieldByIndex(field.index).Interface()
+	}
+
+	keyJson, err := json.Marshal(keyMap)
+	if err != nil {
+		return "", err
+	}
+
+	cursorJson, err := json.Marshal(listCursor{Sort: query.sortSpec, Code: objectInst.CodeValue(), Key: keyJson})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(cursorJson), nil
+}
+
+//----------------------------------------------------------------------------------------
+func (query *listQuery) isMatch(objectInst objects.Object) bool {
+	value := structValue(objectInst)
+
+	for _, filter := range query.filterList {
+		fieldValue := value.FieldByIndex(filter.index)
+		isMatch := false
+
+		for _, filterValue := range filter.valueList {
+			if compareValues(fieldValue, filterValue) == 0 {
+				isMatch = true
+				break
+			}
+		}
+
+		if !isMatch {
+			return false
+		}
+	}
+
+	return true
+}
+
+//----------------------------------------------------------------------------------------
+// compare orders two objects by the sort fields and then by code, so that the order is
+// total and pages are stable.
+func (query *listQuery) compare(a reflect.Value, aCode string, b reflect.Value, bCode string) int {
+	for _, field := range query.sortList {
+		result := compareValues(a.FieldByIndex(field.index), b.FieldByIndex(field.index))
+		if field.isDescending {
+			result = -result
+		}
+
+		if result != 0 {
+			return result
+		}
+	}
+
+	return strings.Compare(aCode, bCode)
+}
+
+//----------------------------------------------------------------------------------------
+// apply filters and sorts objectInstList and cuts the page out of it. It returns the cursor
+// of the next page, which is empty on the last page.
+func applyListQuery[K objects.Object](query *listQuery, objectInstList []K) ([]K, string, error) {
+	matchList := []K{}
+	for _, objectInst := range objectInstList {
+		if query.isMatch(objectInst) {
+			matchList = append(matchList, objectInst)
+		}
+	}
+
+	sort.SliceStable(matchList, func(i int, j int) bool {
+		return query.compare(structValue(matchList[i]), matchList[i].CodeValue(), structValue(matchList[j]), matchList[j].CodeValue()) < 0
+	})
+
+	if query.cursor != nil {
+		cursorValue := structValue(query.cursor.keyInst.Interface())
+		start := sort.Search(len(matchList), func(index int) bool {
+			return query.compare(structValue(matchList[index]), matchList[index].CodeValue(), cursorValue, query.cursor.Code) > 0
+		})
+
+		matchList = matchList[start:]
+	}
+
+	if query.limit == 0 || len(matchList) <= query.limit {
+		return matchList, "", nil
+	}
+
+	matchList = matchList[:query.limit]
+	nextCursor, err := query.encodeCursor(matchList[len(matchList)-1])
+
+	return matchList, nextCursor, err
+}
+
+//----------------------------------------------------------------------------------------
+func setNextPageHeaders(writer http.ResponseWriter, request *http.Request, nextCursor string) {
+	if nextCursor == "" {
+		return
+	}
+
+	nextURL := *request.URL
+	queryValues := nextURL.Query()
+	queryValues.Set(CursorParam, nextCursor)
+	nextURL.RawQuery = queryValues.Encode()
+
+	writer.Header().Set(NextCursorHeader, nextCursor)
+	writer.Header().Set(LinkHeader, fmt.Sprintf("<%s>; rel=\"next\"", nextURL.RequestURI()))
+}
@@ -0,0 +1,157 @@
+package api_util
+
+import (
+	"colmanback/objects"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	listURLConst = "/api/v1/listtest"
+)
+
+type listTestObject struct {
+	Code    string             `json:"code"`
+	Country string             `json:"country"`
+	Scale   objects.ModelScale `json:"scale"`
+	IsCargo bool               `json:"isCargo"`
+	Seats   int                `json:"seats"`
+	Version int64              `json:"version"`
+}
+
+func (objectInst *listTestObject) CodeValue() string        { return objectInst.Code }
+func (objectInst *listTestObject) SortValue() string        { return "" }
+func (objectInst *listTestObject) VersionValue() int64      { return objectInst.Version }
+func (objectInst *listTestObject) SetVersion(version int64) { objectInst.Version = version }
+func (objectInst *listTestObject) ToString() string         { return objectInst.Code }
+func (objectInst *listTestObject) FromJson(jsonInst []byte) error {
+	return json.Unmarshal(jsonInst, objectInst)
+}
+func (objectInst *listTestObject) Print()                                         {}
+func (objectInst *listTestObject) Put() error                                     { return nil }
+func (objectInst *listTestObject) Delete() error                                  { return nil }
+func (objectInst *listTestObject) WriteObject(http.ResponseWriter, *http.Request) {}
+
+func newListRouter() *mux.Router {
+	var apiInst GenAPI[*listTestObject]
+
+	router := mux.NewRouter()
+	router.HandleFunc(listURLConst, apiInst.GetList).Methods(http.MethodGet)
+
+	apiInst.GetObjectList = func() ([]*listTestObject, error) {
+		// Returned out of order on purpose, as the cache of an adapter would.
+		return []*listTestObject{
+			{Code: "e", Country: "fr", Scale: objects.Scale1200, IsCargo: false, Seats: 180},
+			{Code: "b", Country: "gb", Scale: objects.Scale1400, IsCargo: true, Seats: 0},
+			{Code: "d", Country: "GB", Scale: objects.Scale1400, IsCargo: false, Seats: 300},
+			{Code: "a", Country: "de", Scale: objects.Scale1400, IsCargo: false, Seats: 150},
+			{Code: "c", Country: "gb", Scale: objects.Scale1200, IsCargo: false, Seats: 150},
+		}, nil
+	}
+
+	return router
+}
+
+func getListPage(t *testing.T, router *mux.Router, query string, expectedCode int) ([]string, string) {
+	var objectList []listTestObject
+	var codeList []string
+
+	req := httptest.NewRequest(http.MethodGet, listURLConst+"?"+query, nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != expectedCode {
+		t.Errorf("Status code not as expected for %s. Expected %d but got %d: %s", query, expectedCode, resp.Code, resp.Body.String())
+		return nil, ""
+	}
+
+	if resp.Code == http.StatusOK {
+		if err := json.Unmarshal(resp.Body.Bytes(), &objectList); err != nil {
+			t.Errorf("The list returned for %s cannot be unmarshalled. Error: %v", query, err)
+		}
+	}
+
+	for _, objectInst := range objectList {
+		codeList = append(codeList, objectInst.Code)
+	}
+
+	return codeList, resp.Header().Get(NextCursorHeader)
+}
+
+func chkCodes(t *testing.T, query string, codeList []string, expected string) {
+	if strings.Join(codeList, ",") != expected {
+		t.Errorf("Unexpected list for %s. Expected %s but got %v", query, expected, codeList)
+	}
+}
+
+func TestListQuery(t *testing.T) {
+	router := newListRouter()
+
+	queryList := []struct {
+		query    string
+		expected string
+	}{
+		{"", "a,b,c,d,e"},
+		{"country=gb", "b,c,d"},
+		{"country=gb&country=fr", "b,c,d,e"},
+		{"scale=" + url.QueryEscape("1/400") + "&isCargo=false", "a,d"},
+		{"seats=150", "a,c"},
+		{"sort=-seats", "d,e,a,c,b"},
+		{"sort=country,-code", "a,e,d,c,b"},
+		{"sort=SEATS&country=gb", "b,c,d"},
+	}
+
+	t.Log("Lists are filtered and sorted by code unless told otherwise")
+	for _, queryInst := range queryList {
+		codeList, nextCursor := getListPage(t, router, queryInst.query, http.StatusOK)
+		chkCodes(t, queryInst.query, codeList, queryInst.expected)
+
+		if nextCursor != "" {
+			t.Errorf("Unexpected next cursor for %s", queryInst.query)
+		}
+	}
+
+	t.Log("A filter matching nothing returns an empty list rather than null")
+	req := httptest.NewRequest(http.MethodGet, listURLConst+"?country=us", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || strings.TrimSpace(resp.Body.String()) != "[]" {
+		t.Errorf("Expected 200 and [] for an empty filter result, got %d and %s", resp.Code, resp.Body.String())
+	}
+
+	t.Log("Invalid parameters are rejected")
+	for _, query := range []string{"limit=0", "limit=x", "sort=unknown", "unknown=1", "isCargo=maybe", "cursor=garbage"} {
+		getListPage(t, router, query, http.StatusBadRequest)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	var allCodes []string
+
+	router := newListRouter()
+
+	t.Log("Pages follow each other until the next cursor is empty")
+	query := "sort=-seats&limit=2"
+	for page := 0; page < 5; page++ {
+		codeList, nextCursor := getListPage(t, router, query, http.StatusOK)
+		allCodes = append(allCodes, codeList...)
+
+		if nextCursor == "" {
+			break
+		}
+
+		query = fmt.Sprintf("sort=-seats&limit=2&cursor=%s", nextCursor)
+	}
+	chkCodes(t, "all pages", allCodes, "d,e,a,c,b")
+
+	t.Log("A cursor cannot be used with another sort")
+	_, nextCursor := getListPage(t, router, "sort=-seats&limit=2", http.StatusOK)
+	getListPage(t, router, "sort=code&limit=2&cursor="+nextCursor, http.StatusBadRequest)
+}
@@ -0,0 +1,370 @@
+package api_util
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	OPENAPI_VERSION = "3.0.3"
+	API_TITLE       = "colmanback API"
+	API_VERSION     = "1.0"
+
+	ContentTypeMultipart = "multipart/form-data"
+
+	schemaRefPrefix = "#/components/schemas/"
+)
+
+// Types of the parameters and form fields of an Operation.
+const (
+	ParamString  = "string"
+	ParamInteger = "integer"
+	ParamBoolean = "boolean"
+	ParamFile    = "file"
+)
+
+// Param is a query parameter or a form field of an Operation.
+type Param struct {
+	Name        string
+	Type        string
+	Description string
+	IsRequired  bool
+}
+
+// Operation describes a route of the API for the OpenAPI document. Its path is the full path
+// template the route is registered with, e.g. /api/v1/model/{modelID}. The schemas of the
+// request and response bodies are derived from the JSON tags of their types. Without
+// ResponseType, the response is a message.
+type Operation struct {
+	Method      string
+	Path        string
+	OperationID string
+	Tag         string
+	Summary     string
+	QueryParams []Param
+
+	RequestType         reflect.Type
+	RequestContentTypes []string
+	RequestForm         []Param
+
+	ResponseType   reflect.Type
+	IsListResponse bool
+}
+
+var operationMap = make(map[string]Operation)
+var operationLock sync.RWMutex
+
+var pathParamPattern = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+//----------------------------------------------------------------------------------------
+func operationKey(method string, path string) string {
+	return method + " " + path
+}
+
+//----------------------------------------------------------------------------------------
+// DescribeOperation adds operation to the OpenAPI document. It only shows up there once a
+// route with the same method and path is registered. Describing it again replaces it.
+func DescribeOperation(operation Operation) {
+	operationLock.Lock()
+	defer operationLock.Unlock()
+
+	operationMap[operationKey(operation.Method, operation.Path)] = operation
+}
+
+//----------------------------------------------------------------------------------------
+func describedOperation(method string, path string) (Operation, bool) {
+	operationLock.RLock()
+	defer operationLock.RUnlock()
+
+	operation, isFound := operationMap[operationKey(method, path)]
+
+	return operation, isFound
+}
+
+//----------------------------------------------------------------------------------------
+// ListParams returns the query parameters understood by GetList.
+func (apiInst *GenAPI[K]) ListParams() []Param {
+	paramList := []Param{
+		{Name: LimitParam, Type: ParamInteger, Description: fmt.Sprintf("Maximum number of objects returned, up to %d", MAX_LIST_LIMIT)},
+		{Name: CursorParam, Type: ParamString, Description: "Cursor of the page, as returned in " + NextCursorHeader},
+		{Name: SortParam, Type: ParamString, Description: "Comma-separated fields to sort by, descending when prefixed by -"},
+	}
+
+	return append(paramList, apiInst.getParams()...)
+}
+
+//----------------------------------------------------------------------------------------
+func (apiInst *GenAPI[K]) getParams() []Param {
+	if apiInst.Expand == nil {
+		return nil
+	}
+
+	return []Param{{Name: ExpandParam, Type: ParamString, Description: "Comma-separated references to attach the details of, among " + strings.Join(apiInst.ExpandFields, ", ")}}
+}
+
+//----------------------------------------------------------------------------------------
+// Describe adds the operations of GenAPI to the OpenAPI document: the list and the put on
+// BaseURL, and the get, patch and delete on resourceURL, relative to ApiURL. Only those
+// actually routed to are listed in the document.
+func (apiInst *GenAPI[K]) Describe(tag string, resourceURL string) {
+	objectType := reflect.TypeOf((*K)(nil)).Elem()
+	typeName := indirectType(objectType).Name()
+
+	DescribeOperation(Operation{Method: http.MethodGet, Path: apiInst.ApiURL + apiInst.BaseURL, OperationID: "list" + typeName, Tag: tag,
+		Summary:     "Lists the " + tag + " objects. Any other parameter filters on the field of the same name",
+		QueryParams: apiInst.ListParams(), ResponseType: objectType, IsListResponse: true})
+	DescribeOperation(Operation{Method: http.MethodPut, Path: apiInst.ApiURL + apiInst.BaseURL, OperationID: "put" + typeName, Tag: tag,
+		Summary:     "Creates or updates a " + tag + " object",
+		RequestType: objectType, ResponseType: objectType})
+	DescribeOperation(Operation{Method: http.MethodGet, Path: apiInst.ApiURL + resourceURL, OperationID: "get" + typeName, Tag: tag,
+		Summary:     "Returns the " + tag + " object with the given code",
+		QueryParams: apiInst.getParams(), ResponseType: objectType})
+	DescribeOperation(Operation{Method: http.MethodPatch, Path: apiInst.ApiURL + resourceURL, OperationID: "patch" + typeName, Tag: tag,
+		Summary:     "Updates the " + tag + " object with the given code with a merge patch or a JSON patch",
+		RequestType: reflect.TypeOf((*interface{})(nil)).Elem(), RequestContentTypes: []string{ContentTypeMergePatch, ContentTypeJSONPatch}, ResponseType: objectType})
+	DescribeOperation(Operation{Method: http.MethodDelete, Path: apiInst.ApiURL + resourceURL, OperationID: "delete" + typeName, Tag: tag,
+		Summary: "Deletes the " + tag + " object with the given code",
+		QueryParams: []Param{
+			{Name: CascadeParam, Type: ParamBoolean, Description: "Deletes the objects referencing it as well"},
+			{Name: ReassignToParam, Type: ParamString, Description: "Code of the object the objects referencing it are to reference instead"},
+		}})
+}
+
+//----------------------------------------------------------------------------------------
+func indirectType(typeInst reflect.Type) reflect.Type {
+	for typeInst.Kind() == reflect.Ptr {
+		typeInst = typeInst.Elem()
+	}
+
+	return typeInst
+}
+
+//----------------------------------------------------------------------------------------
+// jsonFieldName returns the name of field in JSON, and whether it is marshalled at all.
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" || field.PkgPath != "" {
+		return "", false
+	}
+
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		name = field.Name
+	}
+
+	return name, true
+}
+
+// openAPISchemas collects the schemas of the named structs, so that each of them is
+// described once under components and referenced everywhere else.
+type openAPISchemas struct {
+	schemaMap map[string]interface{}
+}
+
+//----------------------------------------------------------------------------------------
+func (schemas *openAPISchemas) schemaOf(typeInst reflect.Type) map[string]interface{} {
+	typeInst = indirectType(typeInst)
+
+	switch typeInst.Kind() {
+	case reflect.Struct:
+		if typeInst.Name() == "" {
+			return schemas.structSchema(typeInst)
+		}
+
+		if _, isFound := schemas.schemaMap[typeInst.Name()]; !isFound {
+			//registered ahead, so that recursive types end up referencing themselves.
+			schemas.schemaMap[typeInst.Name()] = nil
+			schemas.schemaMap[typeInst.Name()] = schemas.structSchema(typeInst)
+		}
+
+		return map[string]interface{}{"$ref": schemaRefPrefix + typeInst.Name()}
+	case reflect.Slice, reflect.Array:
+		if typeInst.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+
+		return map[string]interface{}{"type": "array", "items": schemas.schemaOf(typeInst.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemas.schemaOf(typeInst.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+
+	//interfaces can hold anything.
+	return map[string]interface{}{}
+}
+
+//----------------------------------------------------------------------------------------
+func (schemas *openAPISchemas) structSchema(typeInst reflect.Type) map[string]interface{} {
+	propertyMap := make(map[string]interface{})
+
+	for index := 0; index < typeInst.NumField(); index++ {
+		field := typeInst.Field(index)
+
+		//embedded structs without a name of their own are marshalled inline.
+		if field.Anonymous && field.Tag.Get("json") == "" && indirectType(field.Type).Kind() == reflect.Struct {
+			embeddedSchema := schemas.structSchema(indirectType(field.Type))
+			for name, property := range embeddedSchema["properties"].(map[string]interface{}) {
+				propertyMap[name] = property
+			}
+
+			continue
+		}
+
+		if name, isMarshalled := jsonFieldName(field); isMarshalled {
+			propertyMap[name] = schemas.schemaOf(field.Type)
+		}
+	}
+
+	return map[string]interface{}{"type": "object", "properties": propertyMap}
+}
+
+//----------------------------------------------------------------------------------------
+func (schemas *openAPISchemas) bodySchema(typeInst reflect.Type, isList bool) map[string]interface{} {
+	if isList {
+		return map[string]interface{}{"type": "array", "items": schemas.schemaOf(typeInst)}
+	}
+
+	return schemas.schemaOf(typeInst)
+}
+
+//----------------------------------------------------------------------------------------
+func paramSchema(param Param) map[string]interface{} {
+	if param.Type == ParamFile {
+		return map[string]interface{}{"type": "string", "format": "binary"}
+	}
+
+	return map[string]interface{}{"type": param.Type}
+}
+
+//----------------------------------------------------------------------------------------
+func (schemas *openAPISchemas) operationDoc(operation Operation) map[string]interface{} {
+	var parameterList []interface{}
+
+	for _, match := range pathParamPattern.FindAllStringSubmatch(operation.Path, -1) {
+		parameterList = append(parameterList, map[string]interface{}{"name": match[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": ParamString}})
+	}
+
+	for _, param := range operation.QueryParams {
+		parameterList = append(parameterList, map[string]interface{}{"name": param.Name, "in": "query", "required": param.IsRequired, "description": param.Description, "schema": paramSchema(param)})
+	}
+
+	responseType := operation.ResponseType
+	if responseType == nil {
+		responseType = reflect.TypeOf(struct {
+			Message string `json:"message"`
+		}{})
+	}
+
+	operationDoc := map[string]interface{}{
+		"tags":    []string{operation.Tag},
+		"summary": operation.Summary,
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "Success",
+				"content":     map[string]interface{}{ContentTypeAppJSON: map[string]interface{}{"schema": schemas.bodySchema(responseType, operation.IsListResponse)}},
+			},
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content":     map[string]interface{}{ContentTypeProblemJSON: map[string]interface{}{"schema": schemas.schemaOf(reflect.TypeOf(Problem{}))}},
+			},
+		},
+	}
+
+	if operation.OperationID != "" {
+		operationDoc["operationId"] = operation.OperationID
+	}
+
+	if len(parameterList) > 0 {
+		operationDoc["parameters"] = parameterList
+	}
+
+	if len(operation.RequestForm) > 0 {
+		propertyMap := make(map[string]interface{})
+		requiredList := []string{}
+
+		for _, param := range operation.RequestForm {
+			propertyMap[param.Name] = paramSchema(param)
+			if param.IsRequired {
+				requiredList = append(requiredList, param.Name)
+			}
+		}
+
+		formSchema := map[string]interface{}{"type": "object", "properties": propertyMap, "required": requiredList}
+		operationDoc["requestBody"] = map[string]interface{}{"required": true, "content": map[string]interface{}{ContentTypeMultipart: map[string]interface{}{"schema": formSchema}}}
+	} else if operation.RequestType != nil {
+		contentTypeList := operation.RequestContentTypes
+		if len(contentTypeList) == 0 {
+			contentTypeList = []string{ContentTypeAppJSON}
+		}
+
+		contentMap := make(map[string]interface{})
+		for _, contentType := range contentTypeList {
+			contentMap[contentType] = map[string]interface{}{"schema": schemas.schemaOf(operation.RequestType)}
+		}
+
+		operationDoc["requestBody"] = map[string]interface{}{"required": true, "content": contentMap}
+	}
+
+	return operationDoc
+}
+
+//----------------------------------------------------------------------------------------
+// BuildOpenAPI returns the OpenAPI document describing the routes of router, along with the
+// routes that have not been described with DescribeOperation. Those are left out.
+func BuildOpenAPI(router *mux.Router) (map[string]interface{}, []string) {
+	var undescribedList []string
+
+	schemas := &openAPISchemas{schemaMap: make(map[string]interface{})}
+	pathMap := make(map[string]interface{})
+
+	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, pathErr := route.GetPathTemplate()
+		methodList, methodErr := route.GetMethods()
+		if pathErr != nil || methodErr != nil || route.GetHandler() == nil {
+			//prefixes of subrouters do not serve anything themselves.
+			return nil
+		}
+
+		for _, method := range methodList {
+			operation, isDescribed := describedOperation(method, path)
+			if !isDescribed {
+				undescribedList = append(undescribedList, operationKey(method, path))
+				continue
+			}
+
+			openAPIPath := pathParamPattern.ReplaceAllString(path, "{$1}")
+			if _, isFound := pathMap[openAPIPath]; !isFound {
+				pathMap[openAPIPath] = make(map[string]interface{})
+			}
+
+			pathMap[openAPIPath].(map[string]interface{})[strings.ToLower(method)] = schemas.operationDoc(operation)
+		}
+
+		return nil
+	})
+
+	sort.Strings(undescribedList)
+
+	return map[string]interface{}{
+		"openapi":    OPENAPI_VERSION,
+		"info":       map[string]interface{}{"title": API_TITLE, "version": API_VERSION},
+		"paths":      pathMap,
+		"components": map[string]interface{}{"schemas": schemas.schemaMap},
+	}, undescribedList
+}
@@ -0,0 +1,25 @@
+package api_util
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey int
+
+const ownerKey contextKey = 0
+
+//----------------------------------------------------------------------------------------
+// NewOwnerContext returns a copy of ctx carrying owner, the collection of the caller.
+func NewOwnerContext(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey, owner)
+}
+
+//----------------------------------------------------------------------------------------
+// CollectionOwner returns the collection of the caller of request, as set by the
+// authentication middleware. Without authentication, every caller shares the collection with
+// no owner.
+func CollectionOwner(request *http.Request) string {
+	owner, _ := request.Context().Value(ownerKey).(string)
+	return owner
+}
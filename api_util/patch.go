@@ -0,0 +1,320 @@
+package api_util
+
+import (
+	"bytes"
+	"colmanback/db"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types accepted by GenAPI.Patch. A body sent as plain application/json, or without a
+// content type, is taken as a merge patch.
+const (
+	ContentTypeMergePatch = "application/merge-patch+json"
+	ContentTypeJSONPatch  = "application/json-patch+json"
+	AcceptPatchHeader     = "Accept-Patch"
+)
+
+// JSON Patch operations (RFC 6902).
+const (
+	PatchOpAdd     = "add"
+	PatchOpRemove  = "remove"
+	PatchOpReplace = "replace"
+	PatchOpMove    = "move"
+	PatchOpCopy    = "copy"
+	PatchOpTest    = "test"
+)
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patchTestError reports a JSON Patch test operation that did not hold. It is a conflict:
+// the object is no longer in the state the client based its patch on.
+type patchTestError struct {
+	Path string
+}
+
+//----------------------------------------------------------------------------------------
+func (testErr *patchTestError) Error() string {
+	return fmt.Sprintf("the test operation on %s failed", testErr.Path)
+}
+
+//----------------------------------------------------------------------------------------
+func (testErr *patchTestError) Is(target error) bool {
+	return target == db.ErrConflict
+}
+
+//----------------------------------------------------------------------------------------
+// decodeDocument decodes jsonInst keeping numbers as json.Number, so that large integers such
+// as versions survive a round trip untouched.
+func decodeDocument(jsonInst []byte) (interface{}, error) {
+	var document interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(jsonInst))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+//----------------------------------------------------------------------------------------
+// applyMergePatch follows RFC 7386: members of patch replace those of target, null removes
+// them and nested objects are merged recursively. target may be modified in place.
+func applyMergePatch(target interface{}, patch interface{}) interface{} {
+	patchMap, isMap := patch.(map[string]interface{})
+	if !isMap {
+		return patch
+	}
+
+	targetMap, isMap := target.(map[string]interface{})
+	if !isMap {
+		targetMap = make(map[string]interface{})
+	}
+
+	for name, value := range patchMap {
+		if value == nil {
+			delete(targetMap, name)
+		} else {
+			targetMap[name] = applyMergePatch(targetMap[name], value)
+		}
+	}
+
+	return targetMap
+}
+
+//----------------------------------------------------------------------------------------
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, &db.ValidationError{Message: fmt.Sprintf("invalid JSON pointer %q", pointer)}
+	}
+
+	tokenList := strings.Split(pointer[1:], "/")
+	for index, token := range tokenList {
+		tokenList[index] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokenList, nil
+}
+
+//----------------------------------------------------------------------------------------
+// arrayIndex converts token to an index of an array of the given length. With isAdding, the
+// index may also point just past the end, which "-" stands for.
+func arrayIndex(token string, length int, isAdding bool) (int, bool) {
+	if isAdding && token == "-" {
+		return length, true
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || strconv.Itoa(index) != token || index < 0 {
+		return 0, false
+	}
+
+	if index > length || (index == length && !isAdding) {
+		return 0, false
+	}
+
+	return index, true
+}
+
+//----------------------------------------------------------------------------------------
+func getPointerValue(document interface{}, tokenList []string) (interface{}, bool) {
+	for _, token := range tokenList {
+		switch container := document.(type) {
+		case map[string]interface{}:
+			value, isFound := container[token]
+			if !isFound {
+				return nil, false
+			}
+			document = value
+		case []interface{}:
+			index, isFound := arrayIndex(token, len(container), false)
+			if !isFound {
+				return nil, false
+			}
+			document = container[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return document, true
+}
+
+//----------------------------------------------------------------------------------------
+// applyPointerOp adds, replaces or removes the value at tokenList within document. It returns
+// the updated document, which differs from the original when the root or an array changes
+// size, and the value that was replaced or removed.
+func applyPointerOp(document interface{}, tokenList []string, op string, value interface{}) (interface{}, interface{}, error) {
+	if len(tokenList) == 0 {
+		if op == PatchOpRemove {
+			return nil, nil, &db.ValidationError{Message: "the whole document cannot be removed"}
+		}
+
+		return value, document, nil
+	}
+
+	token := tokenList[0]
+	notFoundErr := &db.ValidationError{Message: fmt.Sprintf("the path to %s does not exist", token)}
+
+	switch container := document.(type) {
+	case map[string]interface{}:
+		oldValue, isFound := container[token]
+
+		if len(tokenList) > 1 {
+			if !isFound {
+				return nil, nil, notFoundErr
+			}
+
+			newValue, childValue, err := applyPointerOp(oldValue, tokenList[1:], op, value)
+			if err == nil {
+				container[token] = newValue
+			}
+
+			return container, childValue, err
+		}
+
+		if !isFound && op != PatchOpAdd {
+			return nil, nil, notFoundErr
+		}
+
+		if op == PatchOpRemove {
+			delete(container, token)
+		} else {
+			container[token] = value
+		}
+
+		return container, oldValue, nil
+
+	case []interface{}:
+		isAdding := op == PatchOpAdd && len(tokenList) == 1
+
+		index, isFound := arrayIndex(token, len(container), isAdding)
+		if !isFound {
+			return nil, nil, notFoundErr
+		}
+
+		if len(tokenList) > 1 {
+			newValue, childValue, err := applyPointerOp(container[index], tokenList[1:], op, value)
+			if err == nil {
+				container[index] = newValue
+			}
+
+			return container, childValue, err
+		}
+
+		switch op {
+		case PatchOpAdd:
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+
+			return container, nil, nil
+		case PatchOpRemove:
+			oldValue := container[index]
+
+			return append(container[:index], container[index+1:]...), oldValue, nil
+		}
+
+		oldValue := container[index]
+		container[index] = value
+
+		return container, oldValue, nil
+	}
+
+	return nil, nil, notFoundErr
+}
+
+//----------------------------------------------------------------------------------------
+// applyJSONPatch applies the operations of patchJson (RFC 6902) in order. Either all of them
+// succeed or an error is returned.
+func applyJSONPatch(document interface{}, patchJson []byte) (interface{}, error) {
+	var operationList []patchOperation
+
+	if err := json.Unmarshal(patchJson, &operationList); err != nil {
+		return nil, &db.ValidationError{Message: "the JSON patch could not be decoded", Err: err}
+	}
+
+	for _, operation := range operationList {
+		var value interface{}
+		var err error
+
+		tokenList, err := parsePointer(operation.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		switch operation.Op {
+		case PatchOpAdd, PatchOpReplace, PatchOpTest:
+			if len(operation.Value) == 0 {
+				return nil, &db.ValidationError{Message: fmt.Sprintf("the %s operation on %s has no value", operation.Op, operation.Path)}
+			}
+
+			value, err = decodeDocument(operation.Value)
+			if err != nil {
+				return nil, &db.ValidationError{Message: fmt.Sprintf("the value of the %s operation on %s could not be decoded", operation.Op, operation.Path), Err: err}
+			}
+		}
+
+		switch operation.Op {
+		case PatchOpAdd, PatchOpReplace, PatchOpRemove:
+			document, _, err = applyPointerOp(document, tokenList, operation.Op, value)
+
+		case PatchOpMove, PatchOpCopy:
+			fromList, fromErr := parsePointer(operation.From)
+			if fromErr != nil {
+				return nil, fromErr
+			}
+
+			if operation.Op == PatchOpMove && strings.HasPrefix(operation.Path, operation.From+"/") {
+				return nil, &db.ValidationError{Message: fmt.Sprintf("%s cannot be moved into one of its children", operation.From)}
+			}
+
+			value, isFound := getPointerValue(document, fromList)
+			if !isFound {
+				return nil, &db.ValidationError{Message: fmt.Sprintf("the path %s does not exist", operation.From)}
+			}
+
+			if operation.Op == PatchOpMove {
+				document, _, err = applyPointerOp(document, fromList, PatchOpRemove, nil)
+			} else {
+				// The copy must not share maps or slices with the original.
+				valueJson, _ := json.Marshal(value)
+				value, err = decodeDocument(valueJson)
+			}
+
+			if err == nil {
+				document, _, err = applyPointerOp(document, tokenList, PatchOpAdd, value)
+			}
+
+		case PatchOpTest:
+			currentValue, isFound := getPointerValue(document, tokenList)
+			if !isFound || !reflect.DeepEqual(currentValue, value) {
+				return nil, &patchTestError{Path: operation.Path}
+			}
+
+		default:
+			return nil, &db.ValidationError{Message: fmt.Sprintf("unknown JSON patch operation %q", operation.Op)}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return document, nil
+}
@@ -0,0 +1,91 @@
+package api_util
+
+import (
+	"colmanback/db"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const (
+	patchTargetConst = `{"code": "a", "name": "Name", "tags": ["x", "y"], "size": {"length": 70, "span": 60}, "version": 9007199254740993}`
+)
+
+func chkPatched(t *testing.T, description string, document interface{}, expected string) {
+	expectedDocument, _ := decodeDocument([]byte(expected))
+
+	documentJson, _ := json.Marshal(document)
+	expectedJson, _ := json.Marshal(expectedDocument)
+
+	if string(documentJson) != string(expectedJson) {
+		t.Errorf("Unexpected result for %s. Expected %s but got %s", description, expectedJson, documentJson)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	patchList := []struct {
+		patch    string
+		expected string
+	}{
+		{`{"name": "New"}`, `{"code": "a", "name": "New", "tags": ["x", "y"], "size": {"length": 70, "span": 60}, "version": 9007199254740993}`},
+		{`{"name": null, "tags": ["z"]}`, `{"code": "a", "tags": ["z"], "size": {"length": 70, "span": 60}, "version": 9007199254740993}`},
+		{`{"size": {"span": null, "height": 20}}`, `{"code": "a", "name": "Name", "tags": ["x", "y"], "size": {"length": 70, "height": 20}, "version": 9007199254740993}`},
+		{`{}`, patchTargetConst},
+	}
+
+	for _, patchInst := range patchList {
+		document, _ := decodeDocument([]byte(patchTargetConst))
+		patch, _ := decodeDocument([]byte(patchInst.patch))
+
+		chkPatched(t, patchInst.patch, applyMergePatch(document, patch), patchInst.expected)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	patchList := []struct {
+		patch    string
+		expected string
+	}{
+		{`[{"op": "replace", "path": "/name", "value": "New"}]`, `{"code": "a", "name": "New", "tags": ["x", "y"], "size": {"length": 70, "span": 60}, "version": 9007199254740993}`},
+		{`[{"op": "add", "path": "/tags/1", "value": "w"}, {"op": "add", "path": "/tags/-", "value": "z"}]`, `{"code": "a", "name": "Name", "tags": ["x", "w", "y", "z"], "size": {"length": 70, "span": 60}, "version": 9007199254740993}`},
+		{`[{"op": "remove", "path": "/tags/0"}, {"op": "remove", "path": "/size/span"}]`, `{"code": "a", "name": "Name", "tags": ["y"], "size": {"length": 70}, "version": 9007199254740993}`},
+		{`[{"op": "move", "from": "/name", "path": "/size/name"}]`, `{"code": "a", "tags": ["x", "y"], "size": {"length": 70, "span": 60, "name": "Name"}, "version": 9007199254740993}`},
+		{`[{"op": "copy", "from": "/tags", "path": "/labels"}, {"op": "add", "path": "/labels/-", "value": "z"}]`, `{"code": "a", "name": "Name", "tags": ["x", "y"], "labels": ["x", "y", "z"], "size": {"length": 70, "span": 60}, "version": 9007199254740993}`},
+		{`[{"op": "test", "path": "/version", "value": 9007199254740993}, {"op": "replace", "path": "/size/length", "value": 71}]`, `{"code": "a", "name": "Name", "tags": ["x", "y"], "size": {"length": 71, "span": 60}, "version": 9007199254740993}`},
+	}
+
+	t.Log("Operations are applied in order")
+	for _, patchInst := range patchList {
+		document, _ := decodeDocument([]byte(patchTargetConst))
+
+		patchedDocument, err := applyJSONPatch(document, []byte(patchInst.patch))
+		if err != nil {
+			t.Errorf("Patch %s failed. Error: %v", patchInst.patch, err)
+		} else {
+			chkPatched(t, patchInst.patch, patchedDocument, patchInst.expected)
+		}
+	}
+
+	t.Log("Invalid patches are rejected")
+	for _, patch := range []string{
+		`{"op": "add"}`,
+		`[{"op": "unknown", "path": "/name"}]`,
+		`[{"op": "replace", "path": "/missing", "value": 1}]`,
+		`[{"op": "add", "path": "/tags/5", "value": 1}]`,
+		`[{"op": "add", "path": "/name"}]`,
+		`[{"op": "remove", "path": "name"}]`,
+		`[{"op": "move", "from": "/size", "path": "/size/copy"}]`,
+	} {
+		document, _ := decodeDocument([]byte(patchTargetConst))
+
+		if _, err := applyJSONPatch(document, []byte(patch)); !errors.Is(err, db.ErrValidation) {
+			t.Errorf("Patch %s expected to be invalid but got %v", patch, err)
+		}
+	}
+
+	t.Log("A failed test is a conflict")
+	document, _ := decodeDocument([]byte(patchTargetConst))
+	if _, err := applyJSONPatch(document, []byte(`[{"op": "test", "path": "/name", "value": "Other"}]`)); !errors.Is(err, db.ErrConflict) {
+		t.Errorf("Failed test expected to be a conflict but got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package api_util
+
+import (
+	"colmanback/db"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Errors are reported as RFC 7807 problem details. Besides the standard members, every
+// problem carries a stable errorCode for clients to act upon, the code of the object the
+// error is about when there is one, and the id of the request for the logs.
+const (
+	ContentTypeProblemJSON = "application/problem+json"
+	ProblemTypeDefault     = "about:blank"
+
+	ErrorCodeInvalidRequest       = "invalid_request"
+	ErrorCodeInvalidObject        = "invalid_object"
+	ErrorCodeUnauthorized         = "unauthorized"
+	ErrorCodeForbidden            = "forbidden"
+	ErrorCodeNotFound             = "not_found"
+	ErrorCodeConflict             = "conflict"
+	ErrorCodeReferenced           = "referenced"
+	ErrorCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrorCodeTooLarge             = "request_too_large"
+	ErrorCodeBackendUnavailable   = "backend_unavailable"
+	ErrorCodeNotImplemented       = "not_implemented"
+	ErrorCodeInternal             = "internal_error"
+)
+
+var statusErrorCodeMap = map[int]string{
+	http.StatusBadRequest:            ErrorCodeInvalidRequest,
+	http.StatusUnauthorized:          ErrorCodeUnauthorized,
+	http.StatusForbidden:             ErrorCodeForbidden,
+	http.StatusNotFound:              ErrorCodeNotFound,
+	http.StatusConflict:              ErrorCodeConflict,
+	http.StatusUnsupportedMediaType:  ErrorCodeUnsupportedMediaType,
+	http.StatusRequestEntityTooLarge: ErrorCodeTooLarge,
+	http.StatusUnprocessableEntity:   ErrorCodeInvalidObject,
+	http.StatusNotImplemented:        ErrorCodeNotImplemented,
+	http.StatusServiceUnavailable:    ErrorCodeBackendUnavailable,
+}
+
+// Problem is the body of every error response.
+type Problem struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Status     int    `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	ErrorCode  string `json:"errorCode"`
+	ObjectCode string `json:"objectCode,omitempty"`
+	RequestID  string `json:"requestId,omitempty"`
+
+	//Extensions for some kinds of errors
+	FieldErrors     []db.FieldError `json:"fieldErrors,omitempty"`
+	References      []db.Reference  `json:"references,omitempty"`
+	OtherReferences int             `json:"otherReferences,omitempty"`
+	Current         interface{}     `json:"current,omitempty"`
+}
+
+//----------------------------------------------------------------------------------------
+// StatusErrorCode returns the error code reported by default for statusCode.
+func StatusErrorCode(statusCode int) string {
+	if errorCode, isFound := statusErrorCodeMap[statusCode]; isFound {
+		return errorCode
+	} else if statusCode >= http.StatusInternalServerError {
+		return ErrorCodeInternal
+	}
+
+	return ErrorCodeInvalidRequest
+}
+
+//----------------------------------------------------------------------------------------
+// NewProblem returns the problem with the given status, and the default error code of that
+// status.
+func NewProblem(statusCode int, detail string) *Problem {
+	return &Problem{
+		Type:      ProblemTypeDefault,
+		Title:     http.StatusText(statusCode),
+		Status:    statusCode,
+		Detail:    detail,
+		ErrorCode: StatusErrorCode(statusCode),
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// ErrorProblem returns the problem reporting err, with the status matching its kind. Invalid
+// objects come with the list of the fields in error, and objects that cannot be deleted with
+// the list of the objects referencing them.
+func ErrorProblem(err error) *Problem {
+	var notFoundErr *db.NotFoundError
+	var conflictErr *db.ConflictError
+	var invalidErr *db.InvalidObjectError
+	var referencedErr *db.ReferencedError
+
+	problem := NewProblem(ErrorStatus(err), err.Error())
+
+	if errors.As(err, &notFoundErr) {
+		problem.ObjectCode = notFoundErr.Code
+	} else if errors.As(err, &conflictErr) {
+		problem.ObjectCode = conflictErr.Code
+	} else if errors.As(err, &invalidErr) {
+		problem.FieldErrors = invalidErr.FieldErrors
+	} else if errors.As(err, &referencedErr) {
+		problem.ErrorCode = ErrorCodeReferenced
+		problem.ObjectCode = referencedErr.Code
+		problem.References = referencedErr.References
+		problem.OtherReferences = referencedErr.OtherReferences
+	}
+
+	return problem
+}
+
+//----------------------------------------------------------------------------------------
+// WriteProblem writes problem as the response, along with the id of the request set by
+// RequestIDMiddleware.
+func WriteProblem(write *http.ResponseWriter, problem *Problem) {
+	problem.RequestID = (*write).Header().Get(RequestIDHeader)
+	if problem.Status >= http.StatusInternalServerError {
+		log.Printf("Request %s failed with status %d. Error: %s", problem.RequestID, problem.Status, problem.Detail)
+	}
+
+	out, err := json.Marshal(problem)
+	if err != nil {
+		log.Printf("Cannot marshal the problem reported for request %s. Error: %v", problem.RequestID, err)
+
+		problem = &Problem{Type: problem.Type, Title: problem.Title, Status: problem.Status, Detail: problem.Detail, ErrorCode: problem.ErrorCode, ObjectCode: problem.ObjectCode, RequestID: problem.RequestID}
+		out, _ = json.Marshal(problem)
+	}
+
+	(*write).Header().Set(ContentType, ContentTypeProblemJSON)
+	(*write).WriteHeader(problem.Status)
+	(*write).Write(out)
+}
@@ -0,0 +1,78 @@
+package api_util
+
+import (
+	"colmanback/db"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorProblem(t *testing.T) {
+	problemList := []struct {
+		err        error
+		status     int
+		errorCode  string
+		objectCode string
+	}{
+		{&db.NotFoundError{TableName: "airline", Code: "iata:BA"}, http.StatusNotFound, ErrorCodeNotFound, "iata:BA"},
+		{&db.ConflictError{TableName: "airline", Code: "iata:BA", Version: 2}, http.StatusConflict, ErrorCodeConflict, "iata:BA"},
+		{&db.ReferencedError{TableName: "country", Code: "gb"}, http.StatusConflict, ErrorCodeReferenced, "gb"},
+		{&db.ValidationError{Message: "bad request"}, http.StatusBadRequest, ErrorCodeInvalidRequest, ""},
+		{&db.InvalidObjectError{FieldErrors: []db.FieldError{{Field: "name", Message: "required"}}}, http.StatusUnprocessableEntity, ErrorCodeInvalidObject, ""},
+		{&db.BackendError{Operation: "scan", Resource: "airline", Err: errors.New("down")}, http.StatusServiceUnavailable, ErrorCodeBackendUnavailable, ""},
+		{errors.New("unexpected"), http.StatusInternalServerError, ErrorCodeInternal, ""},
+	}
+
+	for _, problemInst := range problemList {
+		problem := ErrorProblem(problemInst.err)
+		if problem.Status != problemInst.status || problem.ErrorCode != problemInst.errorCode || problem.ObjectCode != problemInst.objectCode {
+			t.Errorf("Unexpected problem for %v: %+v", problemInst.err, problem)
+		}
+
+		if problem.Type != ProblemTypeDefault || problem.Title != http.StatusText(problemInst.status) || problem.Detail != problemInst.err.Error() {
+			t.Errorf("Unexpected standard members for %v: %+v", problemInst.err, problem)
+		}
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	var problem Problem
+
+	handler := RequestIDMiddleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		WriteMsg(&writer, http.StatusBadRequest, "The request was malformed.")
+	}))
+
+	t.Log("Error messages are written as problems carrying the id of the request")
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "client-id-1")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest || resp.Header().Get(ContentType) != ContentTypeProblemJSON {
+		t.Errorf("Unexpected status %d or content type %s", resp.Code, resp.Header().Get(ContentType))
+	}
+
+	if err := json.Unmarshal(resp.Body.Bytes(), &problem); err != nil || problem.RequestID != "client-id-1" || problem.ErrorCode != ErrorCodeInvalidRequest {
+		t.Errorf("Unexpected problem %s. Error: %v", resp.Body.String(), err)
+	}
+
+	t.Log("A request id that could break the logs is replaced")
+	req.Header.Set(RequestIDHeader, "bad id\nforged log line")
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if requestID := resp.Header().Get(RequestIDHeader); requestID == "" || requestID == req.Header.Get(RequestIDHeader) {
+		t.Errorf("Unexpected request id %q", requestID)
+	}
+
+	t.Log("Other messages are written as plain JSON")
+	resp = httptest.NewRecorder()
+	writer := http.ResponseWriter(resp)
+	WriteMsg(&writer, http.StatusOK, "Object deleted")
+
+	if resp.Header().Get(ContentType) != ContentTypeAppJSON {
+		t.Errorf("Unexpected content type %s", resp.Header().Get(ContentType))
+	}
+}
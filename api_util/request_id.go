@@ -0,0 +1,30 @@
+package api_util
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+)
+
+// Request ids sent by clients are kept if they are short and cannot break the logs.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+//----------------------------------------------------------------------------------------
+// RequestIDMiddleware sets the X-Request-ID header of every response to the id sent by the
+// client or, failing that, to a new one. Problems written for the request report it too.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requestID := request.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		writer.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(writer, request)
+	})
+}
@@ -4,10 +4,14 @@ import (
 	"colmanback/db"
 	"colmanback/objects"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -16,22 +20,54 @@ const (
 	ContentType          = "Content-Type"
 	ContentTypeAppJSON   = "application/json"
 	ResponseMessageField = "message"
+
+	CascadeParam    = "cascade"
+	ReassignToParam = "reassignTo"
+	ExpandParam     = "expand"
 )
 
 type GenAPI[K objects.Object] struct {
-	ObjectID string
-	ApiURL   string
-	BaseURL  string
+	ObjectID  string
+	ApiURL    string
+	BaseURL   string
+	TableName string
 
 	Constructor         func() K
 	GetObjectByCode     func(objectID string) (K, error)
 	GetObjectList       func() ([]K, error)
 	GetObjectListByCode func(objectID string) ([]K, error)
 	DeleteObjectByCode  func(objectID string) error
+
+	// Expand attaches the details of the references named in its field list to copies of the
+	// objects. When it is set, the expand parameter of Get and GetList picks any of
+	// ExpandFields, e.g. expand=airline,modelMake; an empty value leaves all details out.
+	// ExpandByDefault attaches all of ExpandFields to the listed objects when the parameter is
+	// not given. The details are only fetched for the page returned.
+	Expand          func(objectList []K, fieldList []string) ([]K, error)
+	ExpandFields    []string
+	ExpandByDefault bool
+
+	// Scope, when set, returns the copy of the API that serves a request, so that the functions
+	// above can depend on the caller, e.g. to only reach the objects of their collection.
+	// Prepare, when set, sets the fields that the server rather than the client decides on
+	// every object stored by Put or Patch.
+	Scope   func(request *http.Request) *GenAPI[K]
+	Prepare func(objectInst K)
+}
+
+//----------------------------------------------------------------------------------------
+// scoped returns the API serving request.
+func (apiInst *GenAPI[K]) scoped(request *http.Request) *GenAPI[K] {
+	if apiInst.Scope == nil {
+		return apiInst
+	}
+
+	return apiInst.Scope(request)
 }
 
 //----------------------------------------------------------------------------------------
 func (apiInst *GenAPI[K]) Get(writer http.ResponseWriter, request *http.Request) {
+	apiInst = apiInst.scoped(request)
 	SetupCORSResponse(&writer)
 
 	pathParams := mux.Vars(request)
@@ -40,12 +76,20 @@ func (apiInst *GenAPI[K]) Get(writer http.ResponseWriter, request *http.Request)
 		if unscapeError == nil {
 			objectInst, getErr := apiInst.GetObjectByCode(objectIDUnscaped)
 			if getErr == nil && objectInst.CodeValue() != "" {
-				WriteObject(objectInst, writer, request)
+				objectInstList, expandErr := apiInst.expand([]K{objectInst}, request)
+				if expandErr != nil {
+					WriteError(&writer, expandErr)
+					return
+				}
+
+				WriteObject(objectInstList[0], writer, request)
+			} else if getErr == nil || errors.Is(getErr, db.ErrNotFound) {
+				WriteError(&writer, &db.NotFoundError{TableName: apiInst.TableName, Code: objectIDUnscaped})
 			} else {
-				WriteMsg(&writer, http.StatusNotFound, fmt.Sprintf("%s with code %s not found", apiInst.ObjectID, objectIDUnscaped))
+				WriteError(&writer, getErr)
 			}
 		} else {
-			WriteMsg(&writer, http.StatusInternalServerError, fmt.Sprintf("Error %v", unscapeError))
+			WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("Error %v", unscapeError))
 		}
 	} else {
 		WriteMsg(&writer, http.StatusNotImplemented, "This kind of get is not supported without parameters.")
@@ -53,10 +97,13 @@ func (apiInst *GenAPI[K]) Get(writer http.ResponseWriter, request *http.Request)
 }
 
 //----------------------------------------------------------------------------------------
+// GetList supports filtering, sorting and pagination through the parameters described in
+// list.go. Without them, the whole list is returned sorted by code.
 func (apiInst *GenAPI[K]) GetList(writer http.ResponseWriter, request *http.Request) {
 	var objectInstList []K
 	var getErr error
 
+	apiInst = apiInst.scoped(request)
 	SetupCORSResponse(&writer)
 
 	pathParams := mux.Vars(request)
@@ -66,42 +113,305 @@ func (apiInst *GenAPI[K]) GetList(writer http.ResponseWriter, request *http.Requ
 		objectInstList, getErr = apiInst.GetObjectList()
 	}
 
-	if getErr == nil {
-		apiInst.WriteObjectList(objectInstList, writer, request)
-	} else {
-		WriteMsg(&writer, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", getErr))
+	if getErr != nil {
+		WriteError(&writer, getErr)
+		return
 	}
+
+	query, queryErr := parseListQuery[K](request.URL.Query())
+	if queryErr != nil {
+		WriteError(&writer, queryErr)
+		return
+	}
+
+	objectInstList, nextCursor, queryErr := applyListQuery(query, objectInstList)
+	if queryErr == nil {
+		objectInstList, queryErr = apiInst.expand(objectInstList, request)
+	}
+
+	if queryErr != nil {
+		WriteError(&writer, queryErr)
+		return
+	}
+
+	setNextPageHeaders(writer, request, nextCursor)
+	apiInst.WriteObjectList(objectInstList, writer, request)
+}
+
+//----------------------------------------------------------------------------------------
+// expand attaches the details asked for by the expand parameter of request to copies of the
+// objects of objectInstList. Without the parameter, the objects are returned as they are,
+// unless ExpandByDefault is set.
+func (apiInst *GenAPI[K]) expand(objectInstList []K, request *http.Request) ([]K, error) {
+	queryValues := request.URL.Query()
+	if _, isSet := queryValues[ExpandParam]; !isSet {
+		if apiInst.ExpandByDefault {
+			return apiInst.Expand(objectInstList, apiInst.ExpandFields)
+		}
+
+		return objectInstList, nil
+	}
+
+	if apiInst.Expand == nil {
+		return nil, &db.ValidationError{Message: fmt.Sprintf("%s is not supported for %s", ExpandParam, apiInst.ObjectID)}
+	}
+
+	fieldList := []string{}
+	for _, field := range strings.Split(queryValues.Get(ExpandParam), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if !db.IsExpanded(apiInst.ExpandFields, field) {
+			return nil, &db.ValidationError{Message: fmt.Sprintf("%s cannot be expanded. Expected any of %s", field, strings.Join(apiInst.ExpandFields, ", "))}
+		}
+
+		fieldList = append(fieldList, field)
+	}
+
+	return apiInst.Expand(objectInstList, fieldList)
 }
 
 //----------------------------------------------------------------------------------------
 func (apiInst *GenAPI[K]) Put(writer http.ResponseWriter, request *http.Request) {
+	apiInst = apiInst.scoped(request)
 	objectInst := apiInst.Constructor()
 
 	SetupCORSResponse(&writer)
-	err := json.NewDecoder(request.Body).Decode(objectInst)
+	objectJson, err := io.ReadAll(request.Body)
+	if err != nil {
+		WriteBodyError(&writer, request, "The request body could not be read.", err)
+		return
+	}
 
+	err = objectInst.FromJson(objectJson)
 	if err != nil {
-		writer.WriteHeader(http.StatusBadRequest)
+		WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("The request body could not be decoded. Error: %v", err))
+		return
+	}
+
+	apiInst.putObject(objectInst, writer, request)
+}
+
+//----------------------------------------------------------------------------------------
+// Patch updates the object with the code in the path using a JSON merge patch (RFC 7386) or,
+// when sent as application/json-patch+json, a JSON patch (RFC 6902). The patch is applied to
+// the current copy of the object, so fields it does not mention are kept. Its version is kept
+// too unless the patch sets one, which makes the update fail with a conflict if the object
+// has changed since that version was read.
+func (apiInst *GenAPI[K]) Patch(writer http.ResponseWriter, request *http.Request) {
+	apiInst = apiInst.scoped(request)
+	SetupCORSResponse(&writer)
+	writer.Header().Set(AcceptPatchHeader, ContentTypeMergePatch+", "+ContentTypeJSONPatch)
+
+	pathParams := mux.Vars(request)
+	objectID, ok := pathParams[apiInst.ObjectID]
+	if !ok {
+		WriteMsg(&writer, http.StatusNotFound, "Object resource not found / an error has been produced.")
+		return
+	}
+
+	objectIDUnscaped, unscapeError := url.QueryUnescape(objectID)
+	if unscapeError != nil {
+		WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("Error %v", unscapeError))
+		return
 	}
 
-	objectInst.Put()
-	objectInst.WriteObject(writer, request)
+	isJSONPatch := false
+	if contentType := request.Header.Get(ContentType); contentType != "" {
+		mediaType, _, parseErr := mime.ParseMediaType(contentType)
+		if parseErr != nil || (mediaType != ContentTypeMergePatch && mediaType != ContentTypeJSONPatch && mediaType != ContentTypeAppJSON) {
+			WriteMsg(&writer, http.StatusUnsupportedMediaType, fmt.Sprintf("Patches must be sent as %s or %s", ContentTypeMergePatch, ContentTypeJSONPatch))
+			return
+		}
+
+		isJSONPatch = mediaType == ContentTypeJSONPatch
+	}
+
+	patchJson, readErr := io.ReadAll(request.Body)
+	if readErr != nil {
+		WriteBodyError(&writer, request, "The request body could not be read.", readErr)
+		return
+	}
+
+	currentInst, getErr := apiInst.GetObjectByCode(objectIDUnscaped)
+	if (getErr == nil && currentInst.CodeValue() == "") || errors.Is(getErr, db.ErrNotFound) {
+		WriteError(&writer, &db.NotFoundError{TableName: apiInst.TableName, Code: objectIDUnscaped})
+		return
+	} else if getErr != nil {
+		WriteError(&writer, getErr)
+		return
+	}
+
+	objectInst, patchErr := apiInst.applyPatch(currentInst, patchJson, isJSONPatch)
+	if patchErr != nil {
+		WriteError(&writer, patchErr)
+		return
+	}
+
+	apiInst.putObject(objectInst, writer, request)
 }
 
 //----------------------------------------------------------------------------------------
+// applyPatch returns a new object holding currentInst with the patch applied. currentInst
+// itself is left untouched, as it may be shared with the cache of the adapter.
+func (apiInst *GenAPI[K]) applyPatch(currentInst K, patchJson []byte, isJSONPatch bool) (K, error) {
+	var patchedJson []byte
+	objectInst := apiInst.Constructor()
+
+	currentJson, err := json.Marshal(currentInst)
+	if err != nil {
+		return objectInst, err
+	}
+
+	document, err := decodeDocument(currentJson)
+	if err != nil {
+		return objectInst, err
+	}
+
+	if isJSONPatch {
+		document, err = applyJSONPatch(document, patchJson)
+	} else {
+		var patch interface{}
+
+		patch, err = decodeDocument(patchJson)
+		if err != nil {
+			return objectInst, &db.ValidationError{Message: "the merge patch could not be decoded", Err: err}
+		}
+
+		document = applyMergePatch(document, patch)
+	}
+
+	if err == nil {
+		patchedJson, err = json.Marshal(document)
+	}
+
+	// Decoded as the body of a put would be, so that the object is normalised the same way.
+	if err == nil {
+		err = objectInst.FromJson(patchedJson)
+		if err != nil {
+			err = &db.ValidationError{Message: "the patched object is not valid", Err: err}
+		}
+	}
+
+	if err == nil && objectInst.CodeValue() != currentInst.CodeValue() {
+		err = &db.ValidationError{Message: fmt.Sprintf("the code of %s cannot be changed by a patch", currentInst.CodeValue())}
+	}
+
+	return objectInst, err
+}
+
+//----------------------------------------------------------------------------------------
+// putObject validates objectInst, if it knows how to, before storing it.
+func (apiInst *GenAPI[K]) putObject(objectInst K, writer http.ResponseWriter, request *http.Request) {
+	var conflictErr *db.ConflictError
+
+	if apiInst.Prepare != nil {
+		apiInst.Prepare(objectInst)
+	}
+
+	if validator, isValidator := interface{}(objectInst).(objects.Validator); isValidator {
+		if validateErr := validator.Validate(); validateErr != nil {
+			problem := ErrorProblem(validateErr)
+			problem.ObjectCode = objectInst.CodeValue()
+			WriteProblem(&writer, problem)
+			return
+		}
+	}
+
+	putErr := objectInst.Put()
+	if errors.As(putErr, &conflictErr) {
+		apiInst.writeConflict(conflictErr, writer, request)
+	} else if putErr != nil {
+		WriteError(&writer, putErr)
+	} else {
+		objectInst.WriteObject(writer, request)
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// writeConflict returns the copy held by the server as the current member of the problem, so
+// that the client can merge its changes and retry with the current version.
+func (apiInst *GenAPI[K]) writeConflict(conflictErr *db.ConflictError, writer http.ResponseWriter, request *http.Request) {
+	problem := ErrorProblem(conflictErr)
+
+	serverInst, getErr := apiInst.GetObjectByCode(conflictErr.Code)
+	if getErr == nil && serverInst.CodeValue() != "" {
+		problem.Current = serverInst
+	}
+
+	WriteProblem(&writer, problem)
+}
+
+//----------------------------------------------------------------------------------------
+// Delete refuses with 409 and the list of referencing objects to delete an object that
+// others still reference, unless cascade=true deletes them as well or reassignTo=<code> makes
+// them reference another object.
 func (apiInst *GenAPI[K]) Delete(writer http.ResponseWriter, request *http.Request) {
+	var options db.DeleteOptions
+
+	apiInst = apiInst.scoped(request)
 	pathParams := mux.Vars(request)
 	if objectID, ok := pathParams[apiInst.ObjectID]; ok {
-		apiInst.DeleteObjectByCode(objectID)
-		WriteMsg(&writer, http.StatusOK, "Object with code "+objectID+" deleted")
+		objectIDUnscaped, unscapeError := url.QueryUnescape(objectID)
+		if unscapeError != nil {
+			WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("Error %v", unscapeError))
+			return
+		}
+
+		if cascadeParam := request.URL.Query().Get(CascadeParam); cascadeParam != "" {
+			cascade, parseErr := strconv.ParseBool(cascadeParam)
+			if parseErr != nil {
+				WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("%s must be true or false", CascadeParam))
+				return
+			}
+
+			options.Cascade = cascade
+		}
+
+		options.Owner = CollectionOwner(request)
+		options.ReassignTo = request.URL.Query().Get(ReassignToParam)
+		if options.ReassignTo != "" {
+			checkErr := apiInst.checkReassignTo(objectIDUnscaped, options)
+			if checkErr != nil {
+				WriteError(&writer, checkErr)
+				return
+			}
+		}
+
+		deleteErr := db.DeleteReferenced(apiInst.TableName, objectIDUnscaped, options, apiInst.DeleteObjectByCode)
+		if deleteErr != nil {
+			WriteError(&writer, deleteErr)
+		} else {
+			WriteMsg(&writer, http.StatusOK, "Object with code "+objectIDUnscaped+" deleted")
+		}
 	} else {
 		WriteMsg(&writer, http.StatusNotFound, "Object resource not found / an error has been produced.")
 	}
 }
 
+//----------------------------------------------------------------------------------------
+func (apiInst *GenAPI[K]) checkReassignTo(objectID string, options db.DeleteOptions) error {
+	if options.Cascade {
+		return &db.ValidationError{Message: fmt.Sprintf("%s and %s cannot be used together", CascadeParam, ReassignToParam)}
+	}
+
+	if options.ReassignTo == objectID {
+		return &db.ValidationError{Message: fmt.Sprintf("references to %s cannot be reassigned to itself", objectID)}
+	}
+
+	targetInst, getErr := apiInst.GetObjectByCode(options.ReassignTo)
+	if (getErr == nil && targetInst.CodeValue() == "") || errors.Is(getErr, db.ErrNotFound) {
+		return &db.InvalidObjectError{FieldErrors: []db.FieldError{{Field: ReassignToParam, Message: fmt.Sprintf("no object with code %s exists", options.ReassignTo)}}}
+	}
+
+	return getErr
+}
+
 //----------------------------------------------------------------------------------------
 func (apiInst *GenAPI[K]) WriteObjectList(objectInstList []K, writer http.ResponseWriter, request *http.Request) {
-	var concreteObjectList []objects.Object
+	concreteObjectList := make([]objects.Object, 0, len(objectInstList))
 
 	for _, objectInst := range objectInstList {
 		concreteObjectList = append(concreteObjectList, objectInst)
@@ -113,14 +423,47 @@ func (apiInst *GenAPI[K]) WriteObjectList(objectInstList []K, writer http.Respon
 //----------------------------------------------------------------------------------------
 func SetupCORSResponse(writer *http.ResponseWriter) {
 	(*writer).Header().Set("Access-Control-Allow-Origin", "*")
-	(*writer).Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, DELETE, OPTIONS")
-	(*writer).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Authorization")
+	(*writer).Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, PATCH, DELETE, OPTIONS")
+	(*writer).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Authorization, X-API-Key")
+	(*writer).Header().Set("Access-Control-Expose-Headers", NextCursorHeader+", "+LinkHeader+", "+RequestIDHeader)
+}
+
+//----------------------------------------------------------------------------------------
+// ErrorStatus maps the error kinds reported by the data layer onto HTTP status codes.
+func ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, db.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, db.ErrInvalidObject):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, db.ErrBackendUnavailable):
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
 }
 
 //----------------------------------------------------------------------------------------
+// WriteError reports err as a problem with the status matching its kind.
+func WriteError(write *http.ResponseWriter, err error) {
+	WriteProblem(write, ErrorProblem(err))
+}
+
+//----------------------------------------------------------------------------------------
+// WriteMsg writes message as the response. Error statuses are reported as a problem with
+// message as its detail.
 func WriteMsg(write *http.ResponseWriter, statusCode int, message string) {
-	(*write).WriteHeader(statusCode)
+	if statusCode >= http.StatusBadRequest {
+		WriteProblem(write, NewProblem(statusCode, message))
+		return
+	}
+
 	(*write).Header().Set(ContentType, ContentTypeAppJSON)
+	(*write).WriteHeader(statusCode)
 
 	responseMap := make(map[string]string)
 	responseMap[ResponseMessageField] = message
@@ -130,34 +473,41 @@ func WriteMsg(write *http.ResponseWriter, statusCode int, message string) {
 
 //----------------------------------------------------------------------------------------
 func WriteObject(objectInst objects.Object, writer http.ResponseWriter, request *http.Request) {
-	out, err := json.MarshalIndent(objectInst, db.JSON_PREFIX, db.JSON_INDENT)
+	WriteObjectStatus(objectInst, http.StatusOK, writer, request)
+}
 
+//----------------------------------------------------------------------------------------
+// WriteObjectStatus writes objectInst as the response with statusCode. If it cannot be
+// marshalled, a problem is reported instead.
+func WriteObjectStatus(objectInst objects.Object, statusCode int, writer http.ResponseWriter, request *http.Request) {
+	SetupCORSResponse(&writer)
+
+	out, err := json.MarshalIndent(objectInst, db.JSON_PREFIX, db.JSON_INDENT)
 	if err != nil {
-		log.Panicf("Write Object failed for instance: %s\n", objectInst.ToString())
+		WriteError(&writer, fmt.Errorf("write object failed. Error: %v", err))
+		return
 	}
 
-	SetupCORSResponse(&writer)
-	if out != nil {
-		writer.Header().Set("Content-Type", "application/json")
-		writer.Write(out)
-	} else {
-		writer.WriteHeader(http.StatusInternalServerError)
-	}
+	writer.Header().Set(ContentType, ContentTypeAppJSON)
+	writer.WriteHeader(statusCode)
+	writer.Write(out)
 }
 
 //----------------------------------------------------------------------------------------
 func WriteObjectList(objectInstList []objects.Object, writer http.ResponseWriter, request *http.Request) {
-	out, err := json.MarshalIndent(objectInstList, db.JSON_PREFIX, db.JSON_INDENT)
+	SetupCORSResponse(&writer)
 
-	if err != nil {
-		log.Fatalf("Got error when trying to return object list %s", err)
+	// An empty list is written as [] rather than null.
+	if objectInstList == nil {
+		objectInstList = []objects.Object{}
 	}
 
-	SetupCORSResponse(&writer)
-	if out != nil {
-		writer.Header().Set("Content-Type", "application/json")
-		writer.Write(out)
-	} else {
-		writer.WriteHeader(http.StatusInternalServerError)
+	out, err := json.MarshalIndent(objectInstList, db.JSON_PREFIX, db.JSON_INDENT)
+	if err != nil {
+		WriteError(&writer, fmt.Errorf("got error when trying to return object list. Error: %v", err))
+		return
 	}
+
+	writer.Header().Set(ContentType, ContentTypeAppJSON)
+	writer.Write(out)
 }
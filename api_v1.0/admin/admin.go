@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"colmanback/api_util"
+	"colmanback/db"
+	"colmanback/objects"
+	"colmanback/objects/airline"
+	"colmanback/objects/airplane"
+	"colmanback/objects/airplanemake"
+	"colmanback/objects/model"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	ApiURL        = "/api/v1/admin"
+	BrokenRefsURL = "/broken-refs"
+)
+
+// BrokenRefReport lists the references of an object to objects that do not exist.
+type BrokenRefReport struct {
+	TableName  string         `json:"table"`
+	Code       string         `json:"code"`
+	BrokenRefs []db.Reference `json:"brokenRefs"`
+}
+
+//----------------------------------------------------------------------------------------
+func addReports[K objects.Object](reportList []BrokenRefReport, tableName string, getBrokenRefList func() ([]K, error), brokenRefs func(K) []db.Reference) ([]BrokenRefReport, error) {
+	objectList, err := getBrokenRefList()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, objectInst := range objectList {
+		reportList = append(reportList, BrokenRefReport{TableName: tableName, Code: objectInst.CodeValue(), BrokenRefs: brokenRefs(objectInst)})
+	}
+
+	return reportList, nil
+}
+
+//----------------------------------------------------------------------------------------
+// GetBrokenRefReports returns every object holding a reference to an object that does not
+// exist, table by table. Of the models, only those of the collection of owner are reported.
+func GetBrokenRefReports(owner string) ([]BrokenRefReport, error) {
+	var err error
+	reportList := []BrokenRefReport{}
+
+	reportList, err = addReports(reportList, airline.TABLE_NAME, airline.GetBrokenRefList, func(airlineInst *airline.Airline) []db.Reference { return airlineInst.BrokenRefs })
+	if err == nil {
+		reportList, err = addReports(reportList, airplanemake.TABLE_NAME, airplanemake.GetBrokenRefList, func(airplaneMakeInst *airplanemake.AirplaneMake) []db.Reference { return airplaneMakeInst.BrokenRefs })
+	}
+	if err == nil {
+		reportList, err = addReports(reportList, airplane.TABLE_NAME, airplane.GetBrokenRefList, func(airplaneInst *airplane.Airplane) []db.Reference { return airplaneInst.BrokenRefs })
+	}
+	if err == nil {
+		reportList, err = addReports(reportList, model.TABLE_NAME, func() ([]*model.Model, error) { return model.GetBrokenRefList(owner) }, func(modelInst *model.Model) []db.Reference { return modelInst.BrokenRefs })
+	}
+
+	return reportList, err
+}
+
+//----------------------------------------------------------------------------------------
+func handleBrokenRefs(writer http.ResponseWriter, request *http.Request) {
+	api_util.SetupCORSResponse(&writer)
+
+	reportList, err := GetBrokenRefReports(api_util.CollectionOwner(request))
+	if err != nil {
+		api_util.WriteError(&writer, err)
+		return
+	}
+
+	out, err := json.MarshalIndent(reportList, db.JSON_PREFIX, db.JSON_INDENT)
+	if err != nil {
+		api_util.WriteError(&writer, fmt.Errorf("got error when trying to return the broken references. Error: %v", err))
+		return
+	}
+
+	writer.Header().Set(api_util.ContentType, api_util.ContentTypeAppJSON)
+	writer.Write(out)
+}
+
+//----------------------------------------------------------------------------------------
+func InitRouter(router *mux.Router) {
+	subRouter := router.PathPrefix(ApiURL).Subrouter()
+
+	subRouter.HandleFunc(BrokenRefsURL, handleBrokenRefs).Methods(http.MethodGet)
+
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodGet, Path: ApiURL + BrokenRefsURL, OperationID: "listBrokenRefs", Tag: "admin",
+		Summary:      "Lists the objects referencing objects that do not exist",
+		ResponseType: reflect.TypeOf(BrokenRefReport{}), IsListResponse: true})
+}
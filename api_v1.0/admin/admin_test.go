@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"colmanback/objects"
+	"colmanback/objects/airline"
+	"colmanback/objects/airplane"
+	"colmanback/objects/airplanemake"
+	"colmanback/objects/country"
+	"colmanback/objects/model"
+	"colmanback/objects/modelmake"
+	"colmanback/test_util"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	airplaneCode  = "adminTestAirplane"
+	modelMakeCode = "adminTestModelMake"
+	missingCode   = "adminTestMissing"
+)
+
+func chkBrokenRefs(t *testing.T, router *mux.Router, expectedMap map[string]string) {
+	var reportList []BrokenRefReport
+
+	req, _ := http.NewRequest(http.MethodGet, ApiURL+BrokenRefsURL, nil)
+	resp := test_util.ExecuteRequest(router, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("Status code not as expected for the broken references. Code %d", resp.Code)
+		return
+	}
+
+	if err := json.Unmarshal(resp.Body.Bytes(), &reportList); err != nil {
+		t.Errorf("The broken references cannot be unmarshalled. Error: %v", err)
+		return
+	}
+
+	foundMap := make(map[string]string)
+	for _, report := range reportList {
+		for _, brokenRef := range report.BrokenRefs {
+			foundMap[report.TableName+"."+brokenRef.Field] = brokenRef.Code
+		}
+	}
+
+	for field, code := range expectedMap {
+		if foundMap[field] != code {
+			t.Errorf("Broken reference %s to %s not reported: %s", field, code, resp.Body.String())
+		}
+	}
+}
+
+func TestBrokenRefs(t *testing.T) {
+	router := mux.NewRouter()
+
+	test_util.InitDB()
+
+	country.InitConn()
+	airline.InitConn()
+	airplanemake.InitConn()
+	airplane.InitConn()
+	modelmake.InitConn()
+	model.InitConn()
+
+	InitRouter(router)
+
+	// Written without validation, as data loaded before the references were checked would be.
+	airplaneInst := &airplane.Airplane{Code: airplaneCode, Name: airplaneCode, Make: missingCode}
+	modelMakeInst := &modelmake.ModelMake{Code: modelMakeCode, Name: modelMakeCode}
+	modelInst := &model.Model{ModelMake: modelMakeCode, Airline: missingCode, Airplane: airplaneCode, Scale: objects.Scale1400, Reg: "AD-MIN"}
+
+	for _, objectInst := range []objects.Object{airplaneInst, modelMakeInst, modelInst} {
+		if err := objectInst.Put(); err != nil {
+			t.Fatalf("Cannot put %s. Error: %v", objectInst.CodeValue(), err)
+		}
+	}
+
+	t.Log("Models with a missing airline can still be listed")
+	modelList, err := model.GetList("")
+	if err != nil {
+		t.Errorf("The models cannot be listed. Error: %v", err)
+	}
+
+	for _, listedInst := range modelList {
+		if listedInst.Code == modelInst.Code && (len(listedInst.BrokenRefs) != 1 || listedInst.BrokenRefs[0].Code != missingCode || listedInst.AirplaneInst == nil) {
+			t.Errorf("Unexpected references for the model: %+v, airplane %v", listedInst.BrokenRefs, listedInst.AirplaneInst)
+		}
+	}
+
+	t.Log("The admin endpoint reports every broken reference")
+	chkBrokenRefs(t, router, map[string]string{"airplane.make": missingCode, "model.airline": missingCode})
+
+	t.Log("Only the models of the collection of the caller are reported")
+	otherInst := &model.Model{Owner: "bob", ModelMake: modelMakeCode, Airline: missingCode, Scale: objects.Scale1400, Reg: "AD-MIN"}
+	if err := otherInst.Put(); err != nil {
+		t.Fatalf("Cannot put %s. Error: %v", otherInst.CodeValue(), err)
+	}
+	defer otherInst.Delete()
+
+	for owner, expectedCode := range map[string]string{"": modelInst.CodeValue(), "bob": otherInst.CodeValue()} {
+		reportList, err := GetBrokenRefReports(owner)
+		modelCodeList := []string{}
+		for _, report := range reportList {
+			if report.TableName == model.TABLE_NAME {
+				modelCodeList = append(modelCodeList, report.Code)
+			}
+		}
+
+		if err != nil || len(modelCodeList) != 1 || modelCodeList[0] != expectedCode {
+			t.Errorf("Expected the broken references of %q to list model %s only, got %v. Error: %v", owner, expectedCode, modelCodeList, err)
+		}
+	}
+
+	t.Log("Broken references are reported after a put too")
+	modelInst.Notes = "updated"
+	if err := modelInst.Put(); err != nil {
+		t.Errorf("Cannot update the model. Error: %v", err)
+	} else if len(modelInst.BrokenRefs) != 1 || modelInst.AirlineInst != nil {
+		t.Errorf("Unexpected references for the model after put: %+v, airline %v", modelInst.BrokenRefs, modelInst.AirlineInst)
+	}
+
+	for _, objectInst := range []objects.Object{modelInst, modelMakeInst, airplaneInst} {
+		objectInst.Delete()
+	}
+}
@@ -24,14 +24,20 @@ func InitRouter(router *mux.Router) {
 	subRouter.HandleFunc(BaseURL, apiInst.GetList).Methods(http.MethodGet)
 	subRouter.HandleFunc(BaseURL, apiInst.Put).Methods(http.MethodPut)
 	subRouter.HandleFunc(ResourceURL, apiInst.Get).Methods(http.MethodGet)
+	subRouter.HandleFunc(ResourceURL, apiInst.Patch).Methods(http.MethodPatch)
 	subRouter.HandleFunc(ResourceURL, apiInst.Delete).Methods(http.MethodDelete)
 
 	apiInst.ApiURL = ApiURL
 	apiInst.BaseURL = BaseURL
 	apiInst.ObjectID = ObjectID
+	apiInst.TableName = airline.TABLE_NAME
 
 	apiInst.Constructor = airline.ObjectFactory
 	apiInst.GetObjectByCode = airline.GetByCode
 	apiInst.GetObjectList = airline.GetList
 	apiInst.DeleteObjectByCode = airline.AdapterInst.DeleteObjectByCode
+	apiInst.Expand = airline.Expand
+	apiInst.ExpandFields = airline.ExpandFields
+
+	apiInst.Describe(airline.TABLE_NAME, ResourceURL)
 }
@@ -1,15 +1,15 @@
 package airline
 
 import (
+	"colmanback/api_util"
 	"colmanback/db"
-	"colmanback/db/dyno"
 	"colmanback/objects/airline"
+	"colmanback/objects/country"
 	"colmanback/test_util"
+	"net/http"
 	"strings"
 	"testing"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gorilla/mux"
 )
 
@@ -51,10 +51,29 @@ func chkExists(t *testing.T, router *mux.Router, expectExists bool) {
 }
 
 func chkPut(t *testing.T, router *mux.Router, objectInst airline.Airline) {
-	jsonString := string(db.ToJson(&objectInst))
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
 	test_util.CheckPut(t, router, jsonString, ApiURL+BaseURL)
 }
 
+func chkPutConflict(t *testing.T, router *mux.Router, objectInst airline.Airline, serverVersion int64) {
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
+	test_util.CheckPutConflict(t, router, jsonString, ApiURL+BaseURL, serverVersion)
+}
+
+func chkPutInvalid(t *testing.T, router *mux.Router, jsonString string) {
+	test_util.CheckPutInvalid(t, router, jsonString, ApiURL+BaseURL)
+}
+
+func chkPatch(t *testing.T, router *mux.Router, contentType string, jsonString string, expectedCode int) {
+	test_util.CheckPatch(t, router, ApiURL+strings.Replace(ResourceURL, "{"+ObjectID+"}", codeConst, 1), contentType, jsonString, expectedCode)
+}
+
+func chkPutFieldErrors(t *testing.T, router *mux.Router, jsonString string, fieldList ...string) {
+	test_util.CheckPutFieldErrors(t, router, jsonString, ApiURL+BaseURL, fieldList...)
+}
+
 func chkList(t *testing.T, router *mux.Router) {
 	var objectList []*airline.Airline
 
@@ -76,14 +95,17 @@ func TestAirplane(t *testing.T) {
 	var newObjectInst airline.Airline = getTestInstance()
 
 	newObjectInst.Name = nameNewConst
+	newObjectInst.Version = 1
 
 	router := mux.NewRouter()
 
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+	test_util.InitDB()
+
+	country.InitConn()
+	if test_util.IsMemoryDB() {
+		country.LoadCountryList([]country.Country{{Code: countryConst, Continent: "Europe", Name: "United Kingdom"}})
+	}
 
-	dyno.Conn = dynamodb.New(sess)
 	airline.InitConn()
 
 	InitRouter(router)
@@ -106,6 +128,39 @@ func TestAirplane(t *testing.T) {
 	t.Log("Ensure the object has the expected (updated) field values")
 	chkFields(t, router, newObjectInst)
 
+	t.Log("Check that a put based on an outdated version is rejected")
+	chkPutConflict(t, router, origObjectInst, 2)
+
+	t.Log("Ensure the rejected put did not change the object")
+	chkFields(t, router, newObjectInst)
+
+	t.Log("Check that a put of a malformed document is rejected")
+	chkPutInvalid(t, router, "{\"name\": ")
+
+	t.Log("Check that a put of an airline without IATA or ICAO code is rejected")
+	chkPutFieldErrors(t, router, "{\"name\": \"No Code Airline\"}", "iata")
+
+	t.Log("Check that every invalid field of an airline is reported")
+	chkPutFieldErrors(t, router, "{\"iata\": \"xx\", \"country\": \"zz\"}", "name", "country")
+
+	t.Log("Check that a merge patch only changes the fields it mentions")
+	newObjectInst.Callsign = "patched_callsign"
+	chkPatch(t, router, api_util.ContentTypeMergePatch, "{\"callsign\": \"patched_callsign\"}", http.StatusOK)
+	chkFields(t, router, newObjectInst)
+
+	t.Log("Check that a JSON patch is applied once its test holds")
+	newObjectInst.Name = nameConst
+	chkPatch(t, router, api_util.ContentTypeJSONPatch, "[{\"op\": \"test\", \"path\": \"/name\", \"value\": \""+nameNewConst+"\"}, {\"op\": \"replace\", \"path\": \"/name\", \"value\": \""+nameConst+"\"}]", http.StatusOK)
+	chkFields(t, router, newObjectInst)
+
+	t.Log("Check that failing, outdated or invalid patches are rejected")
+	chkPatch(t, router, api_util.ContentTypeJSONPatch, "[{\"op\": \"test\", \"path\": \"/name\", \"value\": \""+nameNewConst+"\"}]", http.StatusConflict)
+	chkPatch(t, router, api_util.ContentTypeMergePatch, "{\"name\": \"outdated\", \"version\": 1}", http.StatusConflict)
+	chkPatch(t, router, api_util.ContentTypeMergePatch, "{\"code\": \"iata:other\"}", http.StatusBadRequest)
+	chkPatch(t, router, api_util.ContentTypeMergePatch, "{\"name\": ", http.StatusBadRequest)
+	chkPatch(t, router, "text/plain", "{\"name\": \"text\"}", http.StatusUnsupportedMediaType)
+	chkFields(t, router, newObjectInst)
+
 	t.Log("Ensure the full list has at least one element")
 	chkList(t, router)
 
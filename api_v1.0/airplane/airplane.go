@@ -24,14 +24,20 @@ func InitRouter(router *mux.Router) {
 	subRouter.HandleFunc(BaseURL, apiInst.GetList).Methods(http.MethodGet)
 	subRouter.HandleFunc(BaseURL, apiInst.Put).Methods(http.MethodPut)
 	subRouter.HandleFunc(ResourceURL, apiInst.Get).Methods(http.MethodGet)
+	subRouter.HandleFunc(ResourceURL, apiInst.Patch).Methods(http.MethodPatch)
 	subRouter.HandleFunc(ResourceURL, apiInst.Delete).Methods(http.MethodDelete)
 
 	apiInst.ApiURL = ApiURL
 	apiInst.BaseURL = BaseURL
 	apiInst.ObjectID = ObjectID
+	apiInst.TableName = airplane.TABLE_NAME
 
 	apiInst.Constructor = airplane.ObjectFactory
 	apiInst.GetObjectByCode = airplane.GetByCode
 	apiInst.GetObjectList = airplane.GetList
 	apiInst.DeleteObjectByCode = airplane.AdapterInst.DeleteObjectByCode
+	apiInst.Expand = airplane.Expand
+	apiInst.ExpandFields = airplane.ExpandFields
+
+	apiInst.Describe(airplane.TABLE_NAME, ResourceURL)
 }
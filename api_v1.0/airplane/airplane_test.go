@@ -2,14 +2,12 @@ package airplane
 
 import (
 	"colmanback/db"
-	"colmanback/db/dyno"
 	"colmanback/objects/airplane"
+	"colmanback/objects/airplanemake"
 	"colmanback/test_util"
 	"strings"
 	"testing"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gorilla/mux"
 )
 
@@ -48,10 +46,17 @@ func chkExists(t *testing.T, router *mux.Router, expectExists bool) {
 }
 
 func chkPut(t *testing.T, router *mux.Router, objectInst airplane.Airplane) {
-	jsonString := string(db.ToJson(&objectInst))
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
 	test_util.CheckPut(t, router, jsonString, ApiURL+BaseURL)
 }
 
+func chkPutConflict(t *testing.T, router *mux.Router, objectInst airplane.Airplane, serverVersion int64) {
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
+	test_util.CheckPutConflict(t, router, jsonString, ApiURL+BaseURL, serverVersion)
+}
+
 func chkList(t *testing.T, router *mux.Router) {
 	var objectList []*airplane.Airplane
 
@@ -73,14 +78,17 @@ func TestAirplane(t *testing.T) {
 	var newObjectInst airplane.Airplane = getTestInstance()
 
 	newObjectInst.Name = nameNewConst
+	newObjectInst.Version = 1
 
 	router := mux.NewRouter()
 
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+	test_util.InitDB()
+
+	airplanemake.InitConn()
+	if test_util.IsMemoryDB() {
+		airplanemake.LoadList([]airplanemake.AirplaneMake{{Code: makeConst, Name: makeConst}})
+	}
 
-	dyno.Conn = dynamodb.New(sess)
 	airplane.InitConn()
 
 	InitRouter(router)
@@ -103,6 +111,15 @@ func TestAirplane(t *testing.T) {
 	t.Log("Ensure the object has the expected (updated) field values")
 	chkFields(t, router, newObjectInst)
 
+	t.Log("Check that a put based on an outdated version is rejected")
+	chkPutConflict(t, router, origObjectInst, 2)
+
+	t.Log("Ensure the rejected put did not change the object")
+	chkFields(t, router, newObjectInst)
+
+	t.Log("Check that an airplane with an unknown make is rejected")
+	test_util.CheckPutFieldErrors(t, router, "{\"code\": \"iata:unknown_make\", \"name\": \"Unknown Make\", \"make\": \"no_such_make\"}", ApiURL+BaseURL, "make")
+
 	t.Log("Ensure the full list has at least one element")
 	chkList(t, router)
 
@@ -24,14 +24,20 @@ func InitRouter(router *mux.Router) {
 	subRouter.HandleFunc(BaseURL, apiInst.GetList).Methods(http.MethodGet)
 	subRouter.HandleFunc(BaseURL, apiInst.Put).Methods(http.MethodPut)
 	subRouter.HandleFunc(ResourceURL, apiInst.Get).Methods(http.MethodGet)
+	subRouter.HandleFunc(ResourceURL, apiInst.Patch).Methods(http.MethodPatch)
 	subRouter.HandleFunc(ResourceURL, apiInst.Delete).Methods(http.MethodDelete)
 
 	apiInst.ApiURL = ApiURL
 	apiInst.BaseURL = BaseURL
 	apiInst.ObjectID = ObjectID
+	apiInst.TableName = airplanemake.TABLE_NAME
 
 	apiInst.Constructor = airplanemake.ObjectFactory
 	apiInst.GetObjectByCode = airplanemake.GetByCode
 	apiInst.GetObjectList = airplanemake.GetList
 	apiInst.DeleteObjectByCode = airplanemake.AdapterInst.DeleteObjectByCode
+	apiInst.Expand = airplanemake.Expand
+	apiInst.ExpandFields = airplanemake.ExpandFields
+
+	apiInst.Describe(airplanemake.TABLE_NAME, ResourceURL)
 }
@@ -2,14 +2,12 @@ package airplanemake
 
 import (
 	"colmanback/db"
-	"colmanback/db/dyno"
 	"colmanback/objects/airplanemake"
+	"colmanback/objects/country"
 	"colmanback/test_util"
 	"strings"
 	"testing"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gorilla/mux"
 )
 
@@ -45,10 +43,17 @@ func chkExists(t *testing.T, router *mux.Router, expectExists bool) {
 }
 
 func chkPut(t *testing.T, router *mux.Router, objectInst airplanemake.AirplaneMake) {
-	jsonString := string(db.ToJson(&objectInst))
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
 	test_util.CheckPut(t, router, jsonString, ApiURL+BaseURL)
 }
 
+func chkPutConflict(t *testing.T, router *mux.Router, objectInst airplanemake.AirplaneMake, serverVersion int64) {
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
+	test_util.CheckPutConflict(t, router, jsonString, ApiURL+BaseURL, serverVersion)
+}
+
 func chkList(t *testing.T, router *mux.Router) {
 	var objectList []*airplanemake.AirplaneMake
 
@@ -70,14 +75,17 @@ func TestAirplaneMake(t *testing.T) {
 	var newObjectInst airplanemake.AirplaneMake = getTestInstance()
 
 	newObjectInst.Name = nameNewConst
+	newObjectInst.Version = 1
 
 	router := mux.NewRouter()
 
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+	test_util.InitDB()
+
+	country.InitConn()
+	if test_util.IsMemoryDB() {
+		country.LoadCountryList([]country.Country{{Code: countryConst, Continent: "Europe", Name: "Russia"}})
+	}
 
-	dyno.Conn = dynamodb.New(sess)
 	airplanemake.InitConn()
 
 	InitRouter(router)
@@ -100,6 +108,12 @@ func TestAirplaneMake(t *testing.T) {
 	t.Log("Ensure the object has the expected (updated) field values")
 	chkFields(t, router, newObjectInst)
 
+	t.Log("Check that a put based on an outdated version is rejected")
+	chkPutConflict(t, router, origObjectInst, 2)
+
+	t.Log("Ensure the rejected put did not change the object")
+	chkFields(t, router, newObjectInst)
+
 	t.Log("Ensure the full list has at least one element")
 	chkList(t, router)
 
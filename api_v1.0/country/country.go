@@ -27,7 +27,10 @@ func InitRouter(router *mux.Router) {
 	apiInst.ApiURL = ApiURL
 	apiInst.BaseURL = BaseURL
 	apiInst.ObjectID = ObjectID
+	apiInst.TableName = country.TABLE_NAME
 
 	apiInst.GetObjectByCode = country.GetCountryByISO
 	apiInst.GetObjectList = country.GetCountryList
+
+	apiInst.Describe(country.TABLE_NAME, ResourceURL)
 }
@@ -1,7 +1,6 @@
 package country
 
 import (
-	"colmanback/db/dyno"
 	"colmanback/objects/country"
 	"colmanback/test_util"
 	"encoding/json"
@@ -9,8 +8,6 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gorilla/mux"
 )
 
@@ -21,6 +18,21 @@ const (
 	countryName      = "China"
 )
 
+// Countries loaded into the in-memory adapter, which starts empty.
+var memoryCountryList = []country.Country{
+	{Code: countryISO, Continent: countryContinent, Name: countryName},
+	{Code: "fr", Continent: "Europe", Name: "France"},
+	{Code: "gb", Continent: "Europe", Name: "United Kingdom"},
+}
+
+func expectedCountryCount() int {
+	if test_util.IsMemoryDB() {
+		return len(memoryCountryList)
+	}
+
+	return countryCount
+}
+
 func chkSingleCountry(t *testing.T, router *mux.Router) {
 	req, err := http.NewRequest(http.MethodGet, ApiURL+strings.Replace(ResourceURL, "{"+ObjectID+"}", countryISO, 1), nil)
 	var countryInst country.Country
@@ -60,23 +72,36 @@ func chkListCountry(t *testing.T, router *mux.Router) {
 				t.Errorf("An error has occurred whilst unmarshalling the list of countries: %v", unmarshallErr)
 			} else {
 				countryNumber := len(countryList)
-				if countryNumber != countryCount {
-					t.Errorf("Expected %d countries in the list but got %d", countryCount, countryNumber)
+				if countryNumber != expectedCountryCount() {
+					t.Errorf("Expected %d countries in the list but got %d", expectedCountryCount(), countryNumber)
 				}
 			}
 		}
 	}
 }
 
+func chkMissingCountry(t *testing.T, router *mux.Router) {
+	req, _ := http.NewRequest(http.MethodGet, ApiURL+strings.Replace(ResourceURL, "{"+ObjectID+"}", "zz", 1), nil)
+
+	resp := test_util.ExecuteRequest(router, req)
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing country, got %d", http.StatusNotFound, resp.Code)
+	}
+
+	if !strings.Contains(resp.Body.String(), "not found in table "+country.TABLE_NAME) {
+		t.Errorf("Expected the missing country to be reported in table %s, got %s", country.TABLE_NAME, resp.Body.String())
+	}
+}
+
 func TestCountry(t *testing.T) {
 	router := mux.NewRouter()
 
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+	test_util.InitDB()
 
-	dyno.Conn = dynamodb.New(sess)
 	country.InitConn()
+	if test_util.IsMemoryDB() {
+		country.LoadCountryList(memoryCountryList)
+	}
 
 	InitRouter(router)
 
@@ -85,4 +110,7 @@ func TestCountry(t *testing.T) {
 
 	t.Log("Ensure the list of countries can he retrieved")
 	chkListCountry(t, router)
+
+	t.Log("Ensure a missing country is reported with its table")
+	chkMissingCountry(t, router)
 }
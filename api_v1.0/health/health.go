@@ -0,0 +1,269 @@
+package health
+
+import (
+	"colmanback/api_util"
+	"colmanback/db"
+	"colmanback/objects/airline"
+	"colmanback/objects/airplane"
+	"colmanback/objects/airplanemake"
+	"colmanback/objects/country"
+	"colmanback/objects/model"
+	"colmanback/objects/modelmake"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	HealthURL = "/healthz"
+	ReadyURL  = "/readyz"
+	StatusURL = "/debug/status"
+
+	STATUS_OK          = "ok"
+	STATUS_UNAVAILABLE = "unavailable"
+	STATUS_FAILED      = "failed"
+)
+
+// Version is the version of the build, set with
+// -ldflags "-X colmanback/api_v1.0/health.Version=1.2.3".
+var Version = "dev"
+
+var startTime = time.Now()
+
+// readyInst holds the *readiness published by SetReady. The adapters of the object packages
+// are written by another goroutine while the server starts, so the checks only read them
+// through the snapshot stored along with the flag, never through the package variables.
+var readyInst atomic.Value
+
+// Check is the result of checking one of the resources the server depends on.
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report is the body of the liveness and readiness responses.
+type Report struct {
+	Status string  `json:"status"`
+	Checks []Check `json:"checks,omitempty"`
+}
+
+type SearchIndexStatus struct {
+	Documents    int `json:"documents"`
+	Terms        int `json:"terms"`
+	CacheMapTags int `json:"cacheMapTags"`
+}
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// Status is the body of the diagnostics response. The adapters and the search index are
+// only reported once the server is ready.
+type Status struct {
+	Ready       bool               `json:"ready"`
+	StartTime   time.Time          `json:"startTime"`
+	Uptime      string             `json:"uptime"`
+	Adapters    []db.AdapterStatus `json:"adapters,omitempty"`
+	SearchIndex *SearchIndexStatus `json:"searchIndex,omitempty"`
+	Build       BuildInfo          `json:"build"`
+}
+
+// monitor is the part of db.Adapter used for diagnostics, whatever the type of its objects.
+type monitor interface {
+	Status() db.AdapterStatus
+	Ping() error
+}
+
+// readiness is the snapshot of the resources checked once the server is ready.
+type readiness struct {
+	monitorList []monitor
+	fileInst    db.FileAdapter
+	searchIndex *db.TextIndex
+}
+
+//----------------------------------------------------------------------------------------
+// SetReady marks the server as ready to take requests, once every adapter has been
+// configured, or as no longer ready when it is stopping. It must be called by the goroutine
+// that configured the adapters, after it has done so.
+func SetReady(isReady bool) {
+	var readinessInst *readiness
+	if isReady {
+		readinessInst = &readiness{monitorList: monitorList(), fileInst: model.FileInst, searchIndex: model.SearchIndexInst}
+	}
+
+	readyInst.Store(readinessInst)
+}
+
+//----------------------------------------------------------------------------------------
+// getReadiness returns the resources published by SetReady, or nil if the server is not ready.
+func getReadiness() *readiness {
+	readinessInst, _ := readyInst.Load().(*readiness)
+
+	return readinessInst
+}
+
+//----------------------------------------------------------------------------------------
+func IsReady() bool {
+	return getReadiness() != nil
+}
+
+//----------------------------------------------------------------------------------------
+func monitorList() []monitor {
+	return []monitor{
+		airline.AdapterInst,
+		airplanemake.AdapterInst,
+		airplane.AdapterInst,
+		country.AdapterInst,
+		modelmake.AdapterInst,
+		model.AdapterInst,
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func newCheck(name string, err error) Check {
+	if err != nil {
+		return Check{Name: name, Status: STATUS_FAILED, Detail: err.Error()}
+	}
+
+	return Check{Name: name, Status: STATUS_OK}
+}
+
+//----------------------------------------------------------------------------------------
+// GetReadyReport checks that the caches are loaded, that every table can be reached and
+// that the picture bucket can be accessed.
+func GetReadyReport() Report {
+	readinessInst := getReadiness()
+	if readinessInst == nil {
+		return Report{Status: STATUS_UNAVAILABLE, Checks: []Check{{Name: "caches", Status: STATUS_UNAVAILABLE, Detail: "the caches are being loaded or the server is stopping"}}}
+	}
+
+	reportInst := Report{Status: STATUS_OK, Checks: []Check{{Name: "caches", Status: STATUS_OK}}}
+	for _, monitorInst := range readinessInst.monitorList {
+		reportInst.Checks = append(reportInst.Checks, newCheck("table "+monitorInst.Status().TableName, monitorInst.Ping()))
+	}
+
+	reportInst.Checks = append(reportInst.Checks, newCheck("pictures", readinessInst.fileInst.Ping()))
+
+	for _, checkInst := range reportInst.Checks {
+		if checkInst.Status != STATUS_OK {
+			reportInst.Status = STATUS_FAILED
+		}
+	}
+
+	return reportInst
+}
+
+//----------------------------------------------------------------------------------------
+func getBuildInfo() BuildInfo {
+	buildInfoInst := BuildInfo{Version: Version}
+
+	info, isFound := debug.ReadBuildInfo()
+	if !isFound {
+		return buildInfoInst
+	}
+
+	buildInfoInst.GoVersion = info.GoVersion
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			buildInfoInst.Revision = setting.Value
+		case "vcs.time":
+			buildInfoInst.Time = setting.Value
+		case "vcs.modified":
+			buildInfoInst.Modified = setting.Value == "true"
+		}
+	}
+
+	return buildInfoInst
+}
+
+//----------------------------------------------------------------------------------------
+// GetStatus reports the caches of the adapters, the size of the search index and the build.
+func GetStatus() Status {
+	readinessInst := getReadiness()
+	statusInst := Status{
+		Ready:     readinessInst != nil,
+		StartTime: startTime,
+		Uptime:    time.Since(startTime).Round(time.Second).String(),
+		Build:     getBuildInfo(),
+	}
+
+	if !statusInst.Ready {
+		return statusInst
+	}
+
+	for _, monitorInst := range readinessInst.monitorList {
+		statusInst.Adapters = append(statusInst.Adapters, monitorInst.Status())
+	}
+
+	documents, terms := readinessInst.searchIndex.Size()
+	statusInst.SearchIndex = &SearchIndexStatus{Documents: documents, Terms: terms, CacheMapTags: db.CacheMapSize()}
+
+	return statusInst
+}
+
+//----------------------------------------------------------------------------------------
+func writeJSON(writer http.ResponseWriter, statusCode int, value interface{}) {
+	out, err := json.MarshalIndent(value, db.JSON_PREFIX, db.JSON_INDENT)
+	if err != nil {
+		api_util.WriteError(&writer, err)
+		return
+	}
+
+	writer.Header().Set(api_util.ContentType, api_util.ContentTypeAppJSON)
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(statusCode)
+	writer.Write(out)
+}
+
+//----------------------------------------------------------------------------------------
+func handleHealth(writer http.ResponseWriter, request *http.Request) {
+	writeJSON(writer, http.StatusOK, Report{Status: STATUS_OK})
+}
+
+//----------------------------------------------------------------------------------------
+func handleReady(writer http.ResponseWriter, request *http.Request) {
+	reportInst := GetReadyReport()
+
+	statusCode := http.StatusOK
+	if reportInst.Status != STATUS_OK {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	writeJSON(writer, statusCode, reportInst)
+}
+
+//----------------------------------------------------------------------------------------
+func handleStatus(writer http.ResponseWriter, request *http.Request) {
+	api_util.SetupCORSResponse(&writer)
+	writeJSON(writer, http.StatusOK, GetStatus())
+}
+
+//----------------------------------------------------------------------------------------
+// InitRouter registers the health checks, which are meant to be left out of authentication,
+// and the diagnostics, which are not.
+func InitRouter(router *mux.Router) {
+	router.HandleFunc(HealthURL, handleHealth).Methods(http.MethodGet)
+	router.HandleFunc(ReadyURL, handleReady).Methods(http.MethodGet)
+	router.HandleFunc(StatusURL, handleStatus).Methods(http.MethodGet)
+
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodGet, Path: HealthURL, OperationID: "checkHealth", Tag: "health",
+		Summary:      "Reports that the server is running",
+		ResponseType: reflect.TypeOf(Report{})})
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodGet, Path: ReadyURL, OperationID: "checkReady", Tag: "health",
+		Summary:      "Reports whether the caches are loaded and the tables and the picture bucket can be reached, with a 503 status if not",
+		ResponseType: reflect.TypeOf(Report{})})
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodGet, Path: StatusURL, OperationID: "getStatus", Tag: "health",
+		Summary:      "Reports the caches of the adapters, the size of the search index and the build",
+		ResponseType: reflect.TypeOf(Status{})})
+}
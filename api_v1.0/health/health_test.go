@@ -0,0 +1,130 @@
+package health
+
+import (
+	"colmanback/db"
+	"colmanback/objects/airline"
+	"colmanback/objects/airplane"
+	"colmanback/objects/airplanemake"
+	"colmanback/objects/country"
+	"colmanback/objects/model"
+	"colmanback/objects/modelmake"
+	"colmanback/test_util"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// failingFileAdapter is a picture store that cannot be reached.
+type failingFileAdapter struct {
+	db.FileAdapter
+}
+
+func (fileAdapter failingFileAdapter) Ping() error {
+	return errors.New("bucket cannot be reached")
+}
+
+func newRouter() *mux.Router {
+	router := mux.NewRouter()
+
+	test_util.InitDB()
+
+	country.InitConn()
+	airline.InitConn()
+	airplanemake.InitConn()
+	airplane.InitConn()
+	modelmake.InitConn()
+	model.InitConn()
+
+	InitRouter(router)
+
+	return router
+}
+
+func getReport(t *testing.T, router *mux.Router, url string, expectedCode int, report interface{}) map[string]interface{} {
+	var fieldMap map[string]interface{}
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	resp := test_util.ExecuteRequest(router, req)
+	if resp.Code != expectedCode {
+		t.Errorf("Status code not as expected for %s. Expected %d but got %d: %s", url, expectedCode, resp.Code, resp.Body.String())
+	}
+
+	if err := json.Unmarshal(resp.Body.Bytes(), report); err != nil {
+		t.Errorf("The response to %s cannot be unmarshalled. Error: %v", url, err)
+	}
+	json.Unmarshal(resp.Body.Bytes(), &fieldMap)
+
+	return fieldMap
+}
+
+func chkCheck(t *testing.T, reportInst Report, name string, expectedStatus string) {
+	for _, checkInst := range reportInst.Checks {
+		if checkInst.Name == name {
+			if checkInst.Status != expectedStatus {
+				t.Errorf("Expected check %s to be %s, got %+v", name, expectedStatus, checkInst)
+			}
+			return
+		}
+	}
+
+	t.Errorf("Check %s missing from %+v", name, reportInst)
+}
+
+func TestHealth(t *testing.T) {
+	var reportInst Report
+	var statusInst Status
+
+	router := newRouter()
+	defer SetReady(false)
+
+	t.Log("The server is live but not ready while the caches are being loaded")
+	SetReady(false)
+	getReport(t, router, HealthURL, http.StatusOK, &reportInst)
+
+	reportInst = Report{}
+	getReport(t, router, ReadyURL, http.StatusServiceUnavailable, &reportInst)
+	test_util.CheckField(t, "status", STATUS_UNAVAILABLE, reportInst.Status)
+	chkCheck(t, reportInst, "caches", STATUS_UNAVAILABLE)
+
+	t.Log("The adapters are not reported until the server is ready")
+	fieldMap := getReport(t, router, StatusURL, http.StatusOK, &statusInst)
+	if statusInst.Ready {
+		t.Errorf("Expected the status not to be ready")
+	}
+	for _, field := range []string{"adapters", "searchIndex"} {
+		if _, isFound := fieldMap[field]; isFound {
+			t.Errorf("Unexpected %s in the status of a server not ready: %v", field, fieldMap)
+		}
+	}
+
+	t.Log("Once ready, every table and the picture bucket are checked")
+	SetReady(true)
+	reportInst = Report{}
+	getReport(t, router, ReadyURL, http.StatusOK, &reportInst)
+	test_util.CheckField(t, "status", STATUS_OK, reportInst.Status)
+	chkCheck(t, reportInst, "pictures", STATUS_OK)
+	if len(reportInst.Checks) != len(monitorList())+2 {
+		t.Errorf("Expected %d checks, got %+v", len(monitorList())+2, reportInst.Checks)
+	}
+
+	statusInst = Status{}
+	getReport(t, router, StatusURL, http.StatusOK, &statusInst)
+	if !statusInst.Ready || len(statusInst.Adapters) != len(monitorList()) || statusInst.SearchIndex == nil {
+		t.Errorf("Expected the adapters and the search index to be reported, got %+v", statusInst)
+	}
+
+	t.Log("The server is not ready while a resource cannot be reached")
+	fileInst := model.FileInst
+	model.FileInst = failingFileAdapter{FileAdapter: fileInst}
+	defer func() { model.FileInst = fileInst }()
+	SetReady(true)
+
+	reportInst = Report{}
+	getReport(t, router, ReadyURL, http.StatusServiceUnavailable, &reportInst)
+	test_util.CheckField(t, "status", STATUS_FAILED, reportInst.Status)
+	chkCheck(t, reportInst, "pictures", STATUS_FAILED)
+	chkCheck(t, reportInst, "caches", STATUS_OK)
+}
@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -26,28 +28,54 @@ const (
 	TagPicture    = "/picture/{" + PictureID + "}/tag"
 	UntagPicture  = "/picture/{" + PictureID + "}/untag"
 	DeletePicture = "/picture/{" + PictureID + "}"
+	SearchModels  = "/search"
+
+	SearchQueryParam = "q"
+	SearchLimitParam = "limit"
+	SEARCH_LIMIT     = 50
+	SEARCH_LIMIT_MAX = 500
 )
 
 var apiInst api_util.GenAPI[*model.Model]
 var apiInstListByPicture api_util.GenAPI[*model.Model]
 
+var modelType = reflect.TypeOf(model.Model{})
+
+//----------------------------------------------------------------------------------------
+// scopeModelAPI returns a copy of baseInst that only reaches the models of the collection of
+// the caller of request, and stores new ones in it.
+func scopeModelAPI(baseInst *api_util.GenAPI[*model.Model], request *http.Request) *api_util.GenAPI[*model.Model] {
+	owner := api_util.CollectionOwner(request)
+	scopedInst := *baseInst
+	scopedInst.Scope = nil
+
+	scopedInst.GetObjectByCode = func(code string) (*model.Model, error) { return model.GetByCode(owner, code) }
+	scopedInst.GetObjectList = func() ([]*model.Model, error) { return model.GetOwnedList(owner) }
+	scopedInst.GetObjectListByCode = func(picture string) ([]*model.Model, error) { return model.GetModelByPicture(owner, picture) }
+	scopedInst.DeleteObjectByCode = func(code string) error { return model.DeleteByCode(owner, code) }
+	scopedInst.Prepare = func(modelInst *model.Model) { modelInst.Owner = owner }
+
+	return &scopedInst
+}
+
 //----------------------------------------------------------------------------------------
-func handlePictureCommand(writer http.ResponseWriter, request *http.Request, handler func(string, string) (*model.Model, error)) {
+func handlePictureCommand(writer http.ResponseWriter, request *http.Request, handler func(string, string, string) (*model.Model, error)) {
 	var objectInst *model.Model = &model.Model{}
 
 	api_util.SetupCORSResponse(&writer)
 	err := json.NewDecoder(request.Body).Decode(objectInst)
 
 	if err != nil {
-		writer.WriteHeader(http.StatusBadRequest)
+		api_util.WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("The request body could not be decoded. Error: %v", err))
+		return
 	}
 
 	requestVars := mux.Vars(request)
 
 	if picture, ok := requestVars[PictureID]; ok {
-		modelInst, tagErr := handler(picture, objectInst.Code)
+		modelInst, tagErr := handler(api_util.CollectionOwner(request), picture, objectInst.Code)
 		if tagErr != nil {
-			api_util.WriteMsg(&writer, http.StatusInternalServerError, fmt.Sprintf("An internal error has occurred. Error: %v", tagErr))
+			api_util.WriteError(&writer, tagErr)
 		} else {
 			modelInst.WriteObject(writer, request)
 		}
@@ -58,7 +86,7 @@ func handlePictureCommand(writer http.ResponseWriter, request *http.Request, han
 
 //----------------------------------------------------------------------------------------
 func modelListToObjectList(modelList []*model.Model) []objects.Object {
-	var objectInstList []objects.Object
+	objectInstList := make([]objects.Object, 0, len(modelList))
 
 	for _, modelInst := range modelList {
 		objectInstList = append(objectInstList, modelInst)
@@ -73,19 +101,25 @@ func handleAddModelPicture(writer http.ResponseWriter, request *http.Request) {
 	modelPicture, _, formErr := request.FormFile("picture")
 
 	api_util.SetupCORSResponse(&writer)
-	if formErr == nil && len(modelCodeListStr) > 0 {
-		modelCodeList := strings.Split(modelCodeListStr, ",")
-		modelList, addErr := model.AddModelPicture(modelPicture, modelCodeList)
+	if formErr != nil {
+		api_util.WriteBodyError(&writer, request, "The request was malformed.", formErr)
+		return
+	}
 
-		if addErr == nil {
-			objectInstList := modelListToObjectList(modelList)
-			defer modelPicture.Close()
-			api_util.WriteObjectList(objectInstList, writer, request)
-		} else {
-			api_util.WriteMsg(&writer, http.StatusInternalServerError, fmt.Sprintf("An internal error has occurred. Error: %v", addErr))
-		}
+	defer modelPicture.Close()
+	if len(modelCodeListStr) == 0 {
+		api_util.WriteMsg(&writer, http.StatusBadRequest, "The codes of the models to be tagged must be given in the modelList field.")
+		return
+	}
+
+	modelCodeList := strings.Split(modelCodeListStr, ",")
+	modelList, addErr := model.AddModelPicture(api_util.CollectionOwner(request), modelPicture, modelCodeList)
+
+	if addErr == nil {
+		objectInstList := modelListToObjectList(modelList)
+		api_util.WriteObjectList(objectInstList, writer, request)
 	} else {
-		api_util.WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("The request was malformed. Error: %v", formErr))
+		api_util.WriteError(&writer, addErr)
 	}
 }
 
@@ -106,9 +140,9 @@ func handleDeleteModelPicture(writer http.ResponseWriter, request *http.Request)
 	requestVars := mux.Vars(request)
 
 	if picture, ok := requestVars[PictureID]; ok {
-		modelList, tagErr := model.DeleteModelPicture(picture)
+		modelList, tagErr := model.DeleteModelPicture(api_util.CollectionOwner(request), picture)
 		if tagErr != nil {
-			api_util.WriteMsg(&writer, http.StatusInternalServerError, fmt.Sprintf("An internal error has occurred. Error: %v", tagErr))
+			api_util.WriteError(&writer, tagErr)
 		} else {
 			objectInstList := modelListToObjectList(modelList)
 			api_util.WriteObjectList(objectInstList, writer, request)
@@ -118,21 +152,58 @@ func handleDeleteModelPicture(writer http.ResponseWriter, request *http.Request)
 	}
 }
 
+//----------------------------------------------------------------------------------------
+func handleSearchModels(writer http.ResponseWriter, request *http.Request) {
+	var err error
+
+	api_util.SetupCORSResponse(&writer)
+	queryValues := request.URL.Query()
+
+	query := strings.TrimSpace(queryValues.Get(SearchQueryParam))
+	if query == "" {
+		api_util.WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("The search text must be given in the %s parameter.", SearchQueryParam))
+		return
+	}
+
+	limit := SEARCH_LIMIT
+	if limitParam := queryValues.Get(SearchLimitParam); limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > SEARCH_LIMIT_MAX {
+			api_util.WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("The %s parameter must be a number between 1 and %d.", SearchLimitParam, SEARCH_LIMIT_MAX))
+			return
+		}
+	}
+
+	modelList, err := model.Search(api_util.CollectionOwner(request), query, limit)
+	if err != nil {
+		api_util.WriteError(&writer, err)
+	} else {
+		api_util.WriteObjectList(modelListToObjectList(modelList), writer, request)
+	}
+}
+
 //----------------------------------------------------------------------------------------
 func initBase(subRouter *mux.Router) {
 	subRouter.HandleFunc(BaseURL, apiInst.GetList).Methods(http.MethodGet)
 	subRouter.HandleFunc(BaseURL, apiInst.Put).Methods(http.MethodPut)
 	subRouter.HandleFunc(ResourceURL, apiInst.Get).Methods(http.MethodGet)
+	subRouter.HandleFunc(ResourceURL, apiInst.Patch).Methods(http.MethodPatch)
 	subRouter.HandleFunc(ResourceURL, apiInst.Delete).Methods(http.MethodDelete)
 
 	apiInst.ApiURL = ApiURL
 	apiInst.BaseURL = BaseURL
 	apiInst.ObjectID = ObjectID
+	apiInst.TableName = model.TABLE_NAME
 
 	apiInst.Constructor = model.ObjectFactory
-	apiInst.GetObjectByCode = model.GetByCode
-	apiInst.GetObjectList = model.GetList
-	apiInst.DeleteObjectByCode = model.AdapterInst.DeleteObjectByCode
+	apiInst.Scope = func(request *http.Request) *api_util.GenAPI[*model.Model] {
+		return scopeModelAPI(&apiInst, request)
+	}
+	apiInst.Expand = model.Expand
+	apiInst.ExpandFields = model.ExpandFields
+	apiInst.ExpandByDefault = true
+
+	apiInst.Describe(model.TABLE_NAME, ResourceURL)
 }
 
 //----------------------------------------------------------------------------------------
@@ -144,33 +215,77 @@ func initListByPicture(subRouter *mux.Router) {
 	apiInstListByPicture.ObjectID = PictureID
 
 	apiInstListByPicture.Constructor = model.ObjectFactory
-	apiInstListByPicture.GetObjectListByCode = model.GetModelByPicture
+	apiInstListByPicture.Scope = func(request *http.Request) *api_util.GenAPI[*model.Model] {
+		return scopeModelAPI(&apiInstListByPicture, request)
+	}
+	apiInstListByPicture.Expand = model.Expand
+	apiInstListByPicture.ExpandFields = model.ExpandFields
+
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodGet, Path: ApiURL + BaseURL + ListByPicture, OperationID: "listModelsByPicture", Tag: model.TABLE_NAME,
+		Summary:     "Lists the models tagged with the picture",
+		QueryParams: apiInstListByPicture.ListParams(), ResponseType: modelType, IsListResponse: true})
 }
 
 //----------------------------------------------------------------------------------------
 func initAddModelPicture(subRouter *mux.Router) {
 	subRouter.HandleFunc(PutPicture, handleAddModelPicture).Methods(http.MethodPost)
+
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodPost, Path: ApiURL + PutPicture, OperationID: "addModelPicture", Tag: model.TABLE_NAME,
+		Summary: "Stores a picture and tags the models with it",
+		RequestForm: []api_util.Param{
+			{Name: "picture", Type: api_util.ParamFile, Description: "The picture", IsRequired: true},
+			{Name: "modelList", Type: api_util.ParamString, Description: "Comma-separated codes of the models to tag", IsRequired: true},
+		},
+		ResponseType: modelType, IsListResponse: true})
 }
 
 //----------------------------------------------------------------------------------------
 func initTagModelPicture(subRouter *mux.Router) {
 	subRouter.HandleFunc(TagPicture, handleTagModelPicture).Methods(http.MethodPut)
+
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodPut, Path: ApiURL + TagPicture, OperationID: "tagModelPicture", Tag: model.TABLE_NAME,
+		Summary:     "Tags the model with the code given in the body with the picture",
+		RequestType: modelType, ResponseType: modelType})
 }
 
 //----------------------------------------------------------------------------------------
 func initUntagModelPicture(subRouter *mux.Router) {
-	subRouter.HandleFunc(TagPicture, handleUntagModelPicture).Methods(http.MethodPut)
+	subRouter.HandleFunc(UntagPicture, handleUntagModelPicture).Methods(http.MethodPut)
+
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodPut, Path: ApiURL + UntagPicture, OperationID: "untagModelPicture", Tag: model.TABLE_NAME,
+		Summary:     "Removes the picture from the model with the code given in the body",
+		RequestType: modelType, ResponseType: modelType})
 }
 
 //----------------------------------------------------------------------------------------
 func initDeleteModelPicture(subRouter *mux.Router) {
 	subRouter.HandleFunc(DeletePicture, handleDeleteModelPicture).Methods(http.MethodDelete)
+
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodDelete, Path: ApiURL + DeletePicture, OperationID: "deleteModelPicture", Tag: model.TABLE_NAME,
+		Summary:      "Deletes the picture and returns the models it was removed from",
+		ResponseType: modelType, IsListResponse: true})
+}
+
+//----------------------------------------------------------------------------------------
+func initSearchModels(subRouter *mux.Router) {
+	subRouter.HandleFunc(SearchModels, handleSearchModels).Methods(http.MethodGet)
+
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodGet, Path: ApiURL + SearchModels, OperationID: "searchModels", Tag: model.TABLE_NAME,
+		Summary: "Lists the models matching all the words of the text, best matches first",
+		QueryParams: []api_util.Param{
+			{Name: SearchQueryParam, Type: api_util.ParamString, Description: "Text to search for", IsRequired: true},
+			{Name: SearchLimitParam, Type: api_util.ParamInteger, Description: fmt.Sprintf("Maximum number of models returned, up to %d", SEARCH_LIMIT_MAX)},
+		},
+		ResponseType: modelType, IsListResponse: true})
 }
 
 //----------------------------------------------------------------------------------------
 func InitRouter(router *mux.Router) {
 	subRouter := router.PathPrefix(ApiURL).Subrouter()
 
+	//Registered ahead of the generic API, as its path would be taken for a model ID.
+	initSearchModels(subRouter)
+
 	//Generic model API.
 	initBase(subRouter)
 
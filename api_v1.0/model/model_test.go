@@ -2,12 +2,13 @@ package model
 
 import (
 	"bytes"
+	"colmanback/api_util"
 	airlineAPI "colmanback/api_v1.0/airline"
 	airplaneAPI "colmanback/api_v1.0/airplane"
 	airplaneMakeAPI "colmanback/api_v1.0/airplanemake"
 	modelMakeAPI "colmanback/api_v1.0/modelmake"
+	"colmanback/auth"
 	"colmanback/db"
-	"colmanback/db/dyno"
 	"colmanback/objects"
 	airlineObject "colmanback/objects/airline"
 	airplaneObject "colmanback/objects/airplane"
@@ -18,19 +19,21 @@ import (
 	"colmanback/test_util"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gorilla/mux"
 )
 
 const (
-	modelMakeCode = "modelTestModelMakeCode"
-	modelMakeName = modelMakeCode + "Name"
+	modelMakeCode    = "modelTestModelMakeCode"
+	modelMakeName    = modelMakeCode + "Name"
+	newModelMakeCode = "modelTestNewModelMakeCode"
 
 	airlineCode    = "modelTestAirline"
 	airlineName    = airlineCode + "Name"
@@ -128,7 +131,8 @@ func createModelMake(t *testing.T) {
 	modelMakeObject.InitConn()
 	modelMakeAPI.InitRouter(router)
 
-	jsonString := string(db.ToJson(&objectInst))
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
 	test_util.CheckPut(t, router, jsonString, modelMakeAPI.ApiURL+modelMakeAPI.BaseURL)
 }
 
@@ -138,7 +142,8 @@ func createAirline(t *testing.T) {
 	airlineObject.InitConn()
 	airlineAPI.InitRouter(router)
 
-	jsonString := string(db.ToJson(&objectInst))
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
 	test_util.CheckPut(t, router, jsonString, airlineAPI.ApiURL+airlineAPI.BaseURL)
 }
 
@@ -148,7 +153,8 @@ func createAirplaneMake(t *testing.T) {
 	airplaneMakeObject.InitConn()
 	airplaneMakeAPI.InitRouter(router)
 
-	jsonString := string(db.ToJson(&objectInst))
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
 	test_util.CheckPut(t, router, jsonString, airplaneMakeAPI.ApiURL+airplaneMakeAPI.BaseURL)
 }
 
@@ -158,7 +164,8 @@ func createAirplane(t *testing.T) {
 	airplaneObject.InitConn()
 	airplaneAPI.InitRouter(router)
 
-	jsonString := string(db.ToJson(&objectInst))
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
 	test_util.CheckPut(t, router, jsonString, airplaneAPI.ApiURL+airplaneAPI.BaseURL)
 }
 
@@ -166,7 +173,8 @@ func createModel(t *testing.T) {
 	objectInst := makeModelInstance()
 	var newObjectInst modelObject.Model
 
-	jsonString := string(db.ToJson(&objectInst))
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
 	req, err := http.NewRequest(http.MethodPut, ApiURL+BaseURL, bytes.NewBuffer([]byte(jsonString)))
 
 	if err != nil {
@@ -217,18 +225,292 @@ func retrieveModel(t *testing.T) {
 	}
 }
 
+func chkSearch(t *testing.T, query string, expectFound bool) {
+	var objectList []modelObject.Model
+
+	searchURL := ApiURL + SearchModels + "?" + SearchQueryParam + "=" + url.QueryEscape(query)
+	req, err := http.NewRequest(http.MethodGet, searchURL, nil)
+	if err != nil {
+		t.Errorf("An error has occurred whist building search request. Error: %v\n", err)
+		return
+	}
+
+	resp := test_util.ExecuteRequest(router, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("Status code not as expected for search %s. Code %d", query, resp.Code)
+	} else if unmarshallErr := json.Unmarshal(resp.Body.Bytes(), &objectList); unmarshallErr != nil {
+		t.Errorf("An error has occurred whilst unmarshalling the search results. Error: %v\n", unmarshallErr)
+	} else {
+		isFound := false
+		for _, objectInst := range objectList {
+			if objectInst.Code == modelCode {
+				isFound = true
+			}
+		}
+
+		if isFound != expectFound {
+			t.Errorf("Search for %s expected to find model %s: %v, found: %v", query, modelCode, expectFound, isFound)
+		}
+	}
+}
+
+func searchModels(t *testing.T) {
+	t.Log("The model is found by words of its notes, in any form")
+	chkSearch(t, "note", true)
+	chkSearch(t, "MODELTEST notes", true)
+
+	t.Log("The model is found by its registration and the names of its references")
+	chkSearch(t, modelReg, true)
+	chkSearch(t, airlineName+" "+airplaneName+" "+modelMakeName, true)
+
+	t.Log("All the words of the search have to match")
+	chkSearch(t, "notes unmatchedword", false)
+
+	t.Log("A search without text is rejected")
+	req, _ := http.NewRequest(http.MethodGet, ApiURL+SearchModels, nil)
+	if resp := test_util.ExecuteRequest(router, req); resp.Code != http.StatusBadRequest {
+		t.Errorf("Status code not as expected for a search without text. Code %d", resp.Code)
+	}
+}
+
+func patchModel(t *testing.T) {
+	patchURL := ApiURL + strings.Replace(ResourceURL, "{"+ObjectID+"}", url.QueryEscape(modelCode), 1)
+
+	t.Log("A patch of the notes keeps every other field of the model")
+	test_util.CheckPatch(t, router, patchURL, api_util.ContentTypeMergePatch, "{\"notes\": \"Patched livery\"}", http.StatusOK)
+	retrieveModel(t)
+
+	t.Log("The search index follows the patched notes")
+	chkSearch(t, "patched", true)
+	chkSearch(t, "modelTest notes", false)
+
+	t.Log("A patched registration is upper-cased, as it is on put")
+	test_util.CheckPatch(t, router, patchURL, api_util.ContentTypeMergePatch, "{\"reg\": \""+strings.ToLower(modelReg)+"\"}", http.StatusOK)
+	if objectInst, code := getExpandedModel(t, patchURL); code != http.StatusOK || objectInst.Reg != modelReg {
+		t.Errorf("Expected registration %s after the patch, got %s. Code %d", modelReg, objectInst.Reg, code)
+	}
+}
+
+func getExpandedModel(t *testing.T, getURL string) (modelObject.Model, int) {
+	var objectInst modelObject.Model
+
+	req, _ := http.NewRequest(http.MethodGet, getURL, nil)
+	resp := test_util.ExecuteRequest(router, req)
+	if resp.Code == http.StatusOK {
+		if unmarshallErr := json.Unmarshal(resp.Body.Bytes(), &objectInst); unmarshallErr != nil {
+			t.Errorf("An error has occurred whilst unmarshalling object. Error: %v\n", unmarshallErr)
+		}
+	}
+
+	return objectInst, resp.Code
+}
+
+func chkExpand(t *testing.T) {
+	var objectList []*modelObject.Model
+	getURL := ApiURL + strings.Replace(ResourceURL, "{"+ObjectID+"}", url.QueryEscape(modelCode), 1)
+
+	t.Log("Without expand, the list comes with all the details and those of the references")
+	test_util.CheckList(t, router, ApiURL+BaseURL, &objectList)
+	for _, objectInst := range objectList {
+		if objectInst.Code != modelCode {
+			continue
+		}
+
+		if objectInst.AirlineInst == nil || objectInst.AirlineInst.CountryInst == nil || objectInst.AirplaneInst == nil ||
+			objectInst.AirplaneInst.MakeInst == nil || objectInst.AirplaneInst.MakeInst.CountryInst == nil || objectInst.ModelMakeInst == nil {
+			t.Errorf("Details missing from the listed model %s", objectInst.ToString())
+		}
+	}
+
+	t.Log("A page of the list is expanded as well")
+	objectList = nil
+	test_util.CheckList(t, router, ApiURL+BaseURL+"?"+api_util.LimitParam+"=1", &objectList)
+	if len(objectList) != 1 || objectList[0].AirlineInst == nil || objectList[0].ModelMakeInst == nil {
+		t.Errorf("Expected one listed model with its details, got %d models", len(objectList))
+	}
+
+	t.Log("A filter matching no model returns an empty list")
+	req, _ := http.NewRequest(http.MethodGet, ApiURL+BaseURL+"?airline=noSuchAirline", nil)
+	resp := test_util.ExecuteRequest(router, req)
+	if resp.Code != http.StatusOK || strings.TrimSpace(resp.Body.String()) != "[]" {
+		t.Errorf("Expected 200 and [] for an empty filter result, got %d and %s", resp.Code, resp.Body.String())
+	}
+
+	t.Log("Only the details asked for are attached")
+	objectList = nil
+	test_util.CheckList(t, router, ApiURL+BaseURL+"?"+api_util.ExpandParam+"=airline", &objectList)
+	for _, objectInst := range objectList {
+		if objectInst.AirlineInst == nil && objectInst.Code == modelCode || objectInst.AirplaneInst != nil || objectInst.ModelMakeInst != nil {
+			t.Errorf("Unexpected details for model %s expanded by airline only", objectInst.Code)
+		}
+	}
+
+	objectInst, code := getExpandedModel(t, getURL+"?"+api_util.ExpandParam+"=airplane,modelMake")
+	if code != http.StatusOK || objectInst.AirlineInst != nil || objectInst.AirplaneInst == nil || objectInst.ModelMakeInst == nil {
+		t.Errorf("Unexpected details for model expanded by airplane and model make. Code %d", code)
+	}
+
+	objectInst, code = getExpandedModel(t, getURL+"?"+api_util.ExpandParam+"=")
+	if code != http.StatusOK || objectInst.AirlineInst != nil || objectInst.AirplaneInst != nil || objectInst.ModelMakeInst != nil {
+		t.Errorf("No details expected for an empty expand. Code %d", code)
+	}
+
+	t.Log("An unknown reference cannot be expanded")
+	if _, code = getExpandedModel(t, getURL+"?"+api_util.ExpandParam+"=notes"); code != http.StatusBadRequest {
+		t.Errorf("Status code not as expected for an unknown expand field. Code %d", code)
+	}
+}
+
+func chkInvalidModels(t *testing.T) {
+	t.Log("A model without registration or with an unknown scale is rejected")
+	test_util.CheckPutFieldErrors(t, router, "{\"modelMake\": \""+modelMakeCode+"\", \"scale\": \"1/100\"}", ApiURL+BaseURL, "reg", "scale")
+
+	t.Log("A model referencing objects that do not exist is rejected")
+	test_util.CheckPutFieldErrors(t, router, "{\"modelMake\": \"noSuchMake\", \"airline\": \"noSuchAirline\", \"airplane\": \"noSuchAirplane\", \"scale\": \"1/400\", \"reg\": \"TE-STZ\"}", ApiURL+BaseURL, "modelMake", "airline", "airplane")
+}
+
+func chkPictureTooLarge(t *testing.T) {
+	var body bytes.Buffer
+
+	formWriter := multipart.NewWriter(&body)
+	formWriter.WriteField("modelList", modelCode)
+	fileWriter, _ := formWriter.CreateFormFile("picture", "large.png")
+	fileWriter.Write(bytes.Repeat([]byte{0}, 4096))
+	formWriter.Close()
+
+	t.Log("A picture sent without its length is reported as too large once over the limit")
+	// A reader of unknown length leaves ContentLength unset, as with a chunked upload.
+	req := httptest.NewRequest(http.MethodPost, ApiURL+PutPicture, io.MultiReader(&body))
+	req.Header.Set(api_util.ContentType, formWriter.FormDataContentType())
+	resp := httptest.NewRecorder()
+	api_util.BodyLimitMiddleware(1024)(router).ServeHTTP(resp, req)
+	if resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for a picture over the limit, got %d: %s", http.StatusRequestEntityTooLarge, resp.Code, resp.Body.String())
+	}
+}
+
+func chkReferentialIntegrity(t *testing.T) {
+	modelURL := ApiURL + strings.Replace(ResourceURL, "{"+ObjectID+"}", url.QueryEscape(modelCode), 1)
+	airlineURL := airlineAPI.ApiURL + strings.Replace(airlineAPI.ResourceURL, "{"+airlineAPI.ObjectID+"}", airlineCode, 1)
+	airplaneURL := airplaneAPI.ApiURL + strings.Replace(airplaneAPI.ResourceURL, "{"+airplaneAPI.ObjectID+"}", airplaneCode, 1)
+	modelMakeURL := modelMakeAPI.ApiURL + strings.Replace(modelMakeAPI.ResourceURL, "{"+modelMakeAPI.ObjectID+"}", modelMakeCode, 1)
+	newModelMakeURL := modelMakeAPI.ApiURL + strings.Replace(modelMakeAPI.ResourceURL, "{"+modelMakeAPI.ObjectID+"}", newModelMakeCode, 1)
+
+	t.Log("An airline referenced by a model cannot be deleted, the model being listed by owner code")
+	test_util.CheckDeleteReferenced(t, router, airlineURL, modelObject.MakeOwnerCode("", modelCode))
+	test_util.CheckExists(t, router, airlineURL, true)
+
+	t.Log("References cannot be reassigned to an unknown object, nor both reassigned and deleted")
+	test_util.CheckDeleteStatus(t, router, modelMakeURL+"?reassignTo=noSuchMake", http.StatusUnprocessableEntity)
+	test_util.CheckDeleteStatus(t, router, modelMakeURL+"?reassignTo="+newModelMakeCode+"&cascade=true", http.StatusBadRequest)
+
+	t.Log("The model follows its model make when it is reassigned")
+	newModelMakeInst := modelMakeObject.ModelMake{Code: newModelMakeCode, Name: newModelMakeCode}
+	jsonBytes, _ := db.ToJson(&newModelMakeInst)
+	test_util.CheckPut(t, router, string(jsonBytes), modelMakeAPI.ApiURL+modelMakeAPI.BaseURL)
+	test_util.CheckDeleteStatus(t, router, modelMakeURL+"?reassignTo="+newModelMakeCode, http.StatusOK)
+
+	modelInst, err := modelObject.GetByCode("", modelCode)
+	if err != nil {
+		t.Errorf("The model cannot be retrieved after its model make has been reassigned. Error: %v", err)
+	} else {
+		test_util.CheckField(t, "modelMake", newModelMakeCode, modelInst.ModelMake)
+	}
+
+	t.Log("A cascading delete of the airplane deletes the model")
+	test_util.CheckDeleteStatus(t, router, airplaneURL+"?cascade=true", http.StatusOK)
+	test_util.CheckExists(t, router, modelURL, false)
+	test_util.CheckExists(t, router, airplaneURL, false)
+	test_util.CheckDelete(t, router, newModelMakeURL, true)
+}
+
+func executeAs(subject string, method string, requestURL string, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, requestURL, strings.NewReader(body))
+	req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{Subject: subject, Role: auth.RoleEditor}))
+
+	return test_util.ExecuteRequest(router, req)
+}
+
+func chkCollections(t *testing.T) {
+	var objectInst modelObject.Model
+	var objectList []modelObject.Model
+
+	modelURL := ApiURL + strings.Replace(ResourceURL, "{"+ObjectID+"}", url.QueryEscape(modelCode), 1)
+	annInst := makeModelInstance()
+	annInst.Owner = "bob"
+	annInst.Notes = "Ann's copy"
+	jsonBytes, _ := db.ToJson(&annInst)
+
+	t.Log("A model with the code of one of another collection is stored in the collection of the caller")
+	resp := executeAs("ann", http.MethodPut, ApiURL+BaseURL, string(jsonBytes))
+	if err := json.Unmarshal(resp.Body.Bytes(), &objectInst); resp.Code != http.StatusOK || err != nil {
+		t.Fatalf("Status code not as expected after put. Code %d: %s", resp.Code, resp.Body.String())
+	}
+	test_util.CheckField(t, "code", modelCode, objectInst.Code)
+	test_util.CheckField(t, "owner", "ann", objectInst.Owner)
+
+	t.Log("Each caller only gets the models of their collection")
+	resp = executeAs("ann", http.MethodGet, modelURL, "")
+	if err := json.Unmarshal(resp.Body.Bytes(), &objectInst); resp.Code != http.StatusOK || err != nil {
+		t.Errorf("Status code not as expected for the model of ann. Code %d", resp.Code)
+	}
+	test_util.CheckField(t, "notes", annInst.Notes, objectInst.Notes)
+
+	if resp = executeAs("bob", http.MethodGet, modelURL, ""); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected the model of ann not to be found by bob, got %d", resp.Code)
+	}
+
+	resp = executeAs("ann", http.MethodGet, ApiURL+BaseURL, "")
+	if err := json.Unmarshal(resp.Body.Bytes(), &objectList); err != nil || len(objectList) != 1 || objectList[0].Owner != "ann" {
+		t.Errorf("Expected the list of ann to hold her model only, got %s", resp.Body.String())
+	}
+
+	resp = executeAs("bob", http.MethodGet, ApiURL+SearchModels+"?"+SearchQueryParam+"=copy", "")
+	if err := json.Unmarshal(resp.Body.Bytes(), &objectList); err != nil || len(objectList) != 0 {
+		t.Errorf("Expected the search of bob not to find the model of ann, got %s", resp.Body.String())
+	}
+
+	t.Log("The owner of a model cannot be changed")
+	if resp = executeAs("ann", http.MethodPatch, modelURL, `{"owner": "bob"}`); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected the owner change to be rejected, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	t.Log("Objects referenced by the models of other collections are not deleted, and the codes of those are not disclosed")
+	airplaneURL := airplaneAPI.ApiURL + strings.Replace(airplaneAPI.ResourceURL, "{"+airplaneAPI.ObjectID+"}", airplaneCode, 1)
+	for _, query := range []string{"?cascade=true", ""} {
+		var problem api_util.Problem
+
+		resp = executeAs("ann", http.MethodDelete, airplaneURL+query, "")
+		if err := json.Unmarshal(resp.Body.Bytes(), &problem); resp.Code != http.StatusConflict || err != nil || problem.OtherReferences != 1 ||
+			len(problem.References) != 1 || problem.References[0].Code != modelObject.MakeOwnerCode("ann", modelCode) {
+			t.Errorf("Expected the delete%s of the airplane to be refused with the model of ann only, got %d: %s", query, resp.Code, resp.Body.String())
+		}
+	}
+	test_util.CheckExists(t, router, airplaneURL, true)
+	test_util.CheckExists(t, router, modelURL, true)
+
+	t.Log("Deleting the model of ann leaves the model of the same code of the shared collection")
+	if resp = executeAs("ann", http.MethodDelete, modelURL, ""); resp.Code != http.StatusOK {
+		t.Errorf("Status code not as expected after delete. Code %d: %s", resp.Code, resp.Body.String())
+	}
+	test_util.CheckExists(t, router, modelURL, true)
+}
+
 func testSetup(t *testing.T) {
 	router = mux.NewRouter().SkipClean(true).UseEncodedPath()
 
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	dyno.Conn = dynamodb.New(sess)
+	test_util.InitDB()
 
 	modelObject.InitConn()
 	countryObject.InitConn() //Needs explicit init because no country is being created.
 
+	if test_util.IsMemoryDB() {
+		countryObject.LoadCountryList([]countryObject.Country{
+			{Code: airlineCountry, Continent: "Europe", Name: "United Kingdom"},
+			{Code: airplaneMakeCountry, Continent: "Europe", Name: "France"},
+		})
+	}
+
 	InitRouter(router)
 
 	createModelMake(t)
@@ -241,15 +523,26 @@ func testSetup(t *testing.T) {
 }
 
 func testTearDown(t *testing.T) {
+	test_util.CheckDelete(t, router, ApiURL+strings.Replace(ResourceURL, "{"+ObjectID+"}", url.QueryEscape(modelCode), 1), true)
 	test_util.CheckDelete(t, router, modelMakeAPI.ApiURL+strings.Replace(modelMakeAPI.ResourceURL, "{"+modelMakeAPI.ObjectID+"}", modelMakeCode, 1), true)
 	test_util.CheckDelete(t, router, airlineAPI.ApiURL+strings.Replace(airlineAPI.ResourceURL, "{"+airlineAPI.ObjectID+"}", airlineCode, 1), true)
 	test_util.CheckDelete(t, router, airplaneMakeAPI.ApiURL+strings.Replace(airplaneMakeAPI.ResourceURL, "{"+airplaneMakeAPI.ObjectID+"}", airplaneMakeCode, 1), true)
 	test_util.CheckDelete(t, router, airplaneAPI.ApiURL+strings.Replace(airplaneAPI.ResourceURL, "{"+airplaneAPI.ObjectID+"}", airplaneCode, 1), true)
-	test_util.CheckDelete(t, router, ApiURL+strings.Replace(ResourceURL, "{"+ObjectID+"}", modelCode, 1), true)
 }
 
 func TestModel(t *testing.T) {
 	testSetup(t)
 
+	searchModels(t)
+	patchModel(t)
+	chkExpand(t)
+	chkInvalidModels(t)
+	chkPictureTooLarge(t)
+	chkCollections(t)
+	chkReferentialIntegrity(t)
+
 	testTearDown(t)
+
+	t.Log("The deleted model is no longer found")
+	chkSearch(t, "note", false)
 }
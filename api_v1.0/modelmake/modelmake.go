@@ -21,17 +21,21 @@ var apiInst api_util.GenAPI[*modelmake.ModelMake]
 func InitRouter(router *mux.Router) {
 	subRouter := router.PathPrefix(ApiURL).Subrouter()
 
-	subRouter.HandleFunc(BaseURL, apiInst.Get).Methods(http.MethodGet)
+	subRouter.HandleFunc(BaseURL, apiInst.GetList).Methods(http.MethodGet)
 	subRouter.HandleFunc(BaseURL, apiInst.Put).Methods(http.MethodPut)
 	subRouter.HandleFunc(ResourceURL, apiInst.Get).Methods(http.MethodGet)
+	subRouter.HandleFunc(ResourceURL, apiInst.Patch).Methods(http.MethodPatch)
 	subRouter.HandleFunc(ResourceURL, apiInst.Delete).Methods(http.MethodDelete)
 
 	apiInst.ApiURL = ApiURL
 	apiInst.BaseURL = BaseURL
 	apiInst.ObjectID = ObjectID
+	apiInst.TableName = modelmake.TABLE_NAME
 
 	apiInst.Constructor = modelmake.ObjectFactory
 	apiInst.GetObjectByCode = modelmake.GetByCode
 	apiInst.GetObjectList = modelmake.GetList
 	apiInst.DeleteObjectByCode = modelmake.AdapterInst.DeleteObjectByCode
+
+	apiInst.Describe(modelmake.TABLE_NAME, ResourceURL)
 }
@@ -2,14 +2,11 @@ package modelmake
 
 import (
 	"colmanback/db"
-	"colmanback/db/dyno"
 	"colmanback/objects/modelmake"
 	"colmanback/test_util"
 	"strings"
 	"testing"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gorilla/mux"
 )
 
@@ -38,14 +35,29 @@ func chkExists(t *testing.T, router *mux.Router, expectExists bool) {
 }
 
 func chkPut(t *testing.T, router *mux.Router, objectInst modelmake.ModelMake) {
-	jsonString := string(db.ToJson(&objectInst))
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
 	test_util.CheckPut(t, router, jsonString, ApiURL+BaseURL)
 }
 
-func chkList(t *testing.T, router *mux.Router) {
+func chkPutConflict(t *testing.T, router *mux.Router, objectInst modelmake.ModelMake, serverVersion int64) {
+	jsonBytes, _ := db.ToJson(&objectInst)
+	jsonString := string(jsonBytes)
+	test_util.CheckPutConflict(t, router, jsonString, ApiURL+BaseURL, serverVersion)
+}
+
+func chkList(t *testing.T, router *mux.Router, expectedObjectInst modelmake.ModelMake) {
 	var objectList []*modelmake.ModelMake
 
 	test_util.CheckList(t, router, ApiURL+BaseURL, &objectList)
+	for _, objectInst := range objectList {
+		if objectInst.Code == expectedObjectInst.Code {
+			compareFields(t, &expectedObjectInst, objectInst)
+			return
+		}
+	}
+
+	t.Errorf("The model make %s is missing from the list: %v", expectedObjectInst.Code, objectList)
 }
 
 func chkFields(t *testing.T, router *mux.Router, expectedObjectInst modelmake.ModelMake) {
@@ -63,14 +75,11 @@ func TestModelMake(t *testing.T) {
 	var newObjectInst modelmake.ModelMake = getTestInstance()
 
 	newObjectInst.Name = nameNewConst
+	newObjectInst.Version = 1
 
 	router := mux.NewRouter()
 
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	dyno.Conn = dynamodb.New(sess)
+	test_util.InitDB()
 	modelmake.InitConn()
 
 	InitRouter(router)
@@ -93,8 +102,14 @@ func TestModelMake(t *testing.T) {
 	t.Log("Ensure the object has the expected (updated) field values")
 	chkFields(t, router, newObjectInst)
 
-	t.Log("Ensure the full list has at least one element")
-	chkList(t, router)
+	t.Log("Check that a put based on an outdated version is rejected")
+	chkPutConflict(t, router, origObjectInst, 2)
+
+	t.Log("Ensure the rejected put did not change the object")
+	chkFields(t, router, newObjectInst)
+
+	t.Log("Ensure the full list holds the object")
+	chkList(t, router, newObjectInst)
 
 	t.Log("Check delete")
 	chkDelete(t, router, true)
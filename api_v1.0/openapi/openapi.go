@@ -0,0 +1,53 @@
+package openapi
+
+import (
+	"colmanback/api_util"
+	"colmanback/db"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	ApiURL  = "/api/v1"
+	SpecURL = "/openapi.json"
+)
+
+var rootRouter *mux.Router
+
+//----------------------------------------------------------------------------------------
+// handleSpec returns the OpenAPI document of the routes of the root router. It is built
+// on every request, so that it always matches the routes actually served.
+func handleSpec(writer http.ResponseWriter, request *http.Request) {
+	api_util.SetupCORSResponse(&writer)
+
+	spec, undescribedList := api_util.BuildOpenAPI(rootRouter)
+	if len(undescribedList) > 0 {
+		log.Printf("Routes missing from the OpenAPI document: %v", undescribedList)
+	}
+
+	out, err := json.MarshalIndent(spec, db.JSON_PREFIX, db.JSON_INDENT)
+	if err != nil {
+		api_util.WriteError(&writer, fmt.Errorf("got error when trying to return the OpenAPI document. Error: %v", err))
+		return
+	}
+
+	writer.Header().Set(api_util.ContentType, api_util.ContentTypeAppJSON)
+	writer.Write(out)
+}
+
+//----------------------------------------------------------------------------------------
+// InitRouter serves the OpenAPI document of every route of router, including those added
+// after this call.
+func InitRouter(router *mux.Router) {
+	rootRouter = router
+
+	router.HandleFunc(ApiURL+SpecURL, handleSpec).Methods(http.MethodGet)
+
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodGet, Path: ApiURL + SpecURL, OperationID: "getOpenAPI", Tag: "openapi",
+		Summary: "Returns this document", ResponseType: reflect.TypeOf(map[string]interface{}{})})
+}
@@ -0,0 +1,205 @@
+package search
+
+import (
+	"colmanback/api_util"
+	"colmanback/db"
+	"colmanback/objects"
+	"colmanback/objects/airline"
+	"colmanback/objects/airplane"
+	"colmanback/objects/airplanemake"
+	"colmanback/objects/country"
+	"colmanback/objects/modelmake"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	ApiURL  = "/api/v1/search"
+	BaseURL = ""
+
+	QueryParam   = "q"
+	TypeParam    = "type"
+	LimitParam   = "limit"
+	HydrateParam = "hydrate"
+
+	DEFAULT_LIMIT = 50
+	MAX_LIMIT     = 500
+)
+
+type SearchResult struct {
+	db.CacheMapElement
+	Object objects.Object `json:"object,omitempty"`
+}
+
+// getterMap hydrates search results. It is keyed by table name, which is what
+// CacheMapElement.Type holds.
+var getterMap = map[string]func(code string) (objects.Object, error){
+	airline.TABLE_NAME:      getter(airline.GetByCode),
+	airplane.TABLE_NAME:     getter(airplane.GetByCode),
+	airplanemake.TABLE_NAME: getter(airplanemake.GetByCode),
+	country.TABLE_NAME:      getter(country.GetCountryByISO),
+	modelmake.TABLE_NAME:    getter(modelmake.GetByCode),
+}
+
+//----------------------------------------------------------------------------------------
+func getter[K objects.Object](getByCode func(code string) (K, error)) func(code string) (objects.Object, error) {
+	return func(code string) (objects.Object, error) {
+		objectInst, err := getByCode(code)
+		if err != nil {
+			return nil, err
+		}
+
+		return objectInst, nil
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// parseTypes accepts the type parameter repeated and / or as a comma-separated list.
+func parseTypes(typeParamList []string) (map[string]bool, error) {
+	typeMap := make(map[string]bool)
+
+	for _, typeParam := range typeParamList {
+		for _, typeName := range strings.Split(typeParam, ",") {
+			typeName = strings.ToLower(strings.TrimSpace(typeName))
+			if typeName == "" {
+				continue
+			}
+
+			if _, isKnown := getterMap[typeName]; !isKnown {
+				return nil, fmt.Errorf("unknown type %s", typeName)
+			}
+
+			typeMap[typeName] = true
+		}
+	}
+
+	return typeMap, nil
+}
+
+//----------------------------------------------------------------------------------------
+func parseLimit(limitParam string) (int, error) {
+	if limitParam == "" {
+		return DEFAULT_LIMIT, nil
+	}
+
+	limit, err := strconv.Atoi(limitParam)
+	if err != nil || limit < 1 || limit > MAX_LIMIT {
+		return 0, fmt.Errorf("limit must be a number between 1 and %d", MAX_LIMIT)
+	}
+
+	return limit, nil
+}
+
+//----------------------------------------------------------------------------------------
+// Search returns the elements of the search cache map matching searchKey, best matches
+// first, keeping only the given types (all of them if typeMap is empty) and at most limit
+// elements. Hydrated results whose object no longer exists are left out.
+func Search(searchKey string, typeMap map[string]bool, limit int, isHydrating bool) ([]SearchResult, error) {
+	resultList := []SearchResult{}
+
+	for _, cacheMapElement := range db.SearchCacheMap(searchKey) {
+		if len(resultList) >= limit {
+			break
+		}
+
+		if len(typeMap) > 0 && !typeMap[cacheMapElement.Type] {
+			continue
+		}
+
+		result := SearchResult{CacheMapElement: cacheMapElement}
+
+		if isHydrating {
+			getObjectByCode, hasGetter := getterMap[cacheMapElement.Type]
+			if !hasGetter {
+				continue
+			}
+
+			objectInst, err := getObjectByCode(cacheMapElement.Code)
+			if errors.Is(err, db.ErrNotFound) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			result.Object = objectInst
+		}
+
+		resultList = append(resultList, result)
+	}
+
+	return resultList, nil
+}
+
+//----------------------------------------------------------------------------------------
+func handleSearch(writer http.ResponseWriter, request *http.Request) {
+	var isHydrating bool
+	var err error
+
+	api_util.SetupCORSResponse(&writer)
+	queryValues := request.URL.Query()
+
+	searchKey := strings.TrimSpace(queryValues.Get(QueryParam))
+	if searchKey == "" {
+		api_util.WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("The search text must be given in the %s parameter.", QueryParam))
+		return
+	}
+
+	typeMap, err := parseTypes(queryValues[TypeParam])
+	if err != nil {
+		api_util.WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("Invalid %s parameter. Error: %v", TypeParam, err))
+		return
+	}
+
+	limit, err := parseLimit(queryValues.Get(LimitParam))
+	if err != nil {
+		api_util.WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("Invalid %s parameter. Error: %v", LimitParam, err))
+		return
+	}
+
+	if hydrateParam := queryValues.Get(HydrateParam); hydrateParam != "" {
+		isHydrating, err = strconv.ParseBool(hydrateParam)
+		if err != nil {
+			api_util.WriteMsg(&writer, http.StatusBadRequest, fmt.Sprintf("Invalid %s parameter. Error: %v", HydrateParam, err))
+			return
+		}
+	}
+
+	resultList, err := Search(searchKey, typeMap, limit, isHydrating)
+	if err != nil {
+		api_util.WriteError(&writer, err)
+		return
+	}
+
+	out, err := json.MarshalIndent(resultList, db.JSON_PREFIX, db.JSON_INDENT)
+	if err != nil {
+		api_util.WriteError(&writer, fmt.Errorf("got error when trying to return search results for %s. Error: %v", searchKey, err))
+		return
+	}
+
+	writer.Header().Set(api_util.ContentType, api_util.ContentTypeAppJSON)
+	writer.Write(out)
+}
+
+//----------------------------------------------------------------------------------------
+func InitRouter(router *mux.Router) {
+	subRouter := router.PathPrefix(ApiURL).Subrouter()
+
+	subRouter.HandleFunc(BaseURL, handleSearch).Methods(http.MethodGet)
+
+	api_util.DescribeOperation(api_util.Operation{Method: http.MethodGet, Path: ApiURL + BaseURL, OperationID: "search", Tag: "search",
+		Summary: "Lists the objects whose names or codes match the text, best matches first",
+		QueryParams: []api_util.Param{
+			{Name: QueryParam, Type: api_util.ParamString, Description: "Text to search for", IsRequired: true},
+			{Name: TypeParam, Type: api_util.ParamString, Description: "Comma-separated types of objects to search, all of them by default"},
+			{Name: LimitParam, Type: api_util.ParamInteger, Description: fmt.Sprintf("Maximum number of results, up to %d", MAX_LIMIT)},
+			{Name: HydrateParam, Type: api_util.ParamBoolean, Description: "Returns the matching objects along with the results"},
+		},
+		ResponseType: reflect.TypeOf(SearchResult{}), IsListResponse: true})
+}
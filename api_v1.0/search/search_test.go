@@ -0,0 +1,118 @@
+package search
+
+import (
+	"colmanback/objects/airline"
+	"colmanback/objects/country"
+	"colmanback/test_util"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	codeConst    = "iata:srch"
+	nameConst    = "Search Test Airways"
+	iataConst    = "srch"
+	countryConst = "gb"
+)
+
+type testResult struct {
+	Code   string `json:"code"`
+	Tag    string `json:"tag"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Object *struct {
+		Code string `json:"code"`
+		Name string `json:"name"`
+	} `json:"object"`
+}
+
+func doSearch(t *testing.T, router *mux.Router, query string, expectedCode int) []testResult {
+	var resultList []testResult
+
+	req, err := http.NewRequest(http.MethodGet, ApiURL+BaseURL+"?"+query, nil)
+	if err != nil {
+		t.Fatalf("An error has been reported when preparing the search request for %s. Error: %v", query, err)
+	}
+
+	resp := test_util.ExecuteRequest(router, req)
+	if resp.Code != expectedCode {
+		t.Errorf("Status code not as expected for search %s. Expected %d but got %d", query, expectedCode, resp.Code)
+	} else if resp.Code == http.StatusOK {
+		unmarshallErr := json.Unmarshal(resp.Body.Bytes(), &resultList)
+		if unmarshallErr != nil {
+			t.Errorf("The search results for %s cannot be unmarshalled. Error: %v", query, unmarshallErr)
+		}
+	}
+
+	return resultList
+}
+
+func chkAirlineFound(t *testing.T, resultList []testResult, expectHydrated bool) {
+	for _, result := range resultList {
+		if result.Code == codeConst && result.Type == "airline" {
+			if expectHydrated && (result.Object == nil || result.Object.Name != nameConst) {
+				t.Errorf("The airline found has not been hydrated as expected: %+v", result.Object)
+			} else if !expectHydrated && result.Object != nil {
+				t.Errorf("The airline found has been hydrated when it was not requested")
+			}
+
+			return
+		}
+	}
+
+	t.Errorf("The airline %s has not been found in the search results %+v", codeConst, resultList)
+}
+
+func TestSearch(t *testing.T) {
+	router := mux.NewRouter()
+
+	test_util.InitDB()
+
+	country.InitConn()
+	if test_util.IsMemoryDB() {
+		country.LoadCountryList([]country.Country{{Code: countryConst, Continent: "Europe", Name: "United Kingdom"}})
+	}
+
+	airline.InitConn()
+
+	InitRouter(router)
+
+	airlineInst := &airline.Airline{Code: codeConst, Iata: iataConst, Name: nameConst, Country: countryConst}
+	if existingInst, err := airline.GetByCode(codeConst); err == nil {
+		airlineInst.Version = existingInst.Version
+	}
+
+	err := airlineInst.Put()
+	if err != nil {
+		t.Fatalf("Cannot put the test airline. Error: %v", err)
+	}
+	defer airlineInst.Delete()
+
+	t.Log("The airline is found by name, case-insensitively")
+	chkAirlineFound(t, doSearch(t, router, "q=search+test+airways", http.StatusOK), false)
+
+	t.Log("The airline is found by a part of its IATA code, filtered by type and hydrated")
+	chkAirlineFound(t, doSearch(t, router, "q=src&type=airline&hydrate=true", http.StatusOK), true)
+
+	t.Log("Filtering by another type leaves the airline out")
+	for _, result := range doSearch(t, router, "q=search+test+airways&type=country", http.StatusOK) {
+		if result.Type != "country" {
+			t.Errorf("Result of type %s returned when filtering by country", result.Type)
+		}
+	}
+
+	t.Log("The number of results is limited")
+	resultList := doSearch(t, router, "q=a&limit=1", http.StatusOK)
+	if len(resultList) != 1 {
+		t.Errorf("Expected a single result but got %d", len(resultList))
+	}
+
+	t.Log("Invalid requests are rejected")
+	doSearch(t, router, "", http.StatusBadRequest)
+	doSearch(t, router, "q=srch&limit=0", http.StatusBadRequest)
+	doSearch(t, router, "q=srch&type=planet", http.StatusBadRequest)
+	doSearch(t, router, "q=srch&hydrate=maybe", http.StatusBadRequest)
+}
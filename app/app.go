@@ -1,67 +1,347 @@
 package app
 
 import (
+	"colmanback/api_util"
+	adminapi "colmanback/api_v1.0/admin"
 	airlineapi "colmanback/api_v1.0/airline"
 	airplaneapi "colmanback/api_v1.0/airplane"
 	airplanemakeapi "colmanback/api_v1.0/airplanemake"
 	countryapi "colmanback/api_v1.0/country"
+	healthapi "colmanback/api_v1.0/health"
 	modelapi "colmanback/api_v1.0/model"
 	modelmakeapi "colmanback/api_v1.0/modelmake"
+	openapiapi "colmanback/api_v1.0/openapi"
+	searchapi "colmanback/api_v1.0/search"
+	"colmanback/auth"
+	"colmanback/config"
+	"colmanback/db/disk"
 	"colmanback/db/dyno"
+	"colmanback/db/factory"
+	"colmanback/db/s3"
+	"colmanback/db/sqlite"
 	airlineobject "colmanback/objects/airline"
 	airplaneobject "colmanback/objects/airplane"
 	airplanemakeobject "colmanback/objects/airplanemake"
 	countryobject "colmanback/objects/country"
 	modelobject "colmanback/objects/model"
 	modelmakeobject "colmanback/objects/modelmake"
+	"context"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gorilla/mux"
 )
 
+// Clients are asked to retry after STARTUP_RETRY_AFTER seconds while the server is starting.
+const STARTUP_RETRY_AFTER = "5"
+
+// App serves the API with the settings of Config. Authentication is disabled when Config
+// gives neither API keys nor a JWT secret.
 type App struct {
-	Sess *session.Session
-	Port string
+	Sess   *session.Session
+	Config config.Config
+
+	authInst *auth.Middleware
+}
+
+// switchHandler serves the requests with the handler last stored in it, so that the routes
+// can be swapped in once the connections are initialised.
+type switchHandler struct {
+	handler atomic.Value
 }
 
 //----------------------------------------------------------------------------------------
-func (appInst *App) initConn() {
-	appInst.Sess = session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+func (appInst *App) initConn() error {
+	configInst := &appInst.Config
+
+	err := configInst.Validate()
+	if err != nil {
+		return err
+	}
+
+	factory.Type = configInst.DBType
+	if configInst.DBType == factory.DYNO {
+		options := session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+			Profile:           configInst.AWSProfile,
+		}
+
+		if len(configInst.AWSRegion) > 0 {
+			options.Config.Region = aws.String(configInst.AWSRegion)
+		}
+
+		if len(configInst.AWSAccessKeyID) > 0 {
+			options.Config.Credentials = credentials.NewStaticCredentials(configInst.AWSAccessKeyID, configInst.AWSSecretAccessKey, "")
+		}
+
+		appInst.Sess, err = session.NewSessionWithOptions(options)
+		if err != nil {
+			return fmt.Errorf("cannot create the AWS session. Error: %w", err)
+		}
+
+		// Endpoints left empty are resolved by the SDK to the AWS ones of the region.
+		dyno.Conn = dynamodb.New(appInst.Sess, &aws.Config{Endpoint: aws.String(configInst.DynamoDBEndpoint)})
+		dyno.TablePrefix = configInst.TablePrefix
+		dyno.DefaultScanSegments = configInst.ScanSegments
+		dyno.CreateTables = configInst.CreateResources
+		s3.Sess = appInst.Sess.Copy(&aws.Config{
+			Endpoint:         aws.String(configInst.S3Endpoint),
+			S3ForcePathStyle: aws.Bool(configInst.S3PathStyle),
+		})
+		modelobject.PictureIndexName = configInst.PictureIndex
+		modelobject.PictureBucket = configInst.PictureBucket
+		modelobject.MaxPictureEntries = configInst.MaxGetEntries
+
+		if configInst.CreateResources {
+			err = s3.CreateBucket(configInst.PictureBucket)
+			if err != nil {
+				return err
+			}
+		}
+	} else if configInst.DBType == factory.SQLITE {
+		err := sqlite.Open(configInst.SQLitePath)
+		if err != nil {
+			return fmt.Errorf("cannot initialise the sqlite database. Error: %w", err)
+		}
+
+		disk.RootDir = configInst.FilePath
+	}
+
+	initConnList := []func() error{
+		airlineobject.InitConn,
+		airplanemakeobject.InitConn,
+		airplaneobject.InitConn,
+		countryobject.InitConn,
+		modelmakeobject.InitConn,
+		modelobject.InitConn,
+		appInst.migrateModels,
+		modelobject.InitSearchIndex,
+	}
+
+	for _, initConn := range initConnList {
+		err := initConn()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+// migrateModels copies the models stored before collections, if the config asks for it.
+func (appInst *App) migrateModels() error {
+	if !appInst.Config.MigrateModels {
+		return nil
+	}
+
+	copyCount, err := modelobject.MigrateLegacyModels(appInst.Config.LegacyModelOwner)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%d models copied from table %s into the collection of %q", copyCount, modelobject.LEGACY_STORE_NAME, appInst.Config.LegacyModelOwner)
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+// initAuth sets up the authenticators of the API key file and of the JWT secret, if given.
+func (appInst *App) initAuth() error {
+	var authenticatorList []auth.Authenticator
+
+	configInst := &appInst.Config
+	if len(configInst.APIKeyFile) > 0 {
+		apiKeyInst, err := auth.LoadAPIKeyFile(configInst.APIKeyFile)
+		if err != nil {
+			return err
+		}
+
+		authenticatorList = append(authenticatorList, apiKeyInst)
+	}
+
+	if len(configInst.JWTSecretFile) > 0 {
+		secret, err := os.ReadFile(configInst.JWTSecretFile)
+		if err != nil {
+			return fmt.Errorf("cannot read the JWT secret file %s. Error: %w", configInst.JWTSecretFile, err)
+		}
 
-	dyno.Conn = dynamodb.New(appInst.Sess)
+		jwtInst, err := auth.NewJWTAuthenticator([]byte(strings.TrimSpace(string(secret))))
+		if err != nil {
+			return err
+		}
 
-	airlineobject.InitConn()
-	airplanemakeobject.InitConn()
-	airplaneobject.InitConn()
-	countryobject.InitConn()
-	modelmakeobject.InitConn()
-	modelobject.InitConn()
+		jwtInst.Issuer = configInst.JWTIssuer
+		jwtInst.Audience = configInst.JWTAudience
+		authenticatorList = append(authenticatorList, jwtInst)
+	}
+
+	if len(authenticatorList) == 0 {
+		log.Printf("Authentication is disabled, anyone can write to the API")
+		return nil
+	}
+
+	appInst.authInst = &auth.Middleware{AuthenticatorList: authenticatorList, PublicPathList: []string{healthapi.HealthURL, healthapi.ReadyURL}}
+
+	return nil
 }
 
 //----------------------------------------------------------------------------------------
 func (appInst *App) initRoutes() *mux.Router {
 	router := mux.NewRouter().SkipClean(true).UseEncodedPath()
+	router.Use(api_util.RequestIDMiddleware)
+	if appInst.authInst != nil {
+		router.Use(appInst.authInst.Handler)
+	}
 
+	adminapi.InitRouter(router)
 	airlineapi.InitRouter(router)
 	airplanemakeapi.InitRouter(router)
 	airplaneapi.InitRouter(router)
 	countryapi.InitRouter(router)
+	healthapi.InitRouter(router)
 	modelapi.InitRouter(router)
 	modelmakeapi.InitRouter(router)
+	openapiapi.InitRouter(router)
+	searchapi.InitRouter(router)
 
 	return router
 }
 
 //----------------------------------------------------------------------------------------
+// initStartupRoutes returns the routes served while the connections are initialised: the
+// health checks and the diagnostics, every other request being reported as unavailable.
+func (appInst *App) initStartupRoutes() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(api_util.RequestIDMiddleware)
+	if appInst.authInst != nil {
+		router.Use(appInst.authInst.Handler)
+	}
+
+	healthapi.InitRouter(router)
+	router.NotFoundHandler = api_util.RequestIDMiddleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		api_util.SetupCORSResponse(&writer)
+		writer.Header().Set("Retry-After", STARTUP_RETRY_AFTER)
+		api_util.WriteMsg(&writer, http.StatusServiceUnavailable, "The server is starting, its caches are being loaded.")
+	}))
+
+	return router
+}
+
+//----------------------------------------------------------------------------------------
+func (handlerInst *switchHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	handlerInst.handler.Load().(http.Handler).ServeHTTP(writer, request)
+}
+
+//----------------------------------------------------------------------------------------
+// start initialises the connections and then swaps the routes of the API into routes. The
+// adapters are published to the health checks by SetReady, and to the other routes by the
+// store of the handler, both after they have been configured.
+func (appInst *App) start(routes *switchHandler) error {
+	err := appInst.initConn()
+	if err != nil {
+		return err
+	}
+
+	healthapi.SetReady(true)
+	routes.handler.Store(appInst.initRoutes())
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+// newServer returns the server of handler, with the timeouts and size limits of the config.
+func (appInst *App) newServer(handler http.Handler) *http.Server {
+	configInst := &appInst.Config
+
+	return &http.Server{
+		Addr:              configInst.Addr,
+		Handler:           api_util.BodyLimitMiddleware(int64(configInst.MaxBodyBytes))(handler),
+		ReadTimeout:       time.Duration(configInst.ReadTimeout),
+		ReadHeaderTimeout: time.Duration(configInst.ReadHeaderTimeout),
+		WriteTimeout:      time.Duration(configInst.WriteTimeout),
+		IdleTimeout:       time.Duration(configInst.IdleTimeout),
+		MaxHeaderBytes:    configInst.MaxHeaderBytes,
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// run serves the requests accepted by listener until a signal is received on stopChan. The
+// requests in flight are then given the shutdown timeout to finish. It returns an error if
+// the listener fails or if requests had to be cut off.
+func (appInst *App) run(server *http.Server, listener net.Listener, stopChan <-chan os.Signal) error {
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errChan:
+		return fmt.Errorf("the listener on %s has failed. Error: %w", listener.Addr(), err)
+	case stopSignal := <-stopChan:
+		healthapi.SetReady(false)
+		log.Printf("Received %v, waiting up to %v for the requests in flight", stopSignal, appInst.Config.ShutdownTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(appInst.Config.ShutdownTimeout))
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		server.Close()
+		return fmt.Errorf("the requests in flight could not finish in time. Error: %w", err)
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+// Serve starts listening before the connections are initialised, so that the health checks
+// can be answered while the caches are loaded. The other routes are served once they are.
 func (appInst *App) Serve() {
-	appInst.initConn()
-	router := appInst.initRoutes()
+	err := appInst.initAuth()
+	if err != nil {
+		log.Fatalf("Cannot initialise authentication. Error: %v", err)
+	}
+
+	routes := &switchHandler{}
+	routes.handler.Store(appInst.initStartupRoutes())
+	server := appInst.newServer(routes)
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatalf("Cannot listen on %s. Error: %v", server.Addr, err)
+	}
+
+	go func() {
+		err := appInst.start(routes)
+		if err != nil {
+			log.Fatalf("Cannot initialise the database connection. Error: %v", err)
+		}
+
+		log.Printf("The caches are loaded, the server is ready")
+	}()
+
+	stopChan := make(chan os.Signal, 1)
+	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
+
+	log.Printf("Staring web server on %s for environment %q\n", listener.Addr(), appInst.Config.Env)
+	err = appInst.run(server, listener, stopChan)
+	if err != nil {
+		log.Fatalf("The web server has stopped. Error: %v", err)
+	}
 
-	log.Printf("Staring web server on port %s\n", appInst.Port)
-	http.ListenAndServe(appInst.Port, router)
+	log.Printf("The web server has stopped")
 }
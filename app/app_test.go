@@ -0,0 +1,337 @@
+package app
+
+import (
+	"colmanback/api_util"
+	healthapi "colmanback/api_v1.0/health"
+	"colmanback/auth"
+	"colmanback/config"
+	"colmanback/db/factory"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOpenAPI(t *testing.T) {
+	var spec struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+
+	appInst := &App{Config: config.Default()}
+	appInst.Config.DBType = factory.MEMORY
+	if err := appInst.initConn(); err != nil {
+		t.Fatalf("Cannot initialise the database connection. Error: %v", err)
+	}
+
+	router := appInst.initRoutes()
+
+	t.Log("Every route is described")
+	if _, undescribedList := api_util.BuildOpenAPI(router); len(undescribedList) > 0 {
+		t.Errorf("Routes missing from the OpenAPI document: %v", undescribedList)
+	}
+
+	t.Log("The document is served")
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Status code not as expected for the OpenAPI document. Code %d", resp.Code)
+	}
+
+	if err := json.Unmarshal(resp.Body.Bytes(), &spec); err != nil || spec.OpenAPI != api_util.OPENAPI_VERSION {
+		t.Fatalf("The OpenAPI document cannot be unmarshalled. Error: %v", err)
+	}
+
+	for path, methodList := range map[string][]string{
+		"/api/v1/model":                                 {"get", "put"},
+		"/api/v1/model/{modelID}":                       {"get", "patch", "delete"},
+		"/api/v1/model/picture/{pictureID}/tag":         {"put"},
+		"/api/v1/model/picture/{pictureID}/untag":       {"put"},
+		"/api/v1/country/{countryID}":                   {"get"},
+		"/api/v1/admin/broken-refs":                     {"get"},
+		"/api/v1/model/picture/{pictureID}/list-models": {"get"},
+	} {
+		for _, method := range methodList {
+			if _, isFound := spec.Paths[path][method]; !isFound {
+				t.Errorf("Operation %s %s missing from the OpenAPI document", method, path)
+			}
+		}
+	}
+
+	if _, isFound := spec.Paths["/api/v1/country"]["put"]; isFound {
+		t.Errorf("Countries cannot be put but the OpenAPI document says otherwise")
+	}
+
+	t.Log("The schemas follow the JSON tags of the objects")
+	for schemaName, propertyList := range map[string][]string{
+		"Model":        {"code", "modelMake", "airlineDetails", "brokenRefs"},
+		"Airline":      {"iata", "countryDetails"},
+		"Airplane":     {"make", "makeDetails"},
+		"AirplaneMake": {"abbreviation"},
+		"Country":      {"continent"},
+		"ModelMake":    {"name"},
+		"Problem":      {"errorCode", "requestId"},
+	} {
+		for _, property := range propertyList {
+			if _, isFound := spec.Components.Schemas[schemaName].Properties[property]; !isFound {
+				t.Errorf("Property %s missing from schema %s", property, schemaName)
+			}
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "keys.json")
+	os.WriteFile(keyFile, []byte(`[{"key": "viewer-key", "subject": "vera", "role": "viewer"}, {"key": "editor-key", "subject": "ed", "role": "editor"}]`), 0600)
+
+	appInst := &App{Config: config.Default()}
+	appInst.Config.DBType = factory.MEMORY
+	appInst.Config.APIKeyFile = keyFile
+	if err := appInst.initConn(); err != nil {
+		t.Fatalf("Cannot initialise the database connection. Error: %v", err)
+	}
+
+	if err := appInst.initAuth(); err != nil {
+		t.Fatalf("Cannot initialise authentication. Error: %v", err)
+	}
+
+	router := appInst.initRoutes()
+
+	for _, requestInst := range []struct {
+		method string
+		url    string
+		key    string
+		status int
+	}{
+		{http.MethodGet, "/api/v1/country", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/country", "viewer-key", http.StatusOK},
+		{http.MethodPut, "/api/v1/airline", "viewer-key", http.StatusForbidden},
+		{http.MethodDelete, "/api/v1/airline/iata:BA", "viewer-key", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/model/picture/add", "viewer-key", http.StatusForbidden},
+		{http.MethodPut, "/api/v1/airline", "editor-key", http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest(requestInst.method, requestInst.url, strings.NewReader("{"))
+		if len(requestInst.key) > 0 {
+			req.Header.Set(auth.APIKeyHeader, requestInst.key)
+		}
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if resp.Code != requestInst.status {
+			t.Errorf("Expected status %d for %s %s with key %q, got %d: %s", requestInst.status, requestInst.method, requestInst.url, requestInst.key, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan bool)
+	release := make(chan bool)
+
+	appInst := &App{Config: config.Default()}
+	appInst.Config.MaxBodyBytes = 16
+	appInst.Config.ShutdownTimeout = config.Duration(time.Second)
+	server := appInst.newServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		started <- true
+		<-release
+		writer.Write([]byte("done"))
+	}))
+
+	t.Log("Bodies over the limit are rejected before the handler is called")
+	req, _ := http.NewRequest(http.MethodPut, "/api/v1/airline", strings.NewReader(strings.Repeat("x", 17)))
+	resp := httptest.NewRecorder()
+	server.Handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusRequestEntityTooLarge, resp.Code, resp.Body.String())
+	}
+
+	t.Log("The requests in flight are drained when the server is stopped")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen. Error: %v", err)
+	}
+
+	stopChan := make(chan os.Signal, 1)
+	runErrChan := make(chan error, 1)
+	go func() {
+		runErrChan <- appInst.run(server, listener, stopChan)
+	}()
+
+	bodyChan := make(chan string, 1)
+	go func() {
+		getResp, getErr := http.Get("http://" + listener.Addr().String() + "/")
+		if getErr != nil {
+			bodyChan <- getErr.Error()
+			return
+		}
+
+		defer getResp.Body.Close()
+		body, _ := io.ReadAll(getResp.Body)
+		bodyChan <- string(body)
+	}()
+
+	<-started
+	stopChan <- syscall.SIGTERM
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if body := <-bodyChan; body != "done" {
+		t.Errorf("Expected the request in flight to finish, got %s", body)
+	}
+
+	if err := <-runErrChan; err != nil {
+		t.Errorf("Expected a clean shutdown. Error: %v", err)
+	}
+
+	t.Log("A failing listener is reported")
+	listener, _ = net.Listen("tcp", "127.0.0.1:0")
+	listener.Close()
+	if err := appInst.run(appInst.newServer(http.NotFoundHandler()), listener, make(chan os.Signal)); err == nil {
+		t.Errorf("Expected the closed listener to be reported")
+	}
+}
+
+func TestHealth(t *testing.T) {
+	var reportInst healthapi.Report
+	var statusInst healthapi.Status
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "keys.json")
+	os.WriteFile(keyFile, []byte(`[{"key": "viewer-key", "subject": "vera", "role": "viewer"}]`), 0600)
+
+	appInst := &App{Config: config.Default()}
+	appInst.Config.DBType = factory.MEMORY
+	appInst.Config.APIKeyFile = keyFile
+	if err := appInst.initAuth(); err != nil {
+		t.Fatalf("Cannot initialise authentication. Error: %v", err)
+	}
+
+	healthapi.SetReady(false)
+	defer healthapi.SetReady(false)
+
+	serve := func(router http.Handler, url string, key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		if len(key) > 0 {
+			req.Header.Set(auth.APIKeyHeader, key)
+		}
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	t.Log("While starting, the health checks are answered and the other routes are unavailable")
+	startupRouter := appInst.initStartupRoutes()
+	for _, requestInst := range []struct {
+		url    string
+		key    string
+		status int
+	}{
+		{healthapi.HealthURL, "", http.StatusOK},
+		{healthapi.ReadyURL, "", http.StatusServiceUnavailable},
+		{healthapi.StatusURL, "", http.StatusUnauthorized},
+		{healthapi.StatusURL, "viewer-key", http.StatusOK},
+		{"/api/v1/airline", "viewer-key", http.StatusServiceUnavailable},
+	} {
+		if resp := serve(startupRouter, requestInst.url, requestInst.key); resp.Code != requestInst.status {
+			t.Errorf("Expected status %d for %s with key %q, got %d: %s", requestInst.status, requestInst.url, requestInst.key, resp.Code, resp.Body.String())
+		}
+	}
+
+	if resp := serve(startupRouter, "/api/v1/airline", "viewer-key"); resp.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a Retry-After header while starting")
+	}
+
+	t.Log("Once the connections are initialised, every check passes")
+	if err := appInst.initConn(); err != nil {
+		t.Fatalf("Cannot initialise the database connection. Error: %v", err)
+	}
+
+	healthapi.SetReady(true)
+	router := appInst.initRoutes()
+
+	resp := serve(router, healthapi.ReadyURL, "")
+	if err := json.Unmarshal(resp.Body.Bytes(), &reportInst); err != nil || resp.Code != http.StatusOK || reportInst.Status != healthapi.STATUS_OK || len(reportInst.Checks) != 8 {
+		t.Errorf("Unexpected readiness %d: %s. Error: %v", resp.Code, resp.Body.String(), err)
+	}
+
+	resp = serve(router, healthapi.StatusURL, "viewer-key")
+	if err := json.Unmarshal(resp.Body.Bytes(), &statusInst); err != nil || !statusInst.Ready || len(statusInst.Adapters) != 6 || statusInst.SearchIndex == nil || statusInst.Build.Version == "" {
+		t.Fatalf("Unexpected status %s. Error: %v", resp.Body.String(), err)
+	}
+
+	for _, adapterStatus := range statusInst.Adapters {
+		if !adapterStatus.KeepCache || adapterStatus.CacheTime == nil {
+			t.Errorf("Expected the cache of %s to be loaded, got %+v", adapterStatus.TableName, adapterStatus)
+		}
+	}
+}
+
+func TestStartup(t *testing.T) {
+	appInst := &App{Config: config.Default()}
+	appInst.Config.DBType = factory.MEMORY
+
+	healthapi.SetReady(false)
+	defer healthapi.SetReady(false)
+
+	routes := &switchHandler{}
+	routes.handler.Store(appInst.initStartupRoutes())
+
+	t.Log("The diagnostics are served while the connections are initialised")
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- appInst.start(routes)
+	}()
+
+	isStarted := false
+	for !isStarted {
+		select {
+		case err := <-errChan:
+			if err != nil {
+				t.Fatalf("Cannot start. Error: %v", err)
+			}
+			isStarted = true
+		default:
+		}
+
+		for _, url := range []string{healthapi.StatusURL, healthapi.ReadyURL} {
+			var statusInst healthapi.Status
+
+			req, _ := http.NewRequest(http.MethodGet, url, nil)
+			resp := httptest.NewRecorder()
+			routes.ServeHTTP(resp, req)
+
+			if url == healthapi.StatusURL {
+				if err := json.Unmarshal(resp.Body.Bytes(), &statusInst); err != nil || resp.Code != http.StatusOK || statusInst.Ready != (len(statusInst.Adapters) == 6) {
+					t.Fatalf("Unexpected status %d: %s. Error: %v", resp.Code, resp.Body.String(), err)
+				}
+			}
+		}
+	}
+
+	t.Log("Once started, the adapters are reported")
+	req, _ := http.NewRequest(http.MethodGet, healthapi.StatusURL, nil)
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+
+	var statusInst healthapi.Status
+	if err := json.Unmarshal(resp.Body.Bytes(), &statusInst); err != nil || !statusInst.Ready || len(statusInst.Adapters) != 6 {
+		t.Errorf("Expected the adapters to be reported, got %s. Error: %v", resp.Body.String(), err)
+	}
+}
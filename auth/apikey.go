@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+)
+
+// APIKey is an entry of the API key file, which holds a JSON list of them.
+type APIKey struct {
+	Key     string `json:"key"`
+	Subject string `json:"subject"`
+	Role    Role   `json:"role"`
+}
+
+// APIKeyAuthenticator accepts the static keys sent in the X-API-Key header. Keys are looked
+// up by their hash, so that the time taken does not depend on how much of a key matches.
+type APIKeyAuthenticator struct {
+	principalMap map[[sha256.Size]byte]*Principal
+}
+
+//----------------------------------------------------------------------------------------
+// NewAPIKeyAuthenticator returns the authenticator of keyList. Every key must be unique and
+// come with a subject and a valid role.
+func NewAPIKeyAuthenticator(keyList []APIKey) (*APIKeyAuthenticator, error) {
+	authenticatorInst := APIKeyAuthenticator{principalMap: make(map[[sha256.Size]byte]*Principal)}
+
+	for index, keyInst := range keyList {
+		if len(keyInst.Key) == 0 || len(keyInst.Subject) == 0 {
+			return nil, fmt.Errorf("API key %d has no key or no subject", index)
+		}
+
+		if !keyInst.Role.IsValid() {
+			return nil, fmt.Errorf("API key of %s has the unknown role %q", keyInst.Subject, keyInst.Role)
+		}
+
+		hash := sha256.Sum256([]byte(keyInst.Key))
+		if _, isFound := authenticatorInst.principalMap[hash]; isFound {
+			return nil, fmt.Errorf("API key of %s is used more than once", keyInst.Subject)
+		}
+
+		authenticatorInst.principalMap[hash] = &Principal{Subject: keyInst.Subject, Role: keyInst.Role}
+	}
+
+	return &authenticatorInst, nil
+}
+
+//----------------------------------------------------------------------------------------
+// LoadAPIKeyFile returns the authenticator of the keys listed in the JSON file at path.
+func LoadAPIKeyFile(path string) (*APIKeyAuthenticator, error) {
+	var keyList []APIKey
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the API key file %s. Error: %w", path, err)
+	}
+
+	err = json.Unmarshal(content, &keyList)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the API key file %s. Error: %w", path, err)
+	}
+
+	return NewAPIKeyAuthenticator(keyList)
+}
+
+//----------------------------------------------------------------------------------------
+func (authenticatorInst *APIKeyAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	key := request.Header.Get(APIKeyHeader)
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	principal, isFound := authenticatorInst.principalMap[sha256.Sum256([]byte(key))]
+	if !isFound {
+		return nil, fmt.Errorf("the API key is not known: %w", ErrInvalidCredentials)
+	}
+
+	return principal, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (authenticatorInst *APIKeyAuthenticator) Challenge() string {
+	return `ApiKey header="` + APIKeyHeader + `"`
+}
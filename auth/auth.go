@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"colmanback/api_util"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Role is what a user is allowed to do. Every role includes the roles ranked below it.
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+)
+
+var roleRankMap = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+}
+
+// ErrInvalidCredentials is wrapped by the errors of the authenticators when a request
+// carries credentials that cannot be accepted.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is the authenticated user a request is made on behalf of.
+type Principal struct {
+	Subject string `json:"subject"`
+	Role    Role   `json:"role"`
+}
+
+// Authenticator checks the credentials of one kind a request may carry.
+type Authenticator interface {
+	// Authenticate returns the principal the credentials of request belong to, nil if request
+	// carries no credentials of the kind handled, or an error if they are not valid.
+	Authenticate(request *http.Request) (*Principal, error)
+
+	// Challenge is the WWW-Authenticate value of the responses to unauthenticated requests.
+	Challenge() string
+}
+
+// Middleware authenticates every request with the first authenticator that recognises its
+// credentials, then checks that the role of the principal allows the method: viewers may
+// only read, editors may also write and delete. The paths of PublicPathList, such as the
+// health checks, are served to anyone.
+type Middleware struct {
+	AuthenticatorList []Authenticator
+	PublicPathList    []string
+}
+
+type contextKey int
+
+const principalKey contextKey = 0
+
+//----------------------------------------------------------------------------------------
+func (role Role) IsValid() bool {
+	_, isFound := roleRankMap[role]
+	return isFound
+}
+
+//----------------------------------------------------------------------------------------
+// Includes reports whether role grants everything the required role does.
+func (role Role) Includes(required Role) bool {
+	return role.IsValid() && roleRankMap[role] >= roleRankMap[required]
+}
+
+//----------------------------------------------------------------------------------------
+// RequiredRole returns the role needed to make a request with method.
+func RequiredRole(method string) Role {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return RoleViewer
+	default:
+		return RoleEditor
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// NewContext returns a copy of ctx carrying principal, whose subject is the owner of the
+// collection of the caller.
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(api_util.NewOwnerContext(ctx, principal.Subject), principalKey, principal)
+}
+
+//----------------------------------------------------------------------------------------
+// FromRequest returns the principal set by the middleware, or nil if authentication is
+// not enabled.
+func FromRequest(request *http.Request) *Principal {
+	principal, _ := request.Context().Value(principalKey).(*Principal)
+	return principal
+}
+
+//----------------------------------------------------------------------------------------
+func (middlewareInst *Middleware) isPublic(request *http.Request) bool {
+	for _, path := range middlewareInst.PublicPathList {
+		if request.URL.Path == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+//----------------------------------------------------------------------------------------
+func (middlewareInst *Middleware) authenticate(request *http.Request) (*Principal, error) {
+	for _, authenticatorInst := range middlewareInst.AuthenticatorList {
+		principal, err := authenticatorInst.Authenticate(request)
+		if err != nil || principal != nil {
+			return principal, err
+		}
+	}
+
+	return nil, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (middlewareInst *Middleware) writeUnauthorized(writer http.ResponseWriter, detail string) {
+	for _, authenticatorInst := range middlewareInst.AuthenticatorList {
+		writer.Header().Add("WWW-Authenticate", authenticatorInst.Challenge())
+	}
+
+	api_util.WriteProblem(&writer, api_util.NewProblem(http.StatusUnauthorized, detail))
+}
+
+//----------------------------------------------------------------------------------------
+// Handler is the gorilla middleware. Preflight requests are let through unauthenticated,
+// since browsers never send credentials with them.
+func (middlewareInst *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodOptions || middlewareInst.isPublic(request) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		api_util.SetupCORSResponse(&writer)
+
+		principal, err := middlewareInst.authenticate(request)
+		if err != nil {
+			middlewareInst.writeUnauthorized(writer, err.Error())
+			return
+		} else if principal == nil {
+			middlewareInst.writeUnauthorized(writer, "authentication is required")
+			return
+		}
+
+		requiredRole := RequiredRole(request.Method)
+		if !principal.Role.Includes(requiredRole) {
+			detail := fmt.Sprintf("%s has the %s role, %s requests need the %s role", principal.Subject, principal.Role, request.Method, requiredRole)
+			api_util.WriteProblem(&writer, api_util.NewProblem(http.StatusForbidden, detail))
+			return
+		}
+
+		next.ServeHTTP(writer, request.WithContext(NewContext(request.Context(), principal)))
+	})
+}
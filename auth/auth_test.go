@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"colmanback/api_util"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func newTestHandler(t *testing.T) (http.Handler, *JWTAuthenticator) {
+	apiKeyInst, err := NewAPIKeyAuthenticator([]APIKey{
+		{Key: "viewer-key", Subject: "vera", Role: RoleViewer},
+		{Key: "editor-key", Subject: "ed", Role: RoleEditor},
+	})
+	if err != nil {
+		t.Fatalf("Cannot create the API key authenticator. Error: %v", err)
+	}
+
+	jwtInst, err := NewJWTAuthenticator([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("Cannot create the JWT authenticator. Error: %v", err)
+	}
+
+	middlewareInst := Middleware{AuthenticatorList: []Authenticator{apiKeyInst, jwtInst}}
+	handler := middlewareInst.Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if principal := FromRequest(request); principal != nil {
+			writer.Write([]byte(principal.Subject))
+		}
+	}))
+
+	return handler, jwtInst
+}
+
+func serve(handler http.Handler, method string, headerMap map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/api/v1/airline", nil)
+	for name, value := range headerMap {
+		req.Header.Set(name, value)
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func TestMiddleware(t *testing.T) {
+	var problem api_util.Problem
+
+	handler, jwtInst := newTestHandler(t)
+	editorToken, _ := jwtInst.Sign(Claims{Subject: "jo", Role: RoleEditor, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	viewerToken, _ := jwtInst.Sign(Claims{Subject: "val", Role: RoleViewer, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+
+	requestList := []struct {
+		method    string
+		headerMap map[string]string
+		status    int
+		subject   string
+	}{
+		{http.MethodGet, nil, http.StatusUnauthorized, ""},
+		{http.MethodOptions, nil, http.StatusOK, ""},
+		{http.MethodGet, map[string]string{APIKeyHeader: "viewer-key"}, http.StatusOK, "vera"},
+		{http.MethodPut, map[string]string{APIKeyHeader: "viewer-key"}, http.StatusForbidden, ""},
+		{http.MethodDelete, map[string]string{APIKeyHeader: "editor-key"}, http.StatusOK, "ed"},
+		{http.MethodGet, map[string]string{APIKeyHeader: "unknown-key"}, http.StatusUnauthorized, ""},
+		{http.MethodPost, map[string]string{"Authorization": "Bearer " + editorToken}, http.StatusOK, "jo"},
+		{http.MethodPatch, map[string]string{"Authorization": "bearer " + viewerToken}, http.StatusForbidden, ""},
+		{http.MethodGet, map[string]string{"Authorization": "Bearer " + viewerToken + "x"}, http.StatusUnauthorized, ""},
+		{http.MethodGet, map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}, http.StatusUnauthorized, ""},
+	}
+
+	for _, requestInst := range requestList {
+		resp := serve(handler, requestInst.method, requestInst.headerMap)
+		if resp.Code != requestInst.status {
+			t.Errorf("Expected status %d for %s %v, got %d: %s", requestInst.status, requestInst.method, requestInst.headerMap, resp.Code, resp.Body.String())
+			continue
+		}
+
+		if resp.Code == http.StatusOK {
+			if resp.Body.String() != requestInst.subject {
+				t.Errorf("Expected principal %s for %s %v, got %s", requestInst.subject, requestInst.method, requestInst.headerMap, resp.Body.String())
+			}
+			continue
+		}
+
+		if resp.Header().Get(api_util.ContentType) != api_util.ContentTypeProblemJSON {
+			t.Errorf("Expected a problem for %s %v, got %s", requestInst.method, requestInst.headerMap, resp.Body.String())
+		}
+
+		err := json.Unmarshal(resp.Body.Bytes(), &problem)
+		if err != nil || problem.ErrorCode != api_util.StatusErrorCode(requestInst.status) {
+			t.Errorf("Unexpected problem %s. Error: %v", resp.Body.String(), err)
+		}
+
+		if requestInst.status == http.StatusUnauthorized && len(resp.Header().Values("WWW-Authenticate")) != 2 {
+			t.Errorf("Expected a challenge per authenticator, got %v", resp.Header().Values("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestJWTVerify(t *testing.T) {
+	jwtInst, err := NewJWTAuthenticator([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("Cannot create the JWT authenticator. Error: %v", err)
+	}
+
+	jwtInst.Issuer = "colman"
+	jwtInst.Audience = "colmanback"
+	now := time.Now()
+	valid := Claims{Subject: "jo", Issuer: "colman", Audience: audience{"other", "colmanback"}, ExpiresAt: now.Add(time.Hour).Unix(), Role: RoleEditor}
+
+	token, _ := jwtInst.Sign(valid)
+	if claims, err := jwtInst.Verify(token); err != nil || claims.Subject != "jo" || claims.Role != RoleEditor {
+		t.Errorf("Expected the token to be valid, got %+v. Error: %v", claims, err)
+	}
+
+	t.Log("A single audience may be given as a string")
+	payload := `{"sub":"jo","iss":"colman","aud":"colmanback","exp":` + jsonInt(now.Add(time.Hour).Unix()) + `,"role":"viewer"}`
+	if _, err := jwtInst.Verify(signRaw(jwtInst, `{"alg":"HS512"}`, payload)); err != nil {
+		t.Errorf("Expected the token with a single audience to be valid. Error: %v", err)
+	}
+
+	invalidList := map[string]string{}
+	for name, claims := range map[string]Claims{
+		"expired":   {Subject: "jo", Issuer: "colman", Audience: valid.Audience, ExpiresAt: now.Add(-time.Hour).Unix(), Role: RoleEditor},
+		"no expiry": {Subject: "jo", Issuer: "colman", Audience: valid.Audience, Role: RoleEditor},
+		"not yet":   {Subject: "jo", Issuer: "colman", Audience: valid.Audience, ExpiresAt: valid.ExpiresAt, NotBefore: now.Add(time.Hour).Unix(), Role: RoleEditor},
+		"issuer":    {Subject: "jo", Issuer: "other", Audience: valid.Audience, ExpiresAt: valid.ExpiresAt, Role: RoleEditor},
+		"audience":  {Subject: "jo", Issuer: "colman", Audience: audience{"other"}, ExpiresAt: valid.ExpiresAt, Role: RoleEditor},
+		"role":      {Subject: "jo", Issuer: "colman", Audience: valid.Audience, ExpiresAt: valid.ExpiresAt, Role: "admin"},
+		"subject":   {Issuer: "colman", Audience: valid.Audience, ExpiresAt: valid.ExpiresAt, Role: RoleEditor},
+	} {
+		invalidList[name], _ = jwtInst.Sign(claims)
+	}
+
+	validPayload := strings.Split(token, ".")[1]
+	invalidList["alg none"] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + validPayload + "."
+	invalidList["malformed"] = "not-a-token"
+
+	otherInst, _ := NewJWTAuthenticator([]byte(strings.Repeat("x", MIN_SECRET_SIZE)))
+	invalidList["other secret"], _ = otherInst.Sign(valid)
+
+	for name, invalidToken := range invalidList {
+		if _, err := jwtInst.Verify(invalidToken); err == nil {
+			t.Errorf("Expected the %s token to be rejected", name)
+		}
+	}
+
+	if _, err := NewJWTAuthenticator([]byte("short")); err == nil {
+		t.Errorf("Expected a short secret to be rejected")
+	}
+}
+
+func TestLoadAPIKeyFile(t *testing.T) {
+	dir := t.TempDir()
+
+	fileList := map[string]string{
+		"valid.json":     `[{"key": "k1", "subject": "ann", "role": "editor"}, {"key": "k2", "subject": "bob", "role": "viewer"}]`,
+		"role.json":      `[{"key": "k1", "subject": "ann", "role": "owner"}]`,
+		"duplicate.json": `[{"key": "k1", "subject": "ann", "role": "editor"}, {"key": "k1", "subject": "bob", "role": "viewer"}]`,
+		"empty.json":     `[{"key": "", "subject": "ann", "role": "editor"}]`,
+	}
+
+	for name, content := range fileList {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+	}
+
+	apiKeyInst, err := LoadAPIKeyFile(filepath.Join(dir, "valid.json"))
+	if err != nil || len(apiKeyInst.principalMap) != 2 {
+		t.Errorf("Expected the valid file to load 2 keys. Error: %v", err)
+	}
+
+	for _, name := range []string{"role.json", "duplicate.json", "empty.json", "missing.json"} {
+		if _, err := LoadAPIKeyFile(filepath.Join(dir, name)); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
+
+func jsonInt(value int64) string {
+	out, _ := json.Marshal(value)
+	return string(out)
+}
+
+func signRaw(jwtInst *JWTAuthenticator, header string, payload string) string {
+	var parsed jwtHeader
+
+	json.Unmarshal([]byte(header), &parsed)
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(jwtInst.sign(parsed.Alg, signingInput))
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	BearerScheme = "Bearer"
+
+	// Secrets shorter than the output of SHA-256 weaken the signatures.
+	MIN_SECRET_SIZE = 32
+)
+
+// Only HMAC signatures are accepted, so that a token cannot pick a weaker algorithm, or none.
+var algHashMap = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// Claims are the members of a token payload that are checked. The subject and the expiry
+// are required, the issuer and the audience only if the authenticator expects them.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Role      Role     `json:"role"`
+}
+
+// audience is either a single string or a list of them in a token.
+type audience []string
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// JWTAuthenticator accepts the HMAC-signed JSON Web Tokens sent as bearer tokens in the
+// Authorization header. Tokens are verified locally with the shared secret.
+type JWTAuthenticator struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+
+	secret []byte
+	now    func() time.Time
+}
+
+//----------------------------------------------------------------------------------------
+func (audienceInst *audience) UnmarshalJSON(content []byte) error {
+	var single string
+
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("[")) {
+		return json.Unmarshal(content, (*[]string)(audienceInst))
+	}
+
+	err := json.Unmarshal(content, &single)
+	if err != nil {
+		return err
+	}
+
+	*audienceInst = audience{single}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (audienceInst audience) contains(value string) bool {
+	for _, item := range audienceInst {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+//----------------------------------------------------------------------------------------
+// NewJWTAuthenticator returns the authenticator of the tokens signed with secret.
+func NewJWTAuthenticator(secret []byte) (*JWTAuthenticator, error) {
+	if len(secret) < MIN_SECRET_SIZE {
+		return nil, fmt.Errorf("the JWT secret must be at least %d bytes long", MIN_SECRET_SIZE)
+	}
+
+	return &JWTAuthenticator{secret: secret, Leeway: time.Minute, now: time.Now}, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (authenticatorInst *JWTAuthenticator) sign(alg string, signingInput string) []byte {
+	mac := hmac.New(algHashMap[alg], authenticatorInst.secret)
+	mac.Write([]byte(signingInput))
+
+	return mac.Sum(nil)
+}
+
+//----------------------------------------------------------------------------------------
+// Sign returns claims as a token signed with HS256.
+func (authenticatorInst *JWTAuthenticator) Sign(claims Claims) (string, error) {
+	headerJson, err := json.Marshal(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claimsJson, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJson) + "." + base64.RawURLEncoding.EncodeToString(claimsJson)
+	signature := authenticatorInst.sign("HS256", signingInput)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+//----------------------------------------------------------------------------------------
+// Verify returns the claims of token once its signature and claims are checked.
+func (authenticatorInst *JWTAuthenticator) Verify(token string) (*Claims, error) {
+	var header jwtHeader
+	var claims Claims
+
+	partList := strings.Split(token, ".")
+	if len(partList) != 3 {
+		return nil, fmt.Errorf("the token is malformed: %w", ErrInvalidCredentials)
+	}
+
+	headerJson, err := base64.RawURLEncoding.DecodeString(partList[0])
+	if err == nil {
+		err = json.Unmarshal(headerJson, &header)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("the token header cannot be decoded: %w", ErrInvalidCredentials)
+	}
+
+	if _, isFound := algHashMap[header.Alg]; !isFound {
+		return nil, fmt.Errorf("the token algorithm %q is not accepted: %w", header.Alg, ErrInvalidCredentials)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(partList[2])
+	if err != nil || !hmac.Equal(signature, authenticatorInst.sign(header.Alg, partList[0]+"."+partList[1])) {
+		return nil, fmt.Errorf("the token signature is not valid: %w", ErrInvalidCredentials)
+	}
+
+	claimsJson, err := base64.RawURLEncoding.DecodeString(partList[1])
+	if err == nil {
+		err = json.Unmarshal(claimsJson, &claims)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("the token claims cannot be decoded: %w", ErrInvalidCredentials)
+	}
+
+	err = authenticatorInst.checkClaims(&claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (authenticatorInst *JWTAuthenticator) checkClaims(claims *Claims) error {
+	now := authenticatorInst.now()
+
+	if len(claims.Subject) == 0 {
+		return fmt.Errorf("the token has no subject: %w", ErrInvalidCredentials)
+	}
+
+	if claims.ExpiresAt == 0 {
+		return fmt.Errorf("the token has no expiry: %w", ErrInvalidCredentials)
+	} else if now.Add(-authenticatorInst.Leeway).After(time.Unix(claims.ExpiresAt, 0)) {
+		return fmt.Errorf("the token has expired: %w", ErrInvalidCredentials)
+	}
+
+	if claims.NotBefore != 0 && now.Add(authenticatorInst.Leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return fmt.Errorf("the token is not valid yet: %w", ErrInvalidCredentials)
+	}
+
+	if len(authenticatorInst.Issuer) > 0 && claims.Issuer != authenticatorInst.Issuer {
+		return fmt.Errorf("the token issuer %q is not accepted: %w", claims.Issuer, ErrInvalidCredentials)
+	}
+
+	if len(authenticatorInst.Audience) > 0 && !claims.Audience.contains(authenticatorInst.Audience) {
+		return fmt.Errorf("the token is not meant for %q: %w", authenticatorInst.Audience, ErrInvalidCredentials)
+	}
+
+	if !claims.Role.IsValid() {
+		return fmt.Errorf("the token has the unknown role %q: %w", claims.Role, ErrInvalidCredentials)
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+// Authenticate ignores the requests without a bearer token, which may carry credentials of
+// another kind.
+func (authenticatorInst *JWTAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	scheme, token, isFound := strings.Cut(request.Header.Get("Authorization"), " ")
+	if !isFound || !strings.EqualFold(scheme, BearerScheme) {
+		return nil, nil
+	}
+
+	claims, err := authenticatorInst.Verify(strings.TrimSpace(token))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{Subject: claims.Subject, Role: claims.Role}, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (authenticatorInst *JWTAuthenticator) Challenge() string {
+	return BearerScheme + ` realm="colmanback"`
+}
@@ -0,0 +1,462 @@
+package config
+
+import (
+	"bytes"
+	"colmanback/db/factory"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Settings are read from, by increasing precedence: their defaults, the config file, the
+// environment and the command line. Every setting has the same name in the config file and
+// on the command line; its environment variable is that name in upper case, with dashes
+// turned into underscores and the ENV_PREFIX in front, e.g. COLMAN_TABLE_PREFIX.
+const (
+	ENV_PREFIX  = "COLMAN_"
+	CONFIG_NAME = "config"
+)
+
+var tablePrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]*$`)
+var bucketPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// Config holds the settings of the server.
+type Config struct {
+	Env  string `json:"env" yaml:"env"`
+	Addr string `json:"addr" yaml:"addr"`
+
+	//Database
+	DBType       factory.AdapterType `json:"db" yaml:"db"`
+	SQLitePath   string              `json:"sqlite-path" yaml:"sqlite-path"`
+	FilePath     string              `json:"file-path" yaml:"file-path"`
+	ScanSegments int                 `json:"scan-segments" yaml:"scan-segments"`
+
+	//AWS
+	AWSRegion     string `json:"aws-region" yaml:"aws-region"`
+	AWSProfile    string `json:"aws-profile" yaml:"aws-profile"`
+	TablePrefix   string `json:"table-prefix" yaml:"table-prefix"`
+	PictureBucket string `json:"picture-bucket" yaml:"picture-bucket"`
+	PictureIndex  string `json:"picture-index" yaml:"picture-index"`
+	MaxGetEntries int    `json:"max-get-entries" yaml:"max-get-entries"`
+
+	//Copy of the models stored before collections
+	MigrateModels    bool   `json:"migrate-models" yaml:"migrate-models"`
+	LegacyModelOwner string `json:"legacy-model-owner" yaml:"legacy-model-owner"`
+
+	//AWS endpoints, to run against DynamoDB Local and MinIO instead of AWS
+	DynamoDBEndpoint   string `json:"dynamodb-endpoint" yaml:"dynamodb-endpoint"`
+	S3Endpoint         string `json:"s3-endpoint" yaml:"s3-endpoint"`
+	S3PathStyle        bool   `json:"s3-path-style" yaml:"s3-path-style"`
+	AWSAccessKeyID     string `json:"aws-access-key-id" yaml:"aws-access-key-id"`
+	AWSSecretAccessKey string `json:"aws-secret-access-key" yaml:"aws-secret-access-key"`
+	CreateResources    bool   `json:"create-resources" yaml:"create-resources"`
+
+	//HTTP server, timeouts of zero are disabled
+	ReadTimeout       Duration `json:"read-timeout" yaml:"read-timeout"`
+	ReadHeaderTimeout Duration `json:"read-header-timeout" yaml:"read-header-timeout"`
+	WriteTimeout      Duration `json:"write-timeout" yaml:"write-timeout"`
+	IdleTimeout       Duration `json:"idle-timeout" yaml:"idle-timeout"`
+	ShutdownTimeout   Duration `json:"shutdown-timeout" yaml:"shutdown-timeout"`
+	MaxHeaderBytes    int      `json:"max-header-bytes" yaml:"max-header-bytes"`
+	MaxBodyBytes      int      `json:"max-body-bytes" yaml:"max-body-bytes"`
+
+	//Authentication
+	APIKeyFile    string `json:"api-key-file" yaml:"api-key-file"`
+	JWTSecretFile string `json:"jwt-secret-file" yaml:"jwt-secret-file"`
+	JWTIssuer     string `json:"jwt-issuer" yaml:"jwt-issuer"`
+	JWTAudience   string `json:"jwt-audience" yaml:"jwt-audience"`
+}
+
+// Duration is a time.Duration written as in "30s" or "2m" in the config file, rather than as a
+// number of nanoseconds.
+type Duration time.Duration
+
+type setting struct {
+	name  string
+	usage string
+	field func(configInst *Config) interface{}
+}
+
+var settingList = []setting{
+	{"env", "name of the environment, e.g. dev, test or prod", func(c *Config) interface{} { return &c.Env }},
+	{"addr", "address the server listens on", func(c *Config) interface{} { return &c.Addr }},
+	{"db", "database adapter: dynamodb, sqlite or memory", func(c *Config) interface{} { return &c.DBType }},
+	{"sqlite-path", "database file used by the sqlite adapter", func(c *Config) interface{} { return &c.SQLitePath }},
+	{"file-path", "picture directory used by the sqlite adapter", func(c *Config) interface{} { return &c.FilePath }},
+	{"scan-segments", "parallel segments used when scanning dynamodb tables", func(c *Config) interface{} { return &c.ScanSegments }},
+	{"aws-region", "AWS region, instead of the one of the shared config", func(c *Config) interface{} { return &c.AWSRegion }},
+	{"aws-profile", "AWS shared config profile, instead of the default one", func(c *Config) interface{} { return &c.AWSProfile }},
+	{"table-prefix", "prefix of the dynamodb table names, so that environments can share an account", func(c *Config) interface{} { return &c.TablePrefix }},
+	{"picture-bucket", "S3 bucket holding the pictures", func(c *Config) interface{} { return &c.PictureBucket }},
+	{"picture-index", "dynamodb index of the model table by picture", func(c *Config) interface{} { return &c.PictureIndex }},
+	{"max-get-entries", "maximum number of pictures listed at once", func(c *Config) interface{} { return &c.MaxGetEntries }},
+	{"migrate-models", "copy at startup the models of the model table, kept before collections, into the collection of legacy-model-owner", func(c *Config) interface{} { return &c.MigrateModels }},
+	{"legacy-model-owner", "subject owning the copied models, or empty for the collection shared without authentication", func(c *Config) interface{} { return &c.LegacyModelOwner }},
+	{"dynamodb-endpoint", "URL of the dynamodb endpoint, e.g. of DynamoDB Local, instead of the AWS one", func(c *Config) interface{} { return &c.DynamoDBEndpoint }},
+	{"s3-endpoint", "URL of the S3 endpoint, e.g. of MinIO, instead of the AWS one", func(c *Config) interface{} { return &c.S3Endpoint }},
+	{"s3-path-style", "address S3 buckets in the path rather than in the host name, as MinIO expects", func(c *Config) interface{} { return &c.S3PathStyle }},
+	{"aws-access-key-id", "static AWS access key, instead of the credentials of the shared config", func(c *Config) interface{} { return &c.AWSAccessKeyID }},
+	{"aws-secret-access-key", "secret of the static AWS access key", func(c *Config) interface{} { return &c.AWSSecretAccessKey }},
+	{"create-resources", "create the missing dynamodb tables and S3 bucket at startup", func(c *Config) interface{} { return &c.CreateResources }},
+	{"read-timeout", "longest time to read a request, body included", func(c *Config) interface{} { return &c.ReadTimeout }},
+	{"read-header-timeout", "longest time to read the headers of a request", func(c *Config) interface{} { return &c.ReadHeaderTimeout }},
+	{"write-timeout", "longest time from the end of the request headers to the end of the response", func(c *Config) interface{} { return &c.WriteTimeout }},
+	{"idle-timeout", "longest time a kept-alive connection waits for the next request", func(c *Config) interface{} { return &c.IdleTimeout }},
+	{"shutdown-timeout", "longest time in-flight requests are given to finish when the server is stopped", func(c *Config) interface{} { return &c.ShutdownTimeout }},
+	{"max-header-bytes", "maximum size of the headers of a request", func(c *Config) interface{} { return &c.MaxHeaderBytes }},
+	{"max-body-bytes", "maximum size of the body of a request, pictures included", func(c *Config) interface{} { return &c.MaxBodyBytes }},
+	{"api-key-file", "JSON file listing the API keys, with the subject and the role of each", func(c *Config) interface{} { return &c.APIKeyFile }},
+	{"jwt-secret-file", "file holding the secret that JWT bearer tokens are signed with", func(c *Config) interface{} { return &c.JWTSecretFile }},
+	{"jwt-issuer", "issuer that JWT bearer tokens must have, if any", func(c *Config) interface{} { return &c.JWTIssuer }},
+	{"jwt-audience", "audience that JWT bearer tokens must include, if any", func(c *Config) interface{} { return &c.JWTAudience }},
+}
+
+// settingValue lets a setting of a config be parsed as a flag.
+type settingValue struct {
+	configInst  *Config
+	settingInst *setting
+}
+
+//----------------------------------------------------------------------------------------
+// Default returns the config used when no setting is given.
+func Default() Config {
+	return Config{
+		Addr:          ":8081",
+		DBType:        factory.DYNO,
+		SQLitePath:    "colman.db",
+		FilePath:      "pictures",
+		ScanSegments:  1,
+		PictureBucket: "colman-pics",
+		PictureIndex:  "picture-ownerCode-index",
+		MaxGetEntries: 1000,
+
+		ReadTimeout:       Duration(time.Minute),
+		ReadHeaderTimeout: Duration(10 * time.Second),
+		WriteTimeout:      Duration(2 * time.Minute),
+		IdleTimeout:       Duration(2 * time.Minute),
+		ShutdownTimeout:   Duration(30 * time.Second),
+		MaxHeaderBytes:    1 << 20,
+		MaxBodyBytes:      32 << 20,
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// EnvName returns the environment variable of the setting called name.
+func EnvName(name string) string {
+	return ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+//----------------------------------------------------------------------------------------
+func (settingInst *setting) set(configInst *Config, value string) error {
+	switch field := settingInst.field(configInst).(type) {
+	case *string:
+		*field = value
+	case *factory.AdapterType:
+		*field = factory.AdapterType(value)
+	case *int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a number", settingInst.name)
+		}
+
+		*field = number
+	case *bool:
+		flagValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", settingInst.name)
+		}
+
+		*field = flagValue
+	case *Duration:
+		return field.parse(settingInst.name, value)
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (settingInst *setting) get(configInst *Config) string {
+	switch field := settingInst.field(configInst).(type) {
+	case *string:
+		return *field
+	case *factory.AdapterType:
+		return string(*field)
+	case *int:
+		return strconv.Itoa(*field)
+	case *bool:
+		return strconv.FormatBool(*field)
+	case *Duration:
+		return field.String()
+	}
+
+	return ""
+}
+
+//----------------------------------------------------------------------------------------
+func (value settingValue) Set(raw string) error {
+	return value.settingInst.set(value.configInst, raw)
+}
+
+//----------------------------------------------------------------------------------------
+func (duration *Duration) parse(name string, value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s must be a duration such as 30s or 2m", name)
+	}
+
+	*duration = Duration(parsed)
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (duration Duration) String() string {
+	return time.Duration(duration).String()
+}
+
+//----------------------------------------------------------------------------------------
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(duration.String())
+}
+
+//----------------------------------------------------------------------------------------
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return fmt.Errorf("durations must be strings such as \"30s\" or \"2m\"")
+	}
+
+	return duration.parse("duration", value)
+}
+
+//----------------------------------------------------------------------------------------
+func (duration Duration) MarshalYAML() (interface{}, error) {
+	return duration.String(), nil
+}
+
+//----------------------------------------------------------------------------------------
+func (duration *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+
+	err := unmarshal(&value)
+	if err != nil {
+		return err
+	}
+
+	return duration.parse("duration", value)
+}
+
+//----------------------------------------------------------------------------------------
+// IsBoolFlag lets boolean settings be given on the command line without a value.
+func (value settingValue) IsBoolFlag() bool {
+	_, isBool := value.settingInst.field(value.configInst).(*bool)
+	return isBool
+}
+
+//----------------------------------------------------------------------------------------
+func (value settingValue) String() string {
+	if value.settingInst == nil {
+		return ""
+	}
+
+	return value.settingInst.get(value.configInst)
+}
+
+//----------------------------------------------------------------------------------------
+// LoadFile reads the settings of the YAML or JSON file at path into configInst. Unknown
+// settings are reported, as they are most likely misspelt.
+func LoadFile(path string, configInst *Config) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read the config file %s. Error: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(content, configInst)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(configInst)
+	default:
+		return fmt.Errorf("the config file %s must be a .yaml, .yml or .json file", path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot parse the config file %s. Error: %w", path, err)
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+// Load returns the config given by the defaults, the config file, the environment variables
+// found by lookupEnv and the command line args, in that order of precedence. The config file
+// is the one named by the config flag or, failing that, by its environment variable.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	var configPath string
+
+	// The command line is parsed first, into a config that is thrown away, to find the config
+	// file and to report malformed flags before anything is read.
+	flagConfig := Default()
+	flagSet := flag.NewFlagSet("colmanback", flag.ContinueOnError)
+	flagSet.StringVar(&configPath, CONFIG_NAME, "", "YAML or JSON config file, of settings named as the flags")
+	for index := range settingList {
+		flagSet.Var(settingValue{&flagConfig, &settingList[index]}, settingList[index].name, settingList[index].usage)
+	}
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if configPath == "" {
+		configPath, _ = lookupEnv(EnvName(CONFIG_NAME))
+	}
+
+	configInst := Default()
+	if configPath != "" {
+		err = LoadFile(configPath, &configInst)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for index := range settingList {
+		if value, isSet := lookupEnv(EnvName(settingList[index].name)); isSet {
+			err = settingList[index].set(&configInst, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", EnvName(settingList[index].name), err)
+			}
+		}
+	}
+
+	flagSet.Visit(func(flagInst *flag.Flag) {
+		for index := range settingList {
+			if settingList[index].name == flagInst.Name {
+				settingList[index].set(&configInst, flagInst.Value.String())
+			}
+		}
+	})
+
+	err = configInst.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &configInst, nil
+}
+
+//----------------------------------------------------------------------------------------
+// Validate reports every setting of configInst that cannot be used, all at once.
+func (configInst *Config) Validate() error {
+	var problemList []string
+
+	if !tablePrefixPattern.MatchString(configInst.Env) {
+		problemList = append(problemList, "env may only hold letters, digits, '_', '.' and '-'")
+	}
+
+	if _, port, err := net.SplitHostPort(configInst.Addr); err != nil {
+		problemList = append(problemList, fmt.Sprintf("addr %q is not a host:port address", configInst.Addr))
+	} else if number, err := strconv.Atoi(port); err != nil || number < 0 || number > 65535 {
+		problemList = append(problemList, fmt.Sprintf("addr %q does not have a valid port", configInst.Addr))
+	}
+
+	if !factory.IsValid(configInst.DBType) {
+		problemList = append(problemList, fmt.Sprintf("db %q is not a known database adapter", configInst.DBType))
+	}
+
+	if configInst.DBType == factory.SQLITE && (configInst.SQLitePath == "" || configInst.FilePath == "") {
+		problemList = append(problemList, "sqlite-path and file-path are required by the sqlite adapter")
+	}
+
+	if configInst.ScanSegments < 1 {
+		problemList = append(problemList, "scan-segments must be at least 1")
+	}
+
+	if configInst.MaxGetEntries < 1 {
+		problemList = append(problemList, "max-get-entries must be at least 1")
+	}
+
+	if configInst.DBType == factory.DYNO {
+		if !tablePrefixPattern.MatchString(configInst.TablePrefix) {
+			problemList = append(problemList, "table-prefix may only hold letters, digits, '_', '.' and '-'")
+		}
+
+		if !bucketPattern.MatchString(configInst.PictureBucket) {
+			problemList = append(problemList, fmt.Sprintf("picture-bucket %q is not a valid S3 bucket name", configInst.PictureBucket))
+		}
+
+		if configInst.PictureIndex == "" {
+			problemList = append(problemList, "picture-index is required by the dynamodb adapter")
+		}
+
+		for _, endpoint := range []struct {
+			name  string
+			value string
+		}{
+			{"dynamodb-endpoint", configInst.DynamoDBEndpoint},
+			{"s3-endpoint", configInst.S3Endpoint},
+		} {
+			if endpoint.value == "" {
+				continue
+			}
+
+			if endpointURL, err := url.Parse(endpoint.value); err != nil || (endpointURL.Scheme != "http" && endpointURL.Scheme != "https") || endpointURL.Host == "" {
+				problemList = append(problemList, fmt.Sprintf("%s %q is not an http or https URL", endpoint.name, endpoint.value))
+			}
+		}
+
+		if (configInst.AWSAccessKeyID == "") != (configInst.AWSSecretAccessKey == "") {
+			problemList = append(problemList, "aws-access-key-id and aws-secret-access-key must be given together")
+		}
+	}
+
+	for _, timeout := range []struct {
+		name  string
+		value Duration
+	}{
+		{"read-timeout", configInst.ReadTimeout},
+		{"read-header-timeout", configInst.ReadHeaderTimeout},
+		{"write-timeout", configInst.WriteTimeout},
+		{"idle-timeout", configInst.IdleTimeout},
+	} {
+		if timeout.value < 0 {
+			problemList = append(problemList, timeout.name+" cannot be negative")
+		}
+	}
+
+	if configInst.ShutdownTimeout <= 0 {
+		problemList = append(problemList, "shutdown-timeout must be positive")
+	}
+
+	if configInst.MaxHeaderBytes < 1 {
+		problemList = append(problemList, "max-header-bytes must be at least 1")
+	}
+
+	if configInst.MaxBodyBytes < 1 {
+		problemList = append(problemList, "max-body-bytes must be at least 1")
+	}
+
+	if configInst.JWTSecretFile == "" && (configInst.JWTIssuer != "" || configInst.JWTAudience != "") {
+		problemList = append(problemList, "jwt-issuer and jwt-audience require jwt-secret-file")
+	}
+
+	if len(problemList) > 0 {
+		return fmt.Errorf("the config is not valid: %s", strings.Join(problemList, "; "))
+	}
+
+	return nil
+}
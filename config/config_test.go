@@ -0,0 +1,161 @@
+package config
+
+import (
+	"colmanback/db/factory"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envLookup(envMap map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, isSet := envMap[name]
+		return value, isSet
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "colman.yaml")
+	os.WriteFile(yamlFile, []byte("env: test\ntable-prefix: file-\npicture-bucket: file-pics\nscan-segments: 2\n"), 0600)
+
+	t.Log("The defaults are used when nothing is given")
+	configInst, err := Load(nil, envLookup(nil))
+	if err != nil || *configInst != Default() {
+		t.Fatalf("Expected the default config, got %+v. Error: %v", configInst, err)
+	}
+
+	t.Log("The config file overrides the defaults")
+	configInst, err = Load([]string{"-config", yamlFile}, envLookup(nil))
+	if err != nil {
+		t.Fatalf("Cannot load %s. Error: %v", yamlFile, err)
+	}
+
+	if configInst.Env != "test" || configInst.TablePrefix != "file-" || configInst.ScanSegments != 2 || configInst.Addr != ":8081" {
+		t.Errorf("Unexpected config %+v", configInst)
+	}
+
+	t.Log("The environment overrides the config file, and the flags the environment")
+	envMap := map[string]string{
+		"COLMAN_CONFIG":         yamlFile,
+		"COLMAN_TABLE_PREFIX":   "env-",
+		"COLMAN_PICTURE_BUCKET": "env-pics",
+	}
+
+	configInst, err = Load([]string{"-picture-bucket", "flag-pics", "-max-get-entries=50"}, envLookup(envMap))
+	if err != nil {
+		t.Fatalf("Cannot load the config. Error: %v", err)
+	}
+
+	if configInst.Env != "test" || configInst.TablePrefix != "env-" || configInst.PictureBucket != "flag-pics" || configInst.MaxGetEntries != 50 {
+		t.Errorf("Unexpected config %+v", configInst)
+	}
+
+	t.Log("Boolean settings may be given without a value, durations with their unit")
+	configInst, err = Load([]string{"-s3-path-style", "-dynamodb-endpoint", "http://localhost:8000", "-shutdown-timeout", "5s"}, envLookup(map[string]string{"COLMAN_CREATE_RESOURCES": "true"}))
+	if err != nil || !configInst.S3PathStyle || !configInst.CreateResources || configInst.DynamoDBEndpoint != "http://localhost:8000" || configInst.ShutdownTimeout != Duration(5*time.Second) {
+		t.Errorf("Unexpected config %+v. Error: %v", configInst, err)
+	}
+
+	configInst, err = Load([]string{"-migrate-models", "-legacy-model-owner", "auth0|123"}, envLookup(nil))
+	if err != nil || !configInst.MigrateModels || configInst.LegacyModelOwner != "auth0|123" {
+		t.Errorf("Unexpected config %+v. Error: %v", configInst, err)
+	}
+
+	t.Log("Malformed values are reported")
+	if _, err := Load(nil, envLookup(map[string]string{"COLMAN_SCAN_SEGMENTS": "many"})); err == nil || !strings.Contains(err.Error(), "COLMAN_SCAN_SEGMENTS") {
+		t.Errorf("Expected the malformed environment variable to be reported. Error: %v", err)
+	}
+
+	if _, err := Load([]string{"-scan-segments", "many"}, envLookup(nil)); err == nil {
+		t.Errorf("Expected the malformed flag to be reported")
+	}
+
+	if _, err := Load([]string{"-read-timeout", "30"}, envLookup(nil)); err == nil {
+		t.Errorf("Expected the duration without a unit to be reported")
+	}
+
+	if _, err := Load([]string{"-unknown"}, envLookup(nil)); err == nil {
+		t.Errorf("Expected the unknown flag to be reported")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+
+	fileList := map[string]string{
+		"valid.json":   `{"env": "prod", "db": "sqlite", "sqlite-path": "prod.db", "write-timeout": "5m"}`,
+		"valid.yml":    "env: prod\ndb: sqlite\nsqlite-path: prod.db\nwrite-timeout: 5m\n",
+		"number.json":  `{"write-timeout": 300}`,
+		"unknown.json": `{"env": "prod", "tabel-prefix": "prod-"}`,
+		"unknown.yaml": "env: prod\ntabel-prefix: prod-\n",
+		"config.toml":  "env = \"prod\"\n",
+	}
+
+	for name, content := range fileList {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+	}
+
+	for _, name := range []string{"valid.json", "valid.yml"} {
+		configInst := Default()
+		err := LoadFile(filepath.Join(dir, name), &configInst)
+		if err != nil || configInst.Env != "prod" || configInst.DBType != factory.SQLITE || configInst.SQLitePath != "prod.db" || configInst.FilePath != "pictures" ||
+			configInst.WriteTimeout != Duration(5*time.Minute) || configInst.ReadTimeout != Duration(time.Minute) {
+			t.Errorf("Unexpected config %+v from %s. Error: %v", configInst, name, err)
+		}
+	}
+
+	for _, name := range []string{"unknown.json", "unknown.yaml", "number.json", "config.toml", "missing.yaml"} {
+		configInst := Default()
+		if err := LoadFile(filepath.Join(dir, name), &configInst); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, change := range map[string]func(configInst *Config){
+		"addr":             func(configInst *Config) { configInst.Addr = "8081" },
+		"port":             func(configInst *Config) { configInst.Addr = ":99999" },
+		"db":               func(configInst *Config) { configInst.DBType = "oracle" },
+		"sqlite-path":      func(configInst *Config) { configInst.DBType, configInst.SQLitePath = factory.SQLITE, "" },
+		"scan-segments":    func(configInst *Config) { configInst.ScanSegments = 0 },
+		"max-get-entries":  func(configInst *Config) { configInst.MaxGetEntries = -1 },
+		"table-prefix":     func(configInst *Config) { configInst.TablePrefix = "dev/" },
+		"picture-bucket":   func(configInst *Config) { configInst.PictureBucket = "Colman_Pics" },
+		"picture-index":    func(configInst *Config) { configInst.PictureIndex = "" },
+		"jwt-issuer":       func(configInst *Config) { configInst.JWTIssuer = "colman" },
+		"s3-endpoint":      func(configInst *Config) { configInst.S3Endpoint = "localhost:9000" },
+		"aws-access-key":   func(configInst *Config) { configInst.AWSAccessKeyID = "minio" },
+		"idle-timeout":     func(configInst *Config) { configInst.IdleTimeout = -1 },
+		"shutdown-timeout": func(configInst *Config) { configInst.ShutdownTimeout = 0 },
+		"max-body-bytes":   func(configInst *Config) { configInst.MaxBodyBytes = 0 },
+	} {
+		configInst := Default()
+		change(&configInst)
+
+		err := configInst.Validate()
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected %s to be reported. Error: %v", name, err)
+		}
+	}
+
+	t.Log("The DynamoDB settings are not checked for the other adapters")
+	configInst := Default()
+	configInst.DBType = factory.MEMORY
+	configInst.PictureBucket = ""
+	if err := configInst.Validate(); err != nil {
+		t.Errorf("Expected the memory config to be valid. Error: %v", err)
+	}
+
+	t.Log("Every problem is reported at once")
+	configInst = Default()
+	configInst.ScanSegments = 0
+	configInst.TablePrefix = "dev/"
+	err := configInst.Validate()
+	if err == nil || !strings.Contains(err.Error(), "scan-segments") || !strings.Contains(err.Error(), "table-prefix") {
+		t.Errorf("Expected both problems to be reported. Error: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// The search cache map is held twice: by table and object code, which is what the adapters
+// update, and by tag, which is what searches read. Both are guarded by cacheMapLock. Slices
+// stored in cacheMap are never modified in place, so they can be used after the lock is released.
+var cacheMapLock sync.RWMutex
+var cacheMap map[string][]CacheMapElement = make(map[string][]CacheMapElement)
+var tableCacheMap map[string]map[string][]CacheMapElement = make(map[string]map[string][]CacheMapElement)
+
+type CacheMapEntry struct {
+	Key      string            `json:"key"`
+	Elements []CacheMapElement `json:"elements"`
+}
+
+//----------------------------------------------------------------------------------------
+// LoadCacheMap replaces the elements held for tableName with cacheArray. The map searched
+// is rebuilt and swapped in at once, so readers never see a partially loaded table.
+func LoadCacheMap(tableName string, cacheArray []CacheMapElement) {
+	objectCacheMap := make(map[string][]CacheMapElement)
+	for _, cacheMapElement := range cacheArray {
+		cacheMapElement.Type = tableName
+		objectCacheMap[cacheMapElement.Code] = append(objectCacheMap[cacheMapElement.Code], cacheMapElement)
+	}
+
+	cacheMapLock.Lock()
+	defer cacheMapLock.Unlock()
+
+	tableCacheMap[tableName] = objectCacheMap
+
+	newCacheMap := make(map[string][]CacheMapElement)
+	for _, objectCacheMap := range tableCacheMap {
+		for _, elementArray := range objectCacheMap {
+			for _, cacheMapElement := range elementArray {
+				newCacheMap[cacheMapElement.Tag] = append(newCacheMap[cacheMapElement.Tag], cacheMapElement)
+			}
+		}
+	}
+
+	cacheMap = newCacheMap
+}
+
+//----------------------------------------------------------------------------------------
+// CacheMapSize returns the number of distinct tags held in the search cache map.
+func CacheMapSize() int {
+	cacheMapLock.RLock()
+	defer cacheMapLock.RUnlock()
+
+	return len(cacheMap)
+}
+
+//----------------------------------------------------------------------------------------
+// UpdateCacheMap replaces the elements held for the object with the given code, so that tags
+// the object no longer carries (e.g. after a change of name) stop matching it.
+func UpdateCacheMap(tableName string, code string, cacheArray []CacheMapElement) {
+	var elementArray []CacheMapElement
+
+	for _, cacheMapElement := range cacheArray {
+		cacheMapElement.Type = tableName
+		elementArray = append(elementArray, cacheMapElement)
+	}
+
+	cacheMapLock.Lock()
+	defer cacheMapLock.Unlock()
+
+	removeFromCacheMap(tableName, code)
+
+	if len(elementArray) == 0 {
+		return
+	}
+
+	if _, hasTable := tableCacheMap[tableName]; !hasTable {
+		tableCacheMap[tableName] = make(map[string][]CacheMapElement)
+	}
+	tableCacheMap[tableName][code] = elementArray
+
+	for _, cacheMapElement := range elementArray {
+		currentArray := cacheMap[cacheMapElement.Tag]
+		newArray := make([]CacheMapElement, len(currentArray), len(currentArray)+1)
+		copy(newArray, currentArray)
+
+		cacheMap[cacheMapElement.Tag] = append(newArray, cacheMapElement)
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func RemoveFromCacheMap(tableName string, code string) {
+	cacheMapLock.Lock()
+	defer cacheMapLock.Unlock()
+
+	removeFromCacheMap(tableName, code)
+}
+
+//----------------------------------------------------------------------------------------
+// removeFromCacheMap expects cacheMapLock to be held for writing.
+func removeFromCacheMap(tableName string, code string) {
+	elementArray := tableCacheMap[tableName][code]
+	delete(tableCacheMap[tableName], code)
+
+	for _, oldElement := range elementArray {
+		var newArray []CacheMapElement
+
+		for _, cacheMapElement := range cacheMap[oldElement.Tag] {
+			if cacheMapElement.Code != code || cacheMapElement.Type != tableName {
+				newArray = append(newArray, cacheMapElement)
+			}
+		}
+
+		if len(newArray) == 0 {
+			delete(cacheMap, oldElement.Tag)
+		} else {
+			cacheMap[oldElement.Tag] = newArray
+		}
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func PrintCacheMap() {
+	cacheMapLock.RLock()
+	defer cacheMapLock.RUnlock()
+
+	for key, elementArray := range cacheMap {
+		fmt.Printf("Key %s\n", key)
+		for position, element := range elementArray {
+			fmt.Printf(" -- Position %d: {Code: %s, Tag: %s, Type: %s}\n", position, element.Code, element.Tag, element.Type)
+		}
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// SearchCacheMap returns the objects whose tags match searchKey, ranked by score. Exact
+// matches come first, then prefix and infix ones; multi-word keys match tags containing all
+// of their words, allowing for typos in the longer ones.
+func SearchCacheMap(searchKey string) []CacheMapElement {
+	cacheMapLock.RLock()
+	defer cacheMapLock.RUnlock()
+
+	return rankCacheMap(searchKey)
+}
+
+//----------------------------------------------------------------------------------------
+func SearchCacheMapJSON(searchKey string) ([]byte, error) {
+	allMatches := SearchCacheMap(searchKey)
+	out, err := json.MarshalIndent(allMatches, JSON_PREFIX, JSON_INDENT)
+
+	if err != nil {
+		return nil, fmt.Errorf("got error when trying to return cache map entries for search key: %s. Error: %s", searchKey, err)
+	}
+
+	return out, nil
+}
+
+//----------------------------------------------------------------------------------------
+func CacheMapJSON() ([]byte, error) {
+	var allMatches []CacheMapEntry
+
+	cacheMapLock.RLock()
+	for key, arrayElement := range cacheMap {
+		var entry CacheMapEntry
+		entry.Key = key
+		entry.Elements = arrayElement
+
+		allMatches = append(allMatches, entry)
+	}
+	cacheMapLock.RUnlock()
+
+	out, err := json.MarshalIndent(allMatches, JSON_PREFIX, JSON_INDENT)
+
+	if err != nil {
+		return nil, fmt.Errorf("got error when trying to return full cache map %s", err)
+	}
+
+	return out, nil
+}
@@ -3,25 +3,30 @@ package db
 import (
 	"colmanback/objects"
 	"encoding/json"
-	"log"
+	"fmt"
+	"mime/multipart"
 	"strings"
 )
 
 const (
-	JSON_PREFIX = ""
-	JSON_INDENT = "    "
+	JSON_PREFIX  = ""
+	JSON_INDENT  = "    "
+	VERSION_NAME = "version"
 )
 
 type CacheMapElement struct {
-	Code string `json:"code"`
-	Tag  string `json:"tag"`
-	Type string `json:"type"`
-	Name string `json:"name"`
+	Code  string  `json:"code"`
+	Tag   string  `json:"tag"`
+	Type  string  `json:"type"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score,omitempty"`
 }
 
 type Adapter[K objects.Object] interface {
 	//Config
-	Config(tableName string, codeName string, keepCache bool, constructor func() K, getCacheMap func([]K) []CacheMapElement)
+	Config(tableName string, codeName string, keepCache bool, constructor func() K, getCacheMap func([]K) []CacheMapElement) error
+	SetSortName(sortName string)
+	SetSortGSIName(sortGSIName string)
 
 	//Raw Operations
 	DeleteObjectByCode(codeValue string) error
@@ -29,33 +34,57 @@ type Adapter[K objects.Object] interface {
 	DeleteObject(objectInst K) error
 	GetObjectList() ([]K, error)
 	GetObjectByCode(codeValue string) (K, error)
+	GetObjectMapByCodes(codeList []string) (map[string]K, error)
 	GetObjectByCodeJSON(codeValue string) ([]byte, error)
 	GetObjectListBySort(sortValue string) ([]K, error)
 	GetObjectListJSON() ([]byte, error)
 	GetSortKeyList(codeValue string) ([]string, error)
 	PutObject(objectInst K) error
-	PutObjectList(objectList []K)
-	ResetCache()
+	PutObjectList(objectList []K) error
+	DeleteObjectList(objectList []K) error
+	ResetCache() error
+
+	//Diagnostics
+	Status() AdapterStatus
+	Ping() error
+}
+
+type FileResponse struct {
+	FileLocation string `json:"fileLocation"`
+}
+
+type FileAdapter interface {
+	//Config
+	Config(bucketName string, maxGetEntries int)
+
+	//Raw Operations
+	AddFile(fileName string, file multipart.File) (FileResponse, error)
+	DeleteFiles(fileNameArr []string) error
+	DeleteFile(fileName string) error
+
+	//Diagnostics
+	Ping() error
 }
 
 //----------------------------------------------------------------------------------------
-func FromJson(objectInst objects.Object, jsonInst []byte) {
+func FromJson(objectInst objects.Object, jsonInst []byte) error {
 	err := json.Unmarshal(jsonInst, objectInst)
 	if err != nil {
-		log.Fatalf("Cannot unmarshall %s into object %s", string(jsonInst), objectInst.ToString())
+		return &ValidationError{Message: fmt.Sprintf("cannot unmarshall %s into object", string(jsonInst)), Err: err}
 	}
+
+	return nil
 }
 
 //----------------------------------------------------------------------------------------
-func ToJson(objectInst objects.Object) []byte {
+func ToJson(objectInst objects.Object) ([]byte, error) {
 	out, err := json.MarshalIndent(objectInst, JSON_PREFIX, JSON_INDENT)
 
 	if err != nil {
-		log.Fatalf("Cannot marshal object:\n %s", objectInst.ToString())
-		return nil
+		return nil, fmt.Errorf("cannot marshal object:\n %s. Error: %v", objectInst.ToString(), err)
 	}
 
-	return out
+	return out, nil
 }
 
 //----------------------------------------------------------------------------------------
@@ -0,0 +1,103 @@
+package disk
+
+import (
+	"colmanback/db"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RootDir is the directory under which each bucket is stored as a sub-directory.
+var RootDir string = "pictures"
+
+type DiskAdapter struct {
+	bucketDir     string
+	bucketName    string
+	maxGetEntries int
+}
+
+//----------------------------------------------------------------------------------------
+func (diskAdapter *DiskAdapter) Config(bucketName string, maxGetEntries int) {
+	diskAdapter.bucketName = bucketName
+	diskAdapter.maxGetEntries = maxGetEntries
+	diskAdapter.bucketDir = filepath.Join(RootDir, bucketName)
+}
+
+//----------------------------------------------------------------------------------------
+func (diskAdapter *DiskAdapter) filePath(fileName string) (string, error) {
+	cleanName := strings.Trim(fileName, " ")
+
+	if cleanName == "" || cleanName != filepath.Base(cleanName) {
+		return "", &db.ValidationError{Message: fmt.Sprintf("invalid file name %s for bucket %s", fileName, diskAdapter.bucketName)}
+	}
+
+	return filepath.Join(diskAdapter.bucketDir, cleanName), nil
+}
+
+//----------------------------------------------------------------------------------------
+func (diskAdapter *DiskAdapter) AddFile(fileName string, file multipart.File) (db.FileResponse, error) {
+	var response db.FileResponse
+
+	path, err := diskAdapter.filePath(fileName)
+	if err != nil {
+		return response, err
+	}
+
+	err = os.MkdirAll(diskAdapter.bucketDir, 0755)
+	if err != nil {
+		return response, &db.BackendError{Operation: "directory creation", Resource: "bucket " + diskAdapter.bucketName, Err: err}
+	}
+
+	target, err := os.Create(path)
+	if err != nil {
+		return response, &db.BackendError{Operation: "creation of " + fileName, Resource: "bucket " + diskAdapter.bucketName, Err: err}
+	}
+	defer target.Close()
+
+	_, err = io.Copy(target, file)
+	if err != nil {
+		return response, &db.BackendError{Operation: "write of " + fileName, Resource: "bucket " + diskAdapter.bucketName, Err: err}
+	}
+
+	response.FileLocation = "file://" + filepath.ToSlash(path)
+
+	return response, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (diskAdapter *DiskAdapter) DeleteFiles(fileNameArr []string) error {
+	for _, fileName := range fileNameArr {
+		path, err := diskAdapter.filePath(fileName)
+		if err != nil {
+			return err
+		}
+
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return &db.BackendError{Operation: fmt.Sprintf("deletion of %v", fileNameArr), Resource: "bucket " + diskAdapter.bucketName, Err: err}
+		}
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (diskAdapter *DiskAdapter) DeleteFile(fileName string) error {
+	fileNameArr := []string{fileName}
+
+	return diskAdapter.DeleteFiles(fileNameArr)
+}
+
+//----------------------------------------------------------------------------------------
+// Ping checks that the directory of the bucket exists, or can be created.
+func (diskAdapter *DiskAdapter) Ping() error {
+	err := os.MkdirAll(diskAdapter.bucketDir, 0755)
+	if err != nil {
+		return &db.BackendError{Operation: "directory creation", Resource: "bucket " + diskAdapter.bucketName, Err: err}
+	}
+
+	return nil
+}
@@ -6,19 +6,47 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"strings"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
-var Conn *dynamodb.DynamoDB
+var Conn dynamodbiface.DynamoDBAPI
 
-var cacheMap map[string][]db.CacheMapElement = make(map[string][]db.CacheMapElement)
+// BatchWriteItem accepts at most BATCH_WRITE_SIZE requests per call and BatchGetItem at most
+// BATCH_GET_SIZE keys.
+const BATCH_WRITE_SIZE = 25
+const BATCH_GET_SIZE = 100
+
+// BatchMaxRetries is the number of times the unprocessed items of a batch are resubmitted
+// before they are reported as failed. The wait between attempts starts at BatchRetryBackoff
+// and doubles on every retry.
+var BatchMaxRetries int = 5
+var BatchRetryBackoff time.Duration = 100 * time.Millisecond
+
+// DefaultScanSegments is the number of parallel segments used to scan a table when the
+// adapter has not been given its own value through SetScanSegments.
+var DefaultScanSegments int = 1
+
+// TablePrefix is put in front of the names of the tables in DynamoDB, so that several
+// environments can share an account. Errors and caches still use the unprefixed names. It
+// must be set before the object packages call their InitConn.
+var TablePrefix string
+
+// CreateTables makes Config create the table of the adapter, and its sort index, when the
+// table does not exist yet. It is meant for DynamoDB Local and other test setups, as the
+// tables are created on demand with default settings.
+var CreateTables bool
 
 type Dyno[K objects.Object] struct {
 	tableName   string
+	remoteName  string
 	codeName    string
 	sortName    string
 	sortGSIName string
@@ -26,28 +54,167 @@ type Dyno[K objects.Object] struct {
 	constructor func() K
 	cacheMap    func([]K) []db.CacheMapElement
 
-	cache map[string]K
+	scanSegments int
+
+	// cacheLock guards the cache map. ResetCache builds a new map and swaps it in, so the
+	// lock is never held while DynamoDB is being read.
+	cacheLock sync.RWMutex
+	cache     map[string]K
+	cacheTime time.Time
 }
 
-type CacheMapEntry struct {
-	Key      string               `json:"key"`
-	Elements []db.CacheMapElement `json:"elements"`
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) getScanSegments() int {
+	if dynoInst.scanSegments > 0 {
+		return dynoInst.scanSegments
+	}
+
+	if DefaultScanSegments > 0 {
+		return DefaultScanSegments
+	}
+
+	return 1
 }
 
 //----------------------------------------------------------------------------------------
-func (dynoInst *Dyno[K]) getObjectListFromDB() ([]K, error) {
-	var objectList []K
+func (dynoInst *Dyno[K]) getCached(codeValue string) (K, bool) {
+	dynoInst.cacheLock.RLock()
+	defer dynoInst.cacheLock.RUnlock()
+
+	objectInst, isCached := dynoInst.cache[codeValue]
+
+	return objectInst, isCached
+}
+
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) setCached(objectInst K) {
+	dynoInst.cacheLock.Lock()
+	dynoInst.cache[objectInst.CodeValue()] = objectInst
+	dynoInst.cacheLock.Unlock()
+}
+
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) deleteCached(codeValue string) {
+	dynoInst.cacheLock.Lock()
+	delete(dynoInst.cache, codeValue)
+	dynoInst.cacheLock.Unlock()
+}
+
+//----------------------------------------------------------------------------------------
+// indexObject and unindexObject keep the search cache map in line with the writes made through
+// the adapter. The map is only built for adapters that keep a cache.
+func (dynoInst *Dyno[K]) indexObject(objectInst K) {
+	if dynoInst.keepCache && dynoInst.cacheMap != nil {
+		db.UpdateCacheMap(dynoInst.tableName, objectInst.CodeValue(), dynoInst.cacheMap([]K{objectInst}))
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) unindexObject(codeValue string) {
+	if dynoInst.keepCache && dynoInst.cacheMap != nil {
+		db.RemoveFromCacheMap(dynoInst.tableName, codeValue)
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) backendErr(operation string, err error) error {
+	return &db.BackendError{Operation: operation, Resource: "table " + dynoInst.tableName, Err: err}
+}
+
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) scanSegment(segment int, totalSegments int) ([]map[string]*dynamodb.AttributeValue, error) {
+	var items []map[string]*dynamodb.AttributeValue
 
 	params := &dynamodb.ScanInput{
-		TableName: aws.String(dynoInst.tableName),
+		TableName: aws.String(dynoInst.remoteName),
+	}
+
+	if totalSegments > 1 {
+		params.Segment = aws.Int64(int64(segment))
+		params.TotalSegments = aws.Int64(int64(totalSegments))
+	}
+
+	for {
+		result, err := Conn.Scan(params)
+		if err != nil {
+			return items, dynoInst.backendErr(fmt.Sprintf("scan (segment %d of %d)", segment, totalSegments), err)
+		}
+
+		items = append(items, result.Items...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+
+		params.ExclusiveStartKey = result.LastEvaluatedKey
 	}
+}
+
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) scanAll() ([]map[string]*dynamodb.AttributeValue, error) {
+	var waitGroup sync.WaitGroup
+	var items []map[string]*dynamodb.AttributeValue
+
+	totalSegments := dynoInst.getScanSegments()
+	if totalSegments == 1 {
+		return dynoInst.scanSegment(0, 1)
+	}
+
+	segmentItems := make([][]map[string]*dynamodb.AttributeValue, totalSegments)
+	segmentErrors := make([]error, totalSegments)
+
+	for segment := 0; segment < totalSegments; segment++ {
+		waitGroup.Add(1)
+
+		go func(segment int) {
+			defer waitGroup.Done()
+			segmentItems[segment], segmentErrors[segment] = dynoInst.scanSegment(segment, totalSegments)
+		}(segment)
+	}
+
+	waitGroup.Wait()
+
+	for segment := 0; segment < totalSegments; segment++ {
+		if segmentErrors[segment] != nil {
+			return nil, segmentErrors[segment]
+		}
+
+		items = append(items, segmentItems[segment]...)
+	}
+
+	return items, nil
+}
+
+//----------------------------------------------------------------------------------------
+func queryAll(input *dynamodb.QueryInput) ([]map[string]*dynamodb.AttributeValue, error) {
+	var items []map[string]*dynamodb.AttributeValue
+
+	for {
+		result, err := Conn.Query(input)
+		if err != nil {
+			return items, err
+		}
+
+		items = append(items, result.Items...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) getObjectListFromDB() ([]K, error) {
+	var objectList []K
 
-	result, err := Conn.Scan(params)
+	items, err := dynoInst.scanAll()
 	if err != nil {
-		return objectList, fmt.Errorf("query API call on table %s failed. Err: %s", dynoInst.tableName, err)
+		return objectList, err
 	}
 
-	for _, i := range result.Items {
+	for _, i := range items {
 		objectInst := dynoInst.constructor()
 
 		err = dynamodbattribute.UnmarshalMap(i, &objectInst)
@@ -77,7 +244,7 @@ func (dynoInst *Dyno[K]) getObjectListBySortFromDB(sortValue string) ([]K, error
 	}
 
 	input = &dynamodb.QueryInput{
-		TableName: aws.String(dynoInst.tableName),
+		TableName: aws.String(dynoInst.remoteName),
 		IndexName: aws.String(dynoInst.sortGSIName),
 		KeyConditions: map[string]*dynamodb.Condition{
 			"picture": {
@@ -91,9 +258,9 @@ func (dynoInst *Dyno[K]) getObjectListBySortFromDB(sortValue string) ([]K, error
 		},
 	}
 
-	result, err := Conn.Query(input)
+	items, err := queryAll(input)
 	if err == nil {
-		errUnmarshal := dynamodbattribute.UnmarshalListOfMaps(result.Items, &objectList)
+		errUnmarshal := dynamodbattribute.UnmarshalListOfMaps(items, &objectList)
 		if errUnmarshal != nil {
 			retErr = errUnmarshal
 		} else {
@@ -108,19 +275,19 @@ func (dynoInst *Dyno[K]) getObjectListBySortFromDB(sortValue string) ([]K, error
 			}
 		}
 	} else {
-		retErr = err
+		retErr = dynoInst.backendErr("query on index "+dynoInst.sortGSIName, err)
 	}
 
 	return returnObjectList, retErr
 }
 
 //----------------------------------------------------------------------------------------
-func (dynoInst *Dyno[K]) getObjectByCodeFromDB(codeValue string) K {
+func (dynoInst *Dyno[K]) getObjectByCodeFromDB(codeValue string) (K, bool, error) {
 	var input *dynamodb.GetItemInput
 
 	if dynoInst.sortName == "" {
 		input = &dynamodb.GetItemInput{
-			TableName: aws.String(dynoInst.tableName),
+			TableName: aws.String(dynoInst.remoteName),
 			Key: map[string]*dynamodb.AttributeValue{
 				dynoInst.codeName: {
 					S: aws.String(codeValue),
@@ -129,7 +296,7 @@ func (dynoInst *Dyno[K]) getObjectByCodeFromDB(codeValue string) K {
 		}
 	} else {
 		input = &dynamodb.GetItemInput{
-			TableName: aws.String(dynoInst.tableName),
+			TableName: aws.String(dynoInst.remoteName),
 			Key: map[string]*dynamodb.AttributeValue{
 				dynoInst.codeName: {
 					S: aws.String(codeValue),
@@ -145,59 +312,281 @@ func (dynoInst *Dyno[K]) getObjectByCodeFromDB(codeValue string) K {
 
 	objectInst := dynoInst.constructor()
 	if err != nil {
-		log.Fatalf("Error attempting to retrieve object with %s = %s. Error: %s", dynoInst.codeName, codeValue, err)
+		return objectInst, false, dynoInst.backendErr(fmt.Sprintf("retrieval of object with %s = %s", dynoInst.codeName, codeValue), err)
 	} else if result.Item == nil {
-		log.Printf("Object with %s = %s could not be found in %s.", dynoInst.codeName, codeValue, dynoInst.tableName)
-	} else {
-		err = dynamodbattribute.UnmarshalMap(result.Item, &objectInst)
-		if err != nil {
-			log.Fatalf("Error unmarshalling result for object with %s = %s. Error: %s", dynoInst.codeName, codeValue, err)
+		return objectInst, false, nil
+	}
+
+	err = dynamodbattribute.UnmarshalMap(result.Item, &objectInst)
+	if err != nil {
+		return objectInst, false, fmt.Errorf("error unmarshalling result for object with %s = %s. Error: %s", dynoInst.codeName, codeValue, err)
+	}
+
+	return objectInst, true, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) keyMap(codeValue string, sortValue string) map[string]*dynamodb.AttributeValue {
+	keyMap := map[string]*dynamodb.AttributeValue{
+		dynoInst.codeName: {
+			S: aws.String(codeValue),
+		},
+	}
+
+	if dynoInst.sortName != "" && sortValue != "" {
+		var sortAttribute = dynamodb.AttributeValue{}
+		sortAttribute.S = aws.String(sortValue)
+		keyMap[dynoInst.sortName] = &sortAttribute
+	}
+
+	return keyMap
+}
+
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) marshalObject(objectInst K) (map[string]*dynamodb.AttributeValue, error) {
+	objectMarshalled, err := dynamodbattribute.MarshalMap(objectInst)
+	if err != nil {
+		return nil, fmt.Errorf("got error marshalling map for object with key = %s. Error: %s", objectInst.CodeValue(), err)
+	}
+
+	if dynoInst.sortName != "" {
+		var sortAttribute = dynamodb.AttributeValue{}
+		sortAttribute.S = aws.String(objectInst.SortValue())
+		objectMarshalled[dynoInst.sortName] = &sortAttribute
+	}
+
+	return objectMarshalled, nil
+}
+
+//----------------------------------------------------------------------------------------
+// dedupeObjectList keeps the last occurrence of every code / sort pair, as BatchWriteItem
+// rejects a batch that contains the same key twice.
+func dedupeObjectList[K objects.Object](objectList []K) []K {
+	var dedupedList []K
+	positionMap := make(map[string]int)
+
+	for _, objectInst := range objectList {
+		key := objectInst.CodeValue() + "|" + objectInst.SortValue()
+
+		if position, isDuplicate := positionMap[key]; isDuplicate {
+			dedupedList[position] = objectInst
+		} else {
+			positionMap[key] = len(dedupedList)
+			dedupedList = append(dedupedList, objectInst)
 		}
 	}
 
-	return objectInst
+	return dedupedList
 }
 
 //----------------------------------------------------------------------------------------
-func (dynoInst *Dyno[K]) initCache() {
-	dynoInst.cache = make(map[string]K)
+// batchWrite sends the requests in chunks of BATCH_WRITE_SIZE and resubmits unprocessed items
+// with an exponential backoff. It returns the requests that could not be processed together
+// with the last error returned by DynamoDB, if any.
+func (dynoInst *Dyno[K]) batchWrite(requestList []*dynamodb.WriteRequest) ([]*dynamodb.WriteRequest, error) {
+	var failedList []*dynamodb.WriteRequest
+	var lastErr error
+
+	for start := 0; start < len(requestList); start += BATCH_WRITE_SIZE {
+		end := start + BATCH_WRITE_SIZE
+		if end > len(requestList) {
+			end = len(requestList)
+		}
+
+		pendingList := requestList[start:end]
+		backoff := BatchRetryBackoff
+
+		for attempt := 0; len(pendingList) > 0; attempt++ {
+			if attempt > BatchMaxRetries {
+				lastErr = dynoInst.backendErr("batch write", fmt.Errorf("%d item(s) still unprocessed after %d retries", len(pendingList), BatchMaxRetries))
+				failedList = append(failedList, pendingList...)
+				break
+			}
+
+			if attempt > 0 {
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+
+			input := &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]*dynamodb.WriteRequest{
+					dynoInst.remoteName: pendingList,
+				},
+			}
+
+			result, err := Conn.BatchWriteItem(input)
+			if err != nil {
+				lastErr = dynoInst.backendErr("batch write", err)
+				failedList = append(failedList, pendingList...)
+				break
+			}
+
+			pendingList = result.UnprocessedItems[dynoInst.remoteName]
+		}
+	}
+
+	return failedList, lastErr
+}
+
+//----------------------------------------------------------------------------------------
+// batchGet reads the main items with the codes of codeList in chunks of BATCH_GET_SIZE and
+// resubmits unprocessed keys with an exponential backoff, as batchWrite does.
+func (dynoInst *Dyno[K]) batchGet(codeList []string) ([]map[string]*dynamodb.AttributeValue, error) {
+	var itemList []map[string]*dynamodb.AttributeValue
+
+	for start := 0; start < len(codeList); start += BATCH_GET_SIZE {
+		end := start + BATCH_GET_SIZE
+		if end > len(codeList) {
+			end = len(codeList)
+		}
+
+		var keyList []map[string]*dynamodb.AttributeValue
+		for _, codeValue := range codeList[start:end] {
+			//tables with a sort index store the key as sort value for the actual objects.
+			keyList = append(keyList, dynoInst.keyMap(codeValue, codeValue))
+		}
+
+		pendingKeys := &dynamodb.KeysAndAttributes{Keys: keyList}
+		backoff := BatchRetryBackoff
+
+		for attempt := 0; pendingKeys != nil && len(pendingKeys.Keys) > 0; attempt++ {
+			if attempt > BatchMaxRetries {
+				return nil, dynoInst.backendErr("batch get", fmt.Errorf("%d key(s) still unprocessed after %d retries", len(pendingKeys.Keys), BatchMaxRetries))
+			}
+
+			if attempt > 0 {
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+
+			input := &dynamodb.BatchGetItemInput{
+				RequestItems: map[string]*dynamodb.KeysAndAttributes{
+					dynoInst.remoteName: pendingKeys,
+				},
+			}
+
+			result, err := Conn.BatchGetItem(input)
+			if err != nil {
+				return nil, dynoInst.backendErr("batch get", err)
+			}
+
+			itemList = append(itemList, result.Responses[dynoInst.remoteName]...)
+			pendingKeys = result.UnprocessedKeys[dynoInst.remoteName]
+		}
+	}
+
+	return itemList, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) initCache() error {
+	cache := make(map[string]K)
 	cacheList, err := dynoInst.getObjectListFromDB()
 
 	if err != nil {
-		log.Fatalf("object cache cannot be initialised. Error: %v", err)
+		return fmt.Errorf("object cache for %s cannot be initialised. Error: %w", dynoInst.tableName, err)
 	}
 
 	for _, objectInst := range cacheList {
-		dynoInst.cache[objectInst.CodeValue()] = objectInst
+		cache[objectInst.CodeValue()] = objectInst
 	}
 
+	dynoInst.cacheLock.Lock()
+	dynoInst.cache = cache
+	dynoInst.cacheTime = time.Now()
+	dynoInst.cacheLock.Unlock()
+
 	if dynoInst.cacheMap != nil {
-		cacheArray := dynoInst.cacheMap(cacheList)
+		db.LoadCacheMap(dynoInst.tableName, dynoInst.cacheMap(cacheList))
+	}
 
-		for _, cacheMapElement := range cacheArray {
-			var cacheElementArray []db.CacheMapElement
+	return nil
+}
 
-			if currentElement, hasKey := cacheMap[cacheMapElement.Tag]; hasKey {
-				cacheElementArray = currentElement
-			}
+//----------------------------------------------------------------------------------------
+// createTable creates the table of the adapter unless it exists, with the code as partition
+// key and the sort name, if any, as sort key. The sort index is keyed the other way round and
+// only projects the keys, as getObjectListBySortFromDB reads the objects by code.
+func (dynoInst *Dyno[K]) createTable() error {
+	_, err := Conn.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(dynoInst.remoteName)})
+	if err == nil {
+		return nil
+	}
+
+	if awsErr, isAwsErr := err.(awserr.Error); !isAwsErr || awsErr.Code() != dynamodb.ErrCodeResourceNotFoundException {
+		return dynoInst.backendErr("description of the table", err)
+	}
 
-			cacheMapElement.Type = dynoInst.tableName
-			cacheMap[cacheMapElement.Tag] = append(cacheElementArray, cacheMapElement)
+	input := &dynamodb.CreateTableInput{
+		TableName:   aws.String(dynoInst.remoteName),
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String(dynoInst.codeName), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(dynoInst.codeName), KeyType: aws.String(dynamodb.KeyTypeHash)},
+		},
+	}
+
+	if dynoInst.sortName != "" {
+		input.AttributeDefinitions = append(input.AttributeDefinitions,
+			&dynamodb.AttributeDefinition{AttributeName: aws.String(dynoInst.sortName), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)})
+		input.KeySchema = append(input.KeySchema,
+			&dynamodb.KeySchemaElement{AttributeName: aws.String(dynoInst.sortName), KeyType: aws.String(dynamodb.KeyTypeRange)})
+
+		if dynoInst.sortGSIName != "" {
+			input.GlobalSecondaryIndexes = []*dynamodb.GlobalSecondaryIndex{
+				{
+					IndexName: aws.String(dynoInst.sortGSIName),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{AttributeName: aws.String(dynoInst.sortName), KeyType: aws.String(dynamodb.KeyTypeHash)},
+						{AttributeName: aws.String(dynoInst.codeName), KeyType: aws.String(dynamodb.KeyTypeRange)},
+					},
+					Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeKeysOnly)},
+				},
+			}
 		}
 	}
+
+	log.Printf("Creating table %s", dynoInst.remoteName)
+	_, err = Conn.CreateTable(input)
+	if err != nil {
+		return dynoInst.backendErr("creation of the table", err)
+	}
+
+	err = Conn.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: aws.String(dynoInst.remoteName)})
+	if err != nil {
+		return dynoInst.backendErr("creation of the table", err)
+	}
+
+	return nil
 }
 
 //----------------------------------------------------------------------------------------
-func (dynoInst *Dyno[K]) Config(tableName string, codeName string, keepCache bool, constructor func() K, getCacheMap func([]K) []db.CacheMapElement) {
+func (dynoInst *Dyno[K]) Config(tableName string, codeName string, keepCache bool, constructor func() K, getCacheMap func([]K) []db.CacheMapElement) error {
 	dynoInst.tableName = tableName
+	dynoInst.remoteName = TablePrefix + tableName
 	dynoInst.codeName = codeName
 	dynoInst.keepCache = keepCache
 	dynoInst.constructor = constructor
 	dynoInst.cacheMap = getCacheMap
 
+	dynoInst.cacheLock.Lock()
+	dynoInst.cache = make(map[string]K)
+	dynoInst.cacheLock.Unlock()
+
+	if CreateTables {
+		err := dynoInst.createTable()
+		if err != nil {
+			return err
+		}
+	}
+
 	if keepCache {
-		dynoInst.initCache()
+		return dynoInst.initCache()
 	}
+
+	return nil
 }
 
 //----------------------------------------------------------------------------------------
@@ -215,30 +604,27 @@ func (dynoInst *Dyno[K]) SetSortGSIName(sortGSIName string) {
 }
 
 //----------------------------------------------------------------------------------------
-func (dynoInst *Dyno[K]) DeleteObjectByCodeAndSort(codeValue string, sortValue string) error {
-	keyMap := map[string]*dynamodb.AttributeValue{
-		dynoInst.codeName: {
-			S: aws.String(codeValue),
-		},
-	}
-
-	if dynoInst.sortName != "" && sortValue != "" {
-		var sortAttribute = dynamodb.AttributeValue{}
-		sortAttribute.S = aws.String(sortValue)
-		keyMap[dynoInst.sortName] = &sortAttribute
-	}
+func (dynoInst *Dyno[K]) SetScanSegments(scanSegments int) {
+	dynoInst.scanSegments = scanSegments
+}
 
+//----------------------------------------------------------------------------------------
+func (dynoInst *Dyno[K]) DeleteObjectByCodeAndSort(codeValue string, sortValue string) error {
 	input := &dynamodb.DeleteItemInput{
-		Key:       keyMap,
-		TableName: aws.String(dynoInst.tableName),
+		Key:       dynoInst.keyMap(codeValue, sortValue),
+		TableName: aws.String(dynoInst.remoteName),
 	}
 
 	_, err := Conn.DeleteItem(input)
 	if err != nil {
-		return fmt.Errorf("cannot delete object with %s %s, %s %s. Err: %s", dynoInst.codeName, codeValue, dynoInst.sortName, sortValue, err)
+		return dynoInst.backendErr(fmt.Sprintf("deletion of object with %s %s, %s %s", dynoInst.codeName, codeValue, dynoInst.sortName, sortValue), err)
 	} else {
 		if dynoInst.keepCache {
-			delete(dynoInst.cache, codeValue)
+			dynoInst.deleteCached(codeValue)
+		}
+
+		if dynoInst.sortName == "" || codeValue == sortValue {
+			dynoInst.unindexObject(codeValue)
 		}
 	}
 
@@ -265,21 +651,29 @@ func (dynoInst *Dyno[K]) GetSortKeyList(codeValue string) ([]string, error) {
 		},
 	}
 
-	input.KeyConditionExpression = aws.String(dynoInst.codeName + " = :partitionKey AND (" + dynoInst.sortName + " < :partitionKey OR " + dynoInst.sortName + " > :partitionKey)")
-	input.ProjectionExpression = aws.String(dynoInst.sortName)
-	input.TableName = aws.String(dynoInst.tableName)
+	// Key conditions cannot use OR, so the item holding the object itself (sort value equal
+	// to the code) is skipped below rather than in the query.
+	input.KeyConditionExpression = aws.String("#code = :partitionKey")
+	input.ExpressionAttributeNames = map[string]*string{
+		"#code": aws.String(dynoInst.codeName),
+		"#sort": aws.String(dynoInst.sortName),
+	}
+	input.ProjectionExpression = aws.String("#sort")
+	input.TableName = aws.String(dynoInst.remoteName)
 
-	result, err := Conn.Query(&input)
+	items, err := queryAll(&input)
 
 	if err != nil {
-		log.Fatalf("Error retrieving list of sort keys from table %s for key %s. Error: %v", dynoInst.tableName, codeValue, err)
-	} else {
-		for _, item := range result.Items {
-			keyList = append(keyList, item[dynoInst.sortName].GoString())
+		return keyList, dynoInst.backendErr("retrieval of sort keys for key "+codeValue, err)
+	}
+
+	for _, item := range items {
+		if sortAttribute, hasSort := item[dynoInst.sortName]; hasSort && aws.StringValue(sortAttribute.S) != codeValue {
+			keyList = append(keyList, aws.StringValue(sortAttribute.S))
 		}
 	}
 
-	return keyList, err
+	return keyList, nil
 }
 
 //----------------------------------------------------------------------------------------
@@ -302,9 +696,12 @@ func (dynoInst *Dyno[K]) GetObjectList() ([]K, error) {
 
 	if dynoInst.keepCache {
 		objectList = []K{}
+
+		dynoInst.cacheLock.RLock()
 		for _, objectInst := range dynoInst.cache {
 			objectList = append(objectList, objectInst)
 		}
+		dynoInst.cacheLock.RUnlock()
 	} else {
 		objectList, err = dynoInst.getObjectListFromDB()
 	}
@@ -353,154 +750,253 @@ func (dynoInst *Dyno[K]) GetObjectByCodeJSON(codeValue string) ([]byte, error) {
 
 //----------------------------------------------------------------------------------------
 func (dynoInst *Dyno[K]) GetObjectByCode(codeValue string) (K, error) {
-	var objectInst K
-	var notFoundError error
-	var isFound bool = false
-
 	if dynoInst.keepCache {
-		if objectInstVal, ok := dynoInst.cache[codeValue]; ok {
-			objectInst = objectInstVal
-			isFound = true
+		if objectInst, isCached := dynoInst.getCached(codeValue); isCached {
+			return objectInst, nil
 		}
 	}
 
+	objectInst, isFound, err := dynoInst.getObjectByCodeFromDB(codeValue)
+	if err != nil {
+		return objectInst, err
+	}
+
 	if !isFound {
-		objectInst = dynoInst.getObjectByCodeFromDB(codeValue)
-		if dynoInst.keepCache && len(objectInst.CodeValue()) > 0 {
-			dynoInst.cache[objectInst.CodeValue()] = objectInst
-			isFound = true
+		return objectInst, &db.NotFoundError{TableName: dynoInst.tableName, Code: codeValue}
+	}
+
+	if dynoInst.keepCache {
+		dynoInst.setCached(objectInst)
+	}
+
+	return objectInst, nil
+}
+
+//----------------------------------------------------------------------------------------
+// GetObjectMapByCodes returns the objects with the codes of codeList, keyed by code. Codes
+// that are not found are left out. Cached objects are not read again; the others are read
+// with as few BatchGetItem calls as possible.
+func (dynoInst *Dyno[K]) GetObjectMapByCodes(codeList []string) (map[string]K, error) {
+	var missingList []string
+	objectMap := make(map[string]K)
+
+	for _, codeValue := range db.DistinctCodes(codeList) {
+		if dynoInst.keepCache {
+			if objectInst, isCached := dynoInst.getCached(codeValue); isCached {
+				objectMap[codeValue] = objectInst
+				continue
+			}
 		}
+
+		missingList = append(missingList, codeValue)
 	}
 
-	if !isFound {
-		notFoundError = fmt.Errorf("object with key %s not found", codeValue)
+	if len(missingList) == 0 {
+		return objectMap, nil
+	}
+
+	itemList, err := dynoInst.batchGet(missingList)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range itemList {
+		objectInst := dynoInst.constructor()
+
+		err = dynamodbattribute.UnmarshalMap(item, &objectInst)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling batch result from table %s. Error: %s", dynoInst.tableName, err)
+		}
+
+		objectMap[objectInst.CodeValue()] = objectInst
+		if dynoInst.keepCache {
+			dynoInst.setCached(objectInst)
+		}
 	}
 
-	return objectInst, notFoundError
+	return objectMap, nil
 }
 
 //----------------------------------------------------------------------------------------
 func (dynoInst *Dyno[K]) PutObject(objectInst K) error {
-	objectMarshalled, err := dynamodbattribute.MarshalMap(objectInst)
+	codeValue := objectInst.CodeValue()
+	expectedVersion := objectInst.VersionValue()
+	isMainItem := dynoInst.sortName == "" || codeValue == objectInst.SortValue()
 
-	if dynoInst.sortName != "" {
-		var sortAttribute = dynamodb.AttributeValue{}
-		sortAttribute.S = aws.String(objectInst.SortValue())
-		objectMarshalled[dynoInst.sortName] = &sortAttribute
+	if isMainItem {
+		objectInst.SetVersion(expectedVersion + 1)
 	}
 
+	objectMarshalled, err := dynoInst.marshalObject(objectInst)
 	if err != nil {
-		return fmt.Errorf("got error marshalling map for object with key = %s. Error: %s", objectInst.CodeValue(), err)
+		objectInst.SetVersion(expectedVersion)
+		return err
 	}
 
 	input := &dynamodb.PutItemInput{
 		Item:      objectMarshalled,
-		TableName: aws.String(dynoInst.tableName),
+		TableName: aws.String(dynoInst.remoteName),
+	}
+
+	// Items written before versioning was introduced have no version attribute and are
+	// treated as version 0. Picture stubs are not versioned.
+	if isMainItem {
+		condition := "#version = :version"
+		if expectedVersion == 0 {
+			condition = "attribute_not_exists(#version) OR " + condition
+		}
+
+		input.ConditionExpression = aws.String(condition)
+		input.ExpressionAttributeNames = map[string]*string{
+			"#version": aws.String(db.VERSION_NAME),
+		}
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":version": {
+				N: aws.String(strconv.FormatInt(expectedVersion, 10)),
+			},
+		}
 	}
 
 	_, err = Conn.PutItem(input)
 	if err != nil {
-		return fmt.Errorf("got error calling PutItem for object with key = %s into %s. Error: %s", objectInst.CodeValue(), dynoInst.tableName, err)
+		objectInst.SetVersion(expectedVersion)
+
+		if awsErr, isAwsErr := err.(awserr.Error); isAwsErr && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			if dynoInst.keepCache {
+				dynoInst.deleteCached(codeValue)
+			}
+
+			return &db.ConflictError{TableName: dynoInst.tableName, Code: codeValue, Version: expectedVersion}
+		}
+
+		return dynoInst.backendErr("put of object with key = "+codeValue, err)
 	}
 
-	if dynoInst.keepCache && (objectInst.SortValue() == "" || objectInst.CodeValue() == objectInst.SortValue()) {
-		dynoInst.cache[objectInst.CodeValue()] = objectInst
+	if dynoInst.keepCache && isMainItem {
+		dynoInst.setCached(objectInst)
+		dynoInst.indexObject(objectInst)
 	}
 
 	return nil
 }
 
 //----------------------------------------------------------------------------------------
-func (dynoInst *Dyno[K]) PutObjectList(objectList []K) {
-	for _, objectInst := range objectList {
-		dynoInst.PutObject(objectInst)
-	}
-}
+// PutObjectList writes the objects as given. BatchWriteItem does not support conditions, so
+// unlike PutObject their versions are neither checked nor incremented.
+func (dynoInst *Dyno[K]) PutObjectList(objectList []K) error {
+	var requestList []*dynamodb.WriteRequest
+	var failedCodes []string
+
+	for _, objectInst := range dedupeObjectList(objectList) {
+		objectMarshalled, err := dynoInst.marshalObject(objectInst)
+		if err != nil {
+			return &db.BatchError{TableName: dynoInst.tableName, Operation: "put", FailedCodes: []string{objectInst.CodeValue()}, Err: err}
+		}
 
-//----------------------------------------------------------------------------------------
-func (dynoInst *Dyno[K]) ResetCache() {
-	if !dynoInst.keepCache {
-		return
+		requestList = append(requestList, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: objectMarshalled}})
 	}
 
-	dynoInst.initCache()
-}
+	failedList, err := dynoInst.batchWrite(requestList)
+	failedMap := make(map[string]bool)
 
-//----------------------------------------------------------------------------------------
-func PrintCacheMap() {
-	for key, elementArray := range cacheMap {
-		fmt.Printf("Key %s\n", key)
-		for position, element := range elementArray {
-			fmt.Printf(" -- Position %d: {Code: %s, Tag: %s, Type: %s}\n", position, element.Code, element.Tag, element.Type)
+	for _, request := range failedList {
+		codeValue := aws.StringValue(request.PutRequest.Item[dynoInst.codeName].S)
+		failedMap[codeValue] = true
+		failedCodes = append(failedCodes, codeValue)
+	}
+
+	if dynoInst.keepCache {
+		for _, objectInst := range objectList {
+			if !failedMap[objectInst.CodeValue()] && (objectInst.SortValue() == "" || objectInst.CodeValue() == objectInst.SortValue()) {
+				dynoInst.setCached(objectInst)
+				dynoInst.indexObject(objectInst)
+			}
 		}
 	}
+
+	if len(failedCodes) > 0 {
+		return &db.BatchError{TableName: dynoInst.tableName, Operation: "put", FailedCodes: failedCodes, Err: err}
+	}
+
+	return nil
 }
 
 //----------------------------------------------------------------------------------------
-func SearchCacheMap(searchKey string) []db.CacheMapElement {
-	var exactMatches []db.CacheMapElement
-	var approxMatches []db.CacheMapElement
-	var allMatches []db.CacheMapElement
-	var resultSlice []db.CacheMapElement
-	var resultMap map[string]string = make(map[string]string)
-	var tempKey string
-	searchKeyLower := strings.ToLower(searchKey)
+func (dynoInst *Dyno[K]) DeleteObjectList(objectList []K) error {
+	var requestList []*dynamodb.WriteRequest
+	var failedCodes []string
 
-	if elementArray, hasElementArray := cacheMap[searchKeyLower]; hasElementArray {
-		exactMatches = elementArray
-	}
+	for _, objectInst := range dedupeObjectList(objectList) {
+		var keyMap map[string]*dynamodb.AttributeValue
 
-	for key, cacheMapElement := range cacheMap {
-		if key != searchKeyLower && strings.Contains(key, searchKeyLower) {
-			approxMatches = append(approxMatches, cacheMapElement...)
+		if dynoInst.sortName == "" {
+			keyMap = dynoInst.keyMap(objectInst.CodeValue(), "")
+		} else {
+			keyMap = dynoInst.keyMap(objectInst.CodeValue(), objectInst.SortValue())
 		}
+
+		requestList = append(requestList, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: keyMap}})
 	}
 
-	allMatches = append(allMatches, exactMatches...)
-	allMatches = append(allMatches, approxMatches...)
+	failedList, err := dynoInst.batchWrite(requestList)
+	failedMap := make(map[string]bool)
+
+	for _, request := range failedList {
+		codeValue := aws.StringValue(request.DeleteRequest.Key[dynoInst.codeName].S)
+		failedMap[codeValue] = true
+		failedCodes = append(failedCodes, codeValue)
+	}
+
+	if dynoInst.keepCache {
+		for _, objectInst := range objectList {
+			if !failedMap[objectInst.CodeValue()] {
+				dynoInst.deleteCached(objectInst.CodeValue())
 
-	for _, matchElement := range allMatches {
-		tempKey = matchElement.Code + "|" + matchElement.Type
-		if _, hasKey := resultMap[tempKey]; !hasKey {
-			resultMap[tempKey] = tempKey
-			resultSlice = append(resultSlice, matchElement)
+				if dynoInst.sortName == "" || objectInst.CodeValue() == objectInst.SortValue() {
+					dynoInst.unindexObject(objectInst.CodeValue())
+				}
+			}
 		}
 	}
 
-	return resultSlice
+	if len(failedCodes) > 0 {
+		return &db.BatchError{TableName: dynoInst.tableName, Operation: "delete", FailedCodes: failedCodes, Err: err}
+	}
+
+	return nil
 }
 
 //----------------------------------------------------------------------------------------
-func SearchCacheMapJSON(searchKey string) []byte {
-	allMatches := SearchCacheMap(searchKey)
-	out, err := json.MarshalIndent(allMatches, db.JSON_PREFIX, db.JSON_INDENT)
-
-	if err != nil {
-		log.Fatalf("Got error when trying to return cache map entries for search key: %s. Error: %s", searchKey, err)
+func (dynoInst *Dyno[K]) ResetCache() error {
+	if !dynoInst.keepCache {
 		return nil
 	}
 
-	return out
+	return dynoInst.initCache()
 }
 
 //----------------------------------------------------------------------------------------
-func CacheMapJSON() []byte {
-	var allMatches []CacheMapEntry
-
-	for key, arrayElement := range cacheMap {
-		var entry CacheMapEntry
-		entry.Key = key
-		entry.Elements = arrayElement
+// Status reports the size of the cache of the adapter and the time it was last loaded.
+func (dynoInst *Dyno[K]) Status() db.AdapterStatus {
+	dynoInst.cacheLock.RLock()
+	defer dynoInst.cacheLock.RUnlock()
 
-		allMatches = append(allMatches, entry)
+	statusInst := db.AdapterStatus{TableName: dynoInst.tableName, KeepCache: dynoInst.keepCache, CacheSize: len(dynoInst.cache)}
+	if dynoInst.keepCache && !dynoInst.cacheTime.IsZero() {
+		cacheTime := dynoInst.cacheTime
+		statusInst.CacheTime = &cacheTime
 	}
 
-	out, err := json.MarshalIndent(allMatches, db.JSON_PREFIX, db.JSON_INDENT)
+	return statusInst
+}
 
+//----------------------------------------------------------------------------------------
+// Ping checks that the table of the adapter can be reached.
+func (dynoInst *Dyno[K]) Ping() error {
+	_, err := Conn.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(dynoInst.remoteName)})
 	if err != nil {
-		log.Fatalf("Got error when trying to return full cache map %s", err)
-		return nil
+		return dynoInst.backendErr("description of the table", err)
 	}
 
-	return out
+	return nil
 }
@@ -0,0 +1,951 @@
+package dyno
+
+import (
+	"colmanback/db"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+const (
+	tableConst    = "dynotest"
+	codeNameConst = "code"
+	sortNameConst = "picture"
+	gsiNameConst  = "picture-code-index"
+	pageSizeConst = 4
+	itemCount     = 25
+)
+
+type testObject struct {
+	Code    string `json:"code"`
+	Picture string `json:"picture,omitempty"`
+	Name    string `json:"name"`
+	Version int64  `json:"version"`
+}
+
+func (objectInst *testObject) CodeValue() string {
+	return objectInst.Code
+}
+
+func (objectInst *testObject) SortValue() string {
+	if len(objectInst.Picture) > 0 {
+		return objectInst.Picture
+	}
+
+	return objectInst.Code
+}
+
+func (objectInst *testObject) VersionValue() int64 {
+	return objectInst.Version
+}
+
+func (objectInst *testObject) SetVersion(version int64) {
+	objectInst.Version = version
+}
+
+func (objectInst *testObject) ToString() string {
+	return fmt.Sprintf("{code: %s, picture: %s, name: %s}", objectInst.Code, objectInst.Picture, objectInst.Name)
+}
+
+func (objectInst *testObject) FromJson(jsonInst []byte) error { return nil }
+func (objectInst *testObject) Print()                         {}
+func (objectInst *testObject) Put() error                     { return nil }
+func (objectInst *testObject) Delete() error                  { return nil }
+
+func (objectInst *testObject) WriteObject(writer http.ResponseWriter, request *http.Request) {}
+
+func testObjectFactory() *testObject {
+	return &testObject{}
+}
+
+// fakeDynamo keeps items in insertion order and returns them in pages of pageSize items,
+// so that every caller has to follow LastEvaluatedKey to see the whole table.
+type fakeDynamo struct {
+	dynamodbiface.DynamoDBAPI
+
+	lock     sync.Mutex
+	items    []map[string]*dynamodb.AttributeValue
+	pageSize int
+	calls    map[string]int
+
+	// BatchWriteItem returns the second half of every batch as unprocessed for the first
+	// throttledCalls calls, and leaves the items of throttledCode unprocessed forever.
+	batchSizes     []int
+	throttledCalls int
+	throttledCode  string
+
+	// Scan fails with scanErr when it is set.
+	scanErr error
+
+	// tables holds the tables created through CreateTable, by name.
+	tables map[string]*dynamodb.CreateTableInput
+}
+
+func newFakeDynamo() *fakeDynamo {
+	return &fakeDynamo{pageSize: pageSizeConst, calls: make(map[string]int), tables: make(map[string]*dynamodb.CreateTableInput)}
+}
+
+func (fake *fakeDynamo) addItem(code string, picture string, name string) {
+	item := map[string]*dynamodb.AttributeValue{
+		codeNameConst: {S: aws.String(code)},
+		"name":        {S: aws.String(name)},
+	}
+
+	if picture != "" {
+		item[sortNameConst] = &dynamodb.AttributeValue{S: aws.String(picture)}
+	}
+
+	fake.items = append(fake.items, item)
+}
+
+func (fake *fakeDynamo) page(matches []map[string]*dynamodb.AttributeValue, startKey map[string]*dynamodb.AttributeValue) ([]map[string]*dynamodb.AttributeValue, map[string]*dynamodb.AttributeValue) {
+	start := 0
+	if startKey != nil {
+		start, _ = strconv.Atoi(aws.StringValue(startKey["offset"].S))
+	}
+
+	end := start + fake.pageSize
+	if end >= len(matches) {
+		return matches[start:], nil
+	}
+
+	return matches[start:end], map[string]*dynamodb.AttributeValue{"offset": {S: aws.String(strconv.Itoa(end))}}
+}
+
+func (fake *fakeDynamo) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	var matches []map[string]*dynamodb.AttributeValue
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.calls["Scan"]++
+
+	if fake.scanErr != nil {
+		return nil, fake.scanErr
+	}
+
+	for index, item := range fake.items {
+		if input.TotalSegments == nil || int64(index)%*input.TotalSegments == *input.Segment {
+			matches = append(matches, item)
+		}
+	}
+
+	items, lastKey := fake.page(matches, input.ExclusiveStartKey)
+
+	return &dynamodb.ScanOutput{Items: items, LastEvaluatedKey: lastKey}, nil
+}
+
+func (fake *fakeDynamo) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	var matches []map[string]*dynamodb.AttributeValue
+	var attributeName string
+	var attributeValue string
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.calls["Query"]++
+
+	if input.KeyConditions != nil {
+		for name, condition := range input.KeyConditions {
+			attributeName = name
+			attributeValue = aws.StringValue(condition.AttributeValueList[0].S)
+		}
+	} else {
+		attributeName = aws.StringValue(input.ExpressionAttributeNames["#code"])
+		attributeValue = aws.StringValue(input.ExpressionAttributeValues[":partitionKey"].S)
+	}
+
+	for _, item := range fake.items {
+		if attribute, hasAttribute := item[attributeName]; hasAttribute && aws.StringValue(attribute.S) == attributeValue {
+			matches = append(matches, item)
+		}
+	}
+
+	items, lastKey := fake.page(matches, input.ExclusiveStartKey)
+
+	return &dynamodb.QueryOutput{Items: items, LastEvaluatedKey: lastKey}, nil
+}
+
+func isKeyMatch(item map[string]*dynamodb.AttributeValue, key map[string]*dynamodb.AttributeValue) bool {
+	for name, value := range key {
+		if attribute, hasAttribute := item[name]; !hasAttribute || aws.StringValue(attribute.S) != aws.StringValue(value.S) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (fake *fakeDynamo) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.calls["GetItem"]++
+
+	for _, item := range fake.items {
+		if isKeyMatch(item, input.Key) {
+			return &dynamodb.GetItemOutput{Item: item}, nil
+		}
+	}
+
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func (fake *fakeDynamo) deleteItem(key map[string]*dynamodb.AttributeValue) {
+	var items []map[string]*dynamodb.AttributeValue
+
+	for _, item := range fake.items {
+		if !isKeyMatch(item, key) {
+			items = append(items, item)
+		}
+	}
+
+	fake.items = items
+}
+
+func (fake *fakeDynamo) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.calls["DeleteItem"]++
+
+	fake.deleteItem(input.Key)
+
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// PutItem only understands the version conditions written by PutObject.
+func (fake *fakeDynamo) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.calls["PutItem"]++
+
+	key := map[string]*dynamodb.AttributeValue{codeNameConst: input.Item[codeNameConst]}
+	if sortAttribute, hasSort := input.Item[sortNameConst]; hasSort {
+		key[sortNameConst] = sortAttribute
+	}
+
+	if input.ConditionExpression != nil {
+		var storedVersion *dynamodb.AttributeValue
+
+		for _, item := range fake.items {
+			if isKeyMatch(item, key) {
+				storedVersion = item[db.VERSION_NAME]
+			}
+		}
+
+		expectedVersion := aws.StringValue(input.ExpressionAttributeValues[":version"].N)
+		isMatch := storedVersion != nil && aws.StringValue(storedVersion.N) == expectedVersion
+		if strings.HasPrefix(*input.ConditionExpression, "attribute_not_exists") && storedVersion == nil {
+			isMatch = true
+		}
+
+		if !isMatch {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+		}
+	}
+
+	fake.deleteItem(key)
+	fake.items = append(fake.items, input.Item)
+
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (fake *fakeDynamo) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	unprocessed := make(map[string][]*dynamodb.WriteRequest)
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.calls["BatchWriteItem"]++
+
+	for tableName, requestList := range input.RequestItems {
+		fake.batchSizes = append(fake.batchSizes, len(requestList))
+
+		if fake.throttledCalls > 0 {
+			fake.throttledCalls--
+			unprocessed[tableName] = append(unprocessed[tableName], requestList[len(requestList)/2:]...)
+			requestList = requestList[:len(requestList)/2]
+		}
+
+		for _, request := range requestList {
+			if request.PutRequest != nil {
+				item := request.PutRequest.Item
+				if aws.StringValue(item[codeNameConst].S) == fake.throttledCode {
+					unprocessed[tableName] = append(unprocessed[tableName], request)
+					continue
+				}
+
+				key := map[string]*dynamodb.AttributeValue{codeNameConst: item[codeNameConst]}
+				if sortAttribute, hasSort := item[sortNameConst]; hasSort {
+					key[sortNameConst] = sortAttribute
+				}
+
+				fake.deleteItem(key)
+				fake.items = append(fake.items, item)
+			} else {
+				if aws.StringValue(request.DeleteRequest.Key[codeNameConst].S) == fake.throttledCode {
+					unprocessed[tableName] = append(unprocessed[tableName], request)
+					continue
+				}
+
+				fake.deleteItem(request.DeleteRequest.Key)
+			}
+		}
+	}
+
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: unprocessed}, nil
+}
+
+func (fake *fakeDynamo) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	responses := make(map[string][]map[string]*dynamodb.AttributeValue)
+	unprocessed := make(map[string]*dynamodb.KeysAndAttributes)
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.calls["BatchGetItem"]++
+
+	for tableName, keysInst := range input.RequestItems {
+		keyList := keysInst.Keys
+		fake.batchSizes = append(fake.batchSizes, len(keyList))
+
+		if fake.throttledCalls > 0 {
+			fake.throttledCalls--
+			unprocessed[tableName] = &dynamodb.KeysAndAttributes{Keys: keyList[len(keyList)/2:]}
+			keyList = keyList[:len(keyList)/2]
+		}
+
+		for _, key := range keyList {
+			for _, item := range fake.items {
+				if isKeyMatch(item, key) {
+					responses[tableName] = append(responses[tableName], item)
+					break
+				}
+			}
+		}
+	}
+
+	return &dynamodb.BatchGetItemOutput{Responses: responses, UnprocessedKeys: unprocessed}, nil
+}
+
+func (fake *fakeDynamo) DescribeTable(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.calls["DescribeTable"]++
+
+	if _, isFound := fake.tables[aws.StringValue(input.TableName)]; !isFound {
+		return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found", nil)
+	}
+
+	return &dynamodb.DescribeTableOutput{Table: &dynamodb.TableDescription{TableName: input.TableName}}, nil
+}
+
+func (fake *fakeDynamo) CreateTable(input *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.calls["CreateTable"]++
+
+	fake.tables[aws.StringValue(input.TableName)] = input
+
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (fake *fakeDynamo) WaitUntilTableExists(input *dynamodb.DescribeTableInput) error {
+	_, err := fake.DescribeTable(input)
+	return err
+}
+
+func newPlainAdapter(keepCache bool) *Dyno[*testObject] {
+	dynoInst := &Dyno[*testObject]{}
+	dynoInst.Config(tableConst, codeNameConst, keepCache, testObjectFactory, nil)
+
+	return dynoInst
+}
+
+func newSortAdapter() *Dyno[*testObject] {
+	dynoInst := &Dyno[*testObject]{}
+	dynoInst.SetSortName(sortNameConst)
+	dynoInst.SetSortGSIName(gsiNameConst)
+	dynoInst.Config(tableConst, codeNameConst, true, testObjectFactory, nil)
+
+	return dynoInst
+}
+
+func (dynoInst *Dyno[K]) getListOrFail(t *testing.T) []K {
+	objectList, err := dynoInst.GetObjectList()
+	if err != nil {
+		t.Errorf("Error retrieving list: %v", err)
+	}
+
+	return objectList
+}
+
+func chkCodeList(t *testing.T, objectList []*testObject, expectedCount int) {
+	codeMap := make(map[string]bool)
+
+	for _, objectInst := range objectList {
+		codeMap[objectInst.Code] = true
+	}
+
+	if len(objectList) != expectedCount || len(codeMap) != expectedCount {
+		t.Errorf("Expected %d distinct objects but got %d objects with %d distinct codes", expectedCount, len(objectList), len(codeMap))
+	}
+}
+
+func TestScanPagination(t *testing.T) {
+	fake := newFakeDynamo()
+	for index := 0; index < itemCount; index++ {
+		fake.addItem("code"+strconv.Itoa(index), "", "name"+strconv.Itoa(index))
+	}
+	Conn = fake
+
+	t.Log("Cache initialisation follows every page of the scan")
+	objectList, err := newPlainAdapter(true).GetObjectList()
+	if err != nil {
+		t.Errorf("Error retrieving list from cache: %v", err)
+	}
+	chkCodeList(t, objectList, itemCount)
+
+	t.Log("Direct list retrieval follows every page of the scan")
+	objectList, err = newPlainAdapter(false).GetObjectList()
+	if err != nil {
+		t.Errorf("Error retrieving list from table: %v", err)
+	}
+	chkCodeList(t, objectList, itemCount)
+
+	if fake.calls["Scan"] < 2*(itemCount/pageSizeConst) {
+		t.Errorf("Scan was not paginated. Calls: %d", fake.calls["Scan"])
+	}
+}
+
+func TestParallelScan(t *testing.T) {
+	fake := newFakeDynamo()
+	for index := 0; index < itemCount; index++ {
+		fake.addItem("code"+strconv.Itoa(index), "", "name"+strconv.Itoa(index))
+	}
+	Conn = fake
+
+	dynoInst := &Dyno[*testObject]{}
+	dynoInst.SetScanSegments(3)
+	dynoInst.Config(tableConst, codeNameConst, true, testObjectFactory, nil)
+
+	objectList, err := dynoInst.GetObjectList()
+	if err != nil {
+		t.Errorf("Error retrieving list with a parallel scan: %v", err)
+	}
+	chkCodeList(t, objectList, itemCount)
+}
+
+func TestSortKeyPagination(t *testing.T) {
+	var expectedPictures []string
+
+	fake := newFakeDynamo()
+	fake.addItem("model1", "model1", "model one")
+	fake.addItem("model2", "model2", "model two")
+	for index := 0; index < itemCount; index++ {
+		picture := fmt.Sprintf("picture%02d", index)
+		expectedPictures = append(expectedPictures, picture)
+		fake.addItem("model1", picture, "")
+	}
+	fake.addItem("model2", "picture00", "")
+	Conn = fake
+
+	dynoInst := newSortAdapter()
+
+	t.Log("Sort key list contains every picture but not the object itself")
+	pictureList, err := dynoInst.GetSortKeyList("model1")
+	if err != nil {
+		t.Errorf("Error retrieving sort keys: %v", err)
+	}
+	sort.Strings(pictureList)
+	if fmt.Sprint(expectedPictures) != fmt.Sprint(pictureList) {
+		t.Errorf("Sort key list does not match. Expected %v but got %v", expectedPictures, pictureList)
+	}
+
+	t.Log("List by sort value follows every page of the index query")
+	objectList, err := dynoInst.GetObjectListBySort("picture00")
+	if err != nil {
+		t.Errorf("Error retrieving list by sort value: %v", err)
+	}
+	chkCodeList(t, objectList, 2)
+
+	t.Log("Full list only contains the objects and not the picture entries")
+	objectList, err = dynoInst.GetObjectList()
+	if err != nil {
+		t.Errorf("Error retrieving list: %v", err)
+	}
+	chkCodeList(t, objectList, 2)
+}
+
+func newObjectList(count int) []*testObject {
+	var objectList []*testObject
+
+	for index := 0; index < count; index++ {
+		objectList = append(objectList, &testObject{Code: "code" + strconv.Itoa(index), Name: "name" + strconv.Itoa(index)})
+	}
+
+	return objectList
+}
+
+func TestBatchPut(t *testing.T) {
+	fake := newFakeDynamo()
+	Conn = fake
+	BatchRetryBackoff = time.Millisecond
+
+	dynoInst := newPlainAdapter(true)
+	objectList := newObjectList(60)
+
+	t.Log("Objects are written in chunks of 25, duplicates are only written once")
+	err := dynoInst.PutObjectList(append(objectList, &testObject{Code: "code0", Name: "renamed"}))
+	if err != nil {
+		t.Errorf("Error writing object list: %v", err)
+	}
+
+	if fmt.Sprint(fake.batchSizes) != fmt.Sprint([]int{25, 25, 10}) {
+		t.Errorf("Unexpected batch sizes %v", fake.batchSizes)
+	}
+
+	chkCodeList(t, newPlainAdapter(false).getListOrFail(t), 60)
+
+	objectInst, err := dynoInst.GetObjectByCode("code0")
+	if err != nil || objectInst.Name != "renamed" {
+		t.Errorf("Last duplicate was not kept. Got %v, error %v", objectInst, err)
+	}
+
+	t.Log("Objects are deleted in chunks and evicted from the cache")
+	err = dynoInst.DeleteObjectList(objectList[:30])
+	if err != nil {
+		t.Errorf("Error deleting object list: %v", err)
+	}
+
+	chkCodeList(t, newPlainAdapter(false).getListOrFail(t), 30)
+
+	cachedList, _ := dynoInst.GetObjectList()
+	chkCodeList(t, cachedList, 30)
+}
+
+func TestBatchRetry(t *testing.T) {
+	fake := newFakeDynamo()
+	Conn = fake
+	BatchRetryBackoff = time.Millisecond
+
+	dynoInst := newPlainAdapter(false)
+
+	t.Log("Unprocessed items are resubmitted until they are written")
+	fake.throttledCalls = 3
+	err := dynoInst.PutObjectList(newObjectList(30))
+	if err != nil {
+		t.Errorf("Error writing object list: %v", err)
+	}
+
+	chkCodeList(t, dynoInst.getListOrFail(t), 30)
+
+	if fake.calls["BatchWriteItem"] <= 2 {
+		t.Errorf("Unprocessed items were not retried. Calls: %d", fake.calls["BatchWriteItem"])
+	}
+
+	t.Log("Items that remain unprocessed are reported by code")
+	fake.throttledCode = "code7"
+	err = dynoInst.DeleteObjectList(newObjectList(30))
+
+	batchErr, isBatchErr := err.(*db.BatchError)
+	if !isBatchErr {
+		t.Fatalf("Expected a batch error but got %v", err)
+	}
+
+	if fmt.Sprint(batchErr.FailedCodes) != "[code7]" || batchErr.Operation != "delete" {
+		t.Errorf("Unexpected batch error %v", batchErr)
+	}
+
+	chkCodeList(t, dynoInst.getListOrFail(t), 1)
+}
+
+func TestVersionConflict(t *testing.T) {
+	var conflictErr *db.ConflictError
+
+	fake := newFakeDynamo()
+	fake.addItem("legacy", "", "written before versioning")
+	Conn = fake
+
+	dynoInst := newPlainAdapter(true)
+
+	t.Log("A new object is created with version 1")
+	objectInst := &testObject{Code: "code1", Name: "name1"}
+	err := dynoInst.PutObject(objectInst)
+	if err != nil || objectInst.Version != 1 {
+		t.Errorf("Unexpected result for first put. Version %d, error %v", objectInst.Version, err)
+	}
+
+	t.Log("An update carrying the current version succeeds")
+	objectInst.Name = "name2"
+	err = dynoInst.PutObject(objectInst)
+	if err != nil || objectInst.Version != 2 {
+		t.Errorf("Unexpected result for update. Version %d, error %v", objectInst.Version, err)
+	}
+
+	t.Log("An update carrying an old version is rejected and keeps its version")
+	staleInst := &testObject{Code: "code1", Name: "stale", Version: 1}
+	err = dynoInst.PutObject(staleInst)
+	if !errors.As(err, &conflictErr) || conflictErr.Code != "code1" || staleInst.Version != 1 {
+		t.Errorf("Expected a conflict error for code1 but got %v with version %d", err, staleInst.Version)
+	}
+
+	storedInst, err := newPlainAdapter(true).GetObjectByCode("code1")
+	if err != nil || storedInst.Name != "name2" {
+		t.Errorf("Stale update overwrote the stored object. Got %v, error %v", storedInst, err)
+	}
+
+	t.Log("An object stored without a version can be updated as version 0")
+	err = dynoInst.PutObject(&testObject{Code: "legacy", Name: "updated"})
+	if err != nil {
+		t.Errorf("Error updating unversioned object: %v", err)
+	}
+
+	t.Log("An update of an object that no longer exists is rejected")
+	err = dynoInst.PutObject(&testObject{Code: "deleted", Name: "gone", Version: 3})
+	if !errors.As(err, &conflictErr) {
+		t.Errorf("Expected a conflict error for a deleted object but got %v", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	fake := newFakeDynamo()
+	fake.addItem("code1", "", "name1")
+	Conn = fake
+
+	t.Log("A missing object is reported as not found with and without the cache")
+	for _, keepCache := range []bool{true, false} {
+		dynoInst := newPlainAdapter(keepCache)
+
+		_, err := dynoInst.GetObjectByCode("missing")
+		if !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected a not found error with keepCache %v but got %v", keepCache, err)
+		}
+
+		objectInst, err := dynoInst.GetObjectByCode("code1")
+		if err != nil || objectInst.Name != "name1" {
+			t.Errorf("Unexpected result for code1 with keepCache %v. Got %v, error %v", keepCache, objectInst, err)
+		}
+	}
+
+	t.Log("A failing table is reported as a backend error instead of stopping the process")
+	fake.scanErr = awserr.New(dynamodb.ErrCodeInternalServerError, "Internal server error", nil)
+
+	dynoInst := &Dyno[*testObject]{}
+	err := dynoInst.Config(tableConst, codeNameConst, true, testObjectFactory, nil)
+	if !errors.Is(err, db.ErrBackendUnavailable) {
+		t.Errorf("Expected a backend error from Config but got %v", err)
+	}
+
+	_, err = newPlainAdapter(false).GetObjectList()
+	if !errors.Is(err, db.ErrBackendUnavailable) {
+		t.Errorf("Expected a backend error from GetObjectList but got %v", err)
+	}
+}
+
+func testCacheMap(objectList []*testObject) []db.CacheMapElement {
+	var cacheMap []db.CacheMapElement
+
+	for _, objectInst := range objectList {
+		cacheMap = db.AddToCacheMap(cacheMap, objectInst.Name, objectInst.Code, objectInst.Name)
+	}
+
+	return cacheMap
+}
+
+// TestConcurrentAccess is meant to be run with the race detector (go test -race).
+func TestConcurrentAccess(t *testing.T) {
+	var waitGroup sync.WaitGroup
+
+	fake := newFakeDynamo()
+	for index := 0; index < itemCount; index++ {
+		fake.addItem(fmt.Sprintf("code%02d", index), "", fmt.Sprintf("name%02d", index))
+	}
+	Conn = fake
+
+	dynoInst := &Dyno[*testObject]{}
+	err := dynoInst.Config(tableConst, codeNameConst, true, testObjectFactory, testCacheMap)
+	if err != nil {
+		t.Fatalf("Unexpected error configuring the adapter: %v", err)
+	}
+
+	t.Log("Writers, readers and cache resets run concurrently")
+	for worker := 0; worker < 8; worker++ {
+		waitGroup.Add(1)
+
+		go func(worker int) {
+			defer waitGroup.Done()
+
+			for iteration := 0; iteration < 50; iteration++ {
+				code := fmt.Sprintf("worker%d-%d", worker, iteration%5)
+
+				objectInst := &testObject{Code: code, Name: code}
+				if storedInst, getErr := dynoInst.GetObjectByCode(code); getErr == nil {
+					objectInst.Version = storedInst.Version
+				}
+
+				putErr := dynoInst.PutObject(objectInst)
+				if putErr != nil && !errors.Is(putErr, db.ErrConflict) {
+					t.Errorf("Unexpected error putting %s: %v", code, putErr)
+				}
+
+				_, _ = dynoInst.GetObjectList()
+				_ = db.SearchCacheMap("name")
+
+				switch iteration % 10 {
+				case 3:
+					if deleteErr := dynoInst.DeleteObjectByCode(code); deleteErr != nil {
+						t.Errorf("Unexpected error deleting %s: %v", code, deleteErr)
+					}
+				case 7:
+					if resetErr := dynoInst.ResetCache(); resetErr != nil {
+						t.Errorf("Unexpected error resetting the cache: %v", resetErr)
+					}
+				}
+			}
+		}(worker)
+	}
+
+	waitGroup.Wait()
+}
+
+func TestAtomicResetCache(t *testing.T) {
+	var waitGroup sync.WaitGroup
+
+	fake := newFakeDynamo()
+	for index := 0; index < itemCount; index++ {
+		fake.addItem(fmt.Sprintf("code%02d", index), "", fmt.Sprintf("name%02d", index))
+	}
+	Conn = fake
+
+	dynoInst := &Dyno[*testObject]{}
+	err := dynoInst.Config(tableConst, codeNameConst, true, testObjectFactory, testCacheMap)
+	if err != nil {
+		t.Fatalf("Unexpected error configuring the adapter: %v", err)
+	}
+
+	stopChan := make(chan bool)
+
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+
+		for iteration := 0; iteration < 20; iteration++ {
+			if resetErr := dynoInst.ResetCache(); resetErr != nil {
+				t.Errorf("Unexpected error resetting the cache: %v", resetErr)
+			}
+		}
+
+		close(stopChan)
+	}()
+
+	t.Log("Readers never see a partially loaded cache or search map while it is being reset")
+	for reader := 0; reader < 4; reader++ {
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+
+			for {
+				select {
+				case <-stopChan:
+					return
+				default:
+				}
+
+				objectList, listErr := dynoInst.GetObjectList()
+				if listErr != nil || len(objectList) != itemCount {
+					t.Errorf("Expected %d cached objects but got %d, error %v", itemCount, len(objectList), listErr)
+					return
+				}
+
+				matchList := db.SearchCacheMap("name")
+				if len(matchList) != itemCount {
+					t.Errorf("Expected %d search matches but got %d", itemCount, len(matchList))
+					return
+				}
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+}
+
+func chkSearchCodes(t *testing.T, tag string, expectedCodes ...string) {
+	var codeList []string
+
+	for _, cacheMapElement := range db.SearchCacheMap(tag) {
+		if cacheMapElement.Type == tableConst && cacheMapElement.Tag == tag {
+			codeList = append(codeList, cacheMapElement.Code)
+		}
+	}
+	sort.Strings(codeList)
+
+	if strings.Join(codeList, ",") != strings.Join(expectedCodes, ",") {
+		t.Errorf("Search for tag %s expected codes %v but got %v", tag, expectedCodes, codeList)
+	}
+}
+
+func TestSearchIndexMaintenance(t *testing.T) {
+	fake := newFakeDynamo()
+	fake.addItem("code1", "", "alpha")
+	Conn = fake
+
+	dynoInst := &Dyno[*testObject]{}
+	err := dynoInst.Config(tableConst, codeNameConst, true, testObjectFactory, testCacheMap)
+	if err != nil {
+		t.Fatalf("Unexpected error configuring the adapter: %v", err)
+	}
+	chkSearchCodes(t, "alpha", "code1")
+
+	t.Log("A new object is searchable straight after it has been put")
+	err = dynoInst.PutObject(&testObject{Code: "code2", Name: "alpha"})
+	if err != nil {
+		t.Fatalf("Unexpected error putting code2: %v", err)
+	}
+	chkSearchCodes(t, "alpha", "code1", "code2")
+
+	t.Log("A renamed object is no longer found by its old name")
+	err = dynoInst.PutObject(&testObject{Code: "code1", Name: "beta"})
+	if err != nil {
+		t.Fatalf("Unexpected error renaming code1: %v", err)
+	}
+	chkSearchCodes(t, "alpha", "code2")
+	chkSearchCodes(t, "beta", "code1")
+
+	t.Log("Batch writes and deletes are reflected as well")
+	err = dynoInst.PutObjectList([]*testObject{{Code: "code3", Name: "beta"}})
+	if err != nil {
+		t.Fatalf("Unexpected error in batch put: %v", err)
+	}
+	chkSearchCodes(t, "beta", "code1", "code3")
+
+	err = dynoInst.DeleteObjectList([]*testObject{{Code: "code1"}})
+	if err != nil {
+		t.Fatalf("Unexpected error in batch delete: %v", err)
+	}
+	chkSearchCodes(t, "beta", "code3")
+
+	err = dynoInst.DeleteObjectByCode("code2")
+	if err != nil {
+		t.Fatalf("Unexpected error deleting code2: %v", err)
+	}
+	chkSearchCodes(t, "alpha")
+}
+
+func TestBatchGet(t *testing.T) {
+	fake := newFakeDynamo()
+	Conn = fake
+	BatchRetryBackoff = time.Millisecond
+
+	//the cache is filled when the adapter is configured, so the items are added afterwards.
+	dynoInst := newPlainAdapter(true)
+	for index := 0; index < 150; index++ {
+		fake.addItem("code"+strconv.Itoa(index), "", "name"+strconv.Itoa(index))
+	}
+
+	codeList := []string{"code0", "code0", "", "missing"}
+	for index := 1; index < 150; index++ {
+		codeList = append(codeList, "code"+strconv.Itoa(index))
+	}
+
+	t.Log("Distinct codes are read in chunks of 100, unprocessed keys are resubmitted")
+	fake.throttledCalls = 1
+	objectMap, err := dynoInst.GetObjectMapByCodes(codeList)
+	if err != nil {
+		t.Errorf("Error reading objects: %v", err)
+	}
+
+	if len(objectMap) != 150 || objectMap["code149"] == nil || objectMap["code149"].Name != "name149" {
+		t.Errorf("Expected 150 objects but got %d", len(objectMap))
+	}
+
+	if fmt.Sprint(fake.batchSizes) != fmt.Sprint([]int{100, 50, 51}) {
+		t.Errorf("Unexpected batch sizes %v", fake.batchSizes)
+	}
+
+	t.Log("Cached objects are not read again")
+	fake.batchSizes = nil
+	objectMap, err = dynoInst.GetObjectMapByCodes([]string{"code0", "code1", "missing"})
+	if err != nil || len(objectMap) != 2 {
+		t.Errorf("Expected 2 objects but got %d, error %v", len(objectMap), err)
+	}
+
+	if fmt.Sprint(fake.batchSizes) != fmt.Sprint([]int{1}) {
+		t.Errorf("Only the missing code expected to be read but got batch sizes %v", fake.batchSizes)
+	}
+}
+
+func TestCreateTables(t *testing.T) {
+	fake := newFakeDynamo()
+	Conn = fake
+	CreateTables = true
+	TablePrefix = "test-"
+	defer func() {
+		CreateTables = false
+		TablePrefix = ""
+	}()
+
+	t.Log("Missing tables are created with their keys and sort index")
+	newSortAdapter()
+	input := fake.tables["test-"+tableConst]
+	if input == nil {
+		t.Fatalf("Expected table test-%s to be created, got %v", tableConst, fake.tables)
+	}
+
+	if len(input.KeySchema) != 2 || aws.StringValue(input.KeySchema[0].AttributeName) != codeNameConst || aws.StringValue(input.KeySchema[1].AttributeName) != sortNameConst {
+		t.Errorf("Unexpected key schema %v", input.KeySchema)
+	}
+
+	if len(input.GlobalSecondaryIndexes) != 1 || aws.StringValue(input.GlobalSecondaryIndexes[0].IndexName) != gsiNameConst ||
+		aws.StringValue(input.GlobalSecondaryIndexes[0].KeySchema[0].AttributeName) != sortNameConst {
+		t.Errorf("Unexpected sort index %v", input.GlobalSecondaryIndexes)
+	}
+
+	t.Log("Existing tables are left as they are")
+	newPlainAdapter(true)
+	if fake.calls["CreateTable"] != 1 {
+		t.Errorf("Expected the table to be created once, got %d calls", fake.calls["CreateTable"])
+	}
+
+	t.Log("Tables without a sort name only have a partition key")
+	delete(fake.tables, "test-"+tableConst)
+	newPlainAdapter(false)
+	if input := fake.tables["test-"+tableConst]; input == nil || len(input.KeySchema) != 1 || input.GlobalSecondaryIndexes != nil {
+		t.Errorf("Unexpected table %v", input)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	fake := newFakeDynamo()
+	fake.addItem("code1", "", "name1")
+	fake.addItem("code2", "", "name2")
+	Conn = fake
+
+	dynoInst := newPlainAdapter(true)
+	statusInst := dynoInst.Status()
+	if statusInst.TableName != tableConst || statusInst.CacheSize != 2 || statusInst.CacheTime == nil {
+		t.Errorf("Unexpected status %+v", statusInst)
+	}
+
+	t.Log("Adapters without a cache have no cache time")
+	if statusInst := newPlainAdapter(false).Status(); statusInst.KeepCache || statusInst.CacheTime != nil {
+		t.Errorf("Unexpected status %+v", statusInst)
+	}
+
+	t.Log("Ping fails until the table exists")
+	if err := dynoInst.Ping(); !errors.Is(err, db.ErrBackendUnavailable) {
+		t.Errorf("Expected the missing table to be reported. Error: %v", err)
+	}
+
+	fake.tables[tableConst] = &dynamodb.CreateTableInput{}
+	if err := dynoInst.Ping(); err != nil {
+		t.Errorf("Expected the table to be reachable. Error: %v", err)
+	}
+}
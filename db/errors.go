@@ -0,0 +1,153 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The adapters report failures through the error types below. Each of them matches one of
+// these kinds with errors.Is, which is what the API layer uses to choose a status code.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrValidation         = errors.New("validation failed")
+	ErrInvalidObject      = errors.New("invalid object")
+	ErrBackendUnavailable = errors.New("backend unavailable")
+)
+
+type NotFoundError struct {
+	TableName string
+	Code      string
+}
+
+//----------------------------------------------------------------------------------------
+func (notFoundErr *NotFoundError) Error() string {
+	return fmt.Sprintf("object with key %s not found in table %s", notFoundErr.Code, notFoundErr.TableName)
+}
+
+//----------------------------------------------------------------------------------------
+func (notFoundErr *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// ConflictError is returned by PutObject when the object being written does not carry the
+// version currently held by the table, i.e. it has been updated or deleted by someone else
+// since it was read.
+type ConflictError struct {
+	TableName string
+	Code      string
+	Version   int64
+}
+
+//----------------------------------------------------------------------------------------
+func (conflictErr *ConflictError) Error() string {
+	return fmt.Sprintf("object with key %s in table %s has been modified since version %d was read", conflictErr.Code, conflictErr.TableName, conflictErr.Version)
+}
+
+//----------------------------------------------------------------------------------------
+func (conflictErr *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// ValidationError reports a request that can never succeed as sent, such as a malformed
+// document or an object missing the fields its key is made of.
+type ValidationError struct {
+	Message string
+	Err     error
+}
+
+//----------------------------------------------------------------------------------------
+func (validationErr *ValidationError) Error() string {
+	if validationErr.Err != nil {
+		return fmt.Sprintf("%s. Error: %v", validationErr.Message, validationErr.Err)
+	}
+
+	return validationErr.Message
+}
+
+//----------------------------------------------------------------------------------------
+func (validationErr *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+//----------------------------------------------------------------------------------------
+func (validationErr *ValidationError) Unwrap() error {
+	return validationErr.Err
+}
+
+// FieldError describes why the value of a single field of an object is not acceptable.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// InvalidObjectError is returned by Validate when an object is well formed but some of its
+// fields are not acceptable, e.g. a required field is empty or a foreign key points nowhere.
+type InvalidObjectError struct {
+	FieldErrors []FieldError
+}
+
+//----------------------------------------------------------------------------------------
+func (invalidErr *InvalidObjectError) Error() string {
+	messageList := make([]string, 0, len(invalidErr.FieldErrors))
+	for _, fieldErr := range invalidErr.FieldErrors {
+		messageList = append(messageList, fieldErr.Field+": "+fieldErr.Message)
+	}
+
+	return "invalid object. " + strings.Join(messageList, "; ")
+}
+
+//----------------------------------------------------------------------------------------
+func (invalidErr *InvalidObjectError) Is(target error) bool {
+	return target == ErrInvalidObject
+}
+
+// BackendError wraps a failed call to the database or the file storage. These failures are
+// usually transient, so the request may be retried.
+type BackendError struct {
+	Operation string
+	Resource  string
+	Err       error
+}
+
+//----------------------------------------------------------------------------------------
+func (backendErr *BackendError) Error() string {
+	return fmt.Sprintf("%s on %s failed. Error: %v", backendErr.Operation, backendErr.Resource, backendErr.Err)
+}
+
+//----------------------------------------------------------------------------------------
+func (backendErr *BackendError) Is(target error) bool {
+	return target == ErrBackendUnavailable
+}
+
+//----------------------------------------------------------------------------------------
+func (backendErr *BackendError) Unwrap() error {
+	return backendErr.Err
+}
+
+// BatchError is returned by PutObjectList and DeleteObjectList when some of the objects
+// could not be processed. Objects whose codes are not listed in FailedCodes were written
+// or deleted successfully.
+type BatchError struct {
+	TableName   string
+	Operation   string
+	FailedCodes []string
+	Err         error
+}
+
+//----------------------------------------------------------------------------------------
+func (batchErr *BatchError) Error() string {
+	message := fmt.Sprintf("%s on table %s failed for %d object(s): %s", batchErr.Operation, batchErr.TableName, len(batchErr.FailedCodes), strings.Join(batchErr.FailedCodes, ", "))
+
+	if batchErr.Err != nil {
+		message = fmt.Sprintf("%s. Last error: %v", message, batchErr.Err)
+	}
+
+	return message
+}
+
+//----------------------------------------------------------------------------------------
+func (batchErr *BatchError) Unwrap() error {
+	return batchErr.Err
+}
@@ -0,0 +1,64 @@
+package factory
+
+import (
+	"colmanback/db"
+	"colmanback/db/disk"
+	"colmanback/db/dyno"
+	"colmanback/db/memory"
+	"colmanback/db/s3"
+	"colmanback/db/sqlite"
+	"colmanback/objects"
+	"log"
+)
+
+type AdapterType string
+
+const (
+	DYNO   AdapterType = "dynamodb"
+	MEMORY AdapterType = "memory"
+	SQLITE AdapterType = "sqlite"
+)
+
+// Type selects the adapter implementation returned by NewAdapter and NewFileAdapter.
+// It must be set before the object packages call their InitConn.
+var Type AdapterType = DYNO
+
+//----------------------------------------------------------------------------------------
+func IsValid(adapterType AdapterType) bool {
+	switch adapterType {
+	case DYNO, MEMORY, SQLITE:
+		return true
+	}
+
+	return false
+}
+
+//----------------------------------------------------------------------------------------
+func NewAdapter[K objects.Object]() db.Adapter[K] {
+	switch Type {
+	case DYNO:
+		return &dyno.Dyno[K]{}
+	case MEMORY:
+		return &memory.Memory[K]{}
+	case SQLITE:
+		return &sqlite.Sqlite[K]{}
+	}
+
+	log.Fatalf("Unknown adapter type %s", Type)
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func NewFileAdapter() db.FileAdapter {
+	switch Type {
+	case DYNO:
+		return &s3.S3Adapter{}
+	case SQLITE:
+		return &disk.DiskAdapter{}
+	case MEMORY:
+		return &memory.FileAdapter{}
+	}
+
+	log.Fatalf("Unknown adapter type %s", Type)
+	return nil
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"colmanback/objects"
+)
+
+//----------------------------------------------------------------------------------------
+// DistinctCodes returns the non-empty codes of codeList, each of them once, in the order
+// they first appear.
+func DistinctCodes(codeList []string) []string {
+	distinctList := []string{}
+	seenMap := make(map[string]bool)
+
+	for _, code := range codeList {
+		if code != "" && !seenMap[code] {
+			seenMap[code] = true
+			distinctList = append(distinctList, code)
+		}
+	}
+
+	return distinctList
+}
+
+//----------------------------------------------------------------------------------------
+// AttachRef returns the object with code from refMap, which holds the objects of tableName
+// fetched in one go for a whole list. If it is missing, a reference to it is added to
+// brokenRefList instead, as ResolveRef does. A nil refMap means that the details of field
+// were not asked for, so nothing is attached.
+func AttachRef[K objects.Object](brokenRefList *[]Reference, refMap map[string]K, tableName string, field string, code string) K {
+	var refInst K
+
+	if code == "" || refMap == nil {
+		return refInst
+	}
+
+	refInst, isFound := refMap[code]
+	if !isFound {
+		*brokenRefList = append(*brokenRefList, Reference{TableName: tableName, Field: field, Code: code})
+	}
+
+	return refInst
+}
+
+//----------------------------------------------------------------------------------------
+// IsExpanded reports whether field is in fieldList, the details to be attached to objects.
+func IsExpanded(fieldList []string, field string) bool {
+	for _, expandedField := range fieldList {
+		if expandedField == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+//----------------------------------------------------------------------------------------
+// FetchRefMap returns the objects referenced by field in the objects of objectList, keyed by
+// code. codeOf returns the code held by field and getMap fetches the objects for all the
+// distinct codes at once, usually with Adapter.GetObjectMapByCodes. If field is not in
+// fieldList, nothing is fetched and nil is returned.
+func FetchRefMap[K objects.Object, R objects.Object](objectList []K, fieldList []string, field string, codeOf func(K) string, getMap func([]string) (map[string]R, error)) (map[string]R, error) {
+	if !IsExpanded(fieldList, field) {
+		return nil, nil
+	}
+
+	codeList := make([]string, 0, len(objectList))
+	for _, objectInst := range objectList {
+		codeList = append(codeList, codeOf(objectInst))
+	}
+
+	return getMap(DistinctCodes(codeList))
+}
+
+//----------------------------------------------------------------------------------------
+// ExpandRefMap replaces the objects of refMap by the ones returned by expand, so that the
+// referenced objects get their own details attached in one go as well.
+func ExpandRefMap[R objects.Object](refMap map[string]R, expand func([]R) ([]R, error)) (map[string]R, error) {
+	if refMap == nil {
+		return nil, nil
+	}
+
+	codeList := make([]string, 0, len(refMap))
+	refList := make([]R, 0, len(refMap))
+	for code, refInst := range refMap {
+		codeList = append(codeList, code)
+		refList = append(refList, refInst)
+	}
+
+	expandedList, err := expand(refList)
+	if err != nil {
+		return nil, err
+	}
+
+	expandedMap := make(map[string]R, len(expandedList))
+	for index, refInst := range expandedList {
+		expandedMap[codeList[index]] = refInst
+	}
+
+	return expandedMap, nil
+}
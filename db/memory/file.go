@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"colmanback/db"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+	"sync"
+)
+
+type FileAdapter struct {
+	lock          sync.RWMutex
+	files         map[string][]byte
+	bucketName    string
+	maxGetEntries int
+}
+
+//----------------------------------------------------------------------------------------
+func (fileAdapter *FileAdapter) Config(bucketName string, maxGetEntries int) {
+	fileAdapter.bucketName = bucketName
+	fileAdapter.maxGetEntries = maxGetEntries
+	fileAdapter.files = make(map[string][]byte)
+}
+
+//----------------------------------------------------------------------------------------
+func (fileAdapter *FileAdapter) AddFile(fileName string, file multipart.File) (db.FileResponse, error) {
+	var response db.FileResponse
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return response, &db.ValidationError{Message: fmt.Sprintf("cannot read file %s for bucket %s", fileName, fileAdapter.bucketName), Err: err}
+	}
+
+	fileAdapter.lock.Lock()
+	fileAdapter.files[fileName] = content
+	fileAdapter.lock.Unlock()
+
+	response.FileLocation = "memory://" + fileAdapter.bucketName + "/" + fileName
+
+	return response, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (fileAdapter *FileAdapter) GetFile(fileName string) ([]byte, bool) {
+	fileAdapter.lock.RLock()
+	defer fileAdapter.lock.RUnlock()
+
+	content, hasFile := fileAdapter.files[fileName]
+
+	return content, hasFile
+}
+
+//----------------------------------------------------------------------------------------
+func (fileAdapter *FileAdapter) DeleteFiles(fileNameArr []string) error {
+	fileAdapter.lock.Lock()
+	defer fileAdapter.lock.Unlock()
+
+	for _, fileName := range fileNameArr {
+		delete(fileAdapter.files, strings.Trim(fileName, " "))
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (fileAdapter *FileAdapter) DeleteFile(fileName string) error {
+	fileNameArr := []string{fileName}
+
+	return fileAdapter.DeleteFiles(fileNameArr)
+}
+
+//----------------------------------------------------------------------------------------
+// Ping always succeeds, as the files are held in memory.
+func (fileAdapter *FileAdapter) Ping() error {
+	return nil
+}
@@ -0,0 +1,558 @@
+package memory
+
+import (
+	"colmanback/db"
+	"colmanback/objects"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A table maps each code to its items, keyed by sort value. Tables without a sort name
+// keep a single item per code under the empty sort value.
+type table struct {
+	lock  sync.RWMutex
+	items map[string]map[string][]byte
+}
+
+var tableLock sync.Mutex
+var tableMap map[string]*table = make(map[string]*table)
+
+type Memory[K objects.Object] struct {
+	tableName   string
+	codeName    string
+	sortName    string
+	sortGSIName string
+	keepCache   bool
+	constructor func() K
+	cacheMap    func([]K) []db.CacheMapElement
+
+	table     *table
+	cacheLock sync.RWMutex
+	cache     map[string]K
+	cacheTime time.Time
+}
+
+//----------------------------------------------------------------------------------------
+func getTable(tableName string) *table {
+	tableLock.Lock()
+	defer tableLock.Unlock()
+
+	tableInst, hasTable := tableMap[tableName]
+	if !hasTable {
+		tableInst = &table{items: make(map[string]map[string][]byte)}
+		tableMap[tableName] = tableInst
+	}
+
+	return tableInst
+}
+
+//----------------------------------------------------------------------------------------
+func Reset() {
+	tableLock.Lock()
+	defer tableLock.Unlock()
+
+	tableMap = make(map[string]*table)
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) isMainItem(codeValue string, sortValue string) bool {
+	return memoryInst.sortName == "" || codeValue == sortValue
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) mainSortValue(codeValue string) string {
+	if memoryInst.sortName == "" {
+		return ""
+	}
+
+	return codeValue
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) unmarshal(item []byte) (K, error) {
+	objectInst := memoryInst.constructor()
+
+	err := json.Unmarshal(item, objectInst)
+	if err != nil {
+		return objectInst, fmt.Errorf("cannot unmarshall. Err: %s", err)
+	}
+
+	return objectInst, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) getObjectListFromTable() ([]K, error) {
+	var objectList []K
+
+	memoryInst.table.lock.RLock()
+	defer memoryInst.table.lock.RUnlock()
+
+	codeList := make([]string, 0, len(memoryInst.table.items))
+	for codeValue := range memoryInst.table.items {
+		codeList = append(codeList, codeValue)
+	}
+	sort.Strings(codeList)
+
+	for _, codeValue := range codeList {
+		for sortValue, item := range memoryInst.table.items[codeValue] {
+			if !memoryInst.isMainItem(codeValue, sortValue) {
+				continue
+			}
+
+			objectInst, err := memoryInst.unmarshal(item)
+			if err != nil {
+				return objectList, err
+			}
+
+			objectList = append(objectList, objectInst)
+		}
+	}
+
+	return objectList, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) initCache() error {
+	cache := make(map[string]K)
+	cacheList, err := memoryInst.getObjectListFromTable()
+
+	if err != nil {
+		return fmt.Errorf("object cache for %s cannot be initialised. Error: %w", memoryInst.tableName, err)
+	}
+
+	for _, objectInst := range cacheList {
+		cache[objectInst.CodeValue()] = objectInst
+	}
+
+	memoryInst.cacheLock.Lock()
+	memoryInst.cache = cache
+	memoryInst.cacheTime = time.Now()
+	memoryInst.cacheLock.Unlock()
+
+	if memoryInst.cacheMap != nil {
+		db.LoadCacheMap(memoryInst.tableName, memoryInst.cacheMap(cacheList))
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) Config(tableName string, codeName string, keepCache bool, constructor func() K, getCacheMap func([]K) []db.CacheMapElement) error {
+	memoryInst.tableName = tableName
+	memoryInst.codeName = codeName
+	memoryInst.keepCache = keepCache
+	memoryInst.constructor = constructor
+	memoryInst.cacheMap = getCacheMap
+	memoryInst.cache = make(map[string]K)
+	memoryInst.table = getTable(tableName)
+
+	if keepCache {
+		return memoryInst.initCache()
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) SetSortName(sortName string) {
+	if memoryInst.keepCache {
+		log.Fatalf("A sort name for adapter %s cannot be set as this adapter has been already configured to keep a cache. Set the sort name before calling Config.", memoryInst.tableName)
+	} else {
+		memoryInst.sortName = sortName
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) SetSortGSIName(sortGSIName string) {
+	memoryInst.sortGSIName = sortGSIName
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) DeleteObjectByCodeAndSort(codeValue string, sortValue string) error {
+	memoryInst.table.lock.Lock()
+	defer memoryInst.table.lock.Unlock()
+
+	itemMap, hasCode := memoryInst.table.items[codeValue]
+	if !hasCode {
+		return nil
+	}
+
+	if memoryInst.sortName == "" || sortValue == "" {
+		delete(memoryInst.table.items, codeValue)
+	} else {
+		delete(itemMap, sortValue)
+		if len(itemMap) == 0 {
+			delete(memoryInst.table.items, codeValue)
+		}
+	}
+
+	memoryInst.evict(codeValue)
+
+	if sortValue == "" || memoryInst.isMainItem(codeValue, sortValue) {
+		memoryInst.unindexObject(codeValue)
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) DeleteObjectByCode(codeValue string) error {
+	return memoryInst.DeleteObjectByCodeAndSort(codeValue, codeValue)
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) GetSortKeyList(codeValue string) ([]string, error) {
+	keyList := []string{}
+
+	if memoryInst.sortName == "" {
+		return keyList, fmt.Errorf("adapter for %s does not have a sort name set", memoryInst.tableName)
+	}
+
+	memoryInst.table.lock.RLock()
+	defer memoryInst.table.lock.RUnlock()
+
+	for sortValue := range memoryInst.table.items[codeValue] {
+		if sortValue != codeValue {
+			keyList = append(keyList, sortValue)
+		}
+	}
+	sort.Strings(keyList)
+
+	return keyList, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) DeleteObject(objectInst K) error {
+	var err error
+
+	if memoryInst.sortName == "" {
+		err = memoryInst.DeleteObjectByCode(objectInst.CodeValue())
+	} else {
+		err = memoryInst.DeleteObjectByCodeAndSort(objectInst.CodeValue(), objectInst.SortValue())
+	}
+
+	return err
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) GetObjectList() ([]K, error) {
+	if !memoryInst.keepCache {
+		return memoryInst.getObjectListFromTable()
+	}
+
+	memoryInst.cacheLock.RLock()
+	defer memoryInst.cacheLock.RUnlock()
+
+	codeList := make([]string, 0, len(memoryInst.cache))
+	for codeValue := range memoryInst.cache {
+		codeList = append(codeList, codeValue)
+	}
+	sort.Strings(codeList)
+
+	objectList := []K{}
+	for _, codeValue := range codeList {
+		objectList = append(objectList, memoryInst.cache[codeValue])
+	}
+
+	return objectList, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) GetObjectListBySort(sortValue string) ([]K, error) {
+	var codeList []string
+	var returnObjectList []K
+
+	if memoryInst.sortName == "" || memoryInst.sortGSIName == "" {
+		return nil, fmt.Errorf("adapter does not have a configured sortName / sortGSIName %v", memoryInst)
+	}
+
+	memoryInst.table.lock.RLock()
+	for codeValue, itemMap := range memoryInst.table.items {
+		if _, hasSort := itemMap[sortValue]; hasSort {
+			codeList = append(codeList, codeValue)
+		}
+	}
+	memoryInst.table.lock.RUnlock()
+
+	sort.Strings(codeList)
+
+	// Turn index entries into actual objects.
+	for _, codeValue := range codeList {
+		returnObjectInst, instErr := memoryInst.GetObjectByCode(codeValue)
+		if instErr == nil {
+			returnObjectList = append(returnObjectList, returnObjectInst)
+		} else {
+			log.Printf("An object instance could not be retrieved for code %s. Error %v", codeValue, instErr)
+		}
+	}
+
+	return returnObjectList, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) GetObjectListJSON() ([]byte, error) {
+	objectList, errList := memoryInst.GetObjectList()
+	if errList != nil {
+		return nil, errList
+	}
+
+	out, err := json.MarshalIndent(objectList, db.JSON_PREFIX, db.JSON_INDENT)
+	if err != nil {
+		return nil, fmt.Errorf("got error when trying to return object list from table %s as API response. Error: %s", memoryInst.tableName, err)
+	}
+
+	return out, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) GetObjectByCodeJSON(codeValue string) ([]byte, error) {
+	objectInst, getErr := memoryInst.GetObjectByCode(codeValue)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	out, err := json.MarshalIndent(objectInst, db.JSON_PREFIX, db.JSON_INDENT)
+	if err != nil {
+		return nil, fmt.Errorf("got error when trying to return object from table %s as API response. Error: %s", memoryInst.tableName, err)
+	}
+
+	return out, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) GetObjectByCode(codeValue string) (K, error) {
+	if memoryInst.keepCache {
+		memoryInst.cacheLock.RLock()
+		objectInst, isCached := memoryInst.cache[codeValue]
+		memoryInst.cacheLock.RUnlock()
+
+		if isCached {
+			return objectInst, nil
+		}
+	}
+
+	memoryInst.table.lock.RLock()
+	item, isFound := memoryInst.table.items[codeValue][memoryInst.mainSortValue(codeValue)]
+	memoryInst.table.lock.RUnlock()
+
+	if !isFound {
+		return memoryInst.constructor(), &db.NotFoundError{TableName: memoryInst.tableName, Code: codeValue}
+	}
+
+	objectInst, err := memoryInst.unmarshal(item)
+	if err == nil && memoryInst.keepCache {
+		memoryInst.cacheLock.Lock()
+		memoryInst.cache[codeValue] = objectInst
+		memoryInst.cacheLock.Unlock()
+	}
+
+	return objectInst, err
+}
+
+//----------------------------------------------------------------------------------------
+// GetObjectMapByCodes returns the objects with the codes of codeList, keyed by code. Codes
+// that are not found are left out.
+func (memoryInst *Memory[K]) GetObjectMapByCodes(codeList []string) (map[string]K, error) {
+	var missingList []string
+	objectMap := make(map[string]K)
+
+	memoryInst.cacheLock.RLock()
+	for _, codeValue := range db.DistinctCodes(codeList) {
+		if objectInst, isCached := memoryInst.cache[codeValue]; isCached && memoryInst.keepCache {
+			objectMap[codeValue] = objectInst
+		} else {
+			missingList = append(missingList, codeValue)
+		}
+	}
+	memoryInst.cacheLock.RUnlock()
+
+	itemMap := make(map[string][]byte)
+
+	memoryInst.table.lock.RLock()
+	for _, codeValue := range missingList {
+		if item, isFound := memoryInst.table.items[codeValue][memoryInst.mainSortValue(codeValue)]; isFound {
+			itemMap[codeValue] = item
+		}
+	}
+	memoryInst.table.lock.RUnlock()
+
+	for codeValue, item := range itemMap {
+		objectInst, err := memoryInst.unmarshal(item)
+		if err != nil {
+			return nil, err
+		}
+
+		objectMap[codeValue] = objectInst
+		if memoryInst.keepCache {
+			memoryInst.cacheLock.Lock()
+			memoryInst.cache[codeValue] = objectInst
+			memoryInst.cacheLock.Unlock()
+		}
+	}
+
+	return objectMap, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) putObject(objectInst K, checkVersion bool) error {
+	var sortValue string
+
+	codeValue := objectInst.CodeValue()
+	expectedVersion := objectInst.VersionValue()
+	isMainItem := memoryInst.isMainItem(codeValue, objectInst.SortValue())
+
+	if memoryInst.sortName != "" {
+		sortValue = objectInst.SortValue()
+	}
+
+	memoryInst.table.lock.Lock()
+	defer memoryInst.table.lock.Unlock()
+
+	if checkVersion && isMainItem {
+		var storedVersion int64
+
+		if item, isFound := memoryInst.table.items[codeValue][sortValue]; isFound {
+			storedInst, err := memoryInst.unmarshal(item)
+			if err != nil {
+				return err
+			}
+			storedVersion = storedInst.VersionValue()
+		}
+
+		if storedVersion != expectedVersion {
+			memoryInst.evict(codeValue)
+			return &db.ConflictError{TableName: memoryInst.tableName, Code: codeValue, Version: expectedVersion}
+		}
+
+		objectInst.SetVersion(expectedVersion + 1)
+	}
+
+	objectMarshalled, err := json.Marshal(objectInst)
+	if err != nil {
+		objectInst.SetVersion(expectedVersion)
+		return fmt.Errorf("got error marshalling object with key = %s. Error: %s", codeValue, err)
+	}
+
+	itemMap, hasCode := memoryInst.table.items[codeValue]
+	if !hasCode {
+		itemMap = make(map[string][]byte)
+		memoryInst.table.items[codeValue] = itemMap
+	}
+	itemMap[sortValue] = objectMarshalled
+
+	if memoryInst.keepCache && isMainItem {
+		memoryInst.cacheLock.Lock()
+		memoryInst.cache[codeValue] = objectInst
+		memoryInst.cacheLock.Unlock()
+
+		memoryInst.indexObject(objectInst)
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) evict(codeValue string) {
+	if memoryInst.keepCache {
+		memoryInst.cacheLock.Lock()
+		delete(memoryInst.cache, codeValue)
+		memoryInst.cacheLock.Unlock()
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// indexObject and unindexObject keep the search cache map in line with the writes made through
+// the adapter. The map is only built for adapters that keep a cache.
+func (memoryInst *Memory[K]) indexObject(objectInst K) {
+	if memoryInst.keepCache && memoryInst.cacheMap != nil {
+		db.UpdateCacheMap(memoryInst.tableName, objectInst.CodeValue(), memoryInst.cacheMap([]K{objectInst}))
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) unindexObject(codeValue string) {
+	if memoryInst.keepCache && memoryInst.cacheMap != nil {
+		db.RemoveFromCacheMap(memoryInst.tableName, codeValue)
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) PutObject(objectInst K) error {
+	return memoryInst.putObject(objectInst, true)
+}
+
+//----------------------------------------------------------------------------------------
+// PutObjectList writes the objects as given, without checking their versions, in the same
+// way as a DynamoDB batch write.
+func (memoryInst *Memory[K]) PutObjectList(objectList []K) error {
+	var failedCodes []string
+	var lastErr error
+
+	for _, objectInst := range objectList {
+		err := memoryInst.putObject(objectInst, false)
+		if err != nil {
+			failedCodes = append(failedCodes, objectInst.CodeValue())
+			lastErr = err
+		}
+	}
+
+	if len(failedCodes) > 0 {
+		return &db.BatchError{TableName: memoryInst.tableName, Operation: "put", FailedCodes: failedCodes, Err: lastErr}
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) DeleteObjectList(objectList []K) error {
+	var failedCodes []string
+	var lastErr error
+
+	for _, objectInst := range objectList {
+		err := memoryInst.DeleteObject(objectInst)
+		if err != nil {
+			failedCodes = append(failedCodes, objectInst.CodeValue())
+			lastErr = err
+		}
+	}
+
+	if len(failedCodes) > 0 {
+		return &db.BatchError{TableName: memoryInst.tableName, Operation: "delete", FailedCodes: failedCodes, Err: lastErr}
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (memoryInst *Memory[K]) ResetCache() error {
+	if !memoryInst.keepCache {
+		return nil
+	}
+
+	return memoryInst.initCache()
+}
+
+//----------------------------------------------------------------------------------------
+// Status reports the size of the cache of the adapter and the time it was last loaded.
+func (memoryInst *Memory[K]) Status() db.AdapterStatus {
+	memoryInst.cacheLock.RLock()
+	defer memoryInst.cacheLock.RUnlock()
+
+	statusInst := db.AdapterStatus{TableName: memoryInst.tableName, KeepCache: memoryInst.keepCache, CacheSize: len(memoryInst.cache)}
+	if memoryInst.keepCache && !memoryInst.cacheTime.IsZero() {
+		cacheTime := memoryInst.cacheTime
+		statusInst.CacheTime = &cacheTime
+	}
+
+	return statusInst
+}
+
+//----------------------------------------------------------------------------------------
+// Ping always succeeds, as the tables are held in memory.
+func (memoryInst *Memory[K]) Ping() error {
+	return nil
+}
@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"colmanback/db"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+)
+
+const (
+	tableConst    = "memorytest"
+	codeNameConst = "code"
+	sortNameConst = "picture"
+	gsiNameConst  = "picture-code-index"
+	itemCount     = 25
+)
+
+type testObject struct {
+	Code    string `json:"code"`
+	Picture string `json:"picture,omitempty"`
+	Name    string `json:"name"`
+	Version int64  `json:"version"`
+}
+
+func (objectInst *testObject) CodeValue() string {
+	return objectInst.Code
+}
+
+func (objectInst *testObject) SortValue() string {
+	if len(objectInst.Picture) > 0 {
+		return objectInst.Picture
+	}
+
+	return objectInst.Code
+}
+
+func (objectInst *testObject) VersionValue() int64 {
+	return objectInst.Version
+}
+
+func (objectInst *testObject) SetVersion(version int64) {
+	objectInst.Version = version
+}
+
+func (objectInst *testObject) ToString() string {
+	return fmt.Sprintf("{code: %s, picture: %s, name: %s}", objectInst.Code, objectInst.Picture, objectInst.Name)
+}
+
+func (objectInst *testObject) FromJson(jsonInst []byte) error { return nil }
+func (objectInst *testObject) Print()                         {}
+func (objectInst *testObject) Put() error                     { return nil }
+func (objectInst *testObject) Delete() error                  { return nil }
+
+func (objectInst *testObject) WriteObject(writer http.ResponseWriter, request *http.Request) {}
+
+func testObjectFactory() *testObject {
+	return &testObject{}
+}
+
+func newPlainAdapter(keepCache bool) *Memory[*testObject] {
+	memoryInst := &Memory[*testObject]{}
+	memoryInst.Config(tableConst, codeNameConst, keepCache, testObjectFactory, nil)
+
+	return memoryInst
+}
+
+func newSortAdapter(keepCache bool) *Memory[*testObject] {
+	memoryInst := &Memory[*testObject]{}
+	memoryInst.SetSortName(sortNameConst)
+	memoryInst.SetSortGSIName(gsiNameConst)
+	memoryInst.Config(tableConst, codeNameConst, keepCache, testObjectFactory, nil)
+
+	return memoryInst
+}
+
+func newObjectList(count int) []*testObject {
+	var objectList []*testObject
+
+	for index := 0; index < count; index++ {
+		objectList = append(objectList, &testObject{Code: "code" + strconv.Itoa(index), Name: "name" + strconv.Itoa(index)})
+	}
+
+	return objectList
+}
+
+func TestSortValues(t *testing.T) {
+	Reset()
+	memoryInst := newSortAdapter(true)
+
+	for _, objectInst := range []*testObject{{Code: "model1", Name: "model one"}, {Code: "model1", Picture: "pic1.png"}, {Code: "model1", Picture: "pic2.png"}, {Code: "model2", Name: "model two"}, {Code: "model2", Picture: "pic1.png"}} {
+		if err := memoryInst.PutObject(objectInst); err != nil {
+			t.Fatalf("Cannot put %s. Error: %v", objectInst.ToString(), err)
+		}
+	}
+
+	t.Log("Pictures are not listed as objects")
+	objectList, err := memoryInst.GetObjectList()
+	if err != nil || len(objectList) != 2 || objectList[0].Code != "model1" || objectList[1].Code != "model2" {
+		t.Errorf("Expected model1 and model2, got %v. Error: %v", objectList, err)
+	}
+
+	t.Log("The objects are found by their sort values and the other way round")
+	objectList, err = memoryInst.GetObjectListBySort("pic1.png")
+	if err != nil || len(objectList) != 2 || objectList[0].Name != "model one" || objectList[1].Name != "model two" {
+		t.Errorf("Expected both models for pic1.png, got %v. Error: %v", objectList, err)
+	}
+
+	pictureList, err := memoryInst.GetSortKeyList("model1")
+	if err != nil || fmt.Sprint(pictureList) != "[pic1.png pic2.png]" {
+		t.Errorf("Expected the pictures of model1, got %v. Error: %v", pictureList, err)
+	}
+
+	t.Log("Deleting a picture leaves the object and its other pictures")
+	if err = memoryInst.DeleteObjectByCodeAndSort("model1", "pic1.png"); err != nil {
+		t.Errorf("Cannot delete pic1.png of model1. Error: %v", err)
+	}
+	if pictureList, err = memoryInst.GetSortKeyList("model1"); err != nil || fmt.Sprint(pictureList) != "[pic2.png]" {
+		t.Errorf("Expected pic2.png to be left, got %v. Error: %v", pictureList, err)
+	}
+	if objectInst, err := memoryInst.GetObjectByCode("model1"); err != nil || objectInst.Name != "model one" {
+		t.Errorf("Expected model1 to be kept, got %v. Error: %v", objectInst, err)
+	}
+
+	t.Log("Adapters configured on the same table share its rows")
+	if objectList, err = newSortAdapter(false).GetObjectList(); err != nil || len(objectList) != 2 {
+		t.Errorf("Expected the 2 models to be shared, got %v. Error: %v", objectList, err)
+	}
+}
+
+func TestVersionConflict(t *testing.T) {
+	var conflictErr *db.ConflictError
+
+	for _, keepCache := range []bool{true, false} {
+		t.Logf("Writes are checked against the stored version, keepCache %t", keepCache)
+		Reset()
+		memoryInst := newPlainAdapter(keepCache)
+
+		firstInst := &testObject{Code: "code1", Name: "first"}
+		if err := memoryInst.PutObject(firstInst); err != nil || firstInst.Version != 1 {
+			t.Fatalf("Expected the new object to get version 1, got %d. Error: %v", firstInst.Version, err)
+		}
+
+		staleInst := &testObject{Code: "code1", Name: "stale"}
+		err := memoryInst.PutObject(staleInst)
+		if !errors.As(err, &conflictErr) || !errors.Is(err, db.ErrConflict) || conflictErr.Code != "code1" {
+			t.Errorf("Expected a conflict for version 0 of code1, got %v", err)
+		}
+		if staleInst.Version != 0 {
+			t.Errorf("Expected the version of the rejected object to be left at 0, got %d", staleInst.Version)
+		}
+
+		storedInst, err := memoryInst.GetObjectByCode("code1")
+		if err != nil || storedInst.Name != "first" || storedInst.Version != 1 {
+			t.Errorf("Expected the first write to be kept, got %v. Error: %v", storedInst, err)
+		}
+
+		updateInst := &testObject{Code: "code1", Name: "second", Version: 1}
+		if err = memoryInst.PutObject(updateInst); err != nil || updateInst.Version != 2 {
+			t.Errorf("Expected the update to get version 2, got %d. Error: %v", updateInst.Version, err)
+		}
+
+		t.Log("Lists are written as given, without checking the versions")
+		if err = memoryInst.PutObjectList([]*testObject{{Code: "code1", Name: "restored", Version: 7}}); err != nil {
+			t.Errorf("Cannot put the list. Error: %v", err)
+		}
+		if storedInst, err = memoryInst.GetObjectByCode("code1"); err != nil || storedInst.Version != 7 {
+			t.Errorf("Expected version 7 to be written as given, got %v. Error: %v", storedInst, err)
+		}
+	}
+}
+
+func TestGetObjectMapByCodes(t *testing.T) {
+	Reset()
+	memoryInst := newPlainAdapter(false)
+	if err := memoryInst.PutObjectList(newObjectList(itemCount)); err != nil {
+		t.Fatalf("Cannot put the objects. Error: %v", err)
+	}
+
+	t.Log("Duplicates and missing codes are left out")
+	objectMap, err := memoryInst.GetObjectMapByCodes([]string{"code1", "missing", "code2", "code1"})
+	if err != nil || len(objectMap) != 2 || objectMap["code1"].Name != "name1" || objectMap["code2"].Name != "name2" {
+		t.Errorf("Expected code1 and code2, got %v. Error: %v", objectMap, err)
+	}
+
+	t.Log("A missing object is reported as not found, along with an empty object")
+	objectInst, err := memoryInst.GetObjectByCode("missing")
+	if !errors.Is(err, db.ErrNotFound) || objectInst == nil || objectInst.Code != "" {
+		t.Errorf("Expected an empty object and a not found error, got %v. Error: %v", objectInst, err)
+	}
+
+	t.Log("Deleted objects are no longer found")
+	if err = memoryInst.DeleteObjectList(newObjectList(itemCount)[:10]); err != nil {
+		t.Errorf("Cannot delete the list. Error: %v", err)
+	}
+	if objectList, err := memoryInst.GetObjectList(); err != nil || len(objectList) != itemCount-10 {
+		t.Errorf("Expected %d objects to be left, got %d. Error: %v", itemCount-10, len(objectList), err)
+	}
+}
+
+func TestFileAdapter(t *testing.T) {
+	var fileAdapter FileAdapter
+
+	fileAdapter.Config("bucket", 10)
+
+	file, err := os.CreateTemp(t.TempDir(), "picture")
+	if err != nil {
+		t.Fatalf("Cannot create the file. Error: %v", err)
+	}
+	defer file.Close()
+	file.WriteString("content")
+	file.Seek(0, 0)
+
+	t.Log("Files are kept until they are deleted")
+	response, err := fileAdapter.AddFile("picture.png", file)
+	if err != nil || response.FileLocation != "memory://bucket/picture.png" {
+		t.Errorf("Unexpected location %s. Error: %v", response.FileLocation, err)
+	}
+
+	if content, hasFile := fileAdapter.GetFile("picture.png"); !hasFile || string(content) != "content" {
+		t.Errorf("Expected the content of picture.png, got %q", content)
+	}
+
+	fileAdapter.DeleteFile(" picture.png ")
+	if _, hasFile := fileAdapter.GetFile("picture.png"); hasFile {
+		t.Errorf("Expected picture.png to be deleted")
+	}
+}
@@ -0,0 +1,303 @@
+package db
+
+import (
+	"colmanback/objects"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Reference identifies an object holding the code of another object in one of its fields.
+type Reference struct {
+	TableName string `json:"table"`
+	Field     string `json:"field"`
+	Code      string `json:"code"`
+}
+
+// Referrer describes a field of the objects of TableName that holds codes of another table.
+// It is registered against that other table with RegisterReferrer, so that objects cannot be
+// deleted from it while they are still referenced.
+type Referrer struct {
+	TableName string
+	Field     string
+
+	// FindCodes returns the codes of the objects whose field holds code.
+	FindCodes func(code string) ([]string, error)
+	// Reassign makes the field of the object with referrerCode hold newCode instead.
+	Reassign func(referrerCode string, newCode string) error
+	// Delete deletes the object with referrerCode.
+	Delete func(referrerCode string) error
+	// OwnerOf, when set, returns the collection the object with referrerCode belongs to. It is
+	// left unset for the tables shared by every caller.
+	OwnerOf func(referrerCode string) (string, error)
+	// Refresh, when set, updates what the object with referrerCode derives from the object it
+	// references, such as a search index, after that object has been stored again.
+	Refresh func(referrerCode string) error
+}
+
+// DeleteOptions tells DeleteReferenced what to do with the objects referencing the one being
+// deleted. By default, the delete is refused while there are any. Owner is the collection of
+// the caller: the objects of other collections are never deleted or reassigned.
+type DeleteOptions struct {
+	Cascade    bool
+	ReassignTo string
+	Owner      string
+}
+
+// ReferencedError is returned by DeleteReferenced when the object to be deleted is still
+// referenced by other objects and no cascade or reassignment has been asked for, or when some
+// of them belong to other collections. Those are only counted in OtherReferences, so that the
+// codes of other collections are not disclosed.
+type ReferencedError struct {
+	TableName       string
+	Code            string
+	References      []Reference
+	OtherReferences int
+}
+
+// referrerCodes holds the codes of the objects of a referrer that reference an object.
+type referrerCodes struct {
+	referrer Referrer
+	codeList []string
+}
+
+//----------------------------------------------------------------------------------------
+func (referencedErr *ReferencedError) Error() string {
+	if referencedErr.OtherReferences > 0 {
+		return fmt.Sprintf("object with key %s in table %s is still referenced by %d object(s), %d of them in other collections", referencedErr.Code, referencedErr.TableName,
+			len(referencedErr.References)+referencedErr.OtherReferences, referencedErr.OtherReferences)
+	}
+
+	return fmt.Sprintf("object with key %s in table %s is still referenced by %d object(s)", referencedErr.Code, referencedErr.TableName, len(referencedErr.References))
+}
+
+//----------------------------------------------------------------------------------------
+func (referencedErr *ReferencedError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+var referrerMap = make(map[string]map[string]Referrer)
+var referrerLock sync.RWMutex
+
+//----------------------------------------------------------------------------------------
+// RegisterReferrer declares that referrer holds codes of tableName. Registering the same
+// table and field again replaces the previous registration.
+func RegisterReferrer(tableName string, referrer Referrer) {
+	referrerLock.Lock()
+	defer referrerLock.Unlock()
+
+	if _, isFound := referrerMap[tableName]; !isFound {
+		referrerMap[tableName] = make(map[string]Referrer)
+	}
+
+	referrerMap[tableName][referrer.TableName+"."+referrer.Field] = referrer
+}
+
+//----------------------------------------------------------------------------------------
+func referrerList(tableName string) []Referrer {
+	referrerLock.RLock()
+	defer referrerLock.RUnlock()
+
+	list := make([]Referrer, 0, len(referrerMap[tableName]))
+	for _, referrer := range referrerMap[tableName] {
+		list = append(list, referrer)
+	}
+
+	return list
+}
+
+//----------------------------------------------------------------------------------------
+// findReferrerCodes returns the objects of the collection of owner, or of a shared table, that
+// reference the object with code in tableName, along with the number of those of other
+// collections.
+func findReferrerCodes(tableName string, code string, owner string) ([]referrerCodes, int, error) {
+	var foundList []referrerCodes
+	otherCount := 0
+
+	for _, referrer := range referrerList(tableName) {
+		codeList, err := referrer.FindCodes(code)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		ownCodeList := []string{}
+		for _, referrerCode := range codeList {
+			if referrer.OwnerOf != nil {
+				referrerOwner, err := referrer.OwnerOf(referrerCode)
+				if err != nil {
+					return nil, 0, err
+				}
+
+				if referrerOwner != owner {
+					otherCount++
+					continue
+				}
+			}
+
+			ownCodeList = append(ownCodeList, referrerCode)
+		}
+
+		if len(ownCodeList) > 0 {
+			foundList = append(foundList, referrerCodes{referrer: referrer, codeList: ownCodeList})
+		}
+	}
+
+	return foundList, otherCount, nil
+}
+
+//----------------------------------------------------------------------------------------
+func newReferencedError(tableName string, code string, foundList []referrerCodes, otherCount int) *ReferencedError {
+	referenceList := []Reference{}
+
+	for _, found := range foundList {
+		for _, referrerCode := range found.codeList {
+			referenceList = append(referenceList, Reference{TableName: found.referrer.TableName, Field: found.referrer.Field, Code: referrerCode})
+		}
+	}
+
+	return &ReferencedError{TableName: tableName, Code: code, References: referenceList, OtherReferences: otherCount}
+}
+
+//----------------------------------------------------------------------------------------
+// checkCascade returns a *ReferencedError if a cascading delete of the object with code in
+// tableName would reach objects of other collections than that of owner, at any level.
+func checkCascade(tableName string, code string, owner string) error {
+	foundList, otherCount, err := findReferrerCodes(tableName, code, owner)
+	if err != nil {
+		return err
+	}
+
+	if otherCount > 0 {
+		return newReferencedError(tableName, code, foundList, otherCount)
+	}
+
+	for _, found := range foundList {
+		for _, referrerCode := range found.codeList {
+			err = checkCascade(found.referrer.TableName, referrerCode, owner)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+// DeleteReferenced deletes the object with code in tableName with deleteFn once nothing
+// references it any more. With Cascade, the referencing objects are deleted first, along with
+// whatever references them in turn. With ReassignTo, they are made to reference that code
+// instead. Otherwise, or if objects of other collections than that of options.Owner would be
+// changed, a *ReferencedError listing them is returned. Objects processed before a failure
+// stay deleted or reassigned.
+func DeleteReferenced(tableName string, code string, options DeleteOptions, deleteFn func(string) error) error {
+	if options.Cascade {
+		err := checkCascade(tableName, code, options.Owner)
+		if err != nil {
+			return err
+		}
+	}
+
+	return deleteReferenced(tableName, code, options, deleteFn)
+}
+
+//----------------------------------------------------------------------------------------
+func deleteReferenced(tableName string, code string, options DeleteOptions, deleteFn func(string) error) error {
+	foundList, otherCount, err := findReferrerCodes(tableName, code, options.Owner)
+	if err != nil {
+		return err
+	}
+
+	if otherCount > 0 || (len(foundList) > 0 && !options.Cascade && options.ReassignTo == "") {
+		return newReferencedError(tableName, code, foundList, otherCount)
+	}
+
+	for _, found := range foundList {
+		for _, referrerCode := range found.codeList {
+			if options.Cascade {
+				err = deleteReferenced(found.referrer.TableName, referrerCode, options, found.referrer.Delete)
+			} else {
+				err = found.referrer.Reassign(referrerCode, options.ReassignTo)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return deleteFn(code)
+}
+
+//----------------------------------------------------------------------------------------
+// RefreshReferrers calls Refresh for every object of every collection that references the
+// object with code in tableName. It is meant to be called once that object has been stored,
+// so errors are logged rather than returned.
+func RefreshReferrers(tableName string, code string) {
+	for _, referrer := range referrerList(tableName) {
+		if referrer.Refresh == nil {
+			continue
+		}
+
+		codeList, err := referrer.FindCodes(code)
+		if err != nil {
+			log.Printf("Cannot find the objects of %s referencing %s with code %s. Error: %v", referrer.TableName, tableName, code, err)
+			continue
+		}
+
+		for _, referrerCode := range codeList {
+			err = referrer.Refresh(referrerCode)
+			if err != nil {
+				log.Printf("Cannot refresh %s with code %s referencing %s with code %s. Error: %v", referrer.TableName, referrerCode, tableName, code, err)
+			}
+		}
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// ResolveRef returns the object of tableName with code, as found by getter. If there is no
+// such object, a reference to it is added to brokenRefList instead, so that an object with
+// a dangling reference can still be loaded and reported. Other errors are logged.
+//
+// Adapters that keep a cache return and store shared instances, which other requests may be
+// reading. References are therefore attached to copies, never to the objects returned by or
+// given to an adapter.
+func ResolveRef[K objects.Object](brokenRefList *[]Reference, tableName string, field string, code string, getter func(string) (K, error)) K {
+	var refInst K
+
+	if code == "" {
+		return refInst
+	}
+
+	objectInst, err := getter(code)
+	if errors.Is(err, ErrNotFound) {
+		*brokenRefList = append(*brokenRefList, Reference{TableName: tableName, Field: field, Code: code})
+	} else if err != nil {
+		log.Printf("Cannot retrieve %s with code %s referenced by field %s. Error: %v", tableName, code, field, err)
+	} else {
+		refInst = objectInst
+	}
+
+	return refInst
+}
+
+//----------------------------------------------------------------------------------------
+// FindReferrerCodes returns the codes of the objects of adapterInst for which isReferring
+// holds. It is meant to implement Referrer.FindCodes.
+func FindReferrerCodes[K objects.Object](adapterInst Adapter[K], isReferring func(K) bool) ([]string, error) {
+	codeList := []string{}
+
+	objectList, err := adapterInst.GetObjectList()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, objectInst := range objectList {
+		if isReferring(objectInst) {
+			codeList = append(codeList, objectInst.CodeValue())
+		}
+	}
+
+	return codeList, nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+// referenceTable is a table of codes mapped to the code each of them references.
+type referenceTable map[string]string
+
+func (table referenceTable) referrer(tableName string) Referrer {
+	return Referrer{
+		TableName: tableName,
+		Field:     "ref",
+		FindCodes: func(code string) ([]string, error) {
+			codeList := []string{}
+			for referrerCode, refCode := range table {
+				if refCode == code {
+					codeList = append(codeList, referrerCode)
+				}
+			}
+
+			return codeList, nil
+		},
+		Reassign: func(referrerCode string, newCode string) error {
+			table[referrerCode] = newCode
+			return nil
+		},
+		Delete: func(referrerCode string) error {
+			delete(table, referrerCode)
+			return nil
+		},
+	}
+}
+
+func TestDeleteReferenced(t *testing.T) {
+	parentTable := referenceTable{"p1": "", "p2": ""}
+	childTable := referenceTable{"c1": "p1", "c2": "p1"}
+	grandChildTable := referenceTable{"g1": "c1"}
+
+	RegisterReferrer("test_parent", childTable.referrer("test_child"))
+	RegisterReferrer("test_child", grandChildTable.referrer("test_grandchild"))
+
+	t.Log("A referenced object is not deleted")
+	err := DeleteReferenced("test_parent", "p1", DeleteOptions{}, parentTable.referrer("").Delete)
+
+	var referencedErr *ReferencedError
+	if !errors.As(err, &referencedErr) || !errors.Is(err, ErrConflict) || len(referencedErr.References) != 2 {
+		t.Errorf("Delete of a referenced object expected to fail with two references but got %v", err)
+	}
+
+	if _, isFound := parentTable["p1"]; !isFound {
+		t.Errorf("Referenced object deleted")
+	}
+
+	t.Log("References can be reassigned")
+	err = DeleteReferenced("test_child", "c2", DeleteOptions{ReassignTo: "c1"}, childTable.referrer("").Delete)
+	if err != nil || len(childTable) != 1 {
+		t.Errorf("Delete with reassignment failed. Error: %v, children: %v", err, childTable)
+	}
+
+	t.Log("A cascading delete goes down every level")
+	err = DeleteReferenced("test_parent", "p1", DeleteOptions{Cascade: true}, parentTable.referrer("").Delete)
+	if err != nil || len(parentTable) != 1 || len(childTable) != 0 || len(grandChildTable) != 0 {
+		t.Errorf("Cascading delete failed. Error: %v, parents: %v, children: %v, grandchildren: %v", err, parentTable, childTable, grandChildTable)
+	}
+}
+
+func TestDeleteReferencedByOwner(t *testing.T) {
+	parentTable := referenceTable{"p1": "", "p2": ""}
+	childTable := referenceTable{"ann|c1": "p1", "bob|c2": "p1", "ann|c3": "p2"}
+	ownerMap := map[string]string{"ann|c1": "ann", "bob|c2": "bob", "ann|c3": "ann"}
+
+	childReferrer := childTable.referrer("test_owned_child")
+	childReferrer.OwnerOf = func(referrerCode string) (string, error) { return ownerMap[referrerCode], nil }
+	RegisterReferrer("test_owned_parent", childReferrer)
+
+	for _, options := range []DeleteOptions{{Owner: "ann"}, {Owner: "ann", Cascade: true}, {Owner: "ann", ReassignTo: "p2"}} {
+		t.Logf("An object referenced from another collection is not deleted with %+v", options)
+		err := DeleteReferenced("test_owned_parent", "p1", options, parentTable.referrer("").Delete)
+
+		var referencedErr *ReferencedError
+		if !errors.As(err, &referencedErr) || referencedErr.OtherReferences != 1 || len(referencedErr.References) != 1 || referencedErr.References[0].Code != "ann|c1" {
+			t.Errorf("Expected the delete to fail with the reference of ann only, got %+v", err)
+		}
+
+		if len(parentTable) != 2 || childTable["ann|c1"] != "p1" || childTable["bob|c2"] != "p1" {
+			t.Errorf("Objects changed by a refused delete. Parents: %v, children: %v", parentTable, childTable)
+		}
+	}
+
+	t.Log("An object referenced from the collection of the caller only can be deleted")
+	err := DeleteReferenced("test_owned_parent", "p2", DeleteOptions{Owner: "ann", Cascade: true}, parentTable.referrer("").Delete)
+	if _, isFound := childTable["ann|c3"]; err != nil || isFound || len(parentTable) != 1 {
+		t.Errorf("Cascading delete failed. Error: %v, parents: %v, children: %v", err, parentTable, childTable)
+	}
+}
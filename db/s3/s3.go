@@ -1,11 +1,14 @@
 package s3
 
 import (
+	"colmanback/db"
+	"fmt"
 	"log"
 	"mime/multipart"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -19,19 +22,62 @@ type S3Adapter struct {
 	maxGetEntries int
 }
 
-type S3Response struct {
-	FileLocation string `json:"fileLocation"`
-}
+type S3Response = db.FileResponse
+
+// Sess is the AWS session the adapters are configured with. A session of the default shared
+// config is created when it is not set.
+var Sess *session.Session
 
 //----------------------------------------------------------------------------------------
 func (s3Adapter *S3Adapter) Config(bucketName string, maxGetEntries int) {
 	s3Adapter.bucketName = bucketName
 	s3Adapter.maxGetEntries = maxGetEntries
-	s3Adapter.sess = session.Must(session.NewSession())
+	s3Adapter.sess = Sess
+	if s3Adapter.sess == nil {
+		s3Adapter.sess = session.Must(session.NewSession())
+	}
+
 	s3Adapter.uploader = s3manager.NewUploader(s3Adapter.sess)
 	s3Adapter.s3svc = s3.New(s3Adapter.sess)
 }
 
+//----------------------------------------------------------------------------------------
+// CreateBucket creates the bucket called bucketName unless it exists. It is meant for MinIO
+// and other test setups, as the bucket is created with default settings.
+func CreateBucket(bucketName string) error {
+	sess := Sess
+	if sess == nil {
+		sess = session.Must(session.NewSession())
+	}
+
+	s3svc := s3.New(sess)
+	_, err := s3svc.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucketName)})
+	if err == nil {
+		return nil
+	}
+
+	if awsErr, isAwsErr := err.(awserr.Error); !isAwsErr || (awsErr.Code() != "NotFound" && awsErr.Code() != s3.ErrCodeNoSuchBucket) {
+		return &db.BackendError{Operation: "lookup", Resource: "bucket " + bucketName, Err: err}
+	}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucketName)}
+	if region := aws.StringValue(sess.Config.Region); region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(region)}
+	}
+
+	log.Printf("Creating bucket %s", bucketName)
+	_, err = s3svc.CreateBucket(input)
+	if err == nil {
+		err = s3svc.WaitUntilBucketExists(&s3.HeadBucketInput{Bucket: aws.String(bucketName)})
+	}
+
+	if err != nil {
+		return &db.BackendError{Operation: "creation", Resource: "bucket " + bucketName, Err: err}
+	}
+
+	return nil
+}
+
 //----------------------------------------------------------------------------------------
 func (s3Adapter *S3Adapter) AddFile(fileName string, file multipart.File) (S3Response, error) {
 	var response S3Response
@@ -44,11 +90,12 @@ func (s3Adapter *S3Adapter) AddFile(fileName string, file multipart.File) (S3Res
 
 	if err != nil {
 		log.Printf("S3 failed to upload file %s into bucket %s. Error: %v", fileName, s3Adapter.bucketName, err)
-	} else {
-		response.FileLocation = result.Location
+		return response, &db.BackendError{Operation: "upload of " + fileName, Resource: "bucket " + s3Adapter.bucketName, Err: err}
 	}
 
-	return response, err
+	response.FileLocation = result.Location
+
+	return response, nil
 }
 
 //----------------------------------------------------------------------------------------
@@ -72,10 +119,11 @@ func (s3Adapter *S3Adapter) DeleteFiles(fileNameArr []string) error {
 
 	_, err := s3Adapter.s3svc.DeleteObjects(input)
 	if err != nil {
-		log.Fatalf("S3 failed to delete files %v from bucket %s. Error: %v", fileNameArr, s3Adapter.bucketName, err)
+		log.Printf("S3 failed to delete files %v from bucket %s. Error: %v", fileNameArr, s3Adapter.bucketName, err)
+		return &db.BackendError{Operation: fmt.Sprintf("deletion of %v", fileNameArr), Resource: "bucket " + s3Adapter.bucketName, Err: err}
 	}
 
-	return err
+	return nil
 }
 
 //----------------------------------------------------------------------------------------
@@ -85,6 +133,17 @@ func (s3Adapter *S3Adapter) DeleteFile(fileName string) error {
 	return s3Adapter.DeleteFiles(fileNameArr)
 }
 
+//----------------------------------------------------------------------------------------
+// Ping checks that the bucket exists and can be accessed.
+func (s3Adapter *S3Adapter) Ping() error {
+	_, err := s3Adapter.s3svc.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(s3Adapter.bucketName)})
+	if err != nil {
+		return &db.BackendError{Operation: "lookup", Resource: "bucket " + s3Adapter.bucketName, Err: err}
+	}
+
+	return nil
+}
+
 //----------------------------------------------------------------------------------------
 /*
 func ListModelPictures(Code string) []byte {
@@ -126,3 +185,4 @@ func ListModelPictures(Code string) []byte {
 	return []byte(arrayString)
 }
 */
+
@@ -0,0 +1,240 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Scores given to a tag matching the whole search text. A tag matching every word of the
+// search text scores up to SCORE_WORDS, depending on how well each word matches.
+const (
+	SCORE_EXACT  = 1.0
+	SCORE_PREFIX = 0.9
+	SCORE_WORDS  = 0.8
+	SCORE_INFIX  = 0.7
+)
+
+// Scores given to a single word of the search text matching a word of the tag. Typos are
+// only tolerated in words of at least FUZZY_MIN_LENGTH letters, so that short codes such as
+// IATA ones still have to match exactly.
+const (
+	WORD_SCORE_EXACT  = 1.0
+	WORD_SCORE_PREFIX = 0.9
+	WORD_SCORE_INFIX  = 0.75
+	WORD_SCORE_FUZZY  = 0.7
+
+	FUZZY_MIN_LENGTH = 4
+)
+
+//----------------------------------------------------------------------------------------
+// NormalizeText lower-cases text and strips its diacritics, so that "Curaçao" and "curacao"
+// are the same search key.
+func NormalizeText(text string) string {
+	normalizer := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+	normalized, _, err := transform.String(normalizer, text)
+	if err != nil {
+		normalized = text
+	}
+
+	return strings.ToLower(normalized)
+}
+
+//----------------------------------------------------------------------------------------
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(NormalizeText(text), func(char rune) bool {
+		return !unicode.IsLetter(char) && !unicode.IsDigit(char)
+	})
+}
+
+//----------------------------------------------------------------------------------------
+func maxEdits(word string) int {
+	length := len([]rune(word))
+
+	switch {
+	case length < FUZZY_MIN_LENGTH:
+		return 0
+	case length < 8:
+		return 1
+	}
+
+	return 2
+}
+
+//----------------------------------------------------------------------------------------
+// editDistance returns the Levenshtein distance between a and b, or limit + 1 as soon as it
+// is known to exceed limit.
+func editDistance(a string, b string, limit int) int {
+	aRunes := []rune(a)
+	bRunes := []rune(b)
+
+	if diff := len(aRunes) - len(bRunes); diff > limit || -diff > limit {
+		return limit + 1
+	}
+
+	previousRow := make([]int, len(bRunes)+1)
+	currentRow := make([]int, len(bRunes)+1)
+	for column := range previousRow {
+		previousRow[column] = column
+	}
+
+	for row := 1; row <= len(aRunes); row++ {
+		currentRow[0] = row
+		rowMin := row
+
+		for column := 1; column <= len(bRunes); column++ {
+			cost := 1
+			if aRunes[row-1] == bRunes[column-1] {
+				cost = 0
+			}
+
+			currentRow[column] = minInt(previousRow[column]+1, currentRow[column-1]+1, previousRow[column-1]+cost)
+			rowMin = minInt(rowMin, currentRow[column])
+		}
+
+		if rowMin > limit {
+			return limit + 1
+		}
+
+		previousRow, currentRow = currentRow, previousRow
+	}
+
+	return previousRow[len(bRunes)]
+}
+
+//----------------------------------------------------------------------------------------
+func minInt(value int, others ...int) int {
+	for _, other := range others {
+		if other < value {
+			value = other
+		}
+	}
+
+	return value
+}
+
+//----------------------------------------------------------------------------------------
+// scoreWord returns how well a word of the search text matches the best of the tag words.
+func scoreWord(queryWord string, tagWordList []string) float64 {
+	bestScore := 0.0
+	limit := maxEdits(queryWord)
+
+	for _, tagWord := range tagWordList {
+		score := 0.0
+
+		switch {
+		case tagWord == queryWord:
+			score = WORD_SCORE_EXACT
+		case strings.HasPrefix(tagWord, queryWord):
+			score = WORD_SCORE_PREFIX
+		case strings.Contains(tagWord, queryWord):
+			score = WORD_SCORE_INFIX
+		case limit > 0:
+			if distance := editDistance(queryWord, tagWord, limit); distance <= limit {
+				score = WORD_SCORE_FUZZY * (1 - float64(distance)/float64(len([]rune(queryWord))+1))
+			}
+		}
+
+		if score > bestScore {
+			bestScore = score
+		}
+	}
+
+	return bestScore
+}
+
+//----------------------------------------------------------------------------------------
+// ScoreTag returns how well a tag matches the search text, from 0 (no match) to SCORE_EXACT.
+// query is the search text as its words (queryWordList) joined by single spaces.
+func ScoreTag(query string, queryWordList []string, tag string) float64 {
+	tagWordList := Tokenize(tag)
+	normalizedTag := strings.Join(tagWordList, " ")
+
+	switch {
+	case normalizedTag == query:
+		return SCORE_EXACT
+	case strings.HasPrefix(normalizedTag, query):
+		return SCORE_PREFIX
+	}
+
+	score := 0.0
+	if strings.Contains(normalizedTag, query) {
+		score = SCORE_INFIX
+	}
+
+	// Every word of the search text has to match one of the tag words.
+	if len(queryWordList) > 0 {
+		wordScoreSum := 0.0
+
+		for _, queryWord := range queryWordList {
+			wordScore := scoreWord(queryWord, tagWordList)
+			if wordScore == 0 {
+				return score
+			}
+
+			wordScoreSum += wordScore
+		}
+
+		if wordsScore := SCORE_WORDS * wordScoreSum / float64(len(queryWordList)); wordsScore > score {
+			score = wordsScore
+		}
+	}
+
+	return score
+}
+
+//----------------------------------------------------------------------------------------
+// rankCacheMap expects cacheMapLock to be held for reading. Each object is returned once,
+// with the score of its best matching tag, best matches first.
+func rankCacheMap(searchKey string) []CacheMapElement {
+	var resultSlice []CacheMapElement
+	positionMap := make(map[string]int)
+
+	queryWordList := Tokenize(searchKey)
+	query := strings.Join(queryWordList, " ")
+	if query == "" {
+		return resultSlice
+	}
+
+	for tag, elementArray := range cacheMap {
+		score := ScoreTag(query, queryWordList, tag)
+		if score == 0 {
+			continue
+		}
+
+		for _, matchElement := range elementArray {
+			matchElement.Score = score
+			resultKey := matchElement.Code + "|" + matchElement.Type
+
+			if position, hasKey := positionMap[resultKey]; !hasKey {
+				positionMap[resultKey] = len(resultSlice)
+				resultSlice = append(resultSlice, matchElement)
+			} else if score > resultSlice[position].Score {
+				resultSlice[position] = matchElement
+			}
+		}
+	}
+
+	sort.Slice(resultSlice, func(i int, j int) bool {
+		first, second := resultSlice[i], resultSlice[j]
+
+		if first.Score != second.Score {
+			return first.Score > second.Score
+		} else if len(first.Tag) != len(second.Tag) {
+			return len(first.Tag) < len(second.Tag)
+		} else if first.Name != second.Name {
+			return first.Name < second.Name
+		} else if first.Type != second.Type {
+			return first.Type < second.Type
+		}
+
+		return first.Code < second.Code
+	})
+
+	return resultSlice
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"testing"
+)
+
+const (
+	airlineTableConst  = "test_airline"
+	airplaneTableConst = "test_airplane"
+	countryTableConst  = "test_country"
+)
+
+func loadTestCacheMap() {
+	var airlineCacheMap []CacheMapElement
+	var airplaneCacheMap []CacheMapElement
+	var countryCacheMap []CacheMapElement
+
+	airlineCacheMap = AddToCacheMap(airlineCacheMap, "Lufthansa", "iata:lh", "Lufthansa")
+	airlineCacheMap = AddToCacheMap(airlineCacheMap, "lh", "iata:lh", "Lufthansa")
+	airlineCacheMap = AddToCacheMap(airlineCacheMap, "Lufthansa Cargo", "iata:lh_cargo", "Lufthansa Cargo")
+	airlineCacheMap = AddToCacheMap(airlineCacheMap, "Cargolux", "iata:cv", "Cargolux")
+	airlineCacheMap = AddToCacheMap(airlineCacheMap, "Air Lufthansa Charter", "iata:xx", "Air Lufthansa Charter")
+	LoadCacheMap(airlineTableConst, airlineCacheMap)
+
+	airplaneCacheMap = AddToCacheMap(airplaneCacheMap, "Boeing 747-400", "b744", "Boeing 747-400")
+	airplaneCacheMap = AddToCacheMap(airplaneCacheMap, "Boeing 737-800", "b738", "Boeing 737-800")
+	airplaneCacheMap = AddToCacheMap(airplaneCacheMap, "Airbus A380", "a388", "Airbus A380")
+	LoadCacheMap(airplaneTableConst, airplaneCacheMap)
+
+	countryCacheMap = AddToCacheMap(countryCacheMap, "Côte d'Ivoire", "ci", "Côte d'Ivoire")
+	countryCacheMap = AddToCacheMap(countryCacheMap, "Curaçao", "cw", "Curaçao")
+	LoadCacheMap(countryTableConst, countryCacheMap)
+}
+
+func chkFirstResult(t *testing.T, searchKey string, expectedCode string) []CacheMapElement {
+	resultList := SearchCacheMap(searchKey)
+
+	if len(resultList) == 0 {
+		t.Errorf("No results for %s, expected %s first", searchKey, expectedCode)
+	} else if resultList[0].Code != expectedCode {
+		t.Errorf("Expected %s first for %s but got %+v", expectedCode, searchKey, resultList)
+	}
+
+	return resultList
+}
+
+func TestRankedSearch(t *testing.T) {
+	loadTestCacheMap()
+
+	t.Log("Multi-word keys find the record containing all the words")
+	chkFirstResult(t, "lufthansa cargo", "iata:lh_cargo")
+	chkFirstResult(t, "cargo lufthansa", "iata:lh_cargo")
+
+	t.Log("Exact matches come before prefix matches, which come before infix matches")
+	resultList := chkFirstResult(t, "Lufthansa", "iata:lh")
+	if len(resultList) != 3 || resultList[1].Code != "iata:lh_cargo" || resultList[2].Code != "iata:xx" {
+		t.Errorf("Unexpected ranking for lufthansa: %+v", resultList)
+	}
+
+	if resultList[0].Score != SCORE_EXACT || resultList[1].Score != SCORE_PREFIX || resultList[2].Score >= resultList[1].Score {
+		t.Errorf("Unexpected scores for lufthansa: %+v", resultList)
+	}
+
+	t.Log("Typos are tolerated in names")
+	chkFirstResult(t, "boing 747", "b744")
+	chkFirstResult(t, "lufthnasa", "iata:lh")
+
+	t.Log("Typos are not tolerated in short codes")
+	for _, result := range SearchCacheMap("lx") {
+		if result.Code == "iata:lh" {
+			t.Errorf("Code lh found when searching for lx: %+v", result)
+		}
+	}
+
+	t.Log("Diacritics are ignored on both sides")
+	chkFirstResult(t, "cote d'ivoire", "ci")
+	chkFirstResult(t, "CURACAO", "cw")
+	chkFirstResult(t, "Curaçao", "cw")
+
+	t.Log("Nothing is returned for an empty key")
+	if resultList := SearchCacheMap(" - "); len(resultList) != 0 {
+		t.Errorf("Expected no results for an empty key but got %+v", resultList)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	distanceList := []struct {
+		a        string
+		b        string
+		limit    int
+		expected int
+	}{
+		{"boing", "boeing", 1, 1},
+		{"lufthnasa", "lufthansa", 2, 2},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 1, 2},
+		{"same", "same", 1, 0},
+	}
+
+	for _, distanceInst := range distanceList {
+		distance := editDistance(distanceInst.a, distanceInst.b, distanceInst.limit)
+		if distance != distanceInst.expected {
+			t.Errorf("Distance between %s and %s with limit %d expected to be %d but got %d", distanceInst.a, distanceInst.b, distanceInst.limit, distanceInst.expected, distance)
+		}
+	}
+}
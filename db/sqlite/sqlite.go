@@ -0,0 +1,739 @@
+package sqlite
+
+import (
+	"colmanback/db"
+	"colmanback/objects"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	DATA_COLUMN = "data"
+)
+
+// InQuerySize is the largest number of codes looked up by a single query, as SQLite limits
+// the number of parameters of a statement.
+var InQuerySize int = 500
+
+var Conn *sql.DB
+
+type Sqlite[K objects.Object] struct {
+	tableName   string
+	codeName    string
+	sortName    string
+	sortGSIName string
+	keepCache   bool
+	constructor func() K
+	cacheMap    func([]K) []db.CacheMapElement
+
+	cacheLock sync.RWMutex
+	cache     map[string]K
+	cacheTime time.Time
+}
+
+//----------------------------------------------------------------------------------------
+func Open(path string) error {
+	conn, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return &db.BackendError{Operation: "open", Resource: "sqlite database " + path, Err: err}
+	}
+
+	// SQLite allows a single writer; sharing one connection also keeps ":memory:" databases
+	// visible to every query.
+	conn.SetMaxOpenConns(1)
+
+	err = conn.Ping()
+	if err != nil {
+		return &db.BackendError{Operation: "connection", Resource: "sqlite database " + path, Err: err}
+	}
+
+	Conn = conn
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func quote(identifier string) string {
+	return "\"" + strings.ReplaceAll(identifier, "\"", "\"\"") + "\""
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) backendErr(operation string, err error) error {
+	return &db.BackendError{Operation: operation, Resource: "table " + sqliteInst.tableName, Err: err}
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) createSchema() error {
+	var createTable string
+
+	if sqliteInst.sortName == "" {
+		createTable = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s TEXT NOT NULL PRIMARY KEY, %s TEXT NOT NULL)",
+			quote(sqliteInst.tableName), quote(sqliteInst.codeName), DATA_COLUMN)
+	} else {
+		createTable = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s TEXT NOT NULL, %s TEXT NOT NULL, %s TEXT NOT NULL, PRIMARY KEY (%s, %s))",
+			quote(sqliteInst.tableName), quote(sqliteInst.codeName), quote(sqliteInst.sortName), DATA_COLUMN,
+			quote(sqliteInst.codeName), quote(sqliteInst.sortName))
+	}
+
+	_, err := Conn.Exec(createTable)
+	if err != nil {
+		return sqliteInst.backendErr("table creation", err)
+	}
+
+	if sqliteInst.sortName != "" && sqliteInst.sortGSIName != "" {
+		createIndex := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s, %s)",
+			quote(sqliteInst.sortGSIName), quote(sqliteInst.tableName), quote(sqliteInst.sortName), quote(sqliteInst.codeName))
+
+		_, err = Conn.Exec(createIndex)
+		if err != nil {
+			return sqliteInst.backendErr("creation of index "+sqliteInst.sortGSIName, err)
+		}
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) unmarshal(data string) (K, error) {
+	objectInst := sqliteInst.constructor()
+
+	err := json.Unmarshal([]byte(data), objectInst)
+	if err != nil {
+		return objectInst, fmt.Errorf("cannot unmarshall. Err: %s", err)
+	}
+
+	return objectInst, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) getObjectListFromDB() ([]K, error) {
+	var objectList []K
+	var query string
+
+	if sqliteInst.sortName == "" {
+		query = fmt.Sprintf("SELECT %s FROM %s ORDER BY %s", DATA_COLUMN, quote(sqliteInst.tableName), quote(sqliteInst.codeName))
+	} else {
+		query = fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s ORDER BY %s", DATA_COLUMN, quote(sqliteInst.tableName),
+			quote(sqliteInst.codeName), quote(sqliteInst.sortName), quote(sqliteInst.codeName))
+	}
+
+	rows, err := Conn.Query(query)
+	if err != nil {
+		return objectList, sqliteInst.backendErr("query", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+
+		err = rows.Scan(&data)
+		if err != nil {
+			return objectList, sqliteInst.backendErr("row read", err)
+		}
+
+		objectInst, unmarshalErr := sqliteInst.unmarshal(data)
+		if unmarshalErr != nil {
+			return objectList, unmarshalErr
+		}
+
+		objectList = append(objectList, objectInst)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return objectList, sqliteInst.backendErr("row read", err)
+	}
+
+	return objectList, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) getObjectListBySortFromDB(sortValue string) ([]K, error) {
+	var codeList []string
+	var returnObjectList []K
+
+	if sqliteInst.sortName == "" || sqliteInst.sortGSIName == "" {
+		return nil, fmt.Errorf("adapter does not have a configured sortName / sortGSIName %v", sqliteInst)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s INDEXED BY %s WHERE %s = ? ORDER BY %s", quote(sqliteInst.codeName), quote(sqliteInst.tableName),
+		quote(sqliteInst.sortGSIName), quote(sqliteInst.sortName), quote(sqliteInst.codeName))
+
+	rows, err := Conn.Query(query, sortValue)
+	if err != nil {
+		return nil, sqliteInst.backendErr("query on index "+sqliteInst.sortGSIName, err)
+	}
+
+	for rows.Next() {
+		var codeValue string
+
+		err = rows.Scan(&codeValue)
+		if err != nil {
+			rows.Close()
+			return nil, sqliteInst.backendErr("row read from index "+sqliteInst.sortGSIName, err)
+		}
+
+		codeList = append(codeList, codeValue)
+	}
+
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, sqliteInst.backendErr("row read from index "+sqliteInst.sortGSIName, err)
+	}
+
+	// Turn index entries into actual objects.
+	for _, codeValue := range codeList {
+		returnObjectInst, instErr := sqliteInst.GetObjectByCode(codeValue)
+		if instErr == nil {
+			returnObjectList = append(returnObjectList, returnObjectInst)
+		} else {
+			log.Printf("An object instance could not be retrieved for code %s. Error %v", codeValue, instErr)
+		}
+	}
+
+	return returnObjectList, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) getObjectByCodeFromDB(codeValue string) (K, bool, error) {
+	var data string
+	var row *sql.Row
+
+	if sqliteInst.sortName == "" {
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", DATA_COLUMN, quote(sqliteInst.tableName), quote(sqliteInst.codeName))
+		row = Conn.QueryRow(query, codeValue)
+	} else {
+		//tables with a sort index store the key as sort value for the actual objects.
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? AND %s = ?", DATA_COLUMN, quote(sqliteInst.tableName),
+			quote(sqliteInst.codeName), quote(sqliteInst.sortName))
+		row = Conn.QueryRow(query, codeValue, codeValue)
+	}
+
+	err := row.Scan(&data)
+	if err == sql.ErrNoRows {
+		return sqliteInst.constructor(), false, nil
+	} else if err != nil {
+		return sqliteInst.constructor(), false, sqliteInst.backendErr(fmt.Sprintf("retrieval of object with %s = %s", sqliteInst.codeName, codeValue), err)
+	}
+
+	objectInst, err := sqliteInst.unmarshal(data)
+
+	return objectInst, err == nil, err
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) getObjectListByCodesFromDB(codeList []string) ([]K, error) {
+	var objectList []K
+	var argList []interface{}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(codeList)), ",")
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (%s)", DATA_COLUMN, quote(sqliteInst.tableName), quote(sqliteInst.codeName), placeholders)
+	if sqliteInst.sortName != "" {
+		//tables with a sort index store the key as sort value for the actual objects.
+		query += fmt.Sprintf(" AND %s = %s", quote(sqliteInst.sortName), quote(sqliteInst.codeName))
+	}
+
+	for _, codeValue := range codeList {
+		argList = append(argList, codeValue)
+	}
+
+	rows, err := Conn.Query(query, argList...)
+	if err != nil {
+		return objectList, sqliteInst.backendErr("query", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+
+		err = rows.Scan(&data)
+		if err != nil {
+			return objectList, sqliteInst.backendErr("row read", err)
+		}
+
+		objectInst, unmarshalErr := sqliteInst.unmarshal(data)
+		if unmarshalErr != nil {
+			return objectList, unmarshalErr
+		}
+
+		objectList = append(objectList, objectInst)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return objectList, sqliteInst.backendErr("row read", err)
+	}
+
+	return objectList, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) initCache() error {
+	cache := make(map[string]K)
+	cacheList, err := sqliteInst.getObjectListFromDB()
+
+	if err != nil {
+		return fmt.Errorf("object cache for %s cannot be initialised. Error: %w", sqliteInst.tableName, err)
+	}
+
+	for _, objectInst := range cacheList {
+		cache[objectInst.CodeValue()] = objectInst
+	}
+
+	sqliteInst.cacheLock.Lock()
+	sqliteInst.cache = cache
+	sqliteInst.cacheTime = time.Now()
+	sqliteInst.cacheLock.Unlock()
+
+	if sqliteInst.cacheMap != nil {
+		db.LoadCacheMap(sqliteInst.tableName, sqliteInst.cacheMap(cacheList))
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) Config(tableName string, codeName string, keepCache bool, constructor func() K, getCacheMap func([]K) []db.CacheMapElement) error {
+	sqliteInst.tableName = tableName
+	sqliteInst.codeName = codeName
+	sqliteInst.keepCache = keepCache
+	sqliteInst.constructor = constructor
+	sqliteInst.cacheMap = getCacheMap
+	sqliteInst.cache = make(map[string]K)
+
+	err := sqliteInst.createSchema()
+	if err != nil {
+		return err
+	}
+
+	if keepCache {
+		return sqliteInst.initCache()
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) SetSortName(sortName string) {
+	if sqliteInst.keepCache {
+		log.Fatalf("A sort name for adapter %s cannot be set as this adapter has been already configured to keep a cache. Set the sort name before calling Config.", sqliteInst.tableName)
+	} else {
+		sqliteInst.sortName = sortName
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) SetSortGSIName(sortGSIName string) {
+	sqliteInst.sortGSIName = sortGSIName
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) DeleteObjectByCodeAndSort(codeValue string, sortValue string) error {
+	var err error
+
+	if sqliteInst.sortName != "" && sortValue != "" {
+		query := fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND %s = ?", quote(sqliteInst.tableName), quote(sqliteInst.codeName), quote(sqliteInst.sortName))
+		_, err = Conn.Exec(query, codeValue, sortValue)
+	} else {
+		query := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", quote(sqliteInst.tableName), quote(sqliteInst.codeName))
+		_, err = Conn.Exec(query, codeValue)
+	}
+
+	if err != nil {
+		return sqliteInst.backendErr(fmt.Sprintf("deletion of object with %s %s, %s %s", sqliteInst.codeName, codeValue, sqliteInst.sortName, sortValue), err)
+	}
+
+	sqliteInst.evict(codeValue)
+
+	if sqliteInst.sortName == "" || sortValue == "" || codeValue == sortValue {
+		sqliteInst.unindexObject(codeValue)
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) DeleteObjectByCode(codeValue string) error {
+	return sqliteInst.DeleteObjectByCodeAndSort(codeValue, codeValue)
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) GetSortKeyList(codeValue string) ([]string, error) {
+	keyList := []string{}
+
+	if sqliteInst.sortName == "" {
+		return keyList, fmt.Errorf("adapter for %s does not have a sort name set", sqliteInst.tableName)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? AND %s <> ? ORDER BY %s", quote(sqliteInst.sortName), quote(sqliteInst.tableName),
+		quote(sqliteInst.codeName), quote(sqliteInst.sortName), quote(sqliteInst.sortName))
+
+	rows, err := Conn.Query(query, codeValue, codeValue)
+	if err != nil {
+		return keyList, sqliteInst.backendErr("retrieval of sort keys for key "+codeValue, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sortValue string
+
+		err = rows.Scan(&sortValue)
+		if err != nil {
+			return keyList, sqliteInst.backendErr("sort key read", err)
+		}
+
+		keyList = append(keyList, sortValue)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return keyList, sqliteInst.backendErr("sort key read", err)
+	}
+
+	return keyList, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) DeleteObject(objectInst K) error {
+	var err error
+
+	if sqliteInst.sortName == "" {
+		err = sqliteInst.DeleteObjectByCode(objectInst.CodeValue())
+	} else {
+		err = sqliteInst.DeleteObjectByCodeAndSort(objectInst.CodeValue(), objectInst.SortValue())
+	}
+
+	return err
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) GetObjectList() ([]K, error) {
+	if !sqliteInst.keepCache {
+		return sqliteInst.getObjectListFromDB()
+	}
+
+	sqliteInst.cacheLock.RLock()
+	defer sqliteInst.cacheLock.RUnlock()
+
+	objectList := []K{}
+	for _, objectInst := range sqliteInst.cache {
+		objectList = append(objectList, objectInst)
+	}
+
+	return objectList, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) GetObjectListBySort(sortValue string) ([]K, error) {
+	return sqliteInst.getObjectListBySortFromDB(sortValue)
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) GetObjectListJSON() ([]byte, error) {
+	objectList, errList := sqliteInst.GetObjectList()
+	if errList != nil {
+		return nil, errList
+	}
+
+	out, err := json.MarshalIndent(objectList, db.JSON_PREFIX, db.JSON_INDENT)
+	if err != nil {
+		return nil, fmt.Errorf("got error when trying to return object list from table %s as API response. Error: %s", sqliteInst.tableName, err)
+	}
+
+	return out, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) GetObjectByCodeJSON(codeValue string) ([]byte, error) {
+	objectInst, getErr := sqliteInst.GetObjectByCode(codeValue)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	out, err := json.MarshalIndent(objectInst, db.JSON_PREFIX, db.JSON_INDENT)
+	if err != nil {
+		return nil, fmt.Errorf("got error when trying to return object from table %s as API response. Error: %s", sqliteInst.tableName, err)
+	}
+
+	return out, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) GetObjectByCode(codeValue string) (K, error) {
+	if sqliteInst.keepCache {
+		sqliteInst.cacheLock.RLock()
+		objectInst, isCached := sqliteInst.cache[codeValue]
+		sqliteInst.cacheLock.RUnlock()
+
+		if isCached {
+			return objectInst, nil
+		}
+	}
+
+	objectInst, isFound, err := sqliteInst.getObjectByCodeFromDB(codeValue)
+	if err != nil {
+		return objectInst, err
+	} else if !isFound {
+		return objectInst, &db.NotFoundError{TableName: sqliteInst.tableName, Code: codeValue}
+	}
+
+	if sqliteInst.keepCache {
+		sqliteInst.cacheLock.Lock()
+		sqliteInst.cache[codeValue] = objectInst
+		sqliteInst.cacheLock.Unlock()
+	}
+
+	return objectInst, nil
+}
+
+//----------------------------------------------------------------------------------------
+// GetObjectMapByCodes returns the objects with the codes of codeList, keyed by code. Codes
+// that are not found are left out. Cached objects are not read again; the others are read
+// with one query per InQuerySize codes.
+func (sqliteInst *Sqlite[K]) GetObjectMapByCodes(codeList []string) (map[string]K, error) {
+	var missingList []string
+	objectMap := make(map[string]K)
+
+	sqliteInst.cacheLock.RLock()
+	for _, codeValue := range db.DistinctCodes(codeList) {
+		if objectInst, isCached := sqliteInst.cache[codeValue]; isCached && sqliteInst.keepCache {
+			objectMap[codeValue] = objectInst
+		} else {
+			missingList = append(missingList, codeValue)
+		}
+	}
+	sqliteInst.cacheLock.RUnlock()
+
+	if len(missingList) == 0 {
+		return objectMap, nil
+	}
+
+	for start := 0; start < len(missingList); start += InQuerySize {
+		end := start + InQuerySize
+		if end > len(missingList) {
+			end = len(missingList)
+		}
+
+		objectList, err := sqliteInst.getObjectListByCodesFromDB(missingList[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, objectInst := range objectList {
+			objectMap[objectInst.CodeValue()] = objectInst
+			if sqliteInst.keepCache {
+				sqliteInst.cacheLock.Lock()
+				sqliteInst.cache[objectInst.CodeValue()] = objectInst
+				sqliteInst.cacheLock.Unlock()
+			}
+		}
+	}
+
+	return objectMap, nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) storedVersion(tx *sql.Tx, codeValue string) (int64, error) {
+	var data string
+	var row *sql.Row
+
+	if sqliteInst.sortName == "" {
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", DATA_COLUMN, quote(sqliteInst.tableName), quote(sqliteInst.codeName))
+		row = tx.QueryRow(query, codeValue)
+	} else {
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? AND %s = ?", DATA_COLUMN, quote(sqliteInst.tableName),
+			quote(sqliteInst.codeName), quote(sqliteInst.sortName))
+		row = tx.QueryRow(query, codeValue, codeValue)
+	}
+
+	err := row.Scan(&data)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, sqliteInst.backendErr(fmt.Sprintf("retrieval of the version of object with %s = %s", sqliteInst.codeName, codeValue), err)
+	}
+
+	storedInst, err := sqliteInst.unmarshal(data)
+	if err != nil {
+		return 0, err
+	}
+
+	return storedInst.VersionValue(), nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) putObject(objectInst K, checkVersion bool) error {
+	codeValue := objectInst.CodeValue()
+	expectedVersion := objectInst.VersionValue()
+	isMainItem := sqliteInst.sortName == "" || codeValue == objectInst.SortValue()
+
+	tx, err := Conn.Begin()
+	if err != nil {
+		return sqliteInst.backendErr("transaction start", err)
+	}
+	defer tx.Rollback()
+
+	if checkVersion && isMainItem {
+		storedVersion, err := sqliteInst.storedVersion(tx, codeValue)
+		if err != nil {
+			return err
+		}
+
+		if storedVersion != expectedVersion {
+			sqliteInst.evict(codeValue)
+			return &db.ConflictError{TableName: sqliteInst.tableName, Code: codeValue, Version: expectedVersion}
+		}
+
+		objectInst.SetVersion(expectedVersion + 1)
+	}
+
+	objectMarshalled, err := json.Marshal(objectInst)
+	if err != nil {
+		objectInst.SetVersion(expectedVersion)
+		return fmt.Errorf("got error marshalling object with key = %s. Error: %s", codeValue, err)
+	}
+
+	if sqliteInst.sortName == "" {
+		query := fmt.Sprintf("INSERT OR REPLACE INTO %s (%s, %s) VALUES (?, ?)", quote(sqliteInst.tableName), quote(sqliteInst.codeName), DATA_COLUMN)
+		_, err = tx.Exec(query, codeValue, string(objectMarshalled))
+	} else {
+		query := fmt.Sprintf("INSERT OR REPLACE INTO %s (%s, %s, %s) VALUES (?, ?, ?)", quote(sqliteInst.tableName),
+			quote(sqliteInst.codeName), quote(sqliteInst.sortName), DATA_COLUMN)
+		_, err = tx.Exec(query, codeValue, objectInst.SortValue(), string(objectMarshalled))
+	}
+
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		objectInst.SetVersion(expectedVersion)
+		return sqliteInst.backendErr("insertion of object with key = "+codeValue, err)
+	}
+
+	if sqliteInst.keepCache && isMainItem {
+		sqliteInst.cacheLock.Lock()
+		sqliteInst.cache[codeValue] = objectInst
+		sqliteInst.cacheLock.Unlock()
+
+		sqliteInst.indexObject(objectInst)
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) evict(codeValue string) {
+	if sqliteInst.keepCache {
+		sqliteInst.cacheLock.Lock()
+		delete(sqliteInst.cache, codeValue)
+		sqliteInst.cacheLock.Unlock()
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// indexObject and unindexObject keep the search cache map in line with the writes made through
+// the adapter. The map is only built for adapters that keep a cache.
+func (sqliteInst *Sqlite[K]) indexObject(objectInst K) {
+	if sqliteInst.keepCache && sqliteInst.cacheMap != nil {
+		db.UpdateCacheMap(sqliteInst.tableName, objectInst.CodeValue(), sqliteInst.cacheMap([]K{objectInst}))
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) unindexObject(codeValue string) {
+	if sqliteInst.keepCache && sqliteInst.cacheMap != nil {
+		db.RemoveFromCacheMap(sqliteInst.tableName, codeValue)
+	}
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) PutObject(objectInst K) error {
+	return sqliteInst.putObject(objectInst, true)
+}
+
+//----------------------------------------------------------------------------------------
+// PutObjectList writes the objects as given, without checking their versions, in the same
+// way as a DynamoDB batch write.
+func (sqliteInst *Sqlite[K]) PutObjectList(objectList []K) error {
+	var failedCodes []string
+	var lastErr error
+
+	for _, objectInst := range objectList {
+		err := sqliteInst.putObject(objectInst, false)
+		if err != nil {
+			failedCodes = append(failedCodes, objectInst.CodeValue())
+			lastErr = err
+		}
+	}
+
+	if len(failedCodes) > 0 {
+		return &db.BatchError{TableName: sqliteInst.tableName, Operation: "put", FailedCodes: failedCodes, Err: lastErr}
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) DeleteObjectList(objectList []K) error {
+	var failedCodes []string
+	var lastErr error
+
+	for _, objectInst := range objectList {
+		err := sqliteInst.DeleteObject(objectInst)
+		if err != nil {
+			failedCodes = append(failedCodes, objectInst.CodeValue())
+			lastErr = err
+		}
+	}
+
+	if len(failedCodes) > 0 {
+		return &db.BatchError{TableName: sqliteInst.tableName, Operation: "delete", FailedCodes: failedCodes, Err: lastErr}
+	}
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (sqliteInst *Sqlite[K]) ResetCache() error {
+	if !sqliteInst.keepCache {
+		return nil
+	}
+
+	return sqliteInst.initCache()
+}
+
+//----------------------------------------------------------------------------------------
+// Status reports the size of the cache of the adapter and the time it was last loaded.
+func (sqliteInst *Sqlite[K]) Status() db.AdapterStatus {
+	sqliteInst.cacheLock.RLock()
+	defer sqliteInst.cacheLock.RUnlock()
+
+	statusInst := db.AdapterStatus{TableName: sqliteInst.tableName, KeepCache: sqliteInst.keepCache, CacheSize: len(sqliteInst.cache)}
+	if sqliteInst.keepCache && !sqliteInst.cacheTime.IsZero() {
+		cacheTime := sqliteInst.cacheTime
+		statusInst.CacheTime = &cacheTime
+	}
+
+	return statusInst
+}
+
+//----------------------------------------------------------------------------------------
+// Ping checks that the table of the adapter can be read.
+func (sqliteInst *Sqlite[K]) Ping() error {
+	var found int
+
+	err := Conn.QueryRow(fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", quote(sqliteInst.tableName))).Scan(&found)
+	if err != nil && err != sql.ErrNoRows {
+		return sqliteInst.backendErr("read", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package sqlite
+
+import (
+	"colmanback/db"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+const (
+	tableConst    = "sqlitetest"
+	codeNameConst = "code"
+	sortNameConst = "picture"
+	gsiNameConst  = "picture-code-index"
+	itemCount     = 25
+)
+
+type testObject struct {
+	Code    string `json:"code"`
+	Picture string `json:"picture,omitempty"`
+	Name    string `json:"name"`
+	Version int64  `json:"version"`
+}
+
+func (objectInst *testObject) CodeValue() string {
+	return objectInst.Code
+}
+
+func (objectInst *testObject) SortValue() string {
+	if len(objectInst.Picture) > 0 {
+		return objectInst.Picture
+	}
+
+	return objectInst.Code
+}
+
+func (objectInst *testObject) VersionValue() int64 {
+	return objectInst.Version
+}
+
+func (objectInst *testObject) SetVersion(version int64) {
+	objectInst.Version = version
+}
+
+func (objectInst *testObject) ToString() string {
+	return fmt.Sprintf("{code: %s, picture: %s, name: %s}", objectInst.Code, objectInst.Picture, objectInst.Name)
+}
+
+func (objectInst *testObject) FromJson(jsonInst []byte) error { return nil }
+func (objectInst *testObject) Print()                         {}
+func (objectInst *testObject) Put() error                     { return nil }
+func (objectInst *testObject) Delete() error                  { return nil }
+
+func (objectInst *testObject) WriteObject(writer http.ResponseWriter, request *http.Request) {}
+
+func testObjectFactory() *testObject {
+	return &testObject{}
+}
+
+// openMemory gives every test a database of its own.
+func openMemory(t *testing.T) {
+	if err := Open(":memory:"); err != nil {
+		t.Fatalf("Cannot open the in-memory database. Error: %v", err)
+	}
+
+	t.Cleanup(func() { Conn.Close() })
+}
+
+func newPlainAdapter(t *testing.T, keepCache bool) *Sqlite[*testObject] {
+	sqliteInst := &Sqlite[*testObject]{}
+	if err := sqliteInst.Config(tableConst, codeNameConst, keepCache, testObjectFactory, nil); err != nil {
+		t.Fatalf("Cannot configure the adapter. Error: %v", err)
+	}
+
+	return sqliteInst
+}
+
+func newSortAdapter(t *testing.T, keepCache bool) *Sqlite[*testObject] {
+	sqliteInst := &Sqlite[*testObject]{}
+	sqliteInst.SetSortName(sortNameConst)
+	sqliteInst.SetSortGSIName(gsiNameConst)
+	if err := sqliteInst.Config(tableConst, codeNameConst, keepCache, testObjectFactory, nil); err != nil {
+		t.Fatalf("Cannot configure the adapter. Error: %v", err)
+	}
+
+	return sqliteInst
+}
+
+func newObjectList(count int) []*testObject {
+	var objectList []*testObject
+
+	for index := 0; index < count; index++ {
+		objectList = append(objectList, &testObject{Code: "code" + strconv.Itoa(index), Name: "name" + strconv.Itoa(index)})
+	}
+
+	return objectList
+}
+
+func schemaNames(t *testing.T, schemaType string) []string {
+	var nameList []string
+
+	rows, err := Conn.Query("SELECT name FROM sqlite_master WHERE type = ? AND name NOT LIKE 'sqlite\\_%' ESCAPE '\\' ORDER BY name", schemaType)
+	if err != nil {
+		t.Fatalf("Cannot read the schema. Error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+
+		rows.Scan(&name)
+		nameList = append(nameList, name)
+	}
+
+	return nameList
+}
+
+func TestSchema(t *testing.T) {
+	openMemory(t)
+
+	t.Log("Config creates the table and the index of the sort values")
+	sqliteInst := newSortAdapter(t, true)
+	if tableList := schemaNames(t, "table"); fmt.Sprint(tableList) != "["+tableConst+"]" {
+		t.Errorf("Expected table %s, got %v", tableConst, tableList)
+	}
+	if indexList := schemaNames(t, "index"); fmt.Sprint(indexList) != "["+gsiNameConst+"]" {
+		t.Errorf("Expected index %s, got %v", gsiNameConst, indexList)
+	}
+
+	t.Log("The objects are found through the index of the sort values")
+	for _, objectInst := range []*testObject{{Code: "model1", Name: "model one"}, {Code: "model1", Picture: "pic1.png"}, {Code: "model2", Name: "model two"}, {Code: "model2", Picture: "pic1.png"}} {
+		if err := sqliteInst.PutObject(objectInst); err != nil {
+			t.Fatalf("Cannot put %s. Error: %v", objectInst.ToString(), err)
+		}
+	}
+
+	objectList, err := sqliteInst.GetObjectListBySort("pic1.png")
+	if err != nil || len(objectList) != 2 || objectList[0].Name != "model one" || objectList[1].Name != "model two" {
+		t.Errorf("Expected both models for pic1.png, got %v. Error: %v", objectList, err)
+	}
+
+	pictureList, err := sqliteInst.GetSortKeyList("model1")
+	if err != nil || fmt.Sprint(pictureList) != "[pic1.png]" {
+		t.Errorf("Expected the picture of model1, got %v. Error: %v", pictureList, err)
+	}
+
+	t.Log("Configuring the adapter again keeps the existing rows")
+	sqliteInst = newSortAdapter(t, true)
+	if objectList, err = sqliteInst.GetObjectList(); err != nil || len(objectList) != 2 {
+		t.Errorf("Expected the 2 models to be kept, got %v. Error: %v", objectList, err)
+	}
+}
+
+func TestVersionConflict(t *testing.T) {
+	var conflictErr *db.ConflictError
+
+	openMemory(t)
+
+	for _, keepCache := range []bool{true, false} {
+		t.Logf("Writes are checked against the stored version, keepCache %t", keepCache)
+		Conn.Exec("DROP TABLE IF EXISTS " + quote(tableConst))
+		sqliteInst := newPlainAdapter(t, keepCache)
+
+		firstInst := &testObject{Code: "code1", Name: "first"}
+		if err := sqliteInst.PutObject(firstInst); err != nil || firstInst.Version != 1 {
+			t.Fatalf("Expected the new object to get version 1, got %d. Error: %v", firstInst.Version, err)
+		}
+
+		staleInst := &testObject{Code: "code1", Name: "stale"}
+		err := sqliteInst.PutObject(staleInst)
+		if !errors.As(err, &conflictErr) || !errors.Is(err, db.ErrConflict) || conflictErr.Code != "code1" {
+			t.Errorf("Expected a conflict for version 0 of code1, got %v", err)
+		}
+		if staleInst.Version != 0 {
+			t.Errorf("Expected the version of the rejected object to be left at 0, got %d", staleInst.Version)
+		}
+
+		storedInst, err := sqliteInst.GetObjectByCode("code1")
+		if err != nil || storedInst.Name != "first" || storedInst.Version != 1 {
+			t.Errorf("Expected the first write to be kept, got %v. Error: %v", storedInst, err)
+		}
+
+		updateInst := &testObject{Code: "code1", Name: "second", Version: 1}
+		if err = sqliteInst.PutObject(updateInst); err != nil || updateInst.Version != 2 {
+			t.Errorf("Expected the update to get version 2, got %d. Error: %v", updateInst.Version, err)
+		}
+
+		t.Log("Lists are written as given, without checking the versions")
+		if err = sqliteInst.PutObjectList([]*testObject{{Code: "code1", Name: "restored", Version: 7}}); err != nil {
+			t.Errorf("Cannot put the list. Error: %v", err)
+		}
+		if storedInst, err = sqliteInst.GetObjectByCode("code1"); err != nil || storedInst.Version != 7 {
+			t.Errorf("Expected version 7 to be written as given, got %v. Error: %v", storedInst, err)
+		}
+	}
+}
+
+func TestGetObjectMapByCodes(t *testing.T) {
+	defer func(inQuerySize int) { InQuerySize = inQuerySize }(InQuerySize)
+	InQuerySize = 4
+
+	openMemory(t)
+	sqliteInst := newPlainAdapter(t, false)
+	if err := sqliteInst.PutObjectList(newObjectList(itemCount)); err != nil {
+		t.Fatalf("Cannot put the objects. Error: %v", err)
+	}
+
+	t.Log("Codes are looked up in several queries, duplicates and missing codes left out")
+	codeList := []string{"missing"}
+	for index := 0; index < itemCount; index += 2 {
+		codeList = append(codeList, "code"+strconv.Itoa(index), "code"+strconv.Itoa(index))
+	}
+
+	objectMap, err := sqliteInst.GetObjectMapByCodes(codeList)
+	if err != nil {
+		t.Fatalf("Cannot get the objects. Error: %v", err)
+	}
+
+	foundList := []string{}
+	for codeValue, objectInst := range objectMap {
+		if objectInst.Code != codeValue || objectInst.Name != "name"+codeValue[len("code"):] {
+			t.Errorf("Unexpected object %s for code %s", objectInst.ToString(), codeValue)
+		}
+		foundList = append(foundList, codeValue)
+	}
+
+	if len(foundList) != (itemCount+1)/2 {
+		sort.Strings(foundList)
+		t.Errorf("Expected %d objects, got %v", (itemCount+1)/2, foundList)
+	}
+
+	t.Log("The pictures of a table with sort values are not returned as objects")
+	Conn.Exec("DROP TABLE " + quote(tableConst))
+	sortInst := newSortAdapter(t, false)
+	sortInst.PutObject(&testObject{Code: "model1", Name: "model one"})
+	sortInst.PutObject(&testObject{Code: "model1", Picture: "pic1.png"})
+
+	objectMap, err = sortInst.GetObjectMapByCodes([]string{"model1"})
+	if err != nil || len(objectMap) != 1 || objectMap["model1"].Name != "model one" {
+		t.Errorf("Expected model1 alone, got %v. Error: %v", objectMap, err)
+	}
+}
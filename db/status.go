@@ -0,0 +1,14 @@
+package db
+
+import (
+	"time"
+)
+
+// AdapterStatus describes the cache of an adapter, for diagnostics. CacheTime is the time the
+// cache was last loaded, by Config or ResetCache, and is left out for adapters without one.
+type AdapterStatus struct {
+	TableName string     `json:"table"`
+	KeepCache bool       `json:"keepCache"`
+	CacheSize int        `json:"cacheSize"`
+	CacheTime *time.Time `json:"cacheTime,omitempty"`
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"strings"
+)
+
+//----------------------------------------------------------------------------------------
+// Stem reduces an English word to its stem with steps 1a to 1c of the Porter stemmer, which
+// take care of plurals and of the -ed and -ing forms, e.g. "liveries" and "livery" both
+// become "liveri" and "painted" becomes "paint". The word is expected in lower case.
+func Stem(word string) string {
+	if len(word) <= 2 || !isASCIIWord(word) {
+		return word
+	}
+
+	word = stemStep1a(word)
+	word = stemStep1b(word)
+	word = stemStep1c(word)
+
+	return word
+}
+
+//----------------------------------------------------------------------------------------
+func isASCIIWord(word string) bool {
+	for index := 0; index < len(word); index++ {
+		if word[index] < 'a' || word[index] > 'z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+//----------------------------------------------------------------------------------------
+// isConsonant follows the Porter definition, where y is a consonant unless it follows one.
+func isConsonant(word string, index int) bool {
+	switch word[index] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return index == 0 || !isConsonant(word, index-1)
+	}
+
+	return true
+}
+
+//----------------------------------------------------------------------------------------
+// measure counts the vowel-consonant sequences of stem, the m of the Porter algorithm.
+func measure(stem string) int {
+	count := 0
+	index := 0
+
+	for index < len(stem) && isConsonant(stem, index) {
+		index++
+	}
+
+	for index < len(stem) {
+		for index < len(stem) && !isConsonant(stem, index) {
+			index++
+		}
+
+		if index == len(stem) {
+			break
+		}
+
+		for index < len(stem) && isConsonant(stem, index) {
+			index++
+		}
+		count++
+	}
+
+	return count
+}
+
+//----------------------------------------------------------------------------------------
+func hasVowel(stem string) bool {
+	for index := range stem {
+		if !isConsonant(stem, index) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//----------------------------------------------------------------------------------------
+func endsWithDoubleConsonant(stem string) bool {
+	length := len(stem)
+
+	return length >= 2 && stem[length-1] == stem[length-2] && isConsonant(stem, length-1)
+}
+
+//----------------------------------------------------------------------------------------
+// endsWithCVC reports whether stem ends consonant-vowel-consonant, the last one not being
+// w, x or y, as in "hop" or "fil".
+func endsWithCVC(stem string) bool {
+	length := len(stem)
+	if length < 3 || !isConsonant(stem, length-3) || isConsonant(stem, length-2) || !isConsonant(stem, length-1) {
+		return false
+	}
+
+	lastChar := stem[length-1]
+
+	return lastChar != 'w' && lastChar != 'x' && lastChar != 'y'
+}
+
+//----------------------------------------------------------------------------------------
+func stemStep1a(word string) string {
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ies"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ss"):
+		return word
+	case strings.HasSuffix(word, "s"):
+		return word[:len(word)-1]
+	}
+
+	return word
+}
+
+//----------------------------------------------------------------------------------------
+func stemStep1b(word string) string {
+	var stem string
+
+	if strings.HasSuffix(word, "eed") {
+		if measure(word[:len(word)-3]) > 0 {
+			return word[:len(word)-1]
+		}
+
+		return word
+	}
+
+	if strings.HasSuffix(word, "ed") && hasVowel(word[:len(word)-2]) {
+		stem = word[:len(word)-2]
+	} else if strings.HasSuffix(word, "ing") && hasVowel(word[:len(word)-3]) {
+		stem = word[:len(word)-3]
+	} else {
+		return word
+	}
+
+	switch {
+	case strings.HasSuffix(stem, "at"), strings.HasSuffix(stem, "bl"), strings.HasSuffix(stem, "iz"):
+		return stem + "e"
+	case endsWithDoubleConsonant(stem):
+		lastChar := stem[len(stem)-1]
+		if lastChar != 'l' && lastChar != 's' && lastChar != 'z' {
+			return stem[:len(stem)-1]
+		}
+	case measure(stem) == 1 && endsWithCVC(stem):
+		return stem + "e"
+	}
+
+	return stem
+}
+
+//----------------------------------------------------------------------------------------
+func stemStep1c(word string) string {
+	if strings.HasSuffix(word, "y") && hasVowel(word[:len(word)-1]) {
+		return word[:len(word)-1] + "i"
+	}
+
+	return word
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Words too common to be worth indexing. They are dropped from queries as well, so that
+// "models with the old livery" is the same search as "models old livery".
+var stopWordMap = map[string]bool{
+	"a": true, "an": true, "and": true, "at": true, "by": true, "for": true, "from": true, "in": true,
+	"is": true, "of": true, "on": true, "or": true, "the": true, "to": true, "with": true,
+}
+
+type TextField struct {
+	Text   string
+	Weight float64
+}
+
+type TextMatch struct {
+	Code  string  `json:"code"`
+	Score float64 `json:"score"`
+}
+
+// TextIndex is an inverted index from word stems to the codes of the objects containing
+// them, weighted by the fields the words were found in. It is safe for concurrent use.
+type TextIndex struct {
+	lock sync.RWMutex
+
+	postingMap  map[string]map[string]float64
+	documentMap map[string][]string
+}
+
+//----------------------------------------------------------------------------------------
+func NewTextIndex() *TextIndex {
+	return &TextIndex{
+		postingMap:  make(map[string]map[string]float64),
+		documentMap: make(map[string][]string),
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// Size returns the number of documents indexed and of distinct terms found in them.
+func (indexInst *TextIndex) Size() (int, int) {
+	indexInst.lock.RLock()
+	defer indexInst.lock.RUnlock()
+
+	return len(indexInst.documentMap), len(indexInst.postingMap)
+}
+
+//----------------------------------------------------------------------------------------
+// TextTerms splits text into the stems that are indexed and searched for.
+func TextTerms(text string) []string {
+	var termList []string
+
+	for _, word := range Tokenize(text) {
+		if !stopWordMap[word] {
+			termList = append(termList, Stem(word))
+		}
+	}
+
+	return termList
+}
+
+//----------------------------------------------------------------------------------------
+// Update replaces whatever was indexed for code with the words of fieldList.
+func (indexInst *TextIndex) Update(code string, fieldList []TextField) {
+	weightMap := make(map[string]float64)
+
+	for _, field := range fieldList {
+		for _, term := range TextTerms(field.Text) {
+			weightMap[term] += field.Weight
+		}
+	}
+
+	indexInst.lock.Lock()
+	defer indexInst.lock.Unlock()
+
+	indexInst.remove(code)
+
+	termList := make([]string, 0, len(weightMap))
+	for term, weight := range weightMap {
+		if _, hasTerm := indexInst.postingMap[term]; !hasTerm {
+			indexInst.postingMap[term] = make(map[string]float64)
+		}
+
+		indexInst.postingMap[term][code] = weight
+		termList = append(termList, term)
+	}
+
+	indexInst.documentMap[code] = termList
+}
+
+//----------------------------------------------------------------------------------------
+func (indexInst *TextIndex) Remove(code string) {
+	indexInst.lock.Lock()
+	defer indexInst.lock.Unlock()
+
+	indexInst.remove(code)
+}
+
+//----------------------------------------------------------------------------------------
+// Replace makes the index hold the documents of builtInst at once, so that an index can be
+// rebuilt while it is being searched. builtInst must not be used afterwards.
+func (indexInst *TextIndex) Replace(builtInst *TextIndex) {
+	builtInst.lock.RLock()
+	postingMap, documentMap := builtInst.postingMap, builtInst.documentMap
+	builtInst.lock.RUnlock()
+
+	indexInst.lock.Lock()
+	defer indexInst.lock.Unlock()
+
+	indexInst.postingMap = postingMap
+	indexInst.documentMap = documentMap
+}
+
+//----------------------------------------------------------------------------------------
+// remove expects the lock to be held for writing.
+func (indexInst *TextIndex) remove(code string) {
+	for _, term := range indexInst.documentMap[code] {
+		delete(indexInst.postingMap[term], code)
+
+		if len(indexInst.postingMap[term]) == 0 {
+			delete(indexInst.postingMap, term)
+		}
+	}
+
+	delete(indexInst.documentMap, code)
+}
+
+//----------------------------------------------------------------------------------------
+// Search returns the codes of the objects containing every term of query, best matches
+// first. Each term scores its field weight times its inverse document frequency, so rare
+// words count for more than common ones.
+func (indexInst *TextIndex) Search(query string) []TextMatch {
+	matchList := []TextMatch{}
+
+	termList := TextTerms(query)
+	if len(termList) == 0 {
+		return matchList
+	}
+
+	indexInst.lock.RLock()
+	defer indexInst.lock.RUnlock()
+
+	documentCount := float64(len(indexInst.documentMap))
+	scoreMap := make(map[string]float64)
+
+	for position, term := range termList {
+		postingMap := indexInst.postingMap[term]
+		if len(postingMap) == 0 {
+			return matchList
+		}
+
+		idf := math.Log(1 + documentCount/float64(len(postingMap)))
+
+		// Only the codes matching all the previous terms are kept.
+		newScoreMap := make(map[string]float64)
+		for code, weight := range postingMap {
+			if score, isMatch := scoreMap[code]; isMatch || position == 0 {
+				newScoreMap[code] = score + weight*idf
+			}
+		}
+
+		scoreMap = newScoreMap
+	}
+
+	for code, score := range scoreMap {
+		matchList = append(matchList, TextMatch{Code: code, Score: score})
+	}
+
+	sort.Slice(matchList, func(i int, j int) bool {
+		if matchList[i].Score != matchList[j].Score {
+			return matchList[i].Score > matchList[j].Score
+		}
+
+		return matchList[i].Code < matchList[j].Code
+	})
+
+	return matchList
+}
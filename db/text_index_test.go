@@ -0,0 +1,107 @@
+package db
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	stemList := []struct {
+		word     string
+		expected string
+	}{
+		{"liveries", "liveri"},
+		{"livery", "liveri"},
+		{"painted", "paint"},
+		{"painting", "paint"},
+		{"hopping", "hop"},
+		{"filing", "file"},
+		{"agreed", "agree"},
+		{"caresses", "caress"},
+		{"retro", "retro"},
+		{"747", "747"},
+	}
+
+	for _, stemInst := range stemList {
+		if stem := Stem(stemInst.word); stem != stemInst.expected {
+			t.Errorf("Stem of %s expected to be %s but got %s", stemInst.word, stemInst.expected, stem)
+		}
+	}
+}
+
+func chkTextMatches(t *testing.T, indexInst *TextIndex, query string, expectedCodes ...string) {
+	matchList := indexInst.Search(query)
+
+	if len(matchList) != len(expectedCodes) {
+		t.Errorf("Search for %s expected %v but got %+v", query, expectedCodes, matchList)
+		return
+	}
+
+	for position, match := range matchList {
+		if match.Code != expectedCodes[position] {
+			t.Errorf("Search for %s expected %v but got %+v", query, expectedCodes, matchList)
+			return
+		}
+	}
+}
+
+func TestTextIndex(t *testing.T) {
+	indexInst := NewTextIndex()
+
+	indexInst.Update("model1", []TextField{{Text: "D-ABYT", Weight: 3}, {Text: "Retro livery, painted in 2015", Weight: 1}})
+	indexInst.Update("model2", []TextField{{Text: "G-CIVA", Weight: 3}, {Text: "Landor liveries and a retro tail", Weight: 1}, {Text: "British Airways", Weight: 2}})
+	indexInst.Update("model3", []TextField{{Text: "F-HPJA", Weight: 3}, {Text: "Standard colours", Weight: 1}})
+
+	t.Log("Words match regardless of their form and case")
+	chkTextMatches(t, indexInst, "RETRO", "model1", "model2")
+	chkTextMatches(t, indexInst, "livery", "model1", "model2")
+	chkTextMatches(t, indexInst, "the paintings", "model1")
+
+	t.Log("Every word of the query must match, in any field")
+	chkTextMatches(t, indexInst, "retro british", "model2")
+	chkTextMatches(t, indexInst, "retro unknown")
+
+	t.Log("Registrations are found whatever their punctuation")
+	chkTextMatches(t, indexInst, "d-abyt", "model1")
+	chkTextMatches(t, indexInst, "d abyt", "model1")
+
+	t.Log("Updating a document replaces its words")
+	indexInst.Update("model1", []TextField{{Text: "D-ABYT", Weight: 3}, {Text: "Current livery", Weight: 1}})
+	chkTextMatches(t, indexInst, "retro", "model2")
+	chkTextMatches(t, indexInst, "current", "model1")
+
+	t.Log("Removed documents are no longer found")
+	indexInst.Remove("model2")
+	chkTextMatches(t, indexInst, "retro")
+	chkTextMatches(t, indexInst, "")
+}
+
+// TestReplace is meant to be run with the race detector (go test -race).
+func TestReplace(t *testing.T) {
+	var waitGroup sync.WaitGroup
+
+	indexInst := NewTextIndex()
+	indexInst.Update("model1", []TextField{{Text: "old livery", Weight: 1}})
+
+	t.Log("An index can be searched while it is being replaced")
+	for index := 0; index < 8; index++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for search := 0; search < 100; search++ {
+				indexInst.Search("livery")
+				indexInst.Size()
+			}
+		}()
+	}
+
+	for index := 0; index < 10; index++ {
+		builtInst := NewTextIndex()
+		builtInst.Update("model2", []TextField{{Text: "new livery", Weight: 1}})
+		indexInst.Replace(builtInst)
+	}
+	waitGroup.Wait()
+
+	chkTextMatches(t, indexInst, "old")
+	chkTextMatches(t, indexInst, "new", "model2")
+}
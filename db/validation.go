@@ -0,0 +1,57 @@
+package db
+
+import (
+	"colmanback/objects"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validation collects the field errors found while validating an object, so that all of
+// them are reported at once.
+type Validation struct {
+	fieldErrors []FieldError
+	err         error
+}
+
+//----------------------------------------------------------------------------------------
+func (validationInst *Validation) AddError(field string, message string) {
+	validationInst.fieldErrors = append(validationInst.fieldErrors, FieldError{Field: field, Message: message})
+}
+
+//----------------------------------------------------------------------------------------
+func (validationInst *Validation) Require(field string, value string) {
+	if strings.TrimSpace(value) == "" {
+		validationInst.AddError(field, "is required")
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// CheckRef adds an error for field unless code is empty or getter finds an object with it.
+// Errors other than not found abort the validation, as they say nothing about the object.
+func CheckRef[K objects.Object](validationInst *Validation, field string, code string, getter func(string) (K, error)) {
+	if code == "" || validationInst.err != nil {
+		return
+	}
+
+	_, err := getter(code)
+	if errors.Is(err, ErrNotFound) {
+		validationInst.AddError(field, fmt.Sprintf("no object with code %s exists", code))
+	} else if err != nil {
+		validationInst.err = err
+	}
+}
+
+//----------------------------------------------------------------------------------------
+// Result returns nil if no error has been found, or the error to be returned by Validate.
+func (validationInst *Validation) Result() error {
+	if validationInst.err != nil {
+		return validationInst.err
+	}
+
+	if len(validationInst.fieldErrors) > 0 {
+		return &InvalidObjectError{FieldErrors: validationInst.fieldErrors}
+	}
+
+	return nil
+}
@@ -3,8 +3,12 @@ module colmanback
 go 1.18
 
 require (
-	github.com/aws/aws-sdk-go v1.44.162 // indirect
-	github.com/google/uuid v1.3.0 // indirect
-	github.com/gorilla/mux v1.8.0 // indirect
-	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/aws/aws-sdk-go v1.44.162
+	github.com/google/uuid v1.3.0
+	github.com/gorilla/mux v1.8.0
+	github.com/mattn/go-sqlite3 v1.14.16
+	golang.org/x/text v0.4.0
+	gopkg.in/yaml.v2 v2.2.8
 )
+
+require github.com/jmespath/go-jmespath v0.4.0 // indirect
@@ -1,11 +1,25 @@
 package main
 
-import "colmanback/app"
+import (
+	"colmanback/app"
+	"colmanback/config"
+	"errors"
+	"flag"
+	"log"
+	"os"
+)
 
 //----------------------------------------------------------------------------------------
 func main() {
-	appInst := app.App{}
+	configInst, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 
-	appInst.Port = ":8081"
+	if err != nil {
+		log.Fatalf("Cannot load the config. Error: %v", err)
+	}
+
+	appInst := app.App{Config: *configInst}
 	appInst.Serve()
 }
@@ -3,15 +3,15 @@ package airline
 import (
 	"colmanback/api_util"
 	"colmanback/db"
-	"colmanback/db/dyno"
+	"colmanback/db/factory"
 	"colmanback/objects/country"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 )
 
 const (
+	TABLE_NAME  = "airline"
 	ICAO_PREFIX = "icao:"
 	IATA_PREFIX = "iata:"
 )
@@ -23,20 +23,27 @@ type Airline struct {
 	Icao        string           `json:"icao"`
 	Callsign    string           `json:"callsign"`
 	Country     string           `json:"country"`
+	Version     int64            `json:"version"`
 	CountryInst *country.Country `json:"countryDetails,omitempty"`
+	BrokenRefs  []db.Reference   `json:"brokenRefs,omitempty"`
 }
 
 var AdapterInst db.Adapter[*Airline]
 
+// ExpandFields are the references whose details Expand can attach.
+var ExpandFields = []string{"country"}
+
 //----------------------------------------------------------------------------------------
-func (airlineInst *Airline) makeCode() {
+func (airlineInst *Airline) makeCode() error {
 	if airlineInst.Iata != "" {
 		airlineInst.Code = IATA_PREFIX + airlineInst.Iata
 	} else if airlineInst.Icao != "" {
 		airlineInst.Code = ICAO_PREFIX + airlineInst.Icao
 	} else {
-		log.Panicf("Cannot make code for the following airline instance: %s", airlineInst.ToString())
+		return &db.ValidationError{Message: "cannot make a code for an airline without iata or icao code"}
 	}
+
+	return nil
 }
 
 //----------------------------------------------------------------------------------------
@@ -50,8 +57,18 @@ func (airlineInst *Airline) SortValue() string {
 }
 
 //----------------------------------------------------------------------------------------
-func (airlineInst *Airline) FromJson(jsonInst []byte) {
-	db.FromJson(airlineInst, jsonInst)
+func (airlineInst *Airline) VersionValue() int64 {
+	return airlineInst.Version
+}
+
+//----------------------------------------------------------------------------------------
+func (airlineInst *Airline) SetVersion(version int64) {
+	airlineInst.Version = version
+}
+
+//----------------------------------------------------------------------------------------
+func (airlineInst *Airline) FromJson(jsonInst []byte) error {
+	return db.FromJson(airlineInst, jsonInst)
 }
 
 //----------------------------------------------------------------------------------------
@@ -85,22 +102,47 @@ func (airlineInst *Airline) WriteObject(writer http.ResponseWriter, request *htt
 }
 
 //----------------------------------------------------------------------------------------
-func (airlineInst *Airline) Delete() {
-	AdapterInst.DeleteObject(airlineInst)
+func (airlineInst *Airline) Delete() error {
+	return AdapterInst.DeleteObject(airlineInst)
 }
 
 //----------------------------------------------------------------------------------------
-func (airlineInst *Airline) Put() {
-	countryInst := airlineInst.CountryInst
-
+// Put stores a copy of the airline without its details, then refreshes the objects
+// referencing it, as they may show its name.
+func (airlineInst *Airline) Put() error {
 	if airlineInst.Code == "" {
-		airlineInst.makeCode()
+		err := airlineInst.makeCode()
+		if err != nil {
+			return err
+		}
+	}
+
+	storedInst := *airlineInst
+	storedInst.CountryInst = nil
+	storedInst.BrokenRefs = nil
+
+	err := AdapterInst.PutObject(&storedInst)
+	if err != nil {
+		return err
+	}
+	airlineInst.Version = storedInst.Version
+
+	db.RefreshReferrers(TABLE_NAME, airlineInst.Code)
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (airlineInst *Airline) Validate() error {
+	var validationInst db.Validation
+
+	validationInst.Require("name", airlineInst.Name)
+	if airlineInst.Iata == "" && airlineInst.Icao == "" {
+		validationInst.AddError("iata", "either iata or icao is required")
 	}
 
-	airlineInst.CountryInst = nil
-	AdapterInst.PutObject(airlineInst)
+	db.CheckRef(&validationInst, "country", airlineInst.Country, country.AdapterInst.GetObjectByCode)
 
-	airlineInst.CountryInst = countryInst
+	return validationInst.Result()
 }
 
 //----------------------------------------------------------------------------------------
@@ -111,15 +153,12 @@ func ObjectFactory() *Airline {
 }
 
 //----------------------------------------------------------------------------------------
+// InitRefObjs loads the referenced country. If it does not exist, it is listed in BrokenRefs.
 func (airlineInst *Airline) InitRefObjs() {
-	var err error
+	var brokenRefList []db.Reference
 
-	if len(airlineInst.Country) != 0 {
-		airlineInst.CountryInst, err = country.GetCountryByISO(airlineInst.Country)
-		if err != nil {
-			panic(fmt.Sprintf("Error initialising country with code %s for model %s", airlineInst.Country, airlineInst.Code))
-		}
-	}
+	airlineInst.CountryInst = db.ResolveRef(&brokenRefList, country.TABLE_NAME, "country", airlineInst.Country, country.GetCountryByISO)
+	airlineInst.BrokenRefs = brokenRefList
 }
 
 //----------------------------------------------------------------------------------------
@@ -145,6 +184,93 @@ func getAirlineByCodeIntl(code string) (*Airline, error) {
 	return AdapterInst.GetObjectByCode(code)
 }
 
+//----------------------------------------------------------------------------------------
+// Expand returns copies of the airlines of airlineList with the details of the references in
+// fieldList attached and those of the others left out. Each kind of referenced object is
+// fetched once for the whole list. BrokenRefs lists the expanded references that do not exist.
+func Expand(airlineList []*Airline, fieldList []string) ([]*Airline, error) {
+	countryMap, err := db.FetchRefMap(airlineList, fieldList, "country", func(airlineInst *Airline) string { return airlineInst.Country }, country.AdapterInst.GetObjectMapByCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	expandedList := make([]*Airline, 0, len(airlineList))
+	for _, airlineInst := range airlineList {
+		var brokenRefList []db.Reference
+
+		airlineCopy := *airlineInst
+		airlineCopy.CountryInst = db.AttachRef(&brokenRefList, countryMap, country.TABLE_NAME, "country", airlineInst.Country)
+		airlineCopy.BrokenRefs = brokenRefList
+
+		expandedList = append(expandedList, &airlineCopy)
+	}
+
+	return expandedList, nil
+}
+
+//----------------------------------------------------------------------------------------
+// GetMapByCodes returns the airlines with the codes of codeList, keyed by the code asked for.
+// As with GetByCode, codes without prefix that are not found are looked up as IATA and then
+// as ICAO codes, one batch per prefix.
+func GetMapByCodes(codeList []string) (map[string]*Airline, error) {
+	airlineMap, err := AdapterInst.GetObjectMapByCodes(codeList)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, prefix := range []string{IATA_PREFIX, ICAO_PREFIX} {
+		var prefixedList []string
+		codeMap := make(map[string]string)
+
+		for _, code := range db.DistinctCodes(codeList) {
+			if _, isFound := airlineMap[code]; !isFound && !strings.HasPrefix(code, IATA_PREFIX) && !strings.HasPrefix(code, ICAO_PREFIX) {
+				prefixedList = append(prefixedList, prefix+code)
+				codeMap[prefix+code] = code
+			}
+		}
+
+		if len(prefixedList) == 0 {
+			break
+		}
+
+		prefixedMap, err := AdapterInst.GetObjectMapByCodes(prefixedList)
+		if err != nil {
+			return nil, err
+		}
+
+		for prefixedCode, airlineInst := range prefixedMap {
+			airlineMap[codeMap[prefixedCode]] = airlineInst
+		}
+	}
+
+	return airlineMap, nil
+}
+
+//----------------------------------------------------------------------------------------
+// GetBrokenRefList returns the airlines referencing objects that do not exist, with
+// BrokenRefs set.
+func GetBrokenRefList() ([]*Airline, error) {
+	brokenList := []*Airline{}
+
+	airlineList, err := AdapterInst.GetObjectList()
+	if err != nil {
+		return nil, err
+	}
+
+	expandedList, err := Expand(airlineList, ExpandFields)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, airlineInst := range expandedList {
+		if len(airlineInst.BrokenRefs) > 0 {
+			brokenList = append(brokenList, airlineInst)
+		}
+	}
+
+	return brokenList, nil
+}
+
 //----------------------------------------------------------------------------------------
 func GetByCode(code string) (*Airline, error) {
 	var searchErr error = nil
@@ -162,7 +288,7 @@ func GetByCode(code string) (*Airline, error) {
 				airlineInst, apiErr = getAirlineByCodeIntl(icaoCode)
 
 				if apiErr != nil {
-					searchErr = fmt.Errorf("airline with code %s could not be found", code)
+					searchErr = &db.NotFoundError{TableName: TABLE_NAME, Code: code}
 				}
 			}
 		} else {
@@ -170,15 +296,18 @@ func GetByCode(code string) (*Airline, error) {
 		}
 	}
 
-	if airlineInst != nil {
-		airlineInst.InitRefObjs()
+	if airlineInst == nil {
+		return nil, searchErr
 	}
 
-	return airlineInst, searchErr
+	airlineCopy := *airlineInst
+	airlineCopy.InitRefObjs()
+
+	return &airlineCopy, searchErr
 }
 
 //----------------------------------------------------------------------------------------
-func LoadAirlineList(airlineList []Airline) {
+func LoadAirlineList(airlineList []Airline) error {
 	var airlinePointerList []*Airline = []*Airline{}
 	var countryList []*country.Country
 	var countryMap map[string]string = make(map[string]string)
@@ -186,7 +315,7 @@ func LoadAirlineList(airlineList []Airline) {
 
 	countryList, err = country.GetCountryList()
 	if err != nil {
-		log.Fatalf("cannot load the list of countries whilst loading airline list. Error: %v", err)
+		return fmt.Errorf("cannot load the list of countries whilst loading airline list. Error: %w", err)
 	}
 
 	for _, countryInst := range countryList {
@@ -211,12 +340,43 @@ func LoadAirlineList(airlineList []Airline) {
 		airlinePointerList = append(airlinePointerList, airlineNewInst)
 	}
 
-	AdapterInst.PutObjectList(airlinePointerList)
+	return AdapterInst.PutObjectList(airlinePointerList)
+}
+
+//----------------------------------------------------------------------------------------
+func InitConn() error {
+	adapterInstAirline := factory.NewAdapter[*Airline]()
+	err := adapterInstAirline.Config(TABLE_NAME, "code", true, ObjectFactory, GetCacheMap)
+	AdapterInst = adapterInstAirline
+
+	db.RegisterReferrer(country.TABLE_NAME, db.Referrer{
+		TableName: TABLE_NAME,
+		Field:     "country",
+		FindCodes: func(code string) ([]string, error) {
+			return db.FindReferrerCodes(AdapterInst, func(airlineInst *Airline) bool { return airlineInst.Country == code })
+		},
+		Reassign: func(airlineCode string, newCode string) error {
+			return reassign(airlineCode, func(airlineInst *Airline) { airlineInst.Country = newCode })
+		},
+		Delete: func(airlineCode string) error {
+			return AdapterInst.DeleteObjectByCode(airlineCode)
+		},
+	})
+
+	return err
 }
 
 //----------------------------------------------------------------------------------------
-func InitConn() {
-	dynoInstAirline := &dyno.Dyno[*Airline]{}
-	dynoInstAirline.Config("airline", "code", true, ObjectFactory, GetCacheMap)
-	AdapterInst = dynoInstAirline
+// reassign stores a copy of the airline with code changed by update.
+func reassign(code string, update func(*Airline)) error {
+	airlineInst, err := AdapterInst.GetObjectByCode(code)
+	if err != nil {
+		return err
+	}
+
+	newAirlineInst := *airlineInst
+	newAirlineInst.CountryInst = nil
+	update(&newAirlineInst)
+
+	return newAirlineInst.Put()
 }
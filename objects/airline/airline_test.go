@@ -1,13 +1,12 @@
 package airline
 
 import (
-	"colmanback/db/dyno"
+	"colmanback/db"
+	"colmanback/objects/country"
 	"colmanback/test_util"
 	"fmt"
+	"sync"
 	"testing"
-
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 const (
@@ -20,12 +19,13 @@ const (
 	countryConst  = "gb"
 )
 
-func initDyno() {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+func initDB() {
+	test_util.InitDB()
 
-	dyno.Conn = dynamodb.New(sess)
+	country.InitConn()
+	if test_util.IsMemoryDB() {
+		country.LoadCountryList([]country.Country{{Code: countryConst, Continent: "Europe", Name: "United Kingdom"}})
+	}
 
 	InitConn()
 }
@@ -39,8 +39,22 @@ func chkAirline(t *testing.T, airlineInst *Airline) {
 	test_util.CheckField(t, "country", countryConst, airlineInst.Country)
 }
 
+func chkSearch(t *testing.T, tag string, expectFound bool) {
+	isFound := false
+
+	for _, cacheMapElement := range db.SearchCacheMap(tag) {
+		if cacheMapElement.Code == codeConst && cacheMapElement.Tag == tag {
+			isFound = true
+		}
+	}
+
+	if isFound != expectFound {
+		t.Errorf("Search for tag %s expected to find the airline: %v, found: %v", tag, expectFound, isFound)
+	}
+}
+
 func testSetup(t *testing.T) {
-	initDyno()
+	initDB()
 
 	objectInst, _ := GetByCode(codeConst)
 
@@ -79,6 +93,11 @@ func TestAirplane(t *testing.T) {
 	}
 	chkAirline(t, airlineRetrInst)
 
+	t.Log("The new airline can be found by name and codes")
+	chkSearch(t, nameConst, true)
+	chkSearch(t, iataConst, true)
+	chkSearch(t, icaoConst, true)
+
 	t.Log("Update, put again and retrieve")
 	airlineRetrInst.Name = nameNewConst
 	airlineRetrInst.Put()
@@ -88,6 +107,10 @@ func TestAirplane(t *testing.T) {
 	}
 	test_util.CheckField(t, "name", nameNewConst, airlineUpdtInst.Name)
 
+	t.Log("The airline is found by its new name only")
+	chkSearch(t, nameNewConst, true)
+	chkSearch(t, nameConst, false)
+
 	t.Log("Delete and check it's gone!")
 	airlineUpdtInst.Delete()
 	airlineEmptyInst, getEmptyErr := GetByCode(codeConst)
@@ -95,6 +118,50 @@ func TestAirplane(t *testing.T) {
 		t.Errorf("Error for unexistent object not produced when expected. Perhaps the object still exists?\n")
 	}
 	test_util.CheckField(t, "name", "", airlineEmptyInst.Name)
+	chkSearch(t, nameNewConst, false)
+	chkSearch(t, iataConst, false)
 
 	t.Log("Test for airline has finished.")
 }
+
+func TestGetByCodeConcurrent(t *testing.T) {
+	if AdapterInst == nil {
+		testSetup(t)
+	}
+
+	airlineInst := &Airline{Code: "iata:rr", Name: "test_race", Iata: "rr", Country: countryConst}
+	if err := airlineInst.Put(); err != nil {
+		t.Fatalf("Cannot put airline %s. Error: %v", airlineInst.Code, err)
+	}
+	defer AdapterInst.DeleteObjectByCode(airlineInst.Code)
+
+	t.Log("Concurrent gets resolve the country on their own copies")
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			for j := 0; j < 50; j++ {
+				airlineRetrInst, err := GetByCode("iata:rr")
+				if err != nil || airlineRetrInst.CountryInst == nil || airlineRetrInst.CountryInst.Code != countryConst {
+					t.Errorf("Expected airline iata:rr with its country, got %+v. Error: %v", airlineRetrInst, err)
+					return
+				}
+			}
+		}()
+	}
+	waitGroup.Wait()
+
+	t.Log("Neither gets nor puts attach the details to the cached airline")
+	airlineRetrInst, _ := GetByCode("rr")
+	airlineRetrInst.Name = "test_race_2"
+	if err := airlineRetrInst.Put(); err != nil || airlineRetrInst.CountryInst == nil {
+		t.Errorf("Expected the put airline to keep its country. Error: %v", err)
+	}
+
+	cachedInst, _ := AdapterInst.GetObjectByCode("iata:rr")
+	if cachedInst.CountryInst != nil || cachedInst.BrokenRefs != nil || cachedInst.Name != "test_race_2" {
+		t.Errorf("Expected the stored airline without details, got %+v", cachedInst)
+	}
+}
@@ -3,7 +3,7 @@ package airplane
 import (
 	"colmanback/api_util"
 	"colmanback/db"
-	"colmanback/db/dyno"
+	"colmanback/db/factory"
 	"colmanback/objects/airplanemake"
 	"fmt"
 	"net/http"
@@ -12,17 +12,26 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
+const (
+	TABLE_NAME = "airplane"
+)
+
 type Airplane struct {
-	Code     string                     `json:"code"`
-	Name     string                     `json:"name"`
-	Iata     string                     `json:"iata"`
-	Icao     string                     `json:"icao"`
-	Make     string                     `json:"make"`
-	MakeInst *airplanemake.AirplaneMake `json:"makeDetails,omitempty"`
+	Code       string                     `json:"code"`
+	Name       string                     `json:"name"`
+	Iata       string                     `json:"iata"`
+	Icao       string                     `json:"icao"`
+	Make       string                     `json:"make"`
+	Version    int64                      `json:"version"`
+	MakeInst   *airplanemake.AirplaneMake `json:"makeDetails,omitempty"`
+	BrokenRefs []db.Reference             `json:"brokenRefs,omitempty"`
 }
 
 var AdapterInst db.Adapter[*Airplane]
 
+// ExpandFields are the references whose details Expand can attach.
+var ExpandFields = []string{"make"}
+
 //----------------------------------------------------------------------------------------
 func (airplaneInst *Airplane) CodeValue() string {
 	return airplaneInst.Code
@@ -33,6 +42,16 @@ func (airplaneInst *Airplane) SortValue() string {
 	return ""
 }
 
+//----------------------------------------------------------------------------------------
+func (airplaneInst *Airplane) VersionValue() int64 {
+	return airplaneInst.Version
+}
+
+//----------------------------------------------------------------------------------------
+func (airplaneInst *Airplane) SetVersion(version int64) {
+	airplaneInst.Version = version
+}
+
 //----------------------------------------------------------------------------------------
 func (airplaneInst *Airplane) ToString() string {
 	str := fmt.Sprintf(`
@@ -52,8 +71,8 @@ func (airplaneInst *Airplane) ToString() string {
 }
 
 //----------------------------------------------------------------------------------------
-func (airplaneInst *Airplane) FromJson(jsonInst []byte) {
-	db.FromJson(airplaneInst, jsonInst)
+func (airplaneInst *Airplane) FromJson(jsonInst []byte) error {
+	return db.FromJson(airplaneInst, jsonInst)
 }
 
 //----------------------------------------------------------------------------------------
@@ -75,18 +94,37 @@ func GetCacheMap(airplaneList []*Airplane) []db.CacheMapElement {
 }
 
 //----------------------------------------------------------------------------------------
-func (airplaneInst *Airplane) Put() {
-	makeInst := airplaneInst.MakeInst
+// Put stores a copy of the airplane without its details, then refreshes the objects
+// referencing it, as they may show its name.
+func (airplaneInst *Airplane) Put() error {
+	storedInst := *airplaneInst
+	storedInst.MakeInst = nil
+	storedInst.BrokenRefs = nil
+
+	err := AdapterInst.PutObject(&storedInst)
+	if err != nil {
+		return err
+	}
+	airplaneInst.Version = storedInst.Version
+
+	db.RefreshReferrers(TABLE_NAME, airplaneInst.Code)
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (airplaneInst *Airplane) Validate() error {
+	var validationInst db.Validation
 
-	airplaneInst.MakeInst = nil
-	AdapterInst.PutObject(airplaneInst)
+	validationInst.Require("code", airplaneInst.Code)
+	validationInst.Require("name", airplaneInst.Name)
+	db.CheckRef(&validationInst, "make", airplaneInst.Make, airplanemake.AdapterInst.GetObjectByCode)
 
-	airplaneInst.MakeInst = makeInst
+	return validationInst.Result()
 }
 
 //----------------------------------------------------------------------------------------
-func (airplaneInst *Airplane) Delete() {
-	AdapterInst.DeleteObject(airplaneInst)
+func (airplaneInst *Airplane) Delete() error {
+	return AdapterInst.DeleteObject(airplaneInst)
 }
 
 //----------------------------------------------------------------------------------------
@@ -95,15 +133,12 @@ func (airplaneInst *Airplane) WriteObject(writer http.ResponseWriter, request *h
 }
 
 //----------------------------------------------------------------------------------------
+// InitRefObjs loads the referenced make. If it does not exist, it is listed in BrokenRefs.
 func (airplaneInst *Airplane) InitRefObjs() {
-	var err error
+	var brokenRefList []db.Reference
 
-	if len(airplaneInst.Make) != 0 {
-		airplaneInst.MakeInst, err = airplanemake.GetByCode(airplaneInst.Make)
-		if err != nil {
-			panic(fmt.Sprintf("Error initialising airplane make with code %s for airplane %s", airplaneInst.Make, airplaneInst.Code))
-		}
-	}
+	airplaneInst.MakeInst = db.ResolveRef(&brokenRefList, airplanemake.TABLE_NAME, "make", airplaneInst.Make, airplanemake.GetByCode)
+	airplaneInst.BrokenRefs = brokenRefList
 }
 
 //----------------------------------------------------------------------------------------
@@ -111,25 +146,87 @@ func GetList() ([]*Airplane, error) {
 	return AdapterInst.GetObjectList()
 }
 
+//----------------------------------------------------------------------------------------
+// expandMakes attaches all the details of the airplane makes of makeList.
+func expandMakes(makeList []*airplanemake.AirplaneMake) ([]*airplanemake.AirplaneMake, error) {
+	return airplanemake.Expand(makeList, airplanemake.ExpandFields)
+}
+
+//----------------------------------------------------------------------------------------
+// Expand returns copies of the airplanes of airplaneList with the details of the references
+// in fieldList attached and those of the others left out. Each kind of referenced object is
+// fetched once for the whole list, and the makes come with their own details. BrokenRefs
+// lists the expanded references that do not exist.
+func Expand(airplaneList []*Airplane, fieldList []string) ([]*Airplane, error) {
+	makeMap, err := db.FetchRefMap(airplaneList, fieldList, "make", func(airplaneInst *Airplane) string { return airplaneInst.Make }, airplanemake.AdapterInst.GetObjectMapByCodes)
+	if err == nil {
+		makeMap, err = db.ExpandRefMap(makeMap, expandMakes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	expandedList := make([]*Airplane, 0, len(airplaneList))
+	for _, airplaneInst := range airplaneList {
+		var brokenRefList []db.Reference
+
+		airplaneCopy := *airplaneInst
+		airplaneCopy.MakeInst = db.AttachRef(&brokenRefList, makeMap, airplanemake.TABLE_NAME, "make", airplaneInst.Make)
+		airplaneCopy.BrokenRefs = brokenRefList
+
+		expandedList = append(expandedList, &airplaneCopy)
+	}
+
+	return expandedList, nil
+}
+
+//----------------------------------------------------------------------------------------
+// GetBrokenRefList returns the airplanes referencing objects that do not exist, with
+// BrokenRefs set.
+func GetBrokenRefList() ([]*Airplane, error) {
+	brokenList := []*Airplane{}
+
+	airplaneList, err := AdapterInst.GetObjectList()
+	if err != nil {
+		return nil, err
+	}
+
+	expandedList, err := Expand(airplaneList, ExpandFields)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, airplaneInst := range expandedList {
+		if len(airplaneInst.BrokenRefs) > 0 {
+			brokenList = append(brokenList, airplaneInst)
+		}
+	}
+
+	return brokenList, nil
+}
+
 //----------------------------------------------------------------------------------------
 func GetByCode(code string) (*Airplane, error) {
 	airplaneInst, err := AdapterInst.GetObjectByCode(code)
-
-	if airplaneInst != nil {
-		airplaneInst.InitRefObjs()
+	if airplaneInst == nil {
+		return nil, err
 	}
 
-	return airplaneInst, err
+	airplaneCopy := *airplaneInst
+	airplaneCopy.InitRefObjs()
+
+	return &airplaneCopy, err
 }
 
 //----------------------------------------------------------------------------------------
-func LoadAirplaneList(svc *dynamodb.DynamoDB, airplaneList []Airplane) {
+func LoadAirplaneList(svc *dynamodb.DynamoDB, airplaneList []Airplane) error {
 	var airplanePointerList []*Airplane = []*Airplane{}
 	var airplaneMakeMap map[string]string = make(map[string]string)
 
 	airplaneMakeList, err := airplanemake.GetList()
 	if err != nil {
-		panic("Error getting airplaneMakeList")
+		return fmt.Errorf("cannot load the list of airplane makes whilst loading airplane list. Error: %w", err)
 	}
 
 	for _, airplaneMake := range airplaneMakeList {
@@ -150,7 +247,7 @@ func LoadAirplaneList(svc *dynamodb.DynamoDB, airplaneList []Airplane) {
 		airplanePointerList = append(airplanePointerList, &newAirplaneInst)
 	}
 
-	AdapterInst.PutObjectList(airplanePointerList)
+	return AdapterInst.PutObjectList(airplanePointerList)
 }
 
 //----------------------------------------------------------------------------------------
@@ -161,8 +258,39 @@ func ObjectFactory() *Airplane {
 }
 
 //----------------------------------------------------------------------------------------
-func InitConn() {
-	dynoInstAirline := &dyno.Dyno[*Airplane]{}
-	dynoInstAirline.Config("airplane", "code", true, ObjectFactory, GetCacheMap)
-	AdapterInst = dynoInstAirline
+func InitConn() error {
+	adapterInstAirplane := factory.NewAdapter[*Airplane]()
+	err := adapterInstAirplane.Config(TABLE_NAME, "code", true, ObjectFactory, GetCacheMap)
+	AdapterInst = adapterInstAirplane
+
+	db.RegisterReferrer(airplanemake.TABLE_NAME, db.Referrer{
+		TableName: TABLE_NAME,
+		Field:     "make",
+		FindCodes: func(code string) ([]string, error) {
+			return db.FindReferrerCodes(AdapterInst, func(airplaneInst *Airplane) bool { return airplaneInst.Make == code })
+		},
+		Reassign: func(airplaneCode string, newCode string) error {
+			return reassign(airplaneCode, func(airplaneInst *Airplane) { airplaneInst.Make = newCode })
+		},
+		Delete: func(airplaneCode string) error {
+			return AdapterInst.DeleteObjectByCode(airplaneCode)
+		},
+	})
+
+	return err
+}
+
+//----------------------------------------------------------------------------------------
+// reassign stores a copy of the airplane with code changed by update.
+func reassign(code string, update func(*Airplane)) error {
+	airplaneInst, err := AdapterInst.GetObjectByCode(code)
+	if err != nil {
+		return err
+	}
+
+	newAirplaneInst := *airplaneInst
+	newAirplaneInst.MakeInst = nil
+	update(&newAirplaneInst)
+
+	return newAirplaneInst.Put()
 }
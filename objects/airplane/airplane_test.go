@@ -1,13 +1,10 @@
 package airplane
 
 import (
-	"colmanback/db/dyno"
+	"colmanback/objects/airplanemake"
 	"colmanback/test_util"
 	"fmt"
 	"testing"
-
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 const (
@@ -27,18 +24,19 @@ func chkObject(t *testing.T, objectInst *Airplane) {
 	test_util.CheckField(t, "make", makeConst, objectInst.Make)
 }
 
-func initDyno() {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+func initDB() {
+	test_util.InitDB()
 
-	dyno.Conn = dynamodb.New(sess)
+	airplanemake.InitConn()
+	if test_util.IsMemoryDB() {
+		airplanemake.LoadList([]airplanemake.AirplaneMake{{Code: makeConst, Name: makeConst}})
+	}
 
 	InitConn()
 }
 
 func testSetup(t *testing.T) {
-	initDyno()
+	initDB()
 
 	objectInst, _ := GetByCode(codeConst)
 
@@ -3,22 +3,31 @@ package airplanemake
 import (
 	"colmanback/api_util"
 	"colmanback/db"
-	"colmanback/db/dyno"
+	"colmanback/db/factory"
 	"colmanback/objects/country"
 	"fmt"
 	"net/http"
 )
 
+const (
+	TABLE_NAME = "airplanemake"
+)
+
 type AirplaneMake struct {
 	Code         string           `json:"code"`
 	Name         string           `json:"name"`
 	Abbreviation string           `json:"abbreviation"`
 	Country      string           `json:"country"`
+	Version      int64            `json:"version"`
 	CountryInst  *country.Country `json:"countryDetails,omitempty"`
+	BrokenRefs   []db.Reference   `json:"brokenRefs,omitempty"`
 }
 
 var AdapterInst db.Adapter[*AirplaneMake]
 
+// ExpandFields are the references whose details Expand can attach.
+var ExpandFields = []string{"country"}
+
 //----------------------------------------------------------------------------------------
 func (airplaneMakeInst *AirplaneMake) CodeValue() string {
 	return airplaneMakeInst.Code
@@ -30,8 +39,18 @@ func (airplaneMakeInst *AirplaneMake) SortValue() string {
 }
 
 //----------------------------------------------------------------------------------------
-func (airplaneMakeInst *AirplaneMake) FromJson(jsonInst []byte) {
-	db.FromJson(airplaneMakeInst, jsonInst)
+func (airplaneMakeInst *AirplaneMake) VersionValue() int64 {
+	return airplaneMakeInst.Version
+}
+
+//----------------------------------------------------------------------------------------
+func (airplaneMakeInst *AirplaneMake) SetVersion(version int64) {
+	airplaneMakeInst.Version = version
+}
+
+//----------------------------------------------------------------------------------------
+func (airplaneMakeInst *AirplaneMake) FromJson(jsonInst []byte) error {
+	return db.FromJson(airplaneMakeInst, jsonInst)
 }
 
 //----------------------------------------------------------------------------------------
@@ -61,25 +80,36 @@ func (airplaneMakeInst *AirplaneMake) WriteObject(writer http.ResponseWriter, re
 }
 
 //----------------------------------------------------------------------------------------
-func (airplaneMakeInst *AirplaneMake) Put() {
-	countryInst := airplaneMakeInst.CountryInst
+// Put stores a copy of the airplane make without its details.
+func (airplaneMakeInst *AirplaneMake) Put() error {
+	storedInst := *airplaneMakeInst
+	storedInst.CountryInst = nil
+	storedInst.BrokenRefs = nil
+
+	err := AdapterInst.PutObject(&storedInst)
+	airplaneMakeInst.Version = storedInst.Version
+
+	return err
+}
+
+//----------------------------------------------------------------------------------------
+func (airplaneMakeInst *AirplaneMake) Validate() error {
+	var validationInst db.Validation
 
-	airplaneMakeInst.CountryInst = nil
-	AdapterInst.PutObject(airplaneMakeInst)
+	validationInst.Require("code", airplaneMakeInst.Code)
+	validationInst.Require("name", airplaneMakeInst.Name)
+	db.CheckRef(&validationInst, "country", airplaneMakeInst.Country, country.AdapterInst.GetObjectByCode)
 
-	airplaneMakeInst.CountryInst = countryInst
+	return validationInst.Result()
 }
 
 //----------------------------------------------------------------------------------------
+// InitRefObjs loads the referenced country. If it does not exist, it is listed in BrokenRefs.
 func (airplaneMakeInst *AirplaneMake) InitRefObjs() {
-	var err error
+	var brokenRefList []db.Reference
 
-	if len(airplaneMakeInst.Country) != 0 {
-		airplaneMakeInst.CountryInst, err = country.GetCountryByISO(airplaneMakeInst.Country)
-		if err != nil {
-			panic(fmt.Sprintf("Error initialising country with code %s for model %s", airplaneMakeInst.Country, airplaneMakeInst.Code))
-		}
-	}
+	airplaneMakeInst.CountryInst = db.ResolveRef(&brokenRefList, country.TABLE_NAME, "country", airplaneMakeInst.Country, country.GetCountryByISO)
+	airplaneMakeInst.BrokenRefs = brokenRefList
 }
 
 //----------------------------------------------------------------------------------------
@@ -102,8 +132,8 @@ func GetCacheMap(airplaneMakeList []*AirplaneMake) []db.CacheMapElement {
 }
 
 //----------------------------------------------------------------------------------------
-func (airplaneMakeInst *AirplaneMake) Delete() {
-	AdapterInst.DeleteObject(airplaneMakeInst)
+func (airplaneMakeInst *AirplaneMake) Delete() error {
+	return AdapterInst.DeleteObject(airplaneMakeInst)
 }
 
 //----------------------------------------------------------------------------------------
@@ -111,19 +141,71 @@ func GetList() ([]*AirplaneMake, error) {
 	return AdapterInst.GetObjectList()
 }
 
+//----------------------------------------------------------------------------------------
+// Expand returns copies of the airplane makes of airplaneMakeList with the details of the
+// references in fieldList attached and those of the others left out. Each kind of referenced
+// object is fetched once for the whole list. BrokenRefs lists the expanded references that
+// do not exist.
+func Expand(airplaneMakeList []*AirplaneMake, fieldList []string) ([]*AirplaneMake, error) {
+	countryMap, err := db.FetchRefMap(airplaneMakeList, fieldList, "country", func(airplaneMakeInst *AirplaneMake) string { return airplaneMakeInst.Country }, country.AdapterInst.GetObjectMapByCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	expandedList := make([]*AirplaneMake, 0, len(airplaneMakeList))
+	for _, airplaneMakeInst := range airplaneMakeList {
+		var brokenRefList []db.Reference
+
+		airplaneMakeCopy := *airplaneMakeInst
+		airplaneMakeCopy.CountryInst = db.AttachRef(&brokenRefList, countryMap, country.TABLE_NAME, "country", airplaneMakeInst.Country)
+		airplaneMakeCopy.BrokenRefs = brokenRefList
+
+		expandedList = append(expandedList, &airplaneMakeCopy)
+	}
+
+	return expandedList, nil
+}
+
+//----------------------------------------------------------------------------------------
+// GetBrokenRefList returns the airplane makes referencing objects that do not exist, with
+// BrokenRefs set.
+func GetBrokenRefList() ([]*AirplaneMake, error) {
+	brokenList := []*AirplaneMake{}
+
+	airplaneMakeList, err := AdapterInst.GetObjectList()
+	if err != nil {
+		return nil, err
+	}
+
+	expandedList, err := Expand(airplaneMakeList, ExpandFields)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, airplaneMakeInst := range expandedList {
+		if len(airplaneMakeInst.BrokenRefs) > 0 {
+			brokenList = append(brokenList, airplaneMakeInst)
+		}
+	}
+
+	return brokenList, nil
+}
+
 //----------------------------------------------------------------------------------------
 func GetByCode(code string) (*AirplaneMake, error) {
 	airplaneMakeInst, err := AdapterInst.GetObjectByCode(code)
-
-	if airplaneMakeInst != nil {
-		airplaneMakeInst.InitRefObjs()
+	if airplaneMakeInst == nil {
+		return nil, err
 	}
 
-	return airplaneMakeInst, err
+	airplaneMakeCopy := *airplaneMakeInst
+	airplaneMakeCopy.InitRefObjs()
+
+	return &airplaneMakeCopy, err
 }
 
 //----------------------------------------------------------------------------------------
-func LoadList(countryList []AirplaneMake) {
+func LoadList(countryList []AirplaneMake) error {
 	var makePointerList []*AirplaneMake = []*AirplaneMake{}
 
 	for _, airplaneMakeInst := range countryList {
@@ -131,12 +213,43 @@ func LoadList(countryList []AirplaneMake) {
 		makePointerList = append(makePointerList, &newAirplaneMakeInst)
 	}
 
-	AdapterInst.PutObjectList(makePointerList)
+	return AdapterInst.PutObjectList(makePointerList)
 }
 
 //----------------------------------------------------------------------------------------
-func InitConn() {
-	dynoInstAirplaneMake := &dyno.Dyno[*AirplaneMake]{}
-	dynoInstAirplaneMake.Config("airplanemake", "code", true, ObjectFactory, GetCacheMap)
-	AdapterInst = dynoInstAirplaneMake
+func InitConn() error {
+	adapterInstAirplaneMake := factory.NewAdapter[*AirplaneMake]()
+	err := adapterInstAirplaneMake.Config(TABLE_NAME, "code", true, ObjectFactory, GetCacheMap)
+	AdapterInst = adapterInstAirplaneMake
+
+	db.RegisterReferrer(country.TABLE_NAME, db.Referrer{
+		TableName: TABLE_NAME,
+		Field:     "country",
+		FindCodes: func(code string) ([]string, error) {
+			return db.FindReferrerCodes(AdapterInst, func(airplaneMakeInst *AirplaneMake) bool { return airplaneMakeInst.Country == code })
+		},
+		Reassign: func(airplaneMakeCode string, newCode string) error {
+			return reassign(airplaneMakeCode, func(airplaneMakeInst *AirplaneMake) { airplaneMakeInst.Country = newCode })
+		},
+		Delete: func(airplaneMakeCode string) error {
+			return AdapterInst.DeleteObjectByCode(airplaneMakeCode)
+		},
+	})
+
+	return err
+}
+
+//----------------------------------------------------------------------------------------
+// reassign stores a copy of the airplane make with code changed by update.
+func reassign(code string, update func(*AirplaneMake)) error {
+	airplaneMakeInst, err := AdapterInst.GetObjectByCode(code)
+	if err != nil {
+		return err
+	}
+
+	newAirplaneMakeInst := *airplaneMakeInst
+	newAirplaneMakeInst.CountryInst = nil
+	update(&newAirplaneMakeInst)
+
+	return newAirplaneMakeInst.Put()
 }
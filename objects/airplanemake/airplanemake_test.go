@@ -1,13 +1,10 @@
 package airplanemake
 
 import (
-	"colmanback/db/dyno"
+	"colmanback/objects/country"
 	"colmanback/test_util"
 	"fmt"
 	"testing"
-
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 const (
@@ -25,18 +22,19 @@ func chkObject(t *testing.T, objectInst *AirplaneMake) {
 	test_util.CheckField(t, "abbreviation", abbreviationConst, objectInst.Abbreviation)
 }
 
-func initDyno() {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+func initDB() {
+	test_util.InitDB()
 
-	dyno.Conn = dynamodb.New(sess)
+	country.InitConn()
+	if test_util.IsMemoryDB() {
+		country.LoadCountryList([]country.Country{{Code: countryConst, Continent: "Europe", Name: "Russia"}})
+	}
 
 	InitConn()
 }
 
 func testSetup(t *testing.T) {
-	initDyno()
+	initDB()
 
 	objectInst, _ := GetByCode(codeConst)
 
@@ -12,12 +12,26 @@ const (
 type Object interface {
 	CodeValue() string
 	SortValue() string
+	VersionValue() int64
+	SetVersion(version int64)
 	ToString() string
-	FromJson(jsonInst []byte)
+	FromJson(jsonInst []byte) error
 	Print()
 
-	Put()
-	Delete()
+	Put() error
+	Delete() error
 
 	WriteObject(writer http.ResponseWriter, request *http.Request)
 }
+
+// Validator is implemented by objects that check their fields before being stored through
+// the API. Validate returns a *db.InvalidObjectError listing every field in error, or any
+// other error if the check itself could not be completed.
+type Validator interface {
+	Validate() error
+}
+
+//----------------------------------------------------------------------------------------
+func (scale ModelScale) IsValid() bool {
+	return scale == Scale1200 || scale == Scale1400
+}
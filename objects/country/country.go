@@ -3,15 +3,20 @@ package country
 import (
 	"colmanback/api_util"
 	"colmanback/db"
-	"colmanback/db/dyno"
+	"colmanback/db/factory"
 	"fmt"
 	"net/http"
 )
 
+const (
+	TABLE_NAME = "country"
+)
+
 type Country struct {
 	Code      string `json:"code"`
 	Continent string `json:"continent"`
 	Name      string `json:"name"`
+	Version   int64  `json:"version"`
 }
 
 var AdapterInst db.Adapter[*Country]
@@ -27,8 +32,18 @@ func (countryInst *Country) SortValue() string {
 }
 
 //----------------------------------------------------------------------------------------
-func (countryInst *Country) FromJson(jsonInst []byte) {
-	db.FromJson(countryInst, jsonInst)
+func (countryInst *Country) VersionValue() int64 {
+	return countryInst.Version
+}
+
+//----------------------------------------------------------------------------------------
+func (countryInst *Country) SetVersion(version int64) {
+	countryInst.Version = version
+}
+
+//----------------------------------------------------------------------------------------
+func (countryInst *Country) FromJson(jsonInst []byte) error {
+	return db.FromJson(countryInst, jsonInst)
 }
 
 //----------------------------------------------------------------------------------------
@@ -75,13 +90,13 @@ func GetCacheMap(countryList []*Country) []db.CacheMapElement {
 }
 
 //----------------------------------------------------------------------------------------
-func (countryInst *Country) Delete() {
-	AdapterInst.DeleteObject(countryInst)
+func (countryInst *Country) Delete() error {
+	return AdapterInst.DeleteObject(countryInst)
 }
 
 //----------------------------------------------------------------------------------------
-func (countryInst *Country) Put() {
-	panic("Method not implemented.")
+func (countryInst *Country) Put() error {
+	return &db.ValidationError{Message: "countries are reference data and cannot be modified"}
 }
 
 //----------------------------------------------------------------------------------------
@@ -95,7 +110,7 @@ func GetCountryByISO(code string) (*Country, error) {
 }
 
 //----------------------------------------------------------------------------------------
-func LoadCountryList(countryList []Country) {
+func LoadCountryList(countryList []Country) error {
 	var countryPointerList []*Country = []*Country{}
 
 	for _, countryInst := range countryList {
@@ -103,12 +118,14 @@ func LoadCountryList(countryList []Country) {
 		countryPointerList = append(countryPointerList, &newCountryInst)
 	}
 
-	AdapterInst.PutObjectList(countryPointerList)
+	return AdapterInst.PutObjectList(countryPointerList)
 }
 
 //----------------------------------------------------------------------------------------
-func InitConn() {
-	dynoInstCountry := &dyno.Dyno[*Country]{}
-	dynoInstCountry.Config("country", "code", true, CountryFactory, GetCacheMap)
-	AdapterInst = dynoInstCountry
+func InitConn() error {
+	adapterInstCountry := factory.NewAdapter[*Country]()
+	err := adapterInstCountry.Config(TABLE_NAME, "code", true, CountryFactory, GetCacheMap)
+	AdapterInst = adapterInstCountry
+
+	return err
 }
@@ -1,12 +1,8 @@
 package country
 
 import (
-	"colmanback/db/dyno"
 	"colmanback/test_util"
 	"testing"
-
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 const (
@@ -16,17 +12,28 @@ const (
 	countryName      = "China"
 )
 
-func initDyno() {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+// Countries loaded into the in-memory adapter, which starts empty.
+var memoryCountryList = []Country{
+	{Code: countryISO, Continent: countryContinent, Name: countryName},
+	{Code: "fr", Continent: "Europe", Name: "France"},
+	{Code: "gb", Continent: "Europe", Name: "United Kingdom"},
+}
+
+func initDB() {
+	test_util.InitDB()
 
-	dyno.Conn = dynamodb.New(sess)
+	InitConn()
+	if test_util.IsMemoryDB() {
+		LoadCountryList(memoryCountryList)
+	}
+}
+
+func expectedCountryCount() int {
+	if test_util.IsMemoryDB() {
+		return len(memoryCountryList)
+	}
 
-	//Airline adapter
-	dynoInstAirline := &dyno.Dyno[*Country]{}
-	dynoInstAirline.Config("country", "code", true, CountryFactory, GetCacheMap)
-	AdapterInst = dynoInstAirline
+	return countryCount
 }
 
 func chkList(t *testing.T) {
@@ -36,8 +43,8 @@ func chkList(t *testing.T) {
 		t.Errorf("Error when retrieving list of countries. Error: %v", err)
 	} else {
 		countryNumber := len(countryList)
-		if countryNumber != countryCount {
-			t.Errorf("Not all the expected countries were found. Expected %d but got %d", countryCount, countryNumber)
+		if countryNumber != expectedCountryCount() {
+			t.Errorf("Not all the expected countries were found. Expected %d but got %d", expectedCountryCount(), countryNumber)
 		}
 	}
 }
@@ -55,7 +62,7 @@ func chkSingleCountry(t *testing.T) {
 }
 
 func TestAirplane(t *testing.T) {
-	initDyno()
+	initDB()
 
 	t.Log("Ensure that the list has the expected number of countries.")
 	chkList(t)
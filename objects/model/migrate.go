@@ -0,0 +1,96 @@
+package model
+
+import (
+	"colmanback/db"
+	"colmanback/db/factory"
+	"errors"
+	"fmt"
+)
+
+// legacyModel is a model as stored in LEGACY_STORE_NAME, before models were kept in
+// collections: keyed by its code alone, with no owner.
+type legacyModel struct {
+	Model
+}
+
+//----------------------------------------------------------------------------------------
+func legacyFactory() *legacyModel {
+	return &legacyModel{}
+}
+
+//----------------------------------------------------------------------------------------
+func (legacyInst *legacyModel) CodeValue() string {
+	return legacyInst.Code
+}
+
+//----------------------------------------------------------------------------------------
+func (legacyInst *legacyModel) SortValue() string {
+	if len(legacyInst.Picture) > 0 {
+		return legacyInst.Picture
+	}
+
+	return legacyInst.Code
+}
+
+//----------------------------------------------------------------------------------------
+// MigrateLegacyModels copies the models of LEGACY_STORE_NAME, along with their pictures, into
+// the collection of owner and returns how many were copied. Models that the collection
+// already holds are skipped, so that an interrupted migration can be run again. The legacy
+// table is left as it is. InitConn must have been called first.
+func MigrateLegacyModels(owner string) (int, error) {
+	var copyCount int
+
+	legacyAdapterInst := factory.NewAdapter[*legacyModel]()
+	legacyAdapterInst.SetSortName(PICTURE_NAME)
+	err := legacyAdapterInst.Config(LEGACY_STORE_NAME, "code", false, legacyFactory, nil)
+	if err != nil {
+		return 0, fmt.Errorf("cannot open the legacy model table. Error: %w", err)
+	}
+
+	legacyList, err := legacyAdapterInst.GetObjectList()
+	if err != nil {
+		return 0, fmt.Errorf("cannot list the legacy models. Error: %w", err)
+	}
+
+	for _, legacyInst := range legacyList {
+		if len(legacyInst.Picture) > 0 || len(legacyInst.Code) == 0 {
+			continue
+		}
+
+		modelInst := legacyInst.Model
+		modelInst.Owner = owner
+		modelInst.OwnerCode = modelInst.CodeValue()
+		modelInst.Version = 0
+
+		_, getErr := AdapterInst.GetObjectByCode(modelInst.OwnerCode)
+		if getErr == nil {
+			continue
+		} else if !errors.Is(getErr, db.ErrNotFound) {
+			return copyCount, getErr
+		}
+
+		pictureList, err := legacyAdapterInst.GetSortKeyList(legacyInst.Code)
+		if err != nil {
+			return copyCount, fmt.Errorf("cannot list the pictures of legacy model %s. Error: %w", legacyInst.Code, err)
+		}
+
+		// The pictures go first, so that a model is only skipped once all of them are copied.
+		for _, picture := range pictureList {
+			pictureInst := &Model{Code: modelInst.Code, Owner: owner, OwnerCode: modelInst.OwnerCode, Picture: picture}
+			err = AdapterInst.PutObject(pictureInst)
+			if err != nil {
+				return copyCount, fmt.Errorf("cannot copy picture %s of legacy model %s. Error: %w", picture, legacyInst.Code, err)
+			}
+		}
+
+		err = AdapterInst.PutObject(&modelInst)
+		if err != nil {
+			return copyCount, fmt.Errorf("cannot copy legacy model %s. Error: %w", legacyInst.Code, err)
+		}
+
+		indexModel(&modelInst)
+		copyCount++
+	}
+
+	return copyCount, nil
+}
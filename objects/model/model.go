@@ -3,19 +3,27 @@ package model
 import (
 	"colmanback/api_util"
 	"colmanback/db"
-	"colmanback/db/s3"
 	"colmanback/objects"
 	"colmanback/objects/airline"
 	"colmanback/objects/airplane"
 	"colmanback/objects/modelmake"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 )
 
 const (
-	SEP = "#"
+	TABLE_NAME   = "model"
+	PICTURE_NAME = "picture"
+	SEP          = "#"
+	OWNER_SEP    = "|"
+
+	// Models are stored in STORE_NAME, keyed by owner code. Before they were kept in
+	// collections, they were stored in LEGACY_STORE_NAME, keyed by code, from which
+	// MigrateLegacyModels copies them.
+	STORE_NAME        = "collection_model"
+	LEGACY_STORE_NAME = "model"
 )
 
 type Model struct {
@@ -23,6 +31,11 @@ type Model struct {
 	Picture  string   `json:"picture,omitempty"` //Used by the picture index stub only
 	CodeList []string `json:"codeList,omitempty"`
 
+	//Collection the model belongs to. Models are stored under their code qualified by the
+	//owner, so that the codes of different collections cannot collide.
+	Owner     string `json:"owner"`
+	OwnerCode string `json:"ownerCode"`
+
 	//Foreign Keys
 	ModelMake string `json:"modelMake"`
 	Airline   string `json:"airline"`
@@ -36,15 +49,29 @@ type Model struct {
 	IsOldLivery     bool               `json:"isOldLivery"`
 	IsSpecialLivery bool               `json:"isSpecialLivery"`
 	PictureList     []string           `json:"pictureList,omitempty"` //Used by the actual model instances
+	Version         int64              `json:"version"`
 
 	//Reference Instances
 	ModelMakeInst *modelmake.ModelMake `json:"modelMakeDetails,omitempty"`
 	AirlineInst   *airline.Airline     `json:"airlineDetails,omitempty"`
 	AirplaneInst  *airplane.Airplane   `json:"airplaneDetails,omitempty"`
+
+	//References to objects that do not exist
+	BrokenRefs []db.Reference `json:"brokenRefs,omitempty"`
 }
 
 var AdapterInst db.Adapter[*Model]
-var FileInst *s3.S3Adapter
+
+var ownerEscaper = strings.NewReplacer("%", "%25", OWNER_SEP, "%7C")
+
+// ExpandFields are the references whose details Expand can attach.
+var ExpandFields = []string{"airline", "airplane", "modelMake"}
+var FileInst db.FileAdapter
+
+// SearchIndexInst is the full-text index over the registration, notes and the names of the
+// referenced objects of every model. It is kept up to date by Put and Delete, and is never
+// reassigned, as the diagnostics read it while the server starts: InitSearchIndex refills it.
+var SearchIndexInst = db.NewTextIndex()
 
 //----------------------------------------------------------------------------------------
 func (modelInst *Model) makeCode() {
@@ -57,8 +84,22 @@ func (modelInst *Model) makeCode() {
 }
 
 //----------------------------------------------------------------------------------------
+// MakeOwnerCode returns the key a model with code is stored under in the collection of owner.
+// The separator is escaped in owner, as in subjects such as auth0|123, so that the owner part
+// of a key ends at the first separator and the keys of different collections never match.
+func MakeOwnerCode(owner string, code string) string {
+	return ownerEscaper.Replace(owner) + OWNER_SEP + code
+}
+
+//----------------------------------------------------------------------------------------
+// CodeValue is the key the model is stored under. It is worked out from the owner and the
+// code rather than read from OwnerCode, so that neither can be changed without it.
 func (modelInst *Model) CodeValue() string {
-	return modelInst.Code
+	if len(modelInst.Code) == 0 {
+		return ""
+	}
+
+	return MakeOwnerCode(modelInst.Owner, modelInst.Code)
 }
 
 //----------------------------------------------------------------------------------------
@@ -66,19 +107,35 @@ func (modelInst *Model) SortValue() string {
 	if len(modelInst.Picture) > 0 {
 		return modelInst.Picture
 	} else {
-		return modelInst.Code
+		return modelInst.CodeValue()
 	}
 }
 
 //----------------------------------------------------------------------------------------
-func (modelInst *Model) FromJson(jsonInst []byte) {
-	db.FromJson(modelInst, jsonInst)
+func (modelInst *Model) VersionValue() int64 {
+	return modelInst.Version
+}
+
+//----------------------------------------------------------------------------------------
+func (modelInst *Model) SetVersion(version int64) {
+	modelInst.Version = version
+}
+
+//----------------------------------------------------------------------------------------
+func (modelInst *Model) FromJson(jsonInst []byte) error {
+	err := db.FromJson(modelInst, jsonInst)
+	if err != nil {
+		return err
+	}
 
 	if len(modelInst.Code) == 0 {
 		modelInst.makeCode()
 	}
 
+	modelInst.OwnerCode = modelInst.CodeValue()
 	modelInst.Reg = strings.ToUpper(modelInst.Reg)
+
+	return nil
 }
 
 //----------------------------------------------------------------------------------------
@@ -86,6 +143,7 @@ func (modelInst *Model) ToString() string {
 	str := fmt.Sprintf(`
 	----------------------
 	  Code ......: %s
+	  Owner .....: %s
 	  ModelMake .: %s
 	  Airline ...: %s
 	  Airplane ..: %s
@@ -98,6 +156,7 @@ func (modelInst *Model) ToString() string {
 	  Picture ...: %s
 	  PictureList: %v`,
 		modelInst.Code,
+		modelInst.Owner,
 		modelInst.ModelMake,
 		modelInst.Airline,
 		modelInst.Airplane,
@@ -126,107 +185,122 @@ func ObjectFactory() *Model {
 }
 
 //----------------------------------------------------------------------------------------
+// InitRefObjs loads the referenced objects. Those that do not exist are listed in BrokenRefs.
 func (modelInst *Model) InitRefObjs() {
-	var err error
+	var brokenRefList []db.Reference
 
-	if len(modelInst.Airline) != 0 {
-		modelInst.AirlineInst, err = airline.GetByCode(modelInst.Airline)
-		if err != nil {
-			panic(fmt.Sprintf("Error initialising airline with code %s for model %s", modelInst.Airline, modelInst.Code))
-		}
+	modelInst.AirlineInst = db.ResolveRef(&brokenRefList, airline.TABLE_NAME, "airline", modelInst.Airline, airline.GetByCode)
+	modelInst.AirplaneInst = db.ResolveRef(&brokenRefList, airplane.TABLE_NAME, "airplane", modelInst.Airplane, airplane.GetByCode)
+	modelInst.ModelMakeInst = db.ResolveRef(&brokenRefList, modelmake.TABLE_NAME, "modelMake", modelInst.ModelMake, modelmake.GetByCode)
+	modelInst.BrokenRefs = brokenRefList
+}
+
+//----------------------------------------------------------------------------------------
+func (modelInst *Model) LoadPictures() error {
+	pictureList, err := AdapterInst.GetSortKeyList(modelInst.CodeValue())
+	if err != nil {
+		return err
 	}
 
-	if len(modelInst.Airplane) != 0 {
-		modelInst.AirplaneInst, err = airplane.GetByCode(modelInst.Airplane)
-		if err != nil {
-			panic(fmt.Sprintf("Error initialising airplane with code %s for model %s", modelInst.Airline, modelInst.Code))
-		}
+	modelInst.PictureList = pictureList
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (modelInst *Model) Delete() error {
+	if len(modelInst.Picture) > 0 {
+		return AdapterInst.DeleteObjectByCodeAndSort(modelInst.CodeValue(), modelInst.Picture)
 	}
 
-	if len(modelInst.ModelMake) != 0 {
-		modelInst.ModelMakeInst, err = modelmake.GetByCode(modelInst.ModelMake)
+	for _, picture := range modelInst.PictureList {
+		err := AdapterInst.DeleteObjectByCodeAndSort(modelInst.CodeValue(), picture)
 		if err != nil {
-			panic(fmt.Sprintf("Error initialising modelmake with code %s for model %s", modelInst.ModelMake, modelInst.Code))
+			return err
 		}
 	}
-}
-
-//----------------------------------------------------------------------------------------
-func (modelInst *Model) LoadPictures() {
-	pictureList, err := AdapterInst.GetSortKeyList(modelInst.Code)
 
-	modelInst.PictureList = pictureList
-	if err != nil {
-		log.Fatalf("An error has occurred while retrieving the pictures for a model with code %s. Error: %v", modelInst.Code, err)
+	err := AdapterInst.DeleteObject(modelInst)
+	if err == nil {
+		SearchIndexInst.Remove(modelInst.CodeValue())
 	}
+
+	return err
 }
 
 //----------------------------------------------------------------------------------------
-func (modelInst *Model) Delete() {
-	var err error
-
-	if len(modelInst.Picture) == 0 {
-		if modelInst.PictureList != nil && len(modelInst.PictureList) > 0 {
-			for _, picture := range modelInst.PictureList {
-				AdapterInst.DeleteObjectByCodeAndSort(modelInst.CodeValue(), picture)
-			}
-		}
-		err = AdapterInst.DeleteObject(modelInst)
-	} else {
-		err = AdapterInst.DeleteObjectByCodeAndSort(modelInst.Code, modelInst.Picture)
+// canonicalAirline returns the code of the airline referenced by code, which may be an IATA or
+// ICAO code without prefix, or code itself if there is no such airline.
+func canonicalAirline(code string) string {
+	if len(code) == 0 {
+		return code
 	}
 
+	airlineInst, err := airline.GetByCode(code)
 	if err != nil {
-		log.Fatalf("An error has occurred while deleting model with code %s. Error: %v\n", modelInst.Code, err)
+		return code
 	}
+
+	return airlineInst.Code
 }
 
 //----------------------------------------------------------------------------------------
-func (modelInst *Model) Put() {
-	var getErr error
+// Validate checks the fields the code of a model is made of and that its references exist.
+func (modelInst *Model) Validate() error {
+	var validationInst db.Validation
+
+	validationInst.Require("reg", modelInst.Reg)
+	validationInst.Require("modelMake", modelInst.ModelMake)
+	if !modelInst.Scale.IsValid() {
+		validationInst.AddError("scale", fmt.Sprintf("must be %s or %s", objects.Scale1200, objects.Scale1400))
+	}
+
+	db.CheckRef(&validationInst, "modelMake", modelInst.ModelMake, modelmake.AdapterInst.GetObjectByCode)
+	db.CheckRef(&validationInst, "airline", modelInst.Airline, airline.GetByCode)
+	db.CheckRef(&validationInst, "airplane", modelInst.Airplane, airplane.AdapterInst.GetObjectByCode)
 
-	airlineInst := modelInst.AirlineInst
-	airplaneInst := modelInst.AirplaneInst
-	modelMakeInst := modelInst.ModelMakeInst
+	return validationInst.Result()
+}
 
-	//Ensure that redundant ref info is not persisted.
-	modelInst.AirlineInst = nil
-	modelInst.AirplaneInst = nil
-	modelInst.ModelMakeInst = nil
+//----------------------------------------------------------------------------------------
+// Put stores a copy of the model without its details, under its code qualified by its owner.
+// The airline is stored by its code, whatever code it has been given by, so that it can be
+// matched against the airline. Conflicts are reported with the code of the model, which is
+// what clients know it by.
+func (modelInst *Model) Put() error {
+	var conflictErr *db.ConflictError
 
 	if len(modelInst.Code) == 0 {
 		modelInst.makeCode()
 	}
 
-	err := AdapterInst.PutObject(modelInst)
-	if err != nil {
-		log.Fatalf("An error has occurred while putting model with code %s. Error: %v\n", modelInst.Code, err)
-	}
+	modelInst.Airline = canonicalAirline(modelInst.Airline)
 
-	if airlineInst == nil && len(modelInst.Airline) > 0 {
-		airlineInst, getErr = airline.GetByCode(modelInst.Airline)
-		if getErr != nil {
-			log.Printf("Model has airline with code %s, but an attempt to retrieve an airline with that code produced error %v\n", modelInst.Airline, getErr)
-		}
-	}
+	modelInst.OwnerCode = modelInst.CodeValue()
+
+	storedInst := *modelInst
+	storedInst.AirlineInst = nil
+	storedInst.AirplaneInst = nil
+	storedInst.ModelMakeInst = nil
+	storedInst.BrokenRefs = nil
 
-	if airplaneInst == nil && len(modelInst.Airplane) > 0 {
-		airplaneInst, getErr = airplane.GetByCode(modelInst.Airplane)
-		if getErr != nil {
-			log.Printf("Model has airplane with code %s, but an attempt to retrieve an airplane with that code produced error %v\n", modelInst.Airplane, getErr)
+	err := AdapterInst.PutObject(&storedInst)
+	if err != nil {
+		if errors.As(err, &conflictErr) {
+			conflictErr.Code = modelInst.Code
 		}
+
+		return err
 	}
 
-	if modelMakeInst == nil && len(modelInst.ModelMake) > 0 {
-		modelMakeInst, getErr = modelmake.GetByCode(modelInst.ModelMake)
-		if getErr != nil {
-			log.Printf("Model has model make with code %s, but an attempt to retrieve an model make with that code produced error %v\n", modelInst.ModelMake, getErr)
-		}
+	modelInst.Version = storedInst.Version
+	modelInst.InitRefObjs()
+
+	if len(modelInst.Picture) == 0 {
+		indexModel(modelInst)
 	}
 
-	modelInst.AirlineInst = airlineInst
-	modelInst.AirplaneInst = airplaneInst
-	modelInst.ModelMakeInst = modelMakeInst
+	return nil
 }
 
 //----------------------------------------------------------------------------------------
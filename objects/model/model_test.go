@@ -1,14 +1,17 @@
 package model
 
 import (
-	"colmanback/db/dyno"
+	"colmanback/db"
+	"colmanback/db/factory"
 	"colmanback/objects"
 	"colmanback/objects/airline"
 	"colmanback/objects/airplane"
 	"colmanback/objects/airplanemake"
+	"colmanback/objects/country"
 	"colmanback/objects/modelmake"
 	"colmanback/test_util"
 	"encoding/json"
+	"errors"
 	"image"
 	"image/color"
 	"image/png"
@@ -18,9 +21,6 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
-
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 const (
@@ -54,12 +54,8 @@ var airplaneInst airplane.Airplane
 var airplaneMakeInst airplanemake.AirplaneMake
 var modelMakeInst modelmake.ModelMake
 
-func initDyno() {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	dyno.Conn = dynamodb.New(sess)
+func initDB() {
+	test_util.InitDB()
 
 	InitConn()
 }
@@ -89,12 +85,17 @@ func chkModel(t *testing.T, objectInst *Model, emptyCode bool) {
 }
 
 func testSetup(t *testing.T) {
-	initDyno()
+	initDB()
 
 	modelmake.InitConn()
 	airline.InitConn()
 	airplane.InitConn()
 	airplanemake.InitConn()
+	country.InitConn()
+
+	if test_util.IsMemoryDB() {
+		country.LoadCountryList([]country.Country{{Code: countryConst, Continent: "Europe", Name: "United Kingdom"}})
+	}
 
 	modelMakeInst = modelmake.ModelMake{}
 	modelMakeInst.Code = modelMakeConst
@@ -201,7 +202,7 @@ func testFile(t *testing.T, codeArr []string) string {
 	if imageFile == nil {
 		t.Errorf("The image file is NIL!")
 	} else {
-		modelInstList, modelErr := AddModelPicture(imageFile, codeArr)
+		modelInstList, modelErr := AddModelPicture("", imageFile, codeArr)
 		if modelErr != nil {
 			t.Errorf("An error has been returned by the AddMOdelPicture method: %v", modelErr)
 		} else if modelInstList == nil {
@@ -210,7 +211,7 @@ func testFile(t *testing.T, codeArr []string) string {
 			checkImageInModel(t, modelInstList, 2, 1)
 
 			// Add again to simulate a different image.
-			modelInstList, modelErr = AddModelPicture(imageFile, codeArr)
+			modelInstList, modelErr = AddModelPicture("", imageFile, codeArr)
 			if modelErr != nil {
 				t.Errorf("The AddModelPicture returned an error: %v", modelErr)
 			} else {
@@ -267,7 +268,7 @@ func TestModel(t *testing.T) {
 	objectInstLoad.Put()
 	chkModel(t, objectInstLoad, false)
 
-	modelRetrInst, getRetrErr := GetByCode(objectInstLoad.Code)
+	modelRetrInst, getRetrErr := GetByCode("", objectInstLoad.Code)
 	if getRetrErr != nil {
 		t.Errorf("Error in get after putting model. %v\n", getRetrErr)
 	}
@@ -276,7 +277,7 @@ func TestModel(t *testing.T) {
 	t.Log("Update, put again and retrieve")
 	modelRetrInst.Reg = regNewConst
 	modelRetrInst.Put()
-	modelUpdtInst, getUpdtErr := GetByCode(objectInstLoad.Code)
+	modelUpdtInst, getUpdtErr := GetByCode("", objectInstLoad.Code)
 	if getUpdtErr != nil {
 		t.Errorf("Error in get after updating airline\n")
 	}
@@ -289,7 +290,7 @@ func TestModel(t *testing.T) {
 	filename := testFile(t, []string{objectInstLoad.Code, objectInstSnd.Code})
 
 	t.Log("Check that the picture is linked to the two models.")
-	objectInstListFromFile, fromFileErr := GetModelByPicture(filename)
+	objectInstListFromFile, fromFileErr := GetModelByPicture("", filename)
 	if fromFileErr != nil {
 		t.Errorf("The model list cannot be retrieved for image %s. Error: %v", filename, fromFileErr)
 	} else if objectInstListFromFile == nil {
@@ -298,14 +299,22 @@ func TestModel(t *testing.T) {
 		t.Errorf("The model list has the wrong number of items. Expected 2 but got %d", len(objectInstListFromFile))
 	}
 
+	t.Log("Check that the picture is not part of other collections.")
+	if otherList, otherErr := GetModelByPicture("other", filename); otherErr != nil || len(otherList) != 0 {
+		t.Errorf("The picture %s is listed for another collection: %v. Error: %v", filename, otherList, otherErr)
+	}
+	if _, tagErr := TagModelPicture("other", filename, objectInstSnd.Code); tagErr == nil {
+		t.Errorf("The picture %s has been tagged from another collection.", filename)
+	}
+
 	if len(objectInstListFromFile) > 0 {
 		t.Log("Step: Check that a picture can be removed from a single model")
-		singlePicModelInst, removeErr := RemoveModelPicture(filename, objectInstListFromFile[0].CodeValue())
+		singlePicModelInst, removeErr := RemoveModelPicture("", filename, objectInstListFromFile[0].Code)
 		if removeErr == nil {
 			if len(singlePicModelInst.PictureList) != 1 {
 				t.Errorf("The model with code %s has an unexpected number of pictures in its list, which is %v", singlePicModelInst.CodeValue(), singlePicModelInst.PictureList)
 			} else {
-				objectInstListFromFile, fromFileErr = GetModelByPicture(filename)
+				objectInstListFromFile, fromFileErr = GetModelByPicture("", filename)
 				if fromFileErr != nil {
 					t.Errorf("The model list cannot be retrieved for image %s after removing pic from %s. Error: %v", filename, singlePicModelInst.CodeValue(), fromFileErr)
 				} else {
@@ -324,7 +333,7 @@ func TestModel(t *testing.T) {
 	t.Log("Step: Delete and check it's gone!")
 	t.Logf("For model with code %s, picture %s, pictureList %v\n", modelUpdtInst.Code, modelUpdtInst.Picture, modelUpdtInst.PictureList)
 	modelUpdtInst.Delete()
-	modelEmptyInst, getEmptyErr := GetByCode(objectInstLoad.Code)
+	modelEmptyInst, getEmptyErr := GetByCode("", objectInstLoad.Code)
 	if getEmptyErr == nil {
 		t.Errorf("Error for unexistent object not produced when expected. Perhaps the object still exists?\n")
 	}
@@ -332,7 +341,7 @@ func TestModel(t *testing.T) {
 
 	t.Logf("For model with code %s, picture %s, pictureList %v\n", objectInstSnd.Code, objectInstSnd.Picture, objectInstSnd.PictureList)
 	objectInstSnd.Delete()
-	modelEmptyInst, getEmptyErr = GetByCode(objectInstSndCode)
+	modelEmptyInst, getEmptyErr = GetByCode("", objectInstSndCode)
 	if getEmptyErr == nil {
 		t.Errorf("Error for unexistent object not produced when expected. Perhaps the object still exists?\n")
 	}
@@ -341,3 +350,222 @@ func TestModel(t *testing.T) {
 	testTearDown(t)
 	t.Log("Test for model has finished.")
 }
+
+func TestValidate(t *testing.T) {
+	testSetup(t)
+	defer testTearDown(t)
+
+	t.Log("Airlines may be referenced by their IATA or ICAO code without prefix")
+	objectInst := CreateObjectInst(regConst)
+	objectInst.Airline = strings.TrimPrefix(airlineConst, airline.IATA_PREFIX)
+	if err := objectInst.Validate(); err != nil {
+		t.Errorf("Expected the model referencing airline %s to be valid. Error: %v", objectInst.Airline, err)
+	}
+
+	t.Log("They are stored by the code of the airline")
+	if err := objectInst.Put(); err != nil {
+		t.Fatalf("Cannot put model %s. Error: %v", objectInst.Code, err)
+	}
+	defer DeleteByCode("", objectInst.Code)
+	test_util.CheckField(t, "airline", airlineConst, objectInst.Airline)
+	if storedInst, err := GetByCode("", objectInst.Code); err != nil || storedInst.Airline != airlineConst {
+		t.Errorf("Expected the model to be stored with airline %s, got %+v. Error: %v", airlineConst, storedInst, err)
+	}
+
+	t.Log("References to objects that do not exist are reported")
+	objectInst.Airline = "model_airline_missing"
+	if err := objectInst.Validate(); err == nil || !strings.Contains(err.Error(), "airline") {
+		t.Errorf("Expected the missing airline to be reported. Error: %v", err)
+	}
+}
+
+func TestOwnerCode(t *testing.T) {
+	testSetup(t)
+	defer testTearDown(t)
+
+	t.Log("Owners and codes holding the separator do not give the same key")
+	for _, pair := range [][4]string{
+		{"auth0|123", "x", "auth0", "123|x"},
+		{"auth0%7C123", "x", "auth0|123", "x"},
+		{"", "a|b", "a", "b"},
+	} {
+		if key := MakeOwnerCode(pair[0], pair[1]); key == MakeOwnerCode(pair[2], pair[3]) {
+			t.Errorf("Expected %q of %q and %q of %q to be stored under different keys, both got %q", pair[1], pair[0], pair[3], pair[2], key)
+		}
+	}
+
+	t.Log("A model is only found in the collection of its owner")
+	objectInst := CreateObjectInst(regConst)
+	objectInst.Owner = "auth0"
+	objectInst.Code = "123|x"
+	if err := objectInst.Put(); err != nil {
+		t.Fatalf("Cannot put model %s. Error: %v", objectInst.Code, err)
+	}
+	defer DeleteByCode("auth0", "123|x")
+
+	if _, err := GetByCode("auth0|123", "x"); err == nil {
+		t.Errorf("Expected the model of auth0 not to be found in the collection of auth0|123")
+	}
+
+	if modelInst, err := GetByCode("auth0", "123|x"); err != nil || modelInst.Owner != "auth0" {
+		t.Errorf("Expected the model of auth0 to be found, got %+v. Error: %v", modelInst, err)
+	}
+}
+
+func TestMigrateLegacyModels(t *testing.T) {
+	testSetup(t)
+	defer testTearDown(t)
+
+	t.Log("Models stored before collections are keyed by code, without owner")
+	legacyAdapterInst := factory.NewAdapter[*legacyModel]()
+	legacyAdapterInst.SetSortName(PICTURE_NAME)
+	if err := legacyAdapterInst.Config(LEGACY_STORE_NAME, "code", false, legacyFactory, nil); err != nil {
+		t.Fatalf("Cannot open the legacy table. Error: %v", err)
+	}
+
+	legacyInst := &legacyModel{Model: *CreateObjectInst("LE-GACY")}
+	legacyInst.Notes = "legacy livery"
+	legacyInst.makeCode()
+	pictureInst := &legacyModel{Model: Model{Code: legacyInst.Code, Picture: "legacy.png"}}
+	for _, objectInst := range []*legacyModel{legacyInst, pictureInst} {
+		if err := legacyAdapterInst.PutObject(objectInst); err != nil {
+			t.Fatalf("Cannot put legacy row %s. Error: %v", objectInst.SortValue(), err)
+		}
+	}
+	defer legacyAdapterInst.DeleteObjectByCodeAndSort(legacyInst.Code, pictureInst.Picture)
+	defer legacyAdapterInst.DeleteObjectByCode(legacyInst.Code)
+
+	t.Log("They are copied into the collection given, with their pictures")
+	copyCount, err := MigrateLegacyModels("ann")
+	if err != nil || copyCount != 1 {
+		t.Fatalf("Expected 1 model to be copied, got %d. Error: %v", copyCount, err)
+	}
+
+	modelInst, err := GetByCode("ann", legacyInst.Code)
+	if err != nil {
+		t.Fatalf("The copied model cannot be retrieved. Error: %v", err)
+	}
+	defer func() {
+		modelInst.Delete()
+		DeleteByCode("ann", legacyInst.Code)
+	}()
+
+	test_util.CheckField(t, "owner", "ann", modelInst.Owner)
+	test_util.CheckField(t, "ownerCode", MakeOwnerCode("ann", legacyInst.Code), modelInst.OwnerCode)
+	test_util.CheckField(t, "notes", legacyInst.Notes, modelInst.Notes)
+	if modelInst.AirlineInst == nil || len(modelInst.BrokenRefs) > 0 {
+		t.Errorf("Expected the references of the copied model to be resolved, got %+v", modelInst.BrokenRefs)
+	}
+
+	if err := modelInst.LoadPictures(); err != nil || len(modelInst.PictureList) != 1 || modelInst.PictureList[0] != pictureInst.Picture {
+		t.Errorf("Expected the picture of the legacy model to be copied, got %v. Error: %v", modelInst.PictureList, err)
+	}
+
+	if searchList, err := Search("ann", "legacy", 10); err != nil || len(searchList) != 1 {
+		t.Errorf("Expected the copied model to be found by search, got %v. Error: %v", searchList, err)
+	}
+
+	t.Log("Models already copied are skipped when the migration is run again")
+	if copyCount, err = MigrateLegacyModels("ann"); err != nil || copyCount != 0 {
+		t.Errorf("Expected no model to be copied again, got %d. Error: %v", copyCount, err)
+	}
+}
+
+func TestSearchRenamedRefs(t *testing.T) {
+	testSetup(t)
+	defer testTearDown(t)
+
+	objectInst := CreateObjectInst(regConst)
+	if err := objectInst.Put(); err != nil {
+		t.Fatalf("Cannot put model %s. Error: %v", objectInst.Code, err)
+	}
+	defer DeleteByCode("", objectInst.Code)
+
+	t.Log("Models are found by the new names of the objects they reference once those are stored")
+	renamedAirlineInst := airlineInst
+	renamedAirlineInst.Name = "renamedairline"
+	renamedAirplaneInst := airplaneInst
+	renamedAirplaneInst.Name = "renamedairplane"
+	renamedModelMakeInst := modelMakeInst
+	renamedModelMakeInst.Name = "renamedmodelmake"
+	for _, refInst := range []objects.Object{&renamedAirlineInst, &renamedAirplaneInst, &renamedModelMakeInst} {
+		if err := refInst.Put(); err != nil {
+			t.Fatalf("Cannot put %s. Error: %v", refInst.ToString(), err)
+		}
+	}
+
+	for _, query := range []string{"renamedairline", "renamedairplane", "renamedmodelmake"} {
+		if searchList, err := Search("", query, 10); err != nil || len(searchList) != 1 || searchList[0].Code != objectInst.Code {
+			t.Errorf("Expected model %s to be found by %s, got %v. Error: %v", objectInst.Code, query, searchList, err)
+		}
+	}
+
+	if searchList, err := Search("", airlineNameConst, 10); err != nil || len(searchList) != 0 {
+		t.Errorf("Expected no model to be found by the former name of the airline, got %v. Error: %v", searchList, err)
+	}
+}
+
+func TestDeleteReferencedAirline(t *testing.T) {
+	var referencedErr *db.ReferencedError
+
+	testSetup(t)
+	defer testTearDown(t)
+
+	t.Log("Models stored before airlines were stored by their code may hold the IATA code without prefix")
+	objectInst := CreateObjectInst(regConst)
+	objectInst.makeCode()
+	objectInst.OwnerCode = objectInst.CodeValue()
+	objectInst.Airline = strings.TrimPrefix(airlineConst, airline.IATA_PREFIX)
+	if err := AdapterInst.PutObject(objectInst); err != nil {
+		t.Fatalf("Cannot put model %s. Error: %v", objectInst.Code, err)
+	}
+	defer DeleteByCode("", objectInst.Code)
+
+	t.Log("The airline cannot be deleted while they reference it")
+	err := db.DeleteReferenced(airline.TABLE_NAME, airlineConst, db.DeleteOptions{}, airline.AdapterInst.DeleteObjectByCode)
+	if !errors.As(err, &referencedErr) || len(referencedErr.References) != 1 || referencedErr.References[0].Code != objectInst.CodeValue() {
+		t.Errorf("Expected the airline to be referenced by model %s. Error: %v", objectInst.Code, err)
+	}
+
+	if _, err = airline.GetByCode(airlineConst); err != nil {
+		t.Errorf("Expected the airline to be kept. Error: %v", err)
+	}
+}
+
+func TestDeletePictures(t *testing.T) {
+	testSetup(t)
+	defer testTearDown(t)
+
+	modelList := []*Model{CreateObjectInst(regConst), CreateObjectInst(regNewConst)}
+	for _, objectInst := range modelList {
+		if err := objectInst.Put(); err != nil {
+			t.Fatalf("Cannot put model %s. Error: %v", objectInst.Code, err)
+		}
+
+		pictureInst := &Model{Code: objectInst.Code, OwnerCode: objectInst.CodeValue(), Picture: "delete.png"}
+		if err := AdapterInst.PutObject(pictureInst); err != nil {
+			t.Fatalf("Cannot put the picture of model %s. Error: %v", objectInst.Code, err)
+		}
+	}
+
+	t.Log("The pictures of a model are deleted with it")
+	if err := DeleteByCode("", modelList[0].Code); err != nil {
+		t.Errorf("Cannot delete model %s. Error: %v", modelList[0].Code, err)
+	}
+
+	t.Log("Including when it is deleted along with the airplane it references")
+	err := db.DeleteReferenced(airplane.TABLE_NAME, airplaneConst, db.DeleteOptions{Cascade: true}, airplane.AdapterInst.DeleteObjectByCode)
+	if err != nil {
+		t.Errorf("Cannot delete airplane %s with its models. Error: %v", airplaneConst, err)
+	}
+
+	for _, objectInst := range modelList {
+		if pictureList, err := AdapterInst.GetSortKeyList(objectInst.CodeValue()); err != nil || len(pictureList) != 0 {
+			t.Errorf("Expected no picture left for model %s, got %v. Error: %v", objectInst.Code, pictureList, err)
+		}
+	}
+
+	if pictureModelList, err := GetModelByPicture("", "delete.png"); err != nil || len(pictureModelList) != 0 {
+		t.Errorf("Expected no model left for the picture, got %v. Error: %v", pictureModelList, err)
+	}
+}
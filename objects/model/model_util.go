@@ -1,8 +1,13 @@
 package model
 
 import (
-	"colmanback/db/dyno"
-	"colmanback/db/s3"
+	"colmanback/db"
+	"colmanback/db/factory"
+	"colmanback/objects/airline"
+	"colmanback/objects/airplane"
+	"colmanback/objects/modelmake"
+	"errors"
+	"fmt"
 	"log"
 	"mime/multipart"
 	"strings"
@@ -11,8 +16,160 @@ import (
 	"github.com/google/uuid"
 )
 
+// Weights of the model fields in the search index. A word found in the registration counts
+// for more than the same word found in the notes.
+const (
+	SEARCH_WEIGHT_REG       = 3.0
+	SEARCH_WEIGHT_REF_NAME  = 2.0
+	SEARCH_WEIGHT_MODELMAKE = 1.0
+	SEARCH_WEIGHT_NOTES     = 1.0
+)
+
+// PictureIndexName is the index of the model table by picture, PictureBucket the bucket the
+// pictures are stored in and MaxPictureEntries the most pictures listed at once. They must be
+// set before InitConn is called.
+var PictureIndexName = "picture-ownerCode-index"
+var PictureBucket = "colman-pics"
+var MaxPictureEntries = 1000
+
 //----------------------------------------------------------------------------------------
-func tagModelPicture(filename string, modelCodeList []string) ([]*Model, error) {
+// searchFields returns the text indexed for a model. Referenced objects that cannot be
+// retrieved are left out rather than stopping the indexing.
+func searchFields(modelInst *Model) []db.TextField {
+	fieldList := []db.TextField{
+		{Text: modelInst.Reg, Weight: SEARCH_WEIGHT_REG},
+		{Text: modelInst.Notes, Weight: SEARCH_WEIGHT_NOTES},
+	}
+
+	airlineInst := modelInst.AirlineInst
+	if airlineInst == nil && len(modelInst.Airline) > 0 {
+		if refInst, err := airline.GetByCode(modelInst.Airline); err == nil {
+			airlineInst = refInst
+		}
+	}
+	if airlineInst != nil {
+		fieldList = append(fieldList, db.TextField{Text: airlineInst.Name, Weight: SEARCH_WEIGHT_REF_NAME})
+	}
+
+	airplaneInst := modelInst.AirplaneInst
+	if airplaneInst == nil && len(modelInst.Airplane) > 0 {
+		if refInst, err := airplane.GetByCode(modelInst.Airplane); err == nil {
+			airplaneInst = refInst
+		}
+	}
+	if airplaneInst != nil {
+		fieldList = append(fieldList, db.TextField{Text: airplaneInst.Name, Weight: SEARCH_WEIGHT_REF_NAME})
+	}
+
+	modelMakeInst := modelInst.ModelMakeInst
+	if modelMakeInst == nil && len(modelInst.ModelMake) > 0 {
+		if refInst, err := modelmake.GetByCode(modelInst.ModelMake); err == nil {
+			modelMakeInst = refInst
+		}
+	}
+	if modelMakeInst != nil {
+		fieldList = append(fieldList, db.TextField{Text: modelMakeInst.Name, Weight: SEARCH_WEIGHT_MODELMAKE})
+	}
+
+	return fieldList
+}
+
+//----------------------------------------------------------------------------------------
+func indexModel(modelInst *Model) {
+	SearchIndexInst.Update(modelInst.CodeValue(), searchFields(modelInst))
+}
+
+//----------------------------------------------------------------------------------------
+// InitSearchIndex rebuilds the search index from the stored models. The adapters of the
+// referenced objects must have been initialised first, as their names are indexed too.
+func InitSearchIndex() error {
+	objectList, err := AdapterInst.GetObjectList()
+	if err != nil {
+		return fmt.Errorf("model search index cannot be initialised. Error: %w", err)
+	}
+
+	// Built apart and swapped in, as the index may be searched in the meantime.
+	searchIndexInst := db.NewTextIndex()
+	for _, objectInst := range objectList {
+		searchIndexInst.Update(objectInst.CodeValue(), searchFields(objectInst))
+	}
+	SearchIndexInst.Replace(searchIndexInst)
+
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+// Search returns at most limit models of the collection of owner containing every word of
+// query, best matches first. The index covers every collection and is keyed by owner code.
+func Search(owner string, query string, limit int) ([]*Model, error) {
+	objectList := []*Model{}
+	ownerPrefix := MakeOwnerCode(owner, "")
+
+	for _, match := range SearchIndexInst.Search(query) {
+		if len(objectList) >= limit {
+			break
+		}
+
+		if !strings.HasPrefix(match.Code, ownerPrefix) {
+			continue
+		}
+
+		objectInst, err := getByOwnerCode(owner, match.Code)
+		if errors.Is(err, db.ErrNotFound) {
+			SearchIndexInst.Remove(match.Code)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		objectList = append(objectList, objectInst)
+	}
+
+	return objectList, nil
+}
+
+//----------------------------------------------------------------------------------------
+// deleteByOwnerCode deletes the model stored under ownerCode along with the items of its
+// pictures, as Model.Delete does.
+func deleteByOwnerCode(ownerCode string) error {
+	pictureList, err := AdapterInst.GetSortKeyList(ownerCode)
+	if err != nil {
+		return err
+	}
+
+	for _, picture := range pictureList {
+		err = AdapterInst.DeleteObjectByCodeAndSort(ownerCode, picture)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = AdapterInst.DeleteObjectByCode(ownerCode)
+	if err == nil {
+		SearchIndexInst.Remove(ownerCode)
+	}
+
+	return err
+}
+
+//----------------------------------------------------------------------------------------
+// DeleteByCode deletes the model with code of the collection of owner. As for the other
+// tables, there is nothing to do if the collection has no such model.
+func DeleteByCode(owner string, code string) error {
+	ownerCode := MakeOwnerCode(owner, code)
+
+	_, err := getOwned(owner, ownerCode)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return deleteByOwnerCode(ownerCode)
+}
+
+//----------------------------------------------------------------------------------------
+func tagModelPicture(owner string, filename string, modelCodeList []string) ([]*Model, error) {
 	var modelInst *Model
 	var intlErr error
 	modelList := []*Model{}
@@ -21,13 +178,20 @@ func tagModelPicture(filename string, modelCodeList []string) ([]*Model, error)
 		// Save model stub for the index.
 		modelInst = &Model{}
 		modelInst.Code = code
+		modelInst.Owner = owner
 		modelInst.Picture = filename
-		modelInst.Put()
+		intlErr = modelInst.Put()
+		if intlErr != nil {
+			log.Printf("An error has occurred while saving the picture %s for model with code %s. Error: %v", filename, code, intlErr)
+			return nil, intlErr
+		}
+
+		modelInst, intlErr = GetByCode(owner, code)
+		if intlErr == nil {
+			intlErr = modelInst.LoadPictures()
+		}
 
-		//Append the image to the actual model objects (in memory only)
-		modelInst, intlErr = GetByCode(code)
 		if intlErr == nil {
-			modelInst.PictureList = append(modelInst.PictureList, filename)
 			modelList = append(modelList, modelInst)
 		} else {
 			log.Printf("An error has occurred while tagging model with code %s for picture with filename %s. Error: %v", code, filename, intlErr)
@@ -39,12 +203,12 @@ func tagModelPicture(filename string, modelCodeList []string) ([]*Model, error)
 }
 
 //----------------------------------------------------------------------------------------
-func chkModelCode(modelCodeList []string) []string {
+func chkModelCode(owner string, modelCodeList []string) []string {
 	var err error
 	var validModelCodeList []string
 
 	for _, modelCode := range modelCodeList {
-		_, err = GetByCode(modelCode)
+		_, err = GetByCode(owner, modelCode)
 		if err == nil {
 			validModelCodeList = append(validModelCodeList, modelCode)
 		}
@@ -54,44 +218,232 @@ func chkModelCode(modelCodeList []string) []string {
 }
 
 //----------------------------------------------------------------------------------------
-func GetList() ([]*Model, error) {
+func filterByOwner(objectList []*Model, owner string) []*Model {
+	ownedList := []*Model{}
+
+	for _, objectInst := range objectList {
+		if objectInst.Owner == owner {
+			ownedList = append(ownedList, objectInst)
+		}
+	}
+
+	return ownedList
+}
+
+//----------------------------------------------------------------------------------------
+// GetOwnedList returns the models of the collection of owner, without their details.
+func GetOwnedList(owner string) ([]*Model, error) {
 	objectList, err := AdapterInst.GetObjectList()
+	if err != nil {
+		return objectList, err
+	}
+
+	return filterByOwner(objectList, owner), nil
+}
 
+//----------------------------------------------------------------------------------------
+// GetList returns copies of the models of the collection of owner with all their details
+// attached. The referenced objects are fetched once for the whole list.
+func GetList(owner string) ([]*Model, error) {
+	objectList, err := GetOwnedList(owner)
+	if err != nil {
+		return objectList, err
+	}
+
+	return Expand(objectList, ExpandFields)
+}
+
+//----------------------------------------------------------------------------------------
+func expandAirlines(airlineList []*airline.Airline) ([]*airline.Airline, error) {
+	return airline.Expand(airlineList, airline.ExpandFields)
+}
+
+//----------------------------------------------------------------------------------------
+func expandAirplanes(airplaneList []*airplane.Airplane) ([]*airplane.Airplane, error) {
+	return airplane.Expand(airplaneList, airplane.ExpandFields)
+}
+
+//----------------------------------------------------------------------------------------
+// Expand returns copies of the models of modelList with the details of the references in
+// fieldList attached and those of the others left out. Rather than looking up the references
+// of every model one by one, the distinct codes of each kind are collected and fetched at
+// once, from the cache or with a batch read. The airlines and airplanes come with their own
+// details. BrokenRefs lists the expanded references that do not exist.
+func Expand(modelList []*Model, fieldList []string) ([]*Model, error) {
+	airlineMap, err := db.FetchRefMap(modelList, fieldList, "airline", func(modelInst *Model) string { return modelInst.Airline }, airline.GetMapByCodes)
+	if err == nil {
+		airlineMap, err = db.ExpandRefMap(airlineMap, expandAirlines)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	airplaneMap, err := db.FetchRefMap(modelList, fieldList, "airplane", func(modelInst *Model) string { return modelInst.Airplane }, airplane.AdapterInst.GetObjectMapByCodes)
 	if err == nil {
-		for index, objectInst := range objectList {
-			objectInst.InitRefObjs()
-			objectList[index] = objectInst
+		airplaneMap, err = db.ExpandRefMap(airplaneMap, expandAirplanes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	modelMakeMap, err := db.FetchRefMap(modelList, fieldList, "modelMake", func(modelInst *Model) string { return modelInst.ModelMake }, modelmake.AdapterInst.GetObjectMapByCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	expandedList := make([]*Model, 0, len(modelList))
+	for _, modelInst := range modelList {
+		var brokenRefList []db.Reference
+
+		modelCopy := *modelInst
+		modelCopy.AirlineInst = db.AttachRef(&brokenRefList, airlineMap, airline.TABLE_NAME, "airline", modelInst.Airline)
+		modelCopy.AirplaneInst = db.AttachRef(&brokenRefList, airplaneMap, airplane.TABLE_NAME, "airplane", modelInst.Airplane)
+		modelCopy.ModelMakeInst = db.AttachRef(&brokenRefList, modelMakeMap, modelmake.TABLE_NAME, "modelMake", modelInst.ModelMake)
+		modelCopy.BrokenRefs = brokenRefList
+
+		expandedList = append(expandedList, &modelCopy)
+	}
+
+	return expandedList, nil
+}
+
+//----------------------------------------------------------------------------------------
+// GetBrokenRefList returns the models of the collection of owner referencing objects that do
+// not exist, with BrokenRefs set.
+func GetBrokenRefList(owner string) ([]*Model, error) {
+	brokenList := []*Model{}
+
+	modelList, err := AdapterInst.GetObjectList()
+	if err != nil {
+		return nil, err
+	}
+
+	expandedList, err := Expand(filterByOwner(modelList, owner), ExpandFields)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, modelInst := range expandedList {
+		if len(modelInst.BrokenRefs) > 0 {
+			brokenList = append(brokenList, modelInst)
 		}
 	}
 
-	return objectList, err
+	return brokenList, nil
 }
 
 //----------------------------------------------------------------------------------------
-func GetByCode(code string) (*Model, error) {
-	objectInst, err := AdapterInst.GetObjectByCode(code)
-	if err == nil {
-		objectInst.InitRefObjs()
+// getOwned returns the stored model with ownerCode, provided that it belongs to the collection
+// of owner.
+func getOwned(owner string, ownerCode string) (*Model, error) {
+	objectInst, err := AdapterInst.GetObjectByCode(ownerCode)
+	if err == nil && objectInst != nil && objectInst.Owner != owner {
+		return ObjectFactory(), &db.NotFoundError{TableName: TABLE_NAME, Code: ownerCode}
 	}
 
 	return objectInst, err
 }
 
 //----------------------------------------------------------------------------------------
-func InitConn() {
-	dynoInstModel := &dyno.Dyno[*Model]{}
-	dynoInstModel.SetSortName("picture")
-	dynoInstModel.SetSortGSIName("picture-code-index")
-	dynoInstModel.Config("model", "code", true, ObjectFactory, nil)
-	AdapterInst = dynoInstModel
+func getByOwnerCode(owner string, ownerCode string) (*Model, error) {
+	objectInst, err := getOwned(owner, ownerCode)
+	if err != nil || objectInst == nil {
+		return objectInst, err
+	}
+
+	objectCopy := *objectInst
+	objectCopy.InitRefObjs()
+
+	return &objectCopy, nil
+}
+
+//----------------------------------------------------------------------------------------
+// GetByCode returns the model with code of the collection of owner.
+func GetByCode(owner string, code string) (*Model, error) {
+	return getByOwnerCode(owner, MakeOwnerCode(owner, code))
+}
+
+//----------------------------------------------------------------------------------------
+// registerReferrer declares that the field of models returned by fieldRef holds codes of
+// tableName. Referrers are listed by owner code, as the codes of different collections may
+// be the same, and only those of the collection of the caller are deleted or reassigned.
+// Cascading deletes update the search index too, as do the names of the referenced objects
+// when they are stored again. canonical, when set, gives the code of tableName a code held by
+// the field refers to, for the fields that may hold other codes of the same object.
+func registerReferrer(tableName string, field string, fieldRef func(*Model) *string, canonical func(string) string) {
+	db.RegisterReferrer(tableName, db.Referrer{
+		TableName: TABLE_NAME,
+		Field:     field,
+		FindCodes: func(code string) ([]string, error) {
+			return db.FindReferrerCodes(AdapterInst, func(modelInst *Model) bool {
+				refCode := *fieldRef(modelInst)
+				if canonical != nil && refCode != code {
+					refCode = canonical(refCode)
+				}
+
+				return refCode == code
+			})
+		},
+		Reassign: func(modelCode string, newCode string) error {
+			modelInst, err := AdapterInst.GetObjectByCode(modelCode)
+			if err != nil {
+				return err
+			}
 
-	fileInstModel := &s3.S3Adapter{}
-	fileInstModel.Config("colman-pics", 1000)
+			newModelInst := *modelInst
+			newModelInst.AirlineInst = nil
+			newModelInst.AirplaneInst = nil
+			newModelInst.ModelMakeInst = nil
+			*fieldRef(&newModelInst) = newCode
+
+			return newModelInst.Put()
+		},
+		Delete: deleteByOwnerCode,
+		OwnerOf: func(modelCode string) (string, error) {
+			modelInst, err := AdapterInst.GetObjectByCode(modelCode)
+			if err != nil {
+				return "", err
+			}
+
+			return modelInst.Owner, nil
+		},
+		Refresh: func(modelCode string) error {
+			modelInst, err := AdapterInst.GetObjectByCode(modelCode)
+			if err != nil {
+				return err
+			}
+
+			indexModel(modelInst)
+			return nil
+		},
+	})
+}
+
+//----------------------------------------------------------------------------------------
+func InitConn() error {
+	adapterInstModel := factory.NewAdapter[*Model]()
+	adapterInstModel.SetSortName("picture")
+	adapterInstModel.SetSortGSIName(PictureIndexName)
+	err := adapterInstModel.Config(STORE_NAME, "ownerCode", true, ObjectFactory, nil)
+	AdapterInst = adapterInstModel
+
+	registerReferrer(airline.TABLE_NAME, "airline", func(modelInst *Model) *string { return &modelInst.Airline }, canonicalAirline)
+	registerReferrer(airplane.TABLE_NAME, "airplane", func(modelInst *Model) *string { return &modelInst.Airplane }, nil)
+	registerReferrer(modelmake.TABLE_NAME, "modelMake", func(modelInst *Model) *string { return &modelInst.ModelMake }, nil)
+
+	fileInstModel := factory.NewFileAdapter()
+	fileInstModel.Config(PictureBucket, MaxPictureEntries)
 	FileInst = fileInstModel
+
+	return err
 }
 
 //----------------------------------------------------------------------------------------
-func AddModelPicture(file multipart.File, modelCodeList []string) ([]*Model, error) {
+// AddModelPicture stores file and tags with it the models of modelCodeList that exist in the
+// collection of owner.
+func AddModelPicture(owner string, file multipart.File, modelCodeList []string) ([]*Model, error) {
 	var addErr error
 	var modelList []*Model
 
@@ -99,12 +451,12 @@ func AddModelPicture(file multipart.File, modelCodeList []string) ([]*Model, err
 	uuidName := uuid.New().String()
 	filename := strings.Replace(nowTime, ":", "_", -1) + "-" + uuidName
 
-	validModelCodeList := chkModelCode(modelCodeList)
+	validModelCodeList := chkModelCode(owner, modelCodeList)
 	if len(validModelCodeList) > 0 {
 		response, err := FileInst.AddFile(filename, file)
 		if err == nil {
 			if len(response.FileLocation) != 0 {
-				modelList, addErr = tagModelPicture(filename, validModelCodeList)
+				modelList, addErr = tagModelPicture(owner, filename, validModelCodeList)
 			}
 		} else {
 			addErr = err
@@ -115,10 +467,28 @@ func AddModelPicture(file multipart.File, modelCodeList []string) ([]*Model, err
 }
 
 //----------------------------------------------------------------------------------------
-func TagModelPicture(filename string, modelCode string) (*Model, error) {
+// checkPicture makes sure that filename is a picture of the collection of owner, i.e. that
+// at least one of its models is tagged with it.
+func checkPicture(owner string, filename string) error {
+	objectList, err := GetModelByPicture(owner, filename)
+	if err == nil && len(objectList) == 0 {
+		err = &db.NotFoundError{TableName: PICTURE_NAME, Code: filename}
+	}
+
+	return err
+}
+
+//----------------------------------------------------------------------------------------
+// TagModelPicture tags the model with modelCode with a picture of the same collection.
+func TagModelPicture(owner string, filename string, modelCode string) (*Model, error) {
 	var modelCodeList []string = []string{modelCode}
 
-	modelList, tagErr := tagModelPicture(filename, modelCodeList)
+	err := checkPicture(owner, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	modelList, tagErr := tagModelPicture(owner, filename, modelCodeList)
 	if tagErr == nil && len(modelList) > 0 {
 		return modelList[0], nil
 	} else {
@@ -127,7 +497,7 @@ func TagModelPicture(filename string, modelCode string) (*Model, error) {
 }
 
 //----------------------------------------------------------------------------------------
-func GetModelByPicture(filename string) ([]*Model, error) {
+func getModelByPicture(filename string) ([]*Model, error) {
 	objectList, err := AdapterInst.GetObjectListBySort(filename)
 
 	if err != nil {
@@ -137,6 +507,17 @@ func GetModelByPicture(filename string) ([]*Model, error) {
 	return objectList, err
 }
 
+//----------------------------------------------------------------------------------------
+// GetModelByPicture returns the models of the collection of owner tagged with filename.
+func GetModelByPicture(owner string, filename string) ([]*Model, error) {
+	objectList, err := getModelByPicture(filename)
+	if err != nil {
+		return objectList, err
+	}
+
+	return filterByOwner(objectList, owner), nil
+}
+
 //----------------------------------------------------------------------------------------
 func deleteModelPicture(filename string, isDeletingFromDB bool) ([]*Model, error) {
 	var returnErr error
@@ -145,7 +526,7 @@ func deleteModelPicture(filename string, isDeletingFromDB bool) ([]*Model, error
 
 	storageErr := FileInst.DeleteFile(filename)
 	if storageErr == nil {
-		objectList, objectErr = GetModelByPicture(filename)
+		objectList, objectErr = getModelByPicture(filename)
 		if objectErr == nil {
 			if !isDeletingFromDB {
 				for _, objectInst := range objectList {
@@ -165,7 +546,14 @@ func deleteModelPicture(filename string, isDeletingFromDB bool) ([]*Model, error
 }
 
 //----------------------------------------------------------------------------------------
-func DeleteModelPicture(filename string) ([]*Model, error) {
+// DeleteModelPicture deletes a picture of the collection of owner and removes it from the
+// models tagged with it.
+func DeleteModelPicture(owner string, filename string) ([]*Model, error) {
+	err := checkPicture(owner, filename)
+	if err != nil {
+		return nil, err
+	}
+
 	return deleteModelPicture(filename, false)
 }
 
@@ -177,8 +565,13 @@ func removeModelPicture(objectInst *Model, filename string, isDeletingFromFileSt
 
 	objectInstSub = ObjectFactory()
 	objectInstSub.Code = objectInst.Code
+	objectInstSub.Owner = objectInst.Owner
 	objectInstSub.Picture = filename
-	objectInstSub.Delete()
+
+	retErr = objectInstSub.Delete()
+	if retErr != nil {
+		return objectInst, retErr
+	}
 
 	for _, pictureInst := range objectInst.PictureList {
 		if pictureInst != filename {
@@ -187,7 +580,7 @@ func removeModelPicture(objectInst *Model, filename string, isDeletingFromFileSt
 	}
 
 	if !isDeletingFromFileStorage {
-		otherModelsList, otherModelsErr := GetModelByPicture(filename)
+		otherModelsList, otherModelsErr := getModelByPicture(filename)
 		if otherModelsErr == nil {
 			if len(otherModelsList) == 0 {
 				_, retErr = deleteModelPicture(filename, true)
@@ -203,12 +596,16 @@ func removeModelPicture(objectInst *Model, filename string, isDeletingFromFileSt
 }
 
 //----------------------------------------------------------------------------------------
-func RemoveModelPicture(filename string, modelCode string) (*Model, error) {
-	objectInst, objectErr := GetByCode(modelCode)
-
-	log.Printf("Trying to delete for code %s, model code %s, file %s, models pic list %v", modelCode, objectInst.Code, filename, objectInst.PictureList)
+// RemoveModelPicture removes filename from the model with modelCode of the collection of
+// owner.
+func RemoveModelPicture(owner string, filename string, modelCode string) (*Model, error) {
+	objectInst, objectErr := GetByCode(owner, modelCode)
+	if objectErr == nil {
+		objectErr = objectInst.LoadPictures()
+	}
 
 	if objectErr == nil {
+		log.Printf("Trying to delete for code %s, owner %s, file %s, models pic list %v", modelCode, owner, filename, objectInst.PictureList)
 		objectInst, objectErr = removeModelPicture(objectInst, filename, false)
 	}
 
@@ -3,14 +3,19 @@ package modelmake
 import (
 	"colmanback/api_util"
 	"colmanback/db"
-	"colmanback/db/dyno"
+	"colmanback/db/factory"
 	"fmt"
 	"net/http"
 )
 
+const (
+	TABLE_NAME = "modelmake"
+)
+
 type ModelMake struct {
-	Code string `json:"code"`
-	Name string `json:"name"`
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Version int64  `json:"version"`
 }
 
 var AdapterInst db.Adapter[*ModelMake]
@@ -26,8 +31,18 @@ func (modelMakeInst *ModelMake) SortValue() string {
 }
 
 //----------------------------------------------------------------------------------------
-func (modelMakeInst *ModelMake) FromJson(jsonInst []byte) {
-	db.FromJson(modelMakeInst, jsonInst)
+func (modelMakeInst *ModelMake) VersionValue() int64 {
+	return modelMakeInst.Version
+}
+
+//----------------------------------------------------------------------------------------
+func (modelMakeInst *ModelMake) SetVersion(version int64) {
+	modelMakeInst.Version = version
+}
+
+//----------------------------------------------------------------------------------------
+func (modelMakeInst *ModelMake) FromJson(jsonInst []byte) error {
+	return db.FromJson(modelMakeInst, jsonInst)
 }
 
 //----------------------------------------------------------------------------------------
@@ -72,13 +87,31 @@ func GetCacheMap(modelMakeList []*ModelMake) []db.CacheMapElement {
 }
 
 //----------------------------------------------------------------------------------------
-func (modelMakeInst *ModelMake) Delete() {
-	AdapterInst.DeleteObject(modelMakeInst)
+func (modelMakeInst *ModelMake) Delete() error {
+	return AdapterInst.DeleteObject(modelMakeInst)
 }
 
 //----------------------------------------------------------------------------------------
-func (modelMakeInst *ModelMake) Put() {
-	AdapterInst.PutObject(modelMakeInst)
+// Put stores the model make, then refreshes the objects referencing it, as they may show its
+// name.
+func (modelMakeInst *ModelMake) Put() error {
+	err := AdapterInst.PutObject(modelMakeInst)
+	if err != nil {
+		return err
+	}
+
+	db.RefreshReferrers(TABLE_NAME, modelMakeInst.Code)
+	return nil
+}
+
+//----------------------------------------------------------------------------------------
+func (modelMakeInst *ModelMake) Validate() error {
+	var validationInst db.Validation
+
+	validationInst.Require("code", modelMakeInst.Code)
+	validationInst.Require("name", modelMakeInst.Name)
+
+	return validationInst.Result()
 }
 
 //----------------------------------------------------------------------------------------
@@ -92,7 +125,7 @@ func GetByCode(code string) (*ModelMake, error) {
 }
 
 //----------------------------------------------------------------------------------------
-func LoadModelMakeList(ModelMakeList []ModelMake) {
+func LoadModelMakeList(ModelMakeList []ModelMake) error {
 	var modelMakePointerList []*ModelMake = []*ModelMake{}
 
 	for _, modelMakeInst := range ModelMakeList {
@@ -100,12 +133,14 @@ func LoadModelMakeList(ModelMakeList []ModelMake) {
 		modelMakePointerList = append(modelMakePointerList, &newModelMakeInst)
 	}
 
-	AdapterInst.PutObjectList(modelMakePointerList)
+	return AdapterInst.PutObjectList(modelMakePointerList)
 }
 
 //----------------------------------------------------------------------------------------
-func InitConn() {
-	dynoInstAirline := &dyno.Dyno[*ModelMake]{}
-	dynoInstAirline.Config("modelmake", "code", true, ObjectFactory, GetCacheMap)
-	AdapterInst = dynoInstAirline
+func InitConn() error {
+	adapterInstModelMake := factory.NewAdapter[*ModelMake]()
+	err := adapterInstModelMake.Config(TABLE_NAME, "code", true, ObjectFactory, GetCacheMap)
+	AdapterInst = adapterInstModelMake
+
+	return err
 }
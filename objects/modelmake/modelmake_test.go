@@ -1,13 +1,9 @@
 package modelmake
 
 import (
-	"colmanback/db/dyno"
 	"colmanback/test_util"
 	"fmt"
 	"testing"
-
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 const (
@@ -21,18 +17,14 @@ func chkObject(t *testing.T, objectInst *ModelMake) {
 	test_util.CheckField(t, "name", nameConst, objectInst.Name)
 }
 
-func initDyno() {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	dyno.Conn = dynamodb.New(sess)
+func initDB() {
+	test_util.InitDB()
 
 	InitConn()
 }
 
 func testSetup(t *testing.T) {
-	initDyno()
+	initDB()
 
 	objectInst, _ := GetByCode(codeConst)
 
@@ -2,15 +2,63 @@ package test_util
 
 import (
 	"bytes"
+	"colmanback/api_util"
+	"colmanback/db/disk"
+	"colmanback/db/dyno"
+	"colmanback/db/factory"
+	"colmanback/db/sqlite"
 	"colmanback/objects"
 	"encoding/json"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gorilla/mux"
 )
 
+const (
+	TestDBEnv = "COLMAN_TEST_DB"
+)
+
+// InitDB selects the adapter used by the tests. The in-memory adapter is used unless
+// COLMAN_TEST_DB is set to "dynamodb", in which case the shared AWS config is loaded, or
+// to "sqlite", which runs against a fresh in-memory sqlite database and a temporary
+// picture directory.
+func InitDB() {
+	factory.Type = factory.AdapterType(os.Getenv(TestDBEnv))
+	if factory.Type == "" {
+		factory.Type = factory.MEMORY
+	}
+
+	if factory.Type == factory.DYNO {
+		sess := session.Must(session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		}))
+
+		dyno.Conn = dynamodb.New(sess)
+	} else if factory.Type == factory.SQLITE {
+		err := sqlite.Open(":memory:")
+		if err != nil {
+			log.Fatalf("Cannot open the sqlite test database. Error: %v", err)
+		}
+
+		disk.RootDir, err = os.MkdirTemp("", "colman-test-")
+		if err != nil {
+			log.Fatalf("Cannot create the picture directory for the tests. Error: %v", err)
+		}
+	}
+}
+
+// IsMemoryDB reports whether the tests run against an empty database that must be
+// seeded with the reference data they rely on.
+func IsMemoryDB() bool {
+	return factory.Type == factory.MEMORY || factory.Type == factory.SQLITE
+}
+
 func CheckExists(t *testing.T, router *mux.Router, getURL string, expectExists bool) {
 	req, err := http.NewRequest(http.MethodGet, getURL, nil)
 
@@ -49,6 +97,103 @@ func CheckPut(t *testing.T, router *mux.Router, jsonString string, putURL string
 	}
 }
 
+// CheckPutConflict expects the put to be rejected as a conflict, with the copy held by the
+// server at serverVersion as the current member of the problem.
+func CheckPutConflict(t *testing.T, router *mux.Router, jsonString string, putURL string, serverVersion int64) {
+	var problem struct {
+		ErrorCode string `json:"errorCode"`
+		Current   struct {
+			Version int64 `json:"version"`
+		} `json:"current"`
+	}
+
+	req, err := http.NewRequest(http.MethodPut, putURL, bytes.NewBuffer([]byte(jsonString)))
+
+	if err != nil {
+		t.Errorf("An error has been reported when preparing the put request for %s. Error: %v\n", jsonString, err)
+	} else {
+		resp := ExecuteRequest(router, req)
+		if resp.Code != http.StatusConflict {
+			t.Errorf("Status code not as expected after conflicting put. Code %d", resp.Code)
+		} else if unmarshallErr := json.Unmarshal(resp.Body.Bytes(), &problem); unmarshallErr != nil {
+			t.Errorf("The problem returned with the conflict cannot be unmarshalled. Error: %v", unmarshallErr)
+		} else if problem.ErrorCode != api_util.ErrorCodeConflict || problem.Current.Version != serverVersion {
+			t.Errorf("The server copy returned with the conflict has version %d instead of %d: %s", problem.Current.Version, serverVersion, resp.Body.String())
+		}
+	}
+}
+
+func CheckPutInvalid(t *testing.T, router *mux.Router, jsonString string, putURL string) {
+	req, err := http.NewRequest(http.MethodPut, putURL, bytes.NewBuffer([]byte(jsonString)))
+
+	if err != nil {
+		t.Errorf("An error has been reported when preparing the put request for %s. Error: %v\n", jsonString, err)
+	} else {
+		resp := ExecuteRequest(router, req)
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("Status code not as expected after invalid put of %s. Code %d", jsonString, resp.Code)
+		}
+	}
+}
+
+// CheckPutFieldErrors expects the put to be rejected as unprocessable, with an error for
+// each of the fields in fieldList.
+func CheckPutFieldErrors(t *testing.T, router *mux.Router, jsonString string, putURL string, fieldList ...string) {
+	var response struct {
+		FieldErrors []struct {
+			Field string `json:"field"`
+		} `json:"fieldErrors"`
+	}
+
+	req, err := http.NewRequest(http.MethodPut, putURL, bytes.NewBuffer([]byte(jsonString)))
+
+	if err != nil {
+		t.Errorf("An error has been reported when preparing the put request for %s. Error: %v\n", jsonString, err)
+		return
+	}
+
+	resp := ExecuteRequest(router, req)
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Status code not as expected after put of invalid %s. Code %d", jsonString, resp.Code)
+		return
+	}
+
+	if unmarshallErr := json.Unmarshal(resp.Body.Bytes(), &response); unmarshallErr != nil {
+		t.Errorf("The field errors returned for %s cannot be unmarshalled. Error: %v", jsonString, unmarshallErr)
+		return
+	}
+
+	for _, field := range fieldList {
+		isFound := false
+		for _, fieldErr := range response.FieldErrors {
+			isFound = isFound || fieldErr.Field == field
+		}
+
+		if !isFound {
+			t.Errorf("No error reported for field %s after put of invalid %s: %s", field, jsonString, resp.Body.String())
+		}
+	}
+
+	if len(response.FieldErrors) != len(fieldList) {
+		t.Errorf("Expected errors for fields %v after put of invalid %s but got %s", fieldList, jsonString, resp.Body.String())
+	}
+}
+
+func CheckPatch(t *testing.T, router *mux.Router, patchURL string, contentType string, jsonString string, expectedCode int) {
+	req, err := http.NewRequest(http.MethodPatch, patchURL, bytes.NewBuffer([]byte(jsonString)))
+
+	if err != nil {
+		t.Errorf("An error has been reported when preparing the patch request for %s. Error: %v\n", jsonString, err)
+	} else {
+		req.Header.Set("Content-Type", contentType)
+
+		resp := ExecuteRequest(router, req)
+		if resp.Code != expectedCode {
+			t.Errorf("Status code not as expected after patch %s. Expected %d but got %d", jsonString, expectedCode, resp.Code)
+		}
+	}
+}
+
 func CheckList[K objects.Object](t *testing.T, router *mux.Router, listURL string, objectInstList *[]K) {
 	req, err := http.NewRequest(http.MethodGet, listURL, nil)
 	if err != nil {
@@ -105,6 +250,57 @@ func CheckDelete(t *testing.T, router *mux.Router, deleteURL string, expectOK bo
 	}
 }
 
+func CheckDeleteStatus(t *testing.T, router *mux.Router, deleteURL string, expectedCode int) {
+	req, err := http.NewRequest(http.MethodDelete, deleteURL, nil)
+
+	if err != nil {
+		t.Errorf("An error has been reported when preparing delete request: %v\n", err)
+	} else {
+		resp := ExecuteRequest(router, req)
+		if resp.Code != expectedCode {
+			t.Errorf("Status code not as expected after delete of %s. Expected %d but got %d: %s", deleteURL, expectedCode, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+// CheckDeleteReferenced expects the delete to be refused because of the objects with the
+// codes in referrerCodeList.
+func CheckDeleteReferenced(t *testing.T, router *mux.Router, deleteURL string, referrerCodeList ...string) {
+	var response struct {
+		References []struct {
+			Code string `json:"code"`
+		} `json:"references"`
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, deleteURL, nil)
+	if err != nil {
+		t.Errorf("An error has been reported when preparing delete request: %v\n", err)
+		return
+	}
+
+	resp := ExecuteRequest(router, req)
+	if resp.Code != http.StatusConflict {
+		t.Errorf("Status code not as expected after delete of referenced %s. Code %d", deleteURL, resp.Code)
+		return
+	}
+
+	if unmarshallErr := json.Unmarshal(resp.Body.Bytes(), &response); unmarshallErr != nil {
+		t.Errorf("The references returned for %s cannot be unmarshalled. Error: %v", deleteURL, unmarshallErr)
+		return
+	}
+
+	if len(response.References) != len(referrerCodeList) {
+		t.Errorf("Expected references %v after delete of %s but got %s", referrerCodeList, deleteURL, resp.Body.String())
+		return
+	}
+
+	for index, reference := range response.References {
+		if reference.Code != referrerCodeList[index] {
+			t.Errorf("Expected references %v after delete of %s but got %s", referrerCodeList, deleteURL, resp.Body.String())
+		}
+	}
+}
+
 func ExecuteRequest(router *mux.Router, req *http.Request) *httptest.ResponseRecorder {
 	recorder := httptest.NewRecorder()
 	router.ServeHTTP(recorder, req)